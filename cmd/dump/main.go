@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/options"
+	"bitcaskDB/internal/util"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+var (
+	// defaultDBPath is the db 0 of the server, which is the namespace 0 of the root db.
+	defaultDBPath = bitcask.NamespacePath("/tmp/bitcaskDB", "0")
+	defaultFormat = "json"
+)
+
+type DumpOptions struct {
+	path   string
+	op     string
+	file   string
+	format string
+}
+
+// Usage:
+//
+//	dump -op export -path /tmp/bitcaskDB/ns/0 -format binary -file backup.dump
+//	dump -op import -path /tmp/bitcaskDB/ns/1 -file backup.dump
+func main() {
+	dumpOpts := new(DumpOptions)
+	flag.StringVar(&dumpOpts.path, "path", defaultDBPath, "db directory")
+	flag.StringVar(&dumpOpts.op, "op", "export", "export or import")
+	flag.StringVar(&dumpOpts.file, "file", "-", "dump file, - means stdout for export and stdin for import")
+	flag.StringVar(&dumpOpts.format, "format", defaultFormat, "export format, json or binary")
+	flag.Parse()
+
+	// Open creates the db if it does not exist, an export of it would be empty.
+	if dumpOpts.op == "export" && !util.PathExist(dumpOpts.path) {
+		log.Fatalf("db %s does not exist", dumpOpts.path)
+	}
+	db, err := bitcask.Open(options.DefaultOptions(dumpOpts.path))
+	if err != nil {
+		log.Fatalf("open db err: %v", err)
+	}
+	defer db.Close()
+
+	switch dumpOpts.op {
+	case "export":
+		err = export(db, dumpOpts)
+	case "import":
+		err = load(db, dumpOpts)
+	default:
+		err = fmt.Errorf("unknown op %q", dumpOpts.op)
+	}
+	if err != nil {
+		_ = db.Close()
+		log.Fatalf("%s err: %v", dumpOpts.op, err)
+	}
+}
+
+func export(db *bitcask.BitcaskDB, dumpOpts *DumpOptions) error {
+	var format bitcask.ExportFormat
+	switch dumpOpts.format {
+	case "json":
+		format = bitcask.ExportJSONLines
+	case "binary":
+		format = bitcask.ExportBinary
+	default:
+		return bitcask.ErrUnknownExportFormat
+	}
+
+	var w io.Writer = os.Stdout
+	if dumpOpts.file != "-" {
+		f, err := os.Create(dumpOpts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return db.Export(w, format)
+}
+
+func load(db *bitcask.BitcaskDB, dumpOpts *DumpOptions) error {
+	var r io.Reader = os.Stdin
+	if dumpOpts.file != "-" {
+		f, err := os.Open(dumpOpts.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	count, err := db.Import(r)
+	log.Printf("%d records imported", count)
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/logfile"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+var defaultDBDir = "/tmp/bitcaskDB"
+
+// migrate upgrades the log files of a db and its namespaces to the current format.
+// The db must be closed while it is running.
+//
+// Usage:
+//
+//	migrate -dir /tmp/bitcaskDB
+func main() {
+	var dir string
+	flag.StringVar(&dir, "dir", defaultDBDir, "db directory")
+	flag.Parse()
+
+	if err := migrate(dir); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// migrate upgrades the log files of the db in dir and its namespaces.
+func migrate(dir string) error {
+	namespaces, err := filepath.Glob(bitcask.NamespacePath(dir, "*"))
+	if err != nil {
+		return fmt.Errorf("list namespaces err: %w", err)
+	}
+	paths := []string{dir}
+	for _, path := range namespaces {
+		// dropped namespaces are removed when db is opened.
+		if !strings.HasPrefix(filepath.Base(path), ".") {
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range paths {
+		count, err := logfile.MigrateDir(path)
+		if err != nil {
+			return fmt.Errorf("migrate %s err: %w", path, err)
+		}
+		log.Printf("%s: %d log files migrated", path, count)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/options"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLegacyDB writes the strings to a log file in the format of the old versions, which has no segment header,
+// checks the entries by IEEE, and keeps the expiration time in seconds.
+func writeLegacyDB(t *testing.T, path string, entries []*logfile.LogEntry) {
+	assert.Nil(t, os.MkdirAll(path, os.ModePerm))
+	data := make([]byte, 0, 4096)
+	for _, e := range entries {
+		buf, _ := logfile.EncodeEntryWith(e, logfile.SegmentHeader{Version: 1, Checksum: logfile.ChecksumIEEE})
+		data = append(data, buf...)
+	}
+	name := filepath.Join(path, logfile.FileNamesMap[logfile.Strs]+"000000000")
+	assert.Nil(t, ioutil.WriteFile(name, data[:cap(data)], 0644))
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	expiredAt := time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond)
+	writeLegacyDB(t, dir, []*logfile.LogEntry{
+		{Key: []byte("k"), Value: []byte("v")},
+		{Key: []byte("ttl"), Value: []byte("v"), ExpiredAt: expiredAt},
+	})
+	writeLegacyDB(t, bitcask.NamespacePath(dir, "0"), []*logfile.LogEntry{{Key: []byte("k"), Value: []byte("ns")}})
+	dropped := bitcask.NamespacePath(dir, ".dropped-1-0")
+	writeLegacyDB(t, dropped, []*logfile.LogEntry{{Key: []byte("k"), Value: []byte("dropped")}})
+
+	assert.Nil(t, migrate(dir))
+	// dropped namespaces are left as they are.
+	content, err := ioutil.ReadFile(filepath.Join(dropped, logfile.FileNamesMap[logfile.Strs]+"000000000"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, logfile.SegmentMagic, string(content[:4]))
+
+	// the values are read from the log files, so their checksums are verified.
+	opts := options.DefaultOptions(dir)
+	opts.IndexMode = options.KeyOnlyMemMode
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	val, err := db.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(val))
+	val, err = db.Get([]byte("ttl"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(val))
+	// the expiration time is rounded up to seconds in the old format.
+	ttl, err := db.TTL([]byte("ttl"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 3590 && ttl <= 3601, "ttl: %d", ttl)
+
+	ns, err := db.Namespace("0")
+	assert.Nil(t, err)
+	val, err = ns.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ns", string(val))
+}
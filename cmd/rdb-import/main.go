@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/options"
+	"bitcaskDB/internal/rdb"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+var defaultDBDir = "/tmp/bitcaskDB"
+
+type ImportOptions struct {
+	file string
+	dir  string
+	db   int
+}
+
+// Usage:
+//
+//	rdb-import -file dump.rdb -dir /tmp/bitcaskDB
+//	rdb-import -file dump.rdb -dir /tmp/bitcaskDB -db 0
+func main() {
+	importOpts := new(ImportOptions)
+	flag.StringVar(&importOpts.file, "file", "dump.rdb", "redis rdb file")
+	flag.StringVar(&importOpts.dir, "dir", defaultDBDir, "directory of the bitcask dbs")
+	flag.IntVar(&importOpts.db, "db", -1, "only import the specified redis db, -1 means all dbs")
+	flag.Parse()
+
+	f, err := os.Open(importOpts.file)
+	if err != nil {
+		log.Fatalf("open rdb file err: %v", err)
+	}
+	defer f.Close()
+
+	// redis db n is loaded into namespace n, which is the db n of the server.
+	root, err := bitcask.Open(options.DefaultOptions(importOpts.dir))
+	if err != nil {
+		log.Fatalf("open db err: %v", err)
+	}
+	defer root.Close()
+
+	counts, err := load(f, importOpts, root)
+	for idx, count := range counts {
+		log.Printf("db %d: %d keys imported", idx, count)
+	}
+	if err != nil {
+		_ = root.Close()
+		log.Fatalf("import err: %v", err)
+	}
+}
+
+func load(r io.Reader, importOpts *ImportOptions, root *bitcask.BitcaskDB) (map[int]int, error) {
+	counts := make(map[int]int)
+	parser, err := rdb.NewParser(r)
+	if err != nil {
+		return counts, err
+	}
+
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			return counts, nil
+		}
+		var unsupported *rdb.ErrUnsupportedType
+		if errors.As(err, &unsupported) {
+			log.Printf("skip key: %v", err)
+			continue
+		}
+		if err != nil {
+			return counts, err
+		}
+		if importOpts.db >= 0 && entry.DB != importOpts.db {
+			continue
+		}
+
+		db, err := root.Namespace(strconv.Itoa(entry.DB))
+		if err != nil {
+			return counts, err
+		}
+
+		loaded, err := db.LoadRDBEntry(entry)
+		if err != nil {
+			return counts, err
+		}
+		if loaded {
+			counts[entry.DB]++
+		}
+	}
+}
@@ -46,7 +46,11 @@ func main() {
 		return
 	}
 
-	stuLens := db.LLen([]byte("students"))
+	stuLens, err := db.LLen([]byte("students"))
+	if err != nil {
+		fmt.Printf("get data err: %v", err)
+		return
+	}
 	fmt.Println(stuLens)
 
 	// out: Ming
@@ -20,8 +20,8 @@ func main() {
 	key := []byte("Key - Test")
 	key1 := []byte("KKKKKKKey - Test")
 
-	sLen1 := db.StrLen(key1)
-	sLen := db.StrLen(key)
+	sLen1, _ := db.StrLen(key1)
+	sLen, _ := db.StrLen(key)
 	fmt.Println("sLen1:", sLen1)
 	fmt.Println("sLen:", sLen)
 
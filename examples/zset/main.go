@@ -25,7 +25,11 @@ func main() {
 		}
 	}
 
-	ok, score := db.ZScore([]byte("zset-key"), []byte("member-1"))
+	ok, score, err := db.ZScore([]byte("zset-key"), []byte("member-1"))
+	if err != nil {
+		fmt.Printf("get data err: %v", err)
+		return
+	}
 	if ok {
 		fmt.Println("score is ", score)
 	}
@@ -36,7 +40,11 @@ func main() {
 		return
 	}
 
-	card := db.ZCard([]byte("zset-key"))
+	card, err := db.ZCard([]byte("zset-key"))
+	if err != nil {
+		fmt.Printf("get data err: %v", err)
+		return
+	}
 	fmt.Println("card of zset-key : ", card)
 
 	members, err := db.ZRange([]byte("zset-key"), 0, -1)
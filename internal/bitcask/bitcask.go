@@ -7,6 +7,7 @@ import (
 	"bitcaskDB/internal/logfile"
 	"bitcaskDB/internal/options"
 	"bitcaskDB/internal/util"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -38,9 +39,24 @@ type (
 		hashIndex       *hashIndex // Hash indexes.
 		setIndex        *setIndex  // Set indexes.
 		zsetIndex       *zsetIndex // Sorted set indexes.
+		keyspace        *keyspace  // Types of all keys.
 		opts            options.Options
 		mu              *sync.RWMutex
-		gcState         int32
+		unlinkWg        *sync.WaitGroup // Waits for the background unlink.
+		// Keys detached by Unlink whose tombstones are not all written, guarded by the index lock of their types.
+		unlinking  map[DataType]map[*detachedKey]struct{}
+		flushWg    *sync.WaitGroup // Waits for the removal of the log files flushed by Flush.
+		gcMu       *rwMutex        // Held by gc in read mode and by flush in write mode.
+		gcState    int32
+		nsMu       *sync.Mutex
+		namespaces map[string]*BitcaskDB // Opened namespaces.
+		evictor    *evictor              // Memory usage and eviction.
+		ctx        context.Context       // Canceled when db is closed, to stop the background goroutines and gc.
+		cancel     context.CancelFunc
+		bgWg       *sync.WaitGroup // Waits for the background goroutines stopped by ctx.
+
+		// Keys deleted by key tombstones while the indexes are loaded, their members are unlinked after the load.
+		loadedUnlinks map[DataType]map[string]*detachedKey
 	}
 	valuePos struct {
 		fid       uint32
@@ -48,35 +64,37 @@ type (
 		entrySize int
 	}
 	strIndex struct {
-		mu      *sync.RWMutex
+		mu      *rwMutex
 		idxTree *art.AdaptiveRadixTree
 	}
 	listIndex struct {
-		mu    *sync.RWMutex
-		trees map[string]*art.AdaptiveRadixTree
+		mu      *rwMutex
+		trees   map[string]*art.AdaptiveRadixTree
+		blocked *blockedQueues // Clients blocked by BLPop, BRPop and BLMove.
 	}
 	hashIndex struct {
-		mu    *sync.RWMutex
-		trees map[string]*art.AdaptiveRadixTree
+		mu       *rwMutex
+		trees    map[string]*art.AdaptiveRadixTree
+		volatile map[string]int // Keys of the hashes which may have fields with ttl, and the number of their ttls in expires.
+		expires  *fieldExpires  // TTLs of the hash fields in the order of expiration.
 	}
 	setIndex struct {
-		mu      *sync.RWMutex
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
+		mu    *rwMutex
+		trees map[string]*art.AdaptiveRadixTree // Members are keyed by memberKey.
 	}
 
 	zsetIndex struct {
-		mu      *sync.RWMutex
-		indexes *zset.SortedSet
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
+		mu      *rwMutex
+		indexes *zset.SortedSet                   // Members are keyed by memberKey, the same as in trees.
+		trees   map[string]*art.AdaptiveRadixTree // Members are keyed by memberKey.
+		blocked *blockedQueues                    // Clients blocked by BZPopMin and BZPopMax.
 	}
 	indexNode struct {
 		value     []byte
 		fid       uint32
 		offset    int64
 		entrySize int
-		expiredAt int64
+		expiredAt int64 // unix milliseconds
 	}
 )
 
@@ -101,15 +119,41 @@ var (
 
 	// ErrWrongValueType value is not a number
 	ErrWrongValueType = errors.New("value is not an integer")
+
+	// ErrWrongFloatType value is not a float number
+	ErrWrongFloatType = errors.New("value is not a valid float")
+
+	// ErrFloatOverflow float increment results in NaN or Infinity
+	ErrFloatOverflow = errors.New("increment would produce NaN or Infinity")
+
+	// ErrInvalidDataType data type is not one of the log file types
+	ErrInvalidDataType = errors.New("invalid data type")
+
+	// ErrInvalidRank rank of LPos is zero
+	ErrInvalidRank = errors.New("RANK can't be zero")
+
+	// ErrScoreIsNaN score of sorted set is not a number
+	ErrScoreIsNaN = errors.New("resulting score is not a number (NaN)")
+
+	// ErrDBClosed db is closed while waiting
+	ErrDBClosed = errors.New("db is closed")
+
+	// ErrStringTooLong string would exceed the maximum size
+	ErrStringTooLong = errors.New("string exceeds maximum allowed size (512MB)")
+
+	// ErrLCSTooLarge the memory needed to compute LCS exceeds the maximum size of string
+	ErrLCSTooLarge = errors.New("insufficient memory, transient memory for LCS exceeds the maximum size of string")
 )
 
 // DataType Define the data structure type.
 type DataType = int8
 
 const (
-	LogFileTypeNum   = 5
-	discardFilePath  = "DISCARD"
-	initialListSeq   = math.MaxUint32 / 2
+	LogFileTypeNum  = 5
+	discardFilePath = "DISCARD"
+	initialListSeq  = math.MaxUint32 / 2
+	// maxListHoles is the number of holes allowed in a list beyond its length before it is relocated.
+	maxListHoles     = 64
 	encodeHeaderSize = 10
 )
 
@@ -117,6 +161,9 @@ const (
 func Open(opts options.Options) (*BitcaskDB, error) {
 	// create the dir if the path does not exist
 	log.Info("path:", opts.DBPath)
+	if opts.Checksum != 0 && !opts.Checksum.Valid() {
+		return nil, logfile.ErrUnsupportedChecksum
+	}
 
 	if opts.RemakeDir && util.PathExist(opts.DBPath) {
 		os.RemoveAll(opts.DBPath)
@@ -138,9 +185,29 @@ func Open(opts options.Options) (*BitcaskDB, error) {
 		hashIndex:       newHashIndex(),
 		setIndex:        newSetIndex(),
 		zsetIndex:       newZSetIndex(),
+		keyspace:        newKeyspace(),
 		mu:              new(sync.RWMutex),
+		unlinkWg:        new(sync.WaitGroup),
+		unlinking:       make(map[DataType]map[*detachedKey]struct{}),
+		loadedUnlinks:   make(map[DataType]map[string]*detachedKey),
+		flushWg:         new(sync.WaitGroup),
+		gcMu:            newRWMutex(),
+		nsMu:            new(sync.Mutex),
+		namespaces:      make(map[string]*BitcaskDB),
+		evictor:         newEvictor(),
+		bgWg:            new(sync.WaitGroup),
+	}
+	for dataType := String; dataType < LogFileTypeNum; dataType++ {
+		db.unlinking[dataType] = make(map[*detachedKey]struct{})
+		db.loadedUnlinks[dataType] = make(map[string]*detachedKey)
+	}
+	db.ctx, db.cancel = context.WithCancel(context.Background())
+	db.removeDroppedNamespaces()
+
+	if err := db.finishFlush(); err != nil {
+		log.Errorf("finish flush err : %v", err)
+		return nil, err
 	}
-
 	if err := db.loadLogFile(); err != nil {
 		log.Errorf("load log file err : %v", err)
 		return nil, err
@@ -149,40 +216,66 @@ func Open(opts options.Options) (*BitcaskDB, error) {
 	if err := db.LoadIndexFromLogFiles(); err != nil {
 		return nil, err
 	}
+	db.buildKeyspace()
+	db.evictor.usedMemory = db.indexMemory()
 
 	if err := db.initDiscard(); err != nil {
 		return nil, err
 	}
+	db.resumeUnlinks()
 
-	go db.handleLogFileGC()
+	if opts.LogFileGCInterval > 0 {
+		db.bgWg.Add(1)
+		go db.handleLogFileGC()
+	}
+	if opts.DiscardRebuildInterval > 0 {
+		db.bgWg.Add(1)
+		go db.handleDiscardRebuild()
+	}
+	if opts.HashFieldExpireInterval > 0 {
+		db.bgWg.Add(1)
+		go db.handleHashFieldExpire()
+	}
+	if opts.MaxMemory > 0 && opts.EvictionPolicy != options.NoEviction {
+		db.evictor.wg.Add(1)
+		go db.handleEviction()
+	}
 
 	return db, nil
 }
 
 func newStrsIndex() *strIndex {
-	return &strIndex{idxTree: art.NewART(), mu: new(sync.RWMutex)}
+	return &strIndex{idxTree: art.NewART(), mu: newRWMutex()}
 }
 func newListIndex() *listIndex {
-	return &listIndex{trees: make(map[string]*art.AdaptiveRadixTree), mu: new(sync.RWMutex)}
+	return &listIndex{
+		trees:   make(map[string]*art.AdaptiveRadixTree),
+		blocked: newBlockedQueues(),
+		mu:      newRWMutex(),
+	}
 }
 func newHashIndex() *hashIndex {
-	return &hashIndex{trees: make(map[string]*art.AdaptiveRadixTree), mu: new(sync.RWMutex)}
+	return &hashIndex{
+		trees:    make(map[string]*art.AdaptiveRadixTree),
+		volatile: make(map[string]int),
+		expires:  newFieldExpires(),
+		mu:       newRWMutex(),
+	}
 }
 
 func newSetIndex() *setIndex {
 	return &setIndex{
-		murhash: util.NewMurmur128(),
-		trees:   make(map[string]*art.AdaptiveRadixTree),
-		mu:      new(sync.RWMutex),
+		trees: make(map[string]*art.AdaptiveRadixTree),
+		mu:    newRWMutex(),
 	}
 }
 
 func newZSetIndex() *zsetIndex {
 	return &zsetIndex{
-		murhash: util.NewMurmur128(),
 		trees:   make(map[string]*art.AdaptiveRadixTree),
-		mu:      new(sync.RWMutex),
+		mu:      newRWMutex(),
 		indexes: zset.New(),
+		blocked: newBlockedQueues(),
 	}
 }
 
@@ -240,8 +333,10 @@ func (db *BitcaskDB) loadLogFile() error {
 
 		fType := logfile.FileType(dataType)
 		for i, fid := range fids {
-			lf, err := logfile.GetLogFile(db.opts.DBPath, fType, fid, db.opts.LogFileSizeThreshold)
+			lf, err := logfile.GetLogFile(db.opts.DBPath, fType, fid, db.opts.LogFileSizeThreshold, db.opts.IoType, db.opts.Checksum)
 			if err != nil {
+				// the segment header is validated when the file is opened.
+				log.Errorf("open log file err, dataType: [%v], fid: [%v], err: [%v]", dataType, fid, err)
 				return err
 			}
 			// latest one is active log file.
@@ -265,7 +360,7 @@ func (db *BitcaskDB) writeLogEntry(ent *logfile.LogEntry, dataType DataType) (*v
 	if activeLogFile == nil {
 		return nil, ErrLogFileNotFound
 	}
-	entryBuf, eSize := logfile.EncodeEntry(ent)
+	entryBuf, eSize := logfile.EncodeEntryWith(ent, activeLogFile.Header)
 	opts := db.opts
 	if int64(eSize)+activeLogFile.WriteAt > db.opts.LogFileSizeThreshold {
 		if err := activeLogFile.Sync(); err != nil {
@@ -280,7 +375,7 @@ func (db *BitcaskDB) writeLogEntry(ent *logfile.LogEntry, dataType DataType) (*v
 		db.archivedLogFile[dataType][activeFileId] = activeLogFile
 
 		// open a new log file.
-		lf, err := logfile.GetLogFile(opts.DBPath, logfile.FileType(dataType), activeFileId+1, db.opts.LogFileSizeThreshold)
+		lf, err := logfile.GetLogFile(opts.DBPath, logfile.FileType(dataType), activeFileId+1, db.opts.LogFileSizeThreshold, opts.IoType, opts.Checksum)
 		if err != nil {
 			db.mu.Unlock()
 			return nil, err
@@ -289,6 +384,8 @@ func (db *BitcaskDB) writeLogEntry(ent *logfile.LogEntry, dataType DataType) (*v
 		db.discards[dataType].setTotal(lf.Fid, uint32(opts.LogFileSizeThreshold))
 		activeLogFile = lf
 		db.mu.Unlock()
+		// the new log file may use another format, the expiration time may be encoded in another unit.
+		entryBuf, eSize = logfile.EncodeEntryWith(ent, lf.Header)
 	}
 	offset := atomic.LoadInt64(&activeLogFile.WriteAt)
 	if err := activeLogFile.Write(entryBuf); err != nil {
@@ -308,7 +405,7 @@ func (db *BitcaskDB) initLogFile(dataType DataType) error {
 		return nil
 	}
 	opts := db.opts
-	lf, err := logfile.GetLogFile(opts.DBPath, logfile.FileType(dataType), logfile.InitialLogFileId, opts.LogFileSizeThreshold)
+	lf, err := logfile.GetLogFile(opts.DBPath, logfile.FileType(dataType), logfile.InitialLogFileId, opts.LogFileSizeThreshold, opts.IoType, opts.Checksum)
 	if err != nil {
 		return err
 	}
@@ -328,7 +425,7 @@ func (db *BitcaskDB) initDiscard() error {
 	discards := make(map[DataType]*discard)
 	for i := String; i < LogFileTypeNum; i++ {
 		name := logfile.FileNamesMap[logfile.FileType(i)] + discardFileName
-		d, err := newDiscard(discardPath, name, db.opts.DiscardBufferSize)
+		d, err := newDiscard(discardPath, name, db.opts.DiscardBufferSize, db.opts.DiscardSendTimeout)
 		if err != nil {
 			log.Errorf("init discard err:%v", err)
 			return err
@@ -381,9 +478,7 @@ func (db *BitcaskDB) decodeKey(buf []byte) ([]byte, []byte) {
 }
 
 func (db *BitcaskDB) handleLogFileGC() {
-	if db.opts.LogFileGCInterval <= 0 {
-		return
-	}
+	defer db.bgWg.Done()
 
 	ticker := time.NewTicker(db.opts.LogFileGCInterval)
 	defer ticker.Stop()
@@ -403,8 +498,10 @@ func (db *BitcaskDB) handleLogFileGC() {
 			}
 
 			for i := String; i < LogFileTypeNum; i++ {
+				db.bgWg.Add(1)
 				go func(dataType DataType) {
-					err := db.doRunGC(dataType, -1)
+					defer db.bgWg.Done()
+					err := db.doRunGC(db.ctx, dataType, -1)
 					if err != nil {
 						log.Errorf("log file gc err, dataType: [%v], err: [%v]", dataType, err)
 					}
@@ -414,22 +511,45 @@ func (db *BitcaskDB) handleLogFileGC() {
 		case <-quitSig:
 			log.Info("FileGC quit sig...")
 			return
+		case <-db.ctx.Done():
+			return
 		}
 	}
 }
 
-func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
+// RunLogFileGC rewrites the alive entries of the archived log files of dataType whose discarded ratio reaches
+// LogFileGCRatio, and removes the files. Only the file fid is collected if fid is not negative.
+func (db *BitcaskDB) RunLogFileGC(dataType DataType, fid int) error {
+	return db.RunLogFileGCCtx(context.Background(), dataType, fid)
+}
+
+// RunLogFileGCCtx is like RunLogFileGC, but it stops and returns the error of ctx if ctx is done before it completes.
+// The file being collected is kept in that case, the entries already rewritten are discarded by the next gc.
+func (db *BitcaskDB) RunLogFileGCCtx(ctx context.Context, dataType DataType, fid int) error {
+	if dataType >= LogFileTypeNum {
+		return ErrInvalidDataType
+	}
+	return db.doRunGC(ctx, dataType, fid)
+}
+
+func (db *BitcaskDB) doRunGC(ctx context.Context, dataType DataType, specifiedFid int) error {
 	atomic.AddInt32(&db.gcState, 1)
 	defer atomic.AddInt32(&db.gcState, -1)
+	if err := db.gcMu.rlockCtx(ctx); err != nil {
+		return err
+	}
+	defer db.gcMu.RUnlock()
 
 	maybeRewriteStrs := func(logEntry *logfile.LogEntry, fid uint32, offset int64) error {
-		db.strIndex.mu.Lock()
+		if err := db.strIndex.mu.lockCtx(ctx); err != nil {
+			return err
+		}
 		defer db.strIndex.mu.Unlock()
 
 		if logEntry.Type == logfile.TypeDelete {
 			return nil
 		}
-		ts := time.Now().Unix()
+		ts := time.Now().UnixMilli()
 		if logEntry.ExpiredAt != 0 && logEntry.ExpiredAt < ts {
 			return nil
 		}
@@ -457,12 +577,10 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 	}
 
 	maybeRewriteList := func(logEntry *logfile.LogEntry, fid uint32, offset int64) error {
-		db.listIndex.mu.Lock()
-		defer db.listIndex.mu.Unlock()
-
-		if logEntry.Type == logfile.TypeDelete {
-			return nil
+		if err := db.listIndex.mu.lockCtx(ctx); err != nil {
+			return err
 		}
+		defer db.listIndex.mu.Unlock()
 
 		treeKey := logEntry.Key
 		if logEntry.Type != logfile.TypeListMeta {
@@ -473,6 +591,9 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 		if idxTree == nil {
 			return nil
 		}
+		if logEntry.Type == logfile.TypeDelete {
+			return db.maybeRewriteListHole(idxTree, treeKey, logEntry)
+		}
 		idxValue := idxTree.Get(logEntry.Key)
 		if idxValue == nil {
 			return nil
@@ -491,14 +612,16 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 	}
 
 	maybeRewriteHash := func(logEntry *logfile.LogEntry, fid uint32, offset int64) error {
-		db.hashIndex.mu.Lock()
+		if err := db.hashIndex.mu.lockCtx(ctx); err != nil {
+			return err
+		}
 		defer db.hashIndex.mu.Unlock()
 
 		if logEntry.Type == logfile.TypeDelete {
 			return nil
 		}
 
-		key, _ := db.decodeKey(logEntry.Key)
+		key, field := db.decodeKey(logEntry.Key)
 		idxTree := db.hashIndex.trees[string(key)]
 		if idxTree == nil {
 			return nil
@@ -509,11 +632,21 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 		}
 		idxNode, _ := idxValue.(*indexNode)
 		if idxNode != nil && idxNode.fid == fid && idxNode.offset == offset {
-			valuePos, err := db.writeLogEntry(logEntry, List)
+			// the expired field is deleted instead of rewritten, the tombstone keeps the older values from being loaded.
+			if idxNode.expired(time.Now().UnixMilli()) {
+				if _, err := db.hdelInternal(key, idxTree, field); err != nil {
+					return err
+				}
+				if idxTree.Size() == 0 {
+					db.keyspace.release(key, Hash)
+				}
+				return nil
+			}
+			valuePos, err := db.writeLogEntry(logEntry, Hash)
 			if err != nil {
 				return err
 			}
-			if err = db.updateIndexTree(idxTree, logEntry, valuePos, false, List); err != nil {
+			if err = db.updateIndexTree(idxTree, logEntry, valuePos, false, Hash); err != nil {
 				return err
 			}
 		}
@@ -521,7 +654,9 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 	}
 
 	maybeRewriteSets := func(logEntry *logfile.LogEntry, fid uint32, offset int64) error {
-		db.setIndex.mu.Lock()
+		if err := db.setIndex.mu.lockCtx(ctx); err != nil {
+			return err
+		}
 		defer db.setIndex.mu.Unlock()
 
 		if logEntry.Type == logfile.TypeDelete {
@@ -533,24 +668,24 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 			return nil
 		}
 
-		if err := db.setIndex.murhash.Write(logEntry.Value); err != nil {
-			fmt.Println("err")
+		mkey, err := memberKey(logEntry.Value)
+		if err != nil {
 			return err
 		}
-		sum := db.setIndex.murhash.EncodeSum128()
-		db.setIndex.murhash.Reset()
 
-		idxValue := idxTree.Get(sum)
+		idxValue := idxTree.Get(mkey)
 		if idxValue == nil {
 			return nil
 		}
 		idxNode, _ := idxValue.(*indexNode)
 		if idxNode != nil && idxNode.fid == fid && idxNode.offset == offset {
-			valuePos, err := db.writeLogEntry(logEntry, List)
+			valuePos, err := db.writeLogEntry(logEntry, Set)
 			if err != nil {
 				return err
 			}
-			if err = db.updateIndexTree(idxTree, logEntry, valuePos, false, List); err != nil {
+			// the set index is keyed by memberKey.
+			logEntry.Key = mkey
+			if err = db.updateIndexTree(idxTree, logEntry, valuePos, false, Set); err != nil {
 				return err
 			}
 		}
@@ -558,7 +693,9 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 	}
 
 	maybeRewriteZSet := func(logEntry *logfile.LogEntry, fid uint32, offset int64) error {
-		db.zsetIndex.mu.Lock()
+		if err := db.zsetIndex.mu.lockCtx(ctx); err != nil {
+			return err
+		}
 		defer db.zsetIndex.mu.Unlock()
 
 		if logEntry.Type == logfile.TypeDelete {
@@ -571,13 +708,12 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 			return nil
 		}
 
-		if err := db.zsetIndex.murhash.Write(logEntry.Value); err != nil {
+		mkey, err := memberKey(logEntry.Value)
+		if err != nil {
 			return err
 		}
-		sum := db.zsetIndex.murhash.EncodeSum128()
-		db.zsetIndex.murhash.Reset()
 
-		idxValue := idxTree.Get(sum)
+		idxValue := idxTree.Get(mkey)
 		if idxValue == nil {
 			return nil
 		}
@@ -587,6 +723,8 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 			if err != nil {
 				return err
 			}
+			// the sorted set index is keyed by memberKey.
+			logEntry.Key = mkey
 			if err = db.updateIndexTree(idxTree, logEntry, valuePos, false, ZSet); err != nil {
 				return err
 			}
@@ -619,8 +757,11 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 			continue
 		}
 
+		var offset int64 = logfile.SegmentHeaderSize
 		for {
-			var offset int64
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			logEntry, eSize, err := archivedFile.ReadLogEntry(offset)
 			if err != nil {
 				if err == logfile.ErrEndOfEntry || err == io.EOF {
@@ -629,6 +770,15 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 				return err
 			}
 
+			// the key tombstone is dropped like the others, but not before the unlink of the key is done.
+			if logEntry.Type == logfile.TypeKeyDelete {
+				if err = db.checkKeyTombstone(ctx, logEntry.Key, dataType); err != nil {
+					return err
+				}
+				offset += eSize
+				continue
+			}
+
 			switch dataType {
 			case String:
 				err = maybeRewriteStrs(logEntry, fid, offset)
@@ -663,6 +813,129 @@ func (db *BitcaskDB) doRunGC(dataType DataType, specifiedFid int) error {
 	return nil
 }
 
+// RebuildDiscards recomputes the discarded size of every log file from the indexes,
+// so the garbage is taken into account by log file gc even if some discard updates were lost.
+// Every type is rebuilt in turn with its index lock held for the whole walk of its index.
+func (db *BitcaskDB) RebuildDiscards() error {
+	for dataType := String; dataType < LogFileTypeNum; dataType++ {
+		if err := db.rebuildDiscard(dataType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LostDiscardUpdates returns the number of discard updates lost because the discard channel is full.
+func (db *BitcaskDB) LostDiscardUpdates() int64 {
+	var lost int64
+	for _, d := range db.discards {
+		lost += d.lostUpdates()
+	}
+	return lost
+}
+
+func (db *BitcaskDB) handleDiscardRebuild() {
+	defer db.bgWg.Done()
+
+	ticker := time.NewTicker(db.opts.DiscardRebuildInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.RebuildDiscards(); err != nil {
+				log.Errorf("rebuild discard err: %v", err)
+			}
+		case <-db.ctx.Done():
+			return
+		}
+	}
+}
+
+func (db *BitcaskDB) handleHashFieldExpire() {
+	defer db.bgWg.Done()
+
+	ticker := time.NewTicker(db.opts.HashFieldExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.expireHashFields(); err != nil {
+				log.Errorf("expire hash fields err: %v", err)
+			}
+		case <-db.ctx.Done():
+			return
+		}
+	}
+}
+
+// rebuildDiscard rebuilds the discard records of dataType. The index lock is held, so no update can be sent,
+// and the discarded size of a log file is its size minus the size of the entries referenced by the index.
+func (db *BitcaskDB) rebuildDiscard(dataType DataType) error {
+	mu := db.indexLock(dataType)
+	mu.Lock()
+	defer mu.Unlock()
+
+	d := db.discards[dataType]
+	d.drain()
+
+	alive := make(map[uint32]int64)
+	count := func(idxTree *art.AdaptiveRadixTree) {
+		iter := idxTree.Iterator()
+		for iter.HasNext() {
+			node, err := iter.Next()
+			if err != nil {
+				return
+			}
+			if idxNode, _ := node.Value().(*indexNode); idxNode != nil {
+				alive[idxNode.fid] += int64(idxNode.entrySize)
+			}
+		}
+	}
+	switch dataType {
+	case String:
+		count(db.strIndex.idxTree)
+	case List:
+		for _, idxTree := range db.listIndex.trees {
+			count(idxTree)
+		}
+	case Hash:
+		for _, idxTree := range db.hashIndex.trees {
+			count(idxTree)
+		}
+	case Set:
+		for _, idxTree := range db.setIndex.trees {
+			count(idxTree)
+		}
+	case ZSet:
+		for _, idxTree := range db.zsetIndex.trees {
+			count(idxTree)
+		}
+	}
+	// the members of the keys being unlinked are not in the index, but their updates are not sent yet.
+	for dk := range db.unlinking[dataType] {
+		count(dk.idxTree)
+	}
+
+	discarded := func(size, alive int64) uint32 {
+		if size <= alive {
+			return 0
+		}
+		return uint32(size - alive)
+	}
+	db.mu.RLock()
+	records := make(map[uint32]uint32)
+	// archived files are rotated when they are nearly full, the unused tail is also treated as discarded.
+	for fid := range db.archivedLogFile[dataType] {
+		records[fid] = discarded(db.opts.LogFileSizeThreshold, alive[fid])
+	}
+	if lf := db.activateLogFile[dataType]; lf != nil {
+		records[lf.Fid] = discarded(atomic.LoadInt64(&lf.WriteAt), alive[lf.Fid])
+	}
+	db.mu.RUnlock()
+
+	return d.rebuild(records, uint32(db.opts.LogFileSizeThreshold))
+}
+
 func (db *BitcaskDB) sendDiscard(oldVal interface{}, updated bool, dType DataType) {
 	if oldVal == nil || !updated {
 		return
@@ -671,14 +944,41 @@ func (db *BitcaskDB) sendDiscard(oldVal interface{}, updated bool, dType DataTyp
 	if idxNode == nil {
 		return
 	}
-	select {
-	case db.discards[dType].valChan <- idxNode:
-	default:
-		log.Error("send to discard chan fail!")
-	}
+	db.discards[dType].send(idxNode)
 }
 
+// Close closes db and the namespaces opened by it, the background work such as log file gc and unlink is
+// waited before the log files are closed.
 func (db *BitcaskDB) Close() error {
+	return db.CloseCtx(context.Background())
+}
+
+// CloseCtx is like Close, but it returns the error of ctx if ctx is done before the background work stops.
+// The background goroutines are stopped and the running gc is canceled anyway, but the log files are
+// left open in that case, so Close can be called again to wait for the rest.
+func (db *BitcaskDB) CloseCtx(ctx context.Context) error {
+	if err := db.closeNamespaces(ctx); err != nil {
+		return err
+	}
+	db.closeEvictor()
+	db.cancel()
+	if err := waitCtx(ctx, db.bgWg); err != nil {
+		return err
+	}
+
+	// the background unlink writes log entries, wait for it before closing the log files.
+	if err := waitCtx(ctx, db.unlinkWg); err != nil {
+		return err
+	}
+	if err := waitCtx(ctx, db.flushWg); err != nil {
+		return err
+	}
+	// wait for the gc started by RunLogFileGC.
+	if err := db.gcMu.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer db.gcMu.Unlock()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -701,19 +1001,12 @@ func (db *BitcaskDB) Close() error {
 		}
 	}
 
-	// close the mmap.
+	// close the mmap after the pending updates are written.
 	for _, discard := range db.discards {
-		if err := discard.sync(); err != nil {
-			return err
-		}
 		if err := discard.close(); err != nil {
 			return err
 		}
 	}
-	// close discard channel.
-	for _, dis := range db.discards {
-		dis.closeChan()
-	}
 	db.strIndex = nil
 
 	return nil
@@ -0,0 +1,71 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/options"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertStrings checks that the keys k0 to k(n-1) hold the values v0 to v(n-1).
+func assertStrings(t *testing.T, db *BitcaskDB, n int) {
+	for i := 0; i < n; i++ {
+		val, err := db.Get([]byte(fmt.Sprintf("k%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("v%d", i), string(val))
+	}
+}
+
+func TestBitcaskDB_ChecksumSegments(t *testing.T) {
+	path := t.TempDir()
+	// a log file of the old versions is checked by IEEE, it becomes a version 1 segment after migration.
+	data := make([]byte, 0, 4096)
+	for i := 0; i < 3; i++ {
+		entry := &logfile.LogEntry{Key: []byte(fmt.Sprintf("k%d", i)), Value: []byte(fmt.Sprintf("v%d", i))}
+		buf, _ := logfile.EncodeEntryWith(entry, logfile.SegmentHeader{Version: 1, Checksum: logfile.ChecksumIEEE})
+		data = append(data, buf...)
+	}
+	name := filepath.Join(path, logfile.FileNamesMap[logfile.Strs]+"000000000")
+	assert.Nil(t, ioutil.WriteFile(name, data[:cap(data)], 0644))
+	_, err := logfile.MigrateDir(path)
+	assert.Nil(t, err)
+
+	// the values are read from the log files, so the checksums are verified on every read.
+	opts := options.DefaultOptions(path)
+	opts.IndexMode = options.KeyOnlyMemMode
+	opts.LogFileSizeThreshold = 256
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	for i := 3; i < 20; i++ {
+		assert.Nil(t, db.Set([]byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	assert.Equal(t, uint16(1), db.archivedLogFile[String][0].Header.Version)
+	assert.Equal(t, logfile.ChecksumIEEE, db.archivedLogFile[String][0].Header.Checksum)
+	assert.Equal(t, logfile.ChecksumCRC32C, db.activateLogFile[String].Header.Checksum)
+	assertStrings(t, db, 20)
+
+	// the algorithm of new segments can be changed, the existing ones keep theirs.
+	opts.Checksum = logfile.ChecksumIEEE
+	db = reopenTestDB(t, db, opts)
+	assertStrings(t, db, 20)
+	fid := db.activateLogFile[String].Fid
+	for i := 20; i < 40; i++ {
+		assert.Nil(t, db.Set([]byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	assert.Equal(t, logfile.ChecksumCRC32C, db.archivedLogFile[String][fid].Header.Checksum)
+	assert.Equal(t, logfile.SegmentVersion, db.activateLogFile[String].Header.Version)
+	assert.Equal(t, logfile.ChecksumIEEE, db.activateLogFile[String].Header.Checksum)
+
+	opts.Checksum = options.DefaultOptions(path).Checksum
+	db = reopenTestDB(t, db, opts)
+	assertStrings(t, db, 40)
+
+	opts.Checksum = logfile.ChecksumCRC32C + 1
+	_, err = Open(opts)
+	assert.Equal(t, logfile.ErrUnsupportedChecksum, err)
+}
@@ -0,0 +1,312 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/log"
+	"container/list"
+	"context"
+	"time"
+)
+
+// blockedClient is a client blocked by a blocking pop until any of its keys is pushed.
+type blockedClient struct {
+	keys      [][]byte
+	fromHead  bool   // Pops the head of the list, or the member with the lowest score.
+	dstKey    []byte // Destination of BLMove, nil for the other commands.
+	dstIsLeft bool
+	peek      bool            // Only waits for any of the keys to be non-empty, nothing is popped.
+	elems     []*list.Element // Positions of the client in the queues of its keys.
+	result    chan popResult
+}
+
+// popResult is the element handed over to a blockedClient.
+type popResult struct {
+	key   []byte
+	value []byte
+	score float64
+	err   error
+}
+
+// blockedQueues are the clients blocked on the keys of a data type, they are guarded by the lock of its index.
+type blockedQueues struct {
+	waiters map[string]*list.List // Clients blocked on each key, in the order they were blocked.
+	ready   []string              // Pushed keys with blocked clients, they are served before the lock is released.
+}
+
+// blockingOps are what is needed to block on and serve the keys of a data type.
+type blockingOps struct {
+	mu     *rwMutex
+	queues *blockedQueues
+	length func(key []byte) int
+	pop    func(key []byte, c *blockedClient) popResult
+	unpop  func(res popResult, c *blockedClient) error
+}
+
+func newBlockedQueues() *blockedQueues {
+	return &blockedQueues{waiters: make(map[string]*list.List)}
+}
+
+// BLPop is the blocking version of LPop, it pops the first element of the first non-empty list of keys.
+// If all the lists are empty, it blocks until one of them is pushed, timeout elapses or ctx is done.
+// Clients blocked on the same key are served in the order they were blocked, and a zero timeout blocks indefinitely.
+// It returns the key and the popped element, or nils if timeout elapses.
+func (db *BitcaskDB) BLPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	res, err := db.block(ctx, timeout, List, &blockedClient{keys: keys, fromHead: true})
+	return res.key, res.value, err
+}
+
+// BRPop is the blocking version of RPop, it pops the last element of the first non-empty list of keys.
+// It blocks the same as BLPop.
+func (db *BitcaskDB) BRPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	res, err := db.block(ctx, timeout, List, &blockedClient{keys: keys, fromHead: false})
+	return res.key, res.value, err
+}
+
+// BLMove is the blocking version of LMove, it blocks the same as BLPop while the list stored at srcKey is empty.
+// It returns the moved element, or nil if timeout elapses.
+func (db *BitcaskDB) BLMove(ctx context.Context, timeout time.Duration, srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte, error) {
+	if err := db.checkMemory(); err != nil {
+		return nil, err
+	}
+
+	c := &blockedClient{keys: [][]byte{srcKey}, fromHead: srcIsLeft, dstKey: dstKey, dstIsLeft: dstIsLeft}
+	res, err := db.block(ctx, timeout, List, c)
+	return res.value, err
+}
+
+// BZPopMin is the blocking version of ZPopMin, it pops the member with the lowest score of the first non-empty
+// sorted set of keys. It blocks the same as BLPop until ZAdd adds a member to any of the keys.
+// It returns the key and the popped member, or nils if timeout elapses.
+func (db *BitcaskDB) BZPopMin(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, *ZMember, error) {
+	res, err := db.block(ctx, timeout, ZSet, &blockedClient{keys: keys, fromHead: true})
+	if err != nil || res.key == nil {
+		return nil, nil, err
+	}
+	return res.key, &ZMember{Member: res.value, Score: res.score}, nil
+}
+
+// BZPopMax is like BZPopMin, but it pops the member with the highest score.
+func (db *BitcaskDB) BZPopMax(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, *ZMember, error) {
+	res, err := db.block(ctx, timeout, ZSet, &blockedClient{keys: keys, fromHead: false})
+	if err != nil || res.key == nil {
+		return nil, nil, err
+	}
+	return res.key, &ZMember{Member: res.value, Score: res.score}, nil
+}
+
+// ZWait blocks until any of the sorted sets of keys has members, it returns the first such key, or nil if
+// timeout elapses. Nothing is popped, so the members may be removed by others before the caller pops them.
+// It is used by callers which must pop in their own critical section, such as a replicated node.
+func (db *BitcaskDB) ZWait(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, error) {
+	res, err := db.block(ctx, timeout, ZSet, &blockedClient{keys: keys, peek: true})
+	return res.key, err
+}
+
+// block pops an element for c from the first non-empty key of c, or blocks until any of its keys is pushed.
+func (db *BitcaskDB) block(ctx context.Context, timeout time.Duration, dataType DataType, c *blockedClient) (popResult, error) {
+	if len(c.keys) == 0 {
+		return popResult{}, ErrWrongNumberOfArgs
+	}
+	if timeout < 0 {
+		return popResult{}, ErrInvalidTimeDuration
+	}
+	ops := db.blockingOps(dataType)
+	if err := ops.mu.lockCtx(ctx); err != nil {
+		return popResult{}, err
+	}
+
+	for _, key := range c.keys {
+		if err := db.keyspace.check(key, dataType); err != nil {
+			ops.mu.Unlock()
+			return popResult{}, err
+		}
+	}
+	for _, key := range c.keys {
+		if ops.length(key) > 0 {
+			res := popResult{key: key}
+			if !c.peek {
+				res = ops.pop(key, c)
+			}
+			db.serveBlocked(dataType)
+			ops.mu.Unlock()
+			return res, res.err
+		}
+	}
+	ops.queues.add(c)
+	ops.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case res := <-c.result:
+		if ctx.Err() == nil {
+			return res, res.err
+		}
+		// served after ctx is done, the element is put back below.
+		c.result <- res
+		err = ctx.Err()
+	case <-expired:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-db.ctx.Done():
+		err = ErrDBClosed
+	}
+
+	// the client may be served before the lock is acquired, the popped element must not be lost.
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+	select {
+	case res := <-c.result:
+		if err == nil || res.err != nil || res.value == nil {
+			return res, res.err
+		}
+		// nobody waits for the element any more, it is put back to where it was popped from.
+		if putErr := ops.unpop(res, c); putErr != nil {
+			log.Errorf("put back element of key %s err: %v", res.key, putErr)
+		}
+		db.serveBlocked(dataType)
+		return popResult{}, err
+	default:
+	}
+	ops.queues.remove(c)
+	return popResult{}, err
+}
+
+// serveBlocked hands the elements pushed by the current operation over to the clients blocked on the keys
+// of dataType, in the order they were blocked. The write lock of dataType must be held.
+func (db *BitcaskDB) serveBlocked(dataType DataType) {
+	if dataType != List && dataType != ZSet {
+		return
+	}
+	ops := db.blockingOps(dataType)
+	queues := ops.queues
+	for len(queues.ready) > 0 {
+		key := []byte(queues.ready[0])
+		queues.ready = queues.ready[1:]
+
+		queue := queues.waiters[string(key)]
+		for queue != nil && queue.Len() > 0 && ops.length(key) > 0 {
+			c := queue.Front().Value.(*blockedClient)
+			queues.remove(c)
+			if c.peek {
+				c.result <- popResult{key: key}
+				continue
+			}
+			res := ops.pop(key, c)
+			if res.err != nil {
+				log.Errorf("serve blocked client of key %s err: %v", key, res.err)
+			}
+			c.result <- res
+		}
+	}
+	queues.ready = nil
+}
+
+func (db *BitcaskDB) blockingOps(dataType DataType) blockingOps {
+	if dataType == List {
+		return blockingOps{mu: db.listIndex.mu, queues: db.listIndex.blocked, length: db.listLength, pop: db.popListFor, unpop: db.unpopListFor}
+	}
+	return blockingOps{mu: db.zsetIndex.mu, queues: db.zsetIndex.blocked, length: db.zsetLength, pop: db.popZSetFor, unpop: db.unpopZSetFor}
+}
+
+// popListFor pops an element of the list stored at key for c, and pushes it to the destination of BLMove.
+func (db *BitcaskDB) popListFor(key []byte, c *blockedClient) popResult {
+	if c.dstKey != nil {
+		if err := db.keyspace.check(c.dstKey, List); err != nil {
+			return popResult{err: err}
+		}
+	}
+	val, err := db.popInternal(key, c.fromHead)
+	if err != nil || val == nil || c.dstKey == nil {
+		return popResult{key: key, value: val, err: err}
+	}
+
+	if db.listIndex.trees[string(c.dstKey)] == nil {
+		db.listIndex.trees[string(c.dstKey)] = art.NewART()
+	}
+	err = db.pushInternal(c.dstKey, val, c.dstIsLeft)
+	return popResult{key: key, value: val, err: err}
+}
+
+// unpopListFor pushes the element popped for c back to the end of the list it was popped from.
+// The element moved by BLMove is kept in the destination, so it is not lost either.
+func (db *BitcaskDB) unpopListFor(res popResult, c *blockedClient) error {
+	if c.dstKey != nil {
+		return nil
+	}
+	if db.listIndex.trees[string(res.key)] == nil {
+		db.listIndex.trees[string(res.key)] = art.NewART()
+	}
+	return db.pushInternal(res.key, res.value, c.fromHead)
+}
+
+// popZSetFor pops the member with the lowest or highest score of the sorted set stored at key for c.
+func (db *BitcaskDB) popZSetFor(key []byte, c *blockedClient) popResult {
+	member, ok, err := db.zpopInternal(key, !c.fromHead)
+	if err != nil || !ok {
+		return popResult{err: err}
+	}
+	return popResult{key: key, value: member.Member, score: member.Score}
+}
+
+// unpopZSetFor adds the member popped for c back to the sorted set it was popped from.
+func (db *BitcaskDB) unpopZSetFor(res popResult, c *blockedClient) error {
+	return db.zaddInternal(res.key, res.score, res.value)
+}
+
+// listLength returns the length of the list stored at key, the lock of listIndex must be held.
+func (db *BitcaskDB) listLength(key []byte) int {
+	return db.listLen(db.listIndex.trees[string(key)], key)
+}
+
+// zsetLength returns the number of members of the sorted set stored at key, the lock of zsetIndex must be held.
+func (db *BitcaskDB) zsetLength(key []byte) int {
+	return db.zsetIndex.indexes.ZCard(string(key))
+}
+
+// add appends c to the queues of its keys.
+func (q *blockedQueues) add(c *blockedClient) {
+	c.result = make(chan popResult, 1)
+	for _, key := range c.keys {
+		queue := q.waiters[string(key)]
+		if queue == nil {
+			queue = list.New()
+			q.waiters[string(key)] = queue
+		}
+		c.elems = append(c.elems, queue.PushBack(c))
+	}
+}
+
+// remove removes c from the queues of its keys.
+func (q *blockedQueues) remove(c *blockedClient) {
+	for i, key := range c.keys {
+		queue := q.waiters[string(key)]
+		if queue == nil {
+			continue
+		}
+		queue.Remove(c.elems[i])
+		if queue.Len() == 0 {
+			delete(q.waiters, string(key))
+		}
+	}
+	c.elems = nil
+}
+
+// markReady records that key is pushed, if any client is blocked on it.
+func (q *blockedQueues) markReady(key []byte) {
+	if _, ok := q.waiters[string(key)]; !ok {
+		return
+	}
+	for _, k := range q.ready {
+		if k == string(key) {
+			return
+		}
+	}
+	q.ready = append(q.ready, string(key))
+}
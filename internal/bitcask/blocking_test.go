@@ -0,0 +1,245 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/options"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestDB(t *testing.T) *BitcaskDB {
+	db, err := Open(options.DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("open db err: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// waitBlocked waits until n clients are blocked on the key of dataType.
+func waitBlocked(t *testing.T, db *BitcaskDB, dataType DataType, key []byte, n int) {
+	ops := db.blockingOps(dataType)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ops.mu.RLock()
+		queue := ops.queues.waiters[string(key)]
+		blocked := queue != nil && queue.Len() == n
+		ops.mu.RUnlock()
+		if blocked {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d clients are not blocked on key %s", n, key)
+}
+
+func TestBitcaskDB_BLPopFIFO(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("queue")
+
+	results := make([]chan []byte, 3)
+	for i := range results {
+		results[i] = make(chan []byte, 1)
+		go func(res chan []byte) {
+			_, val, err := db.BLPop(context.Background(), 0, key)
+			assert.Nil(t, err)
+			res <- val
+		}(results[i])
+		// the clients are blocked one by one, so their order is known.
+		waitBlocked(t, db, List, key, i+1)
+	}
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c")))
+	for i, want := range []string{"a", "b", "c"} {
+		select {
+		case val := <-results[i]:
+			assert.Equal(t, want, string(val))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("client %d is not served", i)
+		}
+	}
+	assert.Equal(t, 0, listLen(t, db, key))
+}
+
+func TestBitcaskDB_BLPopTimeout(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("queue")
+
+	start := time.Now()
+	k, val, err := db.BLPop(context.Background(), 50*time.Millisecond, key)
+	assert.Nil(t, err)
+	assert.Nil(t, k)
+	assert.Nil(t, val)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// the timed out client is not served.
+	assert.Nil(t, db.RPush(key, []byte("a")))
+	assert.Equal(t, 1, listLen(t, db, key))
+}
+
+func TestBitcaskDB_BLPopCanceled(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("queue")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := db.BLPop(ctx, 0, key)
+		errc <- err
+	}()
+	waitBlocked(t, db, List, key, 1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-errc)
+
+	db.listIndex.mu.RLock()
+	assert.Empty(t, db.listIndex.blocked.waiters)
+	db.listIndex.mu.RUnlock()
+	assert.Nil(t, db.RPush(key, []byte("a")))
+	assert.Equal(t, 1, listLen(t, db, key))
+}
+
+func TestBitcaskDB_BLPopServedAfterCanceled(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("queue")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := db.BLPop(ctx, 0, key)
+		errc <- err
+	}()
+	waitBlocked(t, db, List, key, 1)
+
+	// the client is canceled before it takes the served element, the element must be put back.
+	db.listIndex.mu.Lock()
+	cancel()
+	db.listIndex.trees[string(key)] = art.NewART()
+	assert.Nil(t, db.pushInternal(key, []byte("a"), false))
+	db.serveBlocked(List)
+	db.listIndex.mu.Unlock()
+
+	assert.Equal(t, context.Canceled, <-errc)
+	assert.Equal(t, 1, listLen(t, db, key))
+	val, err := db.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(val))
+}
+
+func TestBitcaskDB_BLPopServedByLInsert(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("queue")
+
+	res := make(chan string, 1)
+	go func() {
+		_, val, err := db.BLPop(context.Background(), 0, key)
+		assert.Nil(t, err)
+		res <- string(val)
+	}()
+	waitBlocked(t, db, List, key, 1)
+
+	// the list becomes non-empty without serving the client, so the client is still blocked.
+	db.listIndex.mu.Lock()
+	db.listIndex.trees[string(key)] = art.NewART()
+	assert.Nil(t, db.pushInternal(key, []byte("a"), false))
+	db.listIndex.mu.Unlock()
+
+	n, err := db.LInsert(key, true, []byte("a"), []byte("head"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	select {
+	case val := <-res:
+		assert.Equal(t, "head", val)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client is not served by LInsert")
+	}
+	assert.Equal(t, []string{"a"}, listStrings(t, db, key))
+}
+
+func TestBitcaskDB_BZPopServedByZAdd(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("z2")
+
+	minRes := make(chan *ZMember, 1)
+	go func() {
+		k, m, err := db.BZPopMin(context.Background(), 0, []byte("z1"), key)
+		assert.Nil(t, err)
+		assert.Equal(t, key, k)
+		minRes <- m
+	}()
+	waitBlocked(t, db, ZSet, key, 1)
+	maxRes := make(chan *ZMember, 1)
+	go func() {
+		_, m, err := db.BZPopMax(context.Background(), 0, key)
+		assert.Nil(t, err)
+		maxRes <- m
+	}()
+	waitBlocked(t, db, ZSet, key, 2)
+
+	// the clients are served in the order they were blocked, ZIncrBy adds a member as ZAdd does.
+	assert.Nil(t, db.ZAdd(key, 1, []byte("a")))
+	_, err := db.ZIncrBy(key, 2, []byte("b"))
+	assert.Nil(t, err)
+	for _, tt := range []struct {
+		res  chan *ZMember
+		want ZMember
+	}{{minRes, zm("a", 1)}, {maxRes, zm("b", 2)}} {
+		select {
+		case m := <-tt.res:
+			assert.Equal(t, tt.want, *m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("client of %s is not served", tt.want.Member)
+		}
+	}
+	card, err := db.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, card)
+}
+
+func TestBitcaskDB_BZPopNotBlocked(t *testing.T) {
+	db := openTestDB(t)
+	writeZSet(t, db, "z", zm("a", 1), zm("b", 2), zm("c", 3))
+
+	k, m, err := db.BZPopMax(context.Background(), 0, []byte("missing"), []byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, "z", string(k))
+	assert.Equal(t, zm("c", 3), *m)
+	k, m, err = db.BZPopMin(context.Background(), 0, []byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, "z", string(k))
+	assert.Equal(t, zm("a", 1), *m)
+
+	k, m, err = db.BZPopMin(context.Background(), 50*time.Millisecond, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Nil(t, k)
+	assert.Nil(t, m)
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, _, err = db.BZPopMin(context.Background(), 0, []byte("str"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_ZWait(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("z")
+
+	res := make(chan []byte, 1)
+	go func() {
+		k, err := db.ZWait(context.Background(), 0, key)
+		assert.Nil(t, err)
+		res <- k
+	}()
+	waitBlocked(t, db, ZSet, key, 1)
+	assert.Nil(t, db.ZAdd(key, 1, []byte("a")))
+	select {
+	case k := <-res:
+		assert.Equal(t, key, k)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client is not woken")
+	}
+	// nothing is popped.
+	card, err := db.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, card)
+}
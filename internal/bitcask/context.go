@@ -0,0 +1,150 @@
+package bitcask
+
+import (
+	"context"
+	"sync"
+)
+
+// rwMutex is a readers-writer lock like sync.RWMutex, but waiting for it can be abandoned when a context is done.
+// A waiting writer blocks the new readers, so writers won't starve.
+type rwMutex struct {
+	mu      sync.Mutex
+	readers int           // Number of readers holding the lock, -1 if a writer holds it.
+	writers int           // Number of writers waiting for the lock.
+	changed chan struct{} // Closed when the lock is released or a writer gives up, nil if nobody waits.
+}
+
+func newRWMutex() *rwMutex {
+	return new(rwMutex)
+}
+
+func (rw *rwMutex) Lock() {
+	_ = rw.lockCtx(context.Background())
+}
+
+func (rw *rwMutex) RLock() {
+	_ = rw.rlockCtx(context.Background())
+}
+
+func (rw *rwMutex) Unlock() {
+	rw.mu.Lock()
+	if rw.readers != -1 {
+		rw.mu.Unlock()
+		panic("bitcask: Unlock of unlocked rwMutex")
+	}
+	rw.readers = 0
+	rw.notifyLocked()
+	rw.mu.Unlock()
+}
+
+func (rw *rwMutex) RUnlock() {
+	rw.mu.Lock()
+	if rw.readers <= 0 {
+		rw.mu.Unlock()
+		panic("bitcask: RUnlock of unlocked rwMutex")
+	}
+	rw.readers--
+	if rw.readers == 0 {
+		rw.notifyLocked()
+	}
+	rw.mu.Unlock()
+}
+
+// lockCtx acquires the write lock, it returns the error of ctx if ctx is done before the lock is acquired.
+func (rw *rwMutex) lockCtx(ctx context.Context) error {
+	rw.mu.Lock()
+	if rw.readers == 0 {
+		rw.readers = -1
+		rw.mu.Unlock()
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		rw.mu.Unlock()
+		return err
+	}
+
+	rw.writers++
+	for rw.readers != 0 {
+		changed := rw.waitLocked()
+		rw.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			rw.mu.Lock()
+			rw.writers--
+			// the readers blocked by this writer can go on.
+			rw.notifyLocked()
+			rw.mu.Unlock()
+			return ctx.Err()
+		}
+		rw.mu.Lock()
+	}
+	rw.writers--
+	rw.readers = -1
+	rw.mu.Unlock()
+	return nil
+}
+
+// rlockCtx acquires the read lock, it returns the error of ctx if ctx is done before the lock is acquired.
+func (rw *rwMutex) rlockCtx(ctx context.Context) error {
+	rw.mu.Lock()
+	if rw.readers >= 0 && rw.writers == 0 {
+		rw.readers++
+		rw.mu.Unlock()
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		rw.mu.Unlock()
+		return err
+	}
+
+	for rw.readers < 0 || rw.writers > 0 {
+		changed := rw.waitLocked()
+		rw.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		rw.mu.Lock()
+	}
+	rw.readers++
+	rw.mu.Unlock()
+	return nil
+}
+
+// waitLocked returns the channel closed on the next change of the lock, rw.mu must be held.
+func (rw *rwMutex) waitLocked() <-chan struct{} {
+	if rw.changed == nil {
+		rw.changed = make(chan struct{})
+	}
+	return rw.changed
+}
+
+// notifyLocked wakes up all the waiters to check the lock again, rw.mu must be held.
+func (rw *rwMutex) notifyLocked() {
+	if rw.changed != nil {
+		close(rw.changed)
+		rw.changed = nil
+	}
+}
+
+// waitCtx waits for wg, it returns the error of ctx if ctx is done first.
+func waitCtx(ctx context.Context, wg *sync.WaitGroup) error {
+	if ctx.Done() == nil {
+		wg.Wait()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package bitcask
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRWMutex_LockCtx(t *testing.T) {
+	rw := newRWMutex()
+	rw.RLock()
+	goroutines := runtime.NumGoroutine()
+
+	// the writer gives up, without leaving anything behind to acquire the lock later.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, rw.lockCtx(ctx))
+	assert.Equal(t, goroutines, runtime.NumGoroutine())
+	assert.Equal(t, 0, rw.writers)
+	rw.RUnlock()
+	assert.Equal(t, 0, rw.readers)
+
+	// a canceled context fails only if the lock has to be waited for.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, rw.lockCtx(canceled))
+	assert.Equal(t, context.Canceled, rw.rlockCtx(canceled))
+	assert.Equal(t, context.Canceled, rw.lockCtx(canceled))
+	rw.Unlock()
+	assert.Nil(t, rw.rlockCtx(canceled))
+	rw.RUnlock()
+}
+
+func TestRWMutex_WriterBlocksReaders(t *testing.T) {
+	rw := newRWMutex()
+	rw.RLock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writerDone := make(chan error)
+	go func() {
+		writerDone <- rw.lockCtx(ctx)
+	}()
+	for {
+		rw.mu.Lock()
+		writers := rw.writers
+		rw.mu.Unlock()
+		if writers == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the new reader waits for the writer.
+	readerDone := make(chan error)
+	go func() {
+		readerDone <- rw.rlockCtx(context.Background())
+	}()
+	select {
+	case <-readerDone:
+		t.Fatal("the reader acquired the lock before the waiting writer")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the reader goes on once the writer gives up.
+	cancel()
+	assert.Equal(t, context.Canceled, <-writerDone)
+	assert.Nil(t, <-readerDone)
+	rw.RUnlock()
+	rw.RUnlock()
+
+	rw.Lock()
+	go func() {
+		readerDone <- rw.rlockCtx(context.Background())
+	}()
+	rw.Unlock()
+	assert.Nil(t, <-readerDone)
+	rw.RUnlock()
+	assert.Equal(t, 0, rw.readers)
+}
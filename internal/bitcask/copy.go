@@ -0,0 +1,301 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrSameObject the source and destination of Copy or Move are the same key of the same db.
+var ErrSameObject = errors.New("source and destination objects are the same")
+
+// keyValue is a copy of the value stored at a key, it is used to copy values between keys and dbs.
+type keyValue struct {
+	dataType  DataType
+	expiredAt int64
+	// value of string, elements of list, fields followed by their values of hash, members of set and sorted set.
+	values         [][]byte
+	scores         []float64 // scores of the members of sorted set.
+	fieldExpiredAt []int64   // expiration time of the fields of hash, 0 means no ttl.
+}
+
+// typeLock is the index lock of a data type in db.
+type typeLock struct {
+	db       *BitcaskDB
+	dataType DataType
+}
+
+// Rename renames src to dst, the value stored at dst is overwritten if dst already exists, regardless of its type.
+// The time to live of src is transferred to dst. It returns ErrKeyNotFound if src does not exist.
+func (db *BitcaskDB) Rename(src, dst []byte) error {
+	if string(src) == string(dst) {
+		if _, ok := db.keyspace.typeOf(src); !ok {
+			return ErrKeyNotFound
+		}
+		return nil
+	}
+	_, err := db.copyKey(src, db, dst, true, true)
+	return err
+}
+
+// RenameNX renames src to dst if dst does not exist yet. It returns false if dst already exists,
+// and ErrKeyNotFound if src does not exist.
+func (db *BitcaskDB) RenameNX(src, dst []byte) (bool, error) {
+	if string(src) == string(dst) {
+		if _, ok := db.keyspace.typeOf(src); !ok {
+			return false, ErrKeyNotFound
+		}
+		return false, nil
+	}
+	return db.copyKey(src, db, dst, false, true)
+}
+
+// Copy copies the value stored at src to dst in dstDB, dstDB can be db itself.
+// The value stored at dst is overwritten if replace is true, otherwise nothing is copied if dst already exists.
+// The time to live of src is also copied. It returns true if src is copied.
+func (db *BitcaskDB) Copy(src []byte, dstDB *BitcaskDB, dst []byte, replace bool) (bool, error) {
+	if err := dstDB.checkMemory(); err != nil {
+		return false, err
+	}
+
+	if dstDB == db && string(src) == string(dst) {
+		return false, ErrSameObject
+	}
+	copied, err := db.copyKey(src, dstDB, dst, replace, false)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return copied, err
+}
+
+// Move moves key from db to dstDB with its time to live. Nothing is moved if key already exists in dstDB,
+// or does not exist in db. It returns true if key is moved.
+func (db *BitcaskDB) Move(key []byte, dstDB *BitcaskDB) (bool, error) {
+	if dstDB == db {
+		return false, ErrSameObject
+	}
+	moved, err := db.copyKey(key, dstDB, key, false, true)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return moved, err
+}
+
+// copyKey copies the value stored at src to dst in dstDB, and removes src if remove is true.
+// All the index locks involved are held during the whole operation, so readers can never see a partial result.
+func (db *BitcaskDB) copyKey(src []byte, dstDB *BitcaskDB, dst []byte, replace, remove bool) (bool, error) {
+	for {
+		srcType, ok := db.keyspace.typeOf(src)
+		if !ok {
+			return false, ErrKeyNotFound
+		}
+		dstType, dstExists := dstDB.keyspace.typeOf(dst)
+		if dstExists && !replace {
+			return false, nil
+		}
+
+		locks := []typeLock{{db, srcType}, {dstDB, srcType}}
+		if dstExists {
+			locks = append(locks, typeLock{dstDB, dstType})
+		}
+		unlock := lockTypes(locks)
+
+		// the keys may be changed before the locks are acquired, check them again.
+		curSrcType, ok := db.keyspace.typeOf(src)
+		curDstType, curDstExists := dstDB.keyspace.typeOf(dst)
+		if !ok || curSrcType != srcType || curDstExists != dstExists || curDstType != dstType {
+			unlock()
+			continue
+		}
+
+		err := db.copyKeyLocked(src, srcType, dstDB, dst, dstExists, dstType, remove)
+		dstDB.serveBlocked(srcType)
+		unlock()
+		return err == nil, err
+	}
+}
+
+// copyKeyLocked does the work of copyKey, the locks of the data types of src and dst must be held.
+func (db *BitcaskDB) copyKeyLocked(src []byte, srcType DataType, dstDB *BitcaskDB,
+	dst []byte, dstExists bool, dstType DataType, remove bool) error {
+
+	kv, err := db.readKeyValue(src, srcType)
+	if err != nil {
+		return err
+	}
+
+	if dstExists {
+		if err = dstDB.removeKeyLocked(dst, dstType); err != nil {
+			return err
+		}
+	}
+	if err = dstDB.writeKeyValue(dst, kv); err != nil {
+		return err
+	}
+	if remove {
+		return db.removeKeyLocked(src, srcType)
+	}
+	return nil
+}
+
+// removeKeyLocked removes key and writes the tombstones of all its members, the lock of dataType must be held.
+func (db *BitcaskDB) removeKeyLocked(key []byte, dataType DataType) error {
+	dk, err := db.detachKey(key, dataType)
+	if err != nil || dk == nil {
+		return err
+	}
+	return db.writeTombstones(dk, nil)
+}
+
+// readKeyValue returns a copy of the value stored at key, the lock of dataType must be held.
+func (db *BitcaskDB) readKeyValue(key []byte, dataType DataType) (*keyValue, error) {
+	kv := &keyValue{dataType: dataType}
+	switch dataType {
+	case String:
+		idxNode, err := db.getIndexNode(db.strIndex.idxTree, key, String)
+		if err != nil {
+			return nil, err
+		}
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil {
+			return nil, err
+		}
+		kv.expiredAt = idxNode.expiredAt
+		kv.values = [][]byte{val}
+	case List:
+		idxTree := db.listIndex.trees[string(key)]
+		if idxTree == nil {
+			return nil, ErrKeyNotFound
+		}
+		headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+		if err != nil {
+			return nil, err
+		}
+		seqs := db.listSeqs(idxTree, key, headSeq, tailSeq, 0, db.listLen(idxTree, key)-1)
+		if kv.values, err = db.listValues(idxTree, key, seqs); err != nil {
+			return nil, err
+		}
+	case Hash:
+		idxTree := db.hashIndex.trees[string(key)]
+		if idxTree == nil {
+			return nil, ErrKeyNotFound
+		}
+		err := db.iterateTree(idxTree, Hash, func(encKey, val []byte) error {
+			_, field := db.decodeKey(encKey)
+			kv.values = append(kv.values, field, val)
+			kv.fieldExpiredAt = append(kv.fieldExpiredAt, db.hFieldExpiredAt(idxTree, encKey))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case Set:
+		members, err := db.sMembers(context.Background(), key)
+		if err != nil {
+			return nil, err
+		}
+		kv.values = members
+	case ZSet:
+		if db.zsetIndex.trees[string(key)] == nil {
+			return nil, ErrKeyNotFound
+		}
+		entries, err := db.zEntries(context.Background(), key)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			kv.values = append(kv.values, e.Member)
+			kv.scores = append(kv.scores, e.Score)
+		}
+	}
+	return kv, nil
+}
+
+// writeKeyValue writes kv to key which must not exist, the lock of kv.dataType must be held.
+func (db *BitcaskDB) writeKeyValue(key []byte, kv *keyValue) error {
+	switch kv.dataType {
+	case String:
+		return db.setInternal(key, kv.values[0], kv.expiredAt)
+	case List:
+		if db.listIndex.trees[string(key)] == nil {
+			db.listIndex.trees[string(key)] = art.NewART()
+		}
+		for _, val := range kv.values {
+			if err := db.pushInternal(key, val, false); err != nil {
+				return err
+			}
+		}
+	case Hash:
+		for i := 0; i < len(kv.values); i += 2 {
+			if err := db.hsetInternal(key, kv.values[i], kv.values[i+1], kv.fieldExpiredAt[i/2]); err != nil {
+				return err
+			}
+		}
+	case Set:
+		for _, member := range kv.values {
+			if _, err := db.saddInternal(key, member); err != nil {
+				return err
+			}
+		}
+	case ZSet:
+		for i, member := range kv.values {
+			if err := db.zaddInternal(key, kv.scores[i], member); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// storeKey overwrites dst with the result of store, which reads the keys of dataType and writes dst.
+// The locks of dataType and the current data type of dst are held during the whole operation, so the result
+// is written atomically. store must remove dst first if it exists.
+func (db *BitcaskDB) storeKey(dst []byte, dataType DataType, store func(dstExists bool, dstType DataType) (int, error)) (int, error) {
+	for {
+		dstType, dstExists := db.keyspace.typeOf(dst)
+		locks := []typeLock{{db, dataType}}
+		if dstExists {
+			locks = append(locks, typeLock{db, dstType})
+		}
+		unlock := lockTypes(locks)
+
+		// dst may be changed before the locks are acquired, check it again.
+		curType, curExists := db.keyspace.typeOf(dst)
+		if curExists != dstExists || curType != dstType {
+			unlock()
+			continue
+		}
+
+		n, err := store(dstExists, dstType)
+		db.serveBlocked(dataType)
+		unlock()
+		return n, err
+	}
+}
+
+// lockTypes acquires the index locks in a global order, which is the order of db path and then data type,
+// so that two operations on the same dbs never deadlock. It returns the function to release them.
+func lockTypes(locks []typeLock) func() {
+	sort.Slice(locks, func(i, j int) bool {
+		if cmp := strings.Compare(locks[i].db.opts.DBPath, locks[j].db.opts.DBPath); cmp != 0 {
+			return cmp < 0
+		}
+		return locks[i].dataType < locks[j].dataType
+	})
+
+	var held []typeLock
+	for i, l := range locks {
+		if i > 0 && l == locks[i-1] {
+			continue
+		}
+		l.db.indexLock(l.dataType).Lock()
+		held = append(held, l)
+	}
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].db.indexLock(held[i].dataType).Unlock()
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeAllTypes writes a key of every type named by its type.
+func writeAllTypes(t *testing.T, db *BitcaskDB) {
+	assert.Nil(t, db.SetEX([]byte("string"), []byte("v"), time.Hour))
+	_, err := db.Del([]byte("list"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.RPush([]byte("list"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v"), []byte("g"), []byte("w")))
+	_, err = db.HExpire([]byte("hash"), time.Hour, ExpireAlways, []byte("f"))
+	assert.Nil(t, err)
+	_, err = db.SAdd([]byte("set"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1.5, []byte("a")))
+}
+
+// assertValue checks that key holds the value of typeName written by writeAllTypes.
+func assertValue(t *testing.T, db *BitcaskDB, key []byte, typeName string) {
+	assert.Equal(t, typeName, db.Type(key))
+	switch typeName {
+	case typeNameString:
+		val, err := db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, "v", string(val))
+		ttl, err := db.TTL(key)
+		assert.Nil(t, err)
+		assert.True(t, ttl > 0)
+	case typeNameList:
+		assert.Equal(t, []string{"a", "b"}, listStrings(t, db, key))
+	case typeNameHash:
+		values, err := db.HGetAll(key)
+		assert.Nil(t, err)
+		assert.Len(t, values, 4)
+		ttls, err := db.HTTL(key, []byte("f"), []byte("g"))
+		assert.Nil(t, err)
+		assert.True(t, ttls[0] > 0)
+		assert.Equal(t, int64(HFieldNoTTL), ttls[1])
+	case typeNameSet:
+		members, err := db.SMembers(key)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, [][]byte{[]byte("a"), []byte("b")}, members)
+	case typeNameZSet:
+		ok, score, err := db.ZScore(key, []byte("a"))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1.5, score)
+	}
+}
+
+func TestBitcaskDB_Rename(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	writeAllTypes(t, db)
+
+	allTypes := []string{typeNameString, typeNameList, typeNameHash, typeNameSet, typeNameZSet}
+	for i, typeName := range allTypes {
+		dst := []byte("renamed-" + typeName)
+		// the destination holds a value of another type, which is overwritten.
+		other := allTypes[(i+1)%len(allTypes)]
+		assert.Nil(t, db.Rename([]byte(other), dst))
+		assert.Nil(t, db.Rename([]byte(typeName), dst))
+		assertValue(t, db, dst, typeName)
+		assert.Equal(t, 0, db.Exists([]byte(typeName)))
+		// move it back and write the others again for the next type.
+		assert.Nil(t, db.Rename(dst, []byte(typeName)))
+		_, err = db.Del([]byte(other))
+		assert.Nil(t, err)
+		writeAllTypes(t, db)
+	}
+
+	db = reopenTestDB(t, db, opts)
+	for _, typeName := range allTypes {
+		assertValue(t, db, []byte(typeName), typeName)
+		assert.Equal(t, 0, db.Exists([]byte("renamed-"+typeName)))
+	}
+}
+
+func TestBitcaskDB_RenameNX(t *testing.T) {
+	db := openTestDB(t)
+	writeAllTypes(t, db)
+
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		renamed bool
+		err     error
+	}{
+		{"dst exists", "list", "set", false, nil},
+		{"dst not exists", "list", "new", true, nil},
+		{"same key", "set", "set", false, nil},
+		{"src not exists", "missing", "other", false, ErrKeyNotFound},
+		{"same missing key", "missing", "missing", false, ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renamed, err := db.RenameNX([]byte(tt.src), []byte(tt.dst))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.renamed, renamed)
+		})
+	}
+	assertValue(t, db, []byte("new"), typeNameList)
+	assertValue(t, db, []byte("set"), typeNameSet)
+	assert.Equal(t, ErrKeyNotFound, db.Rename([]byte("missing"), []byte("other")))
+}
+
+func TestBitcaskDB_Copy(t *testing.T) {
+	db := openTestDB(t)
+	writeAllTypes(t, db)
+	other, err := db.Namespace("other")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		src     string
+		dstDB   *BitcaskDB
+		dst     string
+		replace bool
+		copied  bool
+		err     error
+	}{
+		{"new key", "hash", db, "hash2", false, true, nil},
+		{"dst exists", "set", db, "zset", false, false, nil},
+		{"replace dst", "set", db, "list", true, true, nil},
+		{"other db", "zset", other, "zset", false, true, nil},
+		{"src not exists", "missing", db, "new", false, false, nil},
+		{"same object", "set", db, "set", true, false, ErrSameObject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copied, err := db.Copy([]byte(tt.src), tt.dstDB, []byte(tt.dst), tt.replace)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.copied, copied)
+		})
+	}
+	// the sources are kept.
+	assertValue(t, db, []byte("hash"), typeNameHash)
+	assertValue(t, db, []byte("hash2"), typeNameHash)
+	assertValue(t, db, []byte("zset"), typeNameZSet)
+	assertValue(t, db, []byte("list"), typeNameSet)
+	assertValue(t, other, []byte("zset"), typeNameZSet)
+
+	// the copy is independent of the source.
+	assert.Nil(t, db.HSet([]byte("hash2"), []byte("h"), []byte("x")))
+	assert.Equal(t, 2, db.HLen([]byte("hash")))
+}
+
+func TestBitcaskDB_Move(t *testing.T) {
+	db := openTestDB(t)
+	writeAllTypes(t, db)
+	other, err := db.Namespace("other")
+	assert.Nil(t, err)
+	assert.Nil(t, other.Set([]byte("set"), []byte("exists")))
+
+	moved, err := db.Move([]byte("list"), other)
+	assert.Nil(t, err)
+	assert.True(t, moved)
+	assert.Equal(t, 0, db.Exists([]byte("list")))
+	assertValue(t, other, []byte("list"), typeNameList)
+
+	// nothing is moved if the key exists in the destination.
+	moved, err = db.Move([]byte("set"), other)
+	assert.Nil(t, err)
+	assert.False(t, moved)
+	assertValue(t, db, []byte("set"), typeNameSet)
+
+	moved, err = db.Move([]byte("missing"), other)
+	assert.Nil(t, err)
+	assert.False(t, moved)
+	_, err = db.Move([]byte("hash"), db)
+	assert.Equal(t, ErrSameObject, err)
+}
@@ -4,68 +4,122 @@ import (
 	"bitcaskDB/internal/ioselector"
 	"bitcaskDB/internal/log"
 	"bitcaskDB/internal/logfile"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	discardRecordSize = 12
-	// 8kb, contains mostly 682 records in file.
+	// initial size of discard file, it is doubled when there is no free record.
 	discardFileSize int64 = 2 << 12
 	discardFileName       = "discard"
+
+	discardHeaderSize = 16
+	discardVersion    = 1
 )
 
-// ErrDiscardNoSpace no enough space for discard file.
-var ErrDiscardNoSpace = errors.New("not enough space can be allocated for the discard file")
+// discardMagic identifies the discard files with header, the files written by older versions have no header.
+var discardMagic = []byte("BDSC")
+
+var (
+	// ErrDiscardVersion the version of discard file is not supported.
+	ErrDiscardVersion = errors.New("unsupported discard file version")
+
+	// ErrInvalidDiscard discard file has neither a valid header nor the layout of older versions.
+	ErrInvalidDiscard = errors.New("invalid discard file")
+)
 
 type discard struct {
 	sync.Mutex
-	once     *sync.Once
-	file     ioselector.IOSelector
-	valChan  chan *indexNode
-	freeList []int64          // contains file offset that can be allocated
-	location map[uint32]int64 // offset of each fid
+	lost        int64 // number of updates lost because the channel is full, updated atomically.
+	once        *sync.Once
+	file        *ioselector.MMapIOSelector
+	count       int64 // number of records in file, including the free ones.
+	valChan     chan *indexNode
+	drainChan   chan chan struct{} // requests to apply all the updates in valChan.
+	done        chan struct{}      // closed when listenUpdates exits.
+	sendTimeout time.Duration
+	pending     map[uint32]int   // discarded size of each fid received but not written to file yet.
+	freeList    []int64          // contains file offset that can be allocated
+	location    map[uint32]int64 // offset of each fid
+	minFid      uint32           // updates of the fids less than it are ignored, the log files have been removed.
 }
 
-func newDiscard(path, name string, bufferSize int) (*discard, error) {
+// format of discard file:
+// +---------+-----------+----------------+-----------+-----------+-----
+// |  magic  |  version  |  record count  |  reserved |  records  | ...
+// +---------+-----------+----------------+-----------+-----------+-----
+// 0---------4-----------8---------------12----------16
+func newDiscard(path, name string, bufferSize int, sendTimeout time.Duration) (*discard, error) {
 	fName := filepath.Join(path, name)
-	file, err := ioselector.NewMMapSelector(fName, discardFileSize)
+	if err := migrateDiscard(fName); err != nil {
+		return nil, err
+	}
+	file, err := openDiscardFile(fName)
 	if err != nil {
 		return nil, err
 	}
 
+	header := make([]byte, discardHeaderSize)
+	if _, err = file.Read(header, 0); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	var count int64
+	if bytes.Equal(header[:4], discardMagic) {
+		if version := binary.LittleEndian.Uint32(header[4:8]); version != discardVersion {
+			_ = file.Close()
+			return nil, ErrDiscardVersion
+		}
+		count = int64(binary.LittleEndian.Uint32(header[8:12]))
+	} else {
+		// a new file.
+		copy(header[:4], discardMagic)
+		binary.LittleEndian.PutUint32(header[4:8], discardVersion)
+		if _, err = file.Write(header, 0); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+
 	var freeList []int64
 	localtion := make(map[uint32]int64)
-	var offset int64
-
-	for {
-		buf := make([]byte, discardRecordSize)
+	buf := make([]byte, discardRecordSize)
+	for i := int64(0); i < count; i++ {
+		offset := discardHeaderSize + i*discardRecordSize
 		if _, err := file.Read(buf, offset); err != nil {
-			if err == logfile.ErrEndOfEntry || err == io.EOF {
-				break
-			}
+			_ = file.Close()
 			return nil, err
 		}
 		fid := binary.LittleEndian.Uint32(buf[:4])
-		total := binary.LittleEndian.Uint32(buf[4:])
+		total := binary.LittleEndian.Uint32(buf[4:8])
 		if fid == 0 && total == 0 {
 			freeList = append(freeList, offset)
 		} else {
 			localtion[fid] = offset
 		}
-		offset += discardRecordSize
 	}
 
 	d := &discard{
-		file:     file,
-		valChan:  make(chan *indexNode, bufferSize),
-		freeList: freeList,
-		location: localtion,
-		once:     new(sync.Once),
+		file:        file,
+		count:       count,
+		valChan:     make(chan *indexNode, bufferSize),
+		drainChan:   make(chan chan struct{}),
+		done:        make(chan struct{}),
+		sendTimeout: sendTimeout,
+		pending:     make(map[uint32]int),
+		freeList:    freeList,
+		location:    localtion,
+		once:        new(sync.Once),
 	}
 
 	go d.listenUpdates()
@@ -73,19 +127,78 @@ func newDiscard(path, name string, bufferSize int) (*discard, error) {
 	return d, nil
 }
 
+// listenUpdates aggregates the discarded sizes received from valChan by fid, and writes them to file
+// when the channel is drained, so a burst of updates only costs a few writes.
 func (d *discard) listenUpdates() {
-	for idxNode := range d.valChan {
-		d.incrDiscard(idxNode.fid, idxNode.entrySize)
+	defer close(d.done)
+	for {
+		select {
+		case idxNode, ok := <-d.valChan:
+			if !ok {
+				d.flush()
+				return
+			}
+			d.add(idxNode)
+			if len(d.valChan) == 0 {
+				d.flush()
+			}
+		case ack := <-d.drainChan:
+			for len(d.valChan) > 0 {
+				d.add(<-d.valChan)
+			}
+			d.flush()
+			close(ack)
+		}
 	}
-	// Close the channel, and the loop will end when the buffer is empty
-	if err := d.file.Close(); err != nil {
-		log.Errorf("close discard file err : %v", err)
+}
+
+// send sends the old index node whose entry becomes garbage, it blocks for at most sendTimeout if the channel is full.
+// The update is lost after the timeout, it will be corrected by the next rebuild.
+func (d *discard) send(idxNode *indexNode) {
+	select {
+	case d.valChan <- idxNode:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(d.sendTimeout)
+	defer timer.Stop()
+	select {
+	case d.valChan <- idxNode:
+	case <-timer.C:
+		atomic.AddInt64(&d.lost, 1)
+		log.Error("send to discard chan timeout, the update is lost")
 	}
 }
 
-func (d *discard) incrDiscard(fid uint32, delta int) {
-	if delta > 0 {
-		d.incr(fid, delta)
+// drain waits until all the updates sent before are written to file.
+// It must not be called after the channel is closed.
+func (d *discard) drain() {
+	ack := make(chan struct{})
+	d.drainChan <- ack
+	<-ack
+}
+
+func (d *discard) add(idxNode *indexNode) {
+	if idxNode == nil || idxNode.entrySize <= 0 {
+		return
+	}
+	d.Lock()
+	d.pending[idxNode.fid] += idxNode.entrySize
+	d.Unlock()
+}
+
+// flush writes the pending updates to file.
+func (d *discard) flush() {
+	d.Lock()
+	defer d.Unlock()
+	d.flushLocked()
+}
+
+func (d *discard) flushLocked() {
+	for fid, delta := range d.pending {
+		d.incrLocked(fid, delta)
+		delete(d.pending, fid)
 	}
 }
 
@@ -97,6 +210,13 @@ func (d *discard) incrDiscard(fid uint32, delta int) {
 func (d *discard) incr(fid uint32, delta int) {
 	d.Lock()
 	defer d.Unlock()
+	d.incrLocked(fid, delta)
+}
+
+func (d *discard) incrLocked(fid uint32, delta int) {
+	if fid < d.minFid {
+		return
+	}
 
 	offset, err := d.alloc(fid)
 	if err != nil {
@@ -129,7 +249,9 @@ func (d *discard) alloc(fid uint32) (int64, error) {
 		return offset, nil
 	}
 	if len(d.freeList) == 0 {
-		return 0, ErrDiscardNoSpace
+		if err := d.grow(); err != nil {
+			return 0, err
+		}
 	}
 	// Why allocate from the tail...
 	offset := d.freeList[len(d.freeList)-1]
@@ -138,6 +260,25 @@ func (d *discard) alloc(fid uint32) (int64, error) {
 	return offset, nil
 }
 
+// grow appends a free record, the file is doubled and remapped if it is full.
+func (d *discard) grow() error {
+	offset := discardHeaderSize + d.count*discardRecordSize
+	if size := d.file.Size(); offset+discardRecordSize > size {
+		if err := d.file.Resize(size * 2); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(d.count+1))
+	if _, err := d.file.Write(buf, 8); err != nil {
+		return err
+	}
+	d.count++
+	d.freeList = append(d.freeList, offset)
+	return nil
+}
+
 func (d *discard) setTotal(fid uint32, totalSize uint32) {
 	d.Lock()
 	defer d.Unlock()
@@ -165,10 +306,11 @@ func (d *discard) setTotal(fid uint32, totalSize uint32) {
 
 // CCL means compaction candidate list.
 // iterate and find the file with most discarded data,
-// there are 682 records at most, no need to worry about the performance.
+// there is a record for each log file, no need to worry about the performance.
 func (d *discard) getCCL(activeFid uint32, ratio float64) ([]uint32, error) {
 	d.Lock()
 	defer d.Unlock()
+	d.flushLocked()
 
 	var ccl []uint32
 	for fid, offset := range d.location {
@@ -209,20 +351,156 @@ func (d *discard) clear(fid uint32) {
 	d.Lock()
 	defer d.Unlock()
 
+	delete(d.pending, fid)
 	if offset, ok := d.location[fid]; ok {
 		d.freeList = append(d.freeList, offset)
 		delete(d.location, fid)
 	}
 }
 
+// reset clears all the records, it is called after all the log files are removed.
+// The updates of the removed log files may be still in the channel, they are ignored since their fids are less than minFid.
+func (d *discard) reset(minFid uint32) error {
+	d.Lock()
+	defer d.Unlock()
+
+	d.minFid = minFid
+	return d.resetLocked()
+}
+
+// rebuild replaces all the records with the discarded sizes of fids, the total size of every fid is total.
+// All the updates sent before must be drained, and no update can be sent during the rebuild.
+func (d *discard) rebuild(discarded map[uint32]uint32, total uint32) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.resetLocked(); err != nil {
+		return err
+	}
+	for fid, size := range discarded {
+		if fid < d.minFid {
+			continue
+		}
+		offset, err := d.alloc(fid)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, discardRecordSize)
+		binary.LittleEndian.PutUint32(buf[:4], fid)
+		binary.LittleEndian.PutUint32(buf[4:8], total)
+		binary.LittleEndian.PutUint32(buf[8:12], size)
+		if _, err = d.file.Write(buf, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *discard) resetLocked() error {
+	buf := make([]byte, discardRecordSize)
+	for fid, offset := range d.location {
+		if _, err := d.file.Write(buf, offset); err != nil {
+			return err
+		}
+		d.freeList = append(d.freeList, offset)
+		delete(d.location, fid)
+	}
+	for fid := range d.pending {
+		delete(d.pending, fid)
+	}
+	return nil
+}
+
+func (d *discard) lostUpdates() int64 {
+	return atomic.LoadInt64(&d.lost)
+}
+
 func (d *discard) sync() error {
+	d.Lock()
+	defer d.Unlock()
+	d.flushLocked()
 	return d.file.Sync()
 }
 
-func (d *discard) closeChan() {
+// close stops receiving updates, writes the received ones and closes the file.
+// The file is closed only after the listener exits, so it never writes to the unmapped file.
+func (d *discard) close() error {
 	d.once.Do(func() { close(d.valChan) })
-}
+	<-d.done
 
-func (d *discard) close() error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
 	return d.file.Close()
 }
+
+// openDiscardFile maps the whole discard file, which may have been grown.
+func openDiscardFile(fName string) (*ioselector.MMapIOSelector, error) {
+	size := discardFileSize
+	if stat, err := os.Stat(fName); err == nil && stat.Size() > size {
+		size = stat.Size()
+	}
+	file, err := ioselector.NewMMapSelector(fName, size)
+	if err != nil {
+		return nil, err
+	}
+	return file.(*ioselector.MMapIOSelector), nil
+}
+
+// migrateDiscard converts the discard file written by older versions, which has no header and a fixed size, to the
+// current format. The new file is written aside and then renamed, so the old one is kept if it fails halfway.
+func migrateDiscard(fName string) error {
+	old, err := ioutil.ReadFile(fName)
+	if os.IsNotExist(err) || len(old) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(old) >= len(discardMagic) && bytes.Equal(old[:len(discardMagic)], discardMagic) {
+		return nil
+	}
+	// the files of older versions are never grown, so a file of another size has a corrupted header.
+	if int64(len(old)) != discardFileSize {
+		return ErrInvalidDiscard
+	}
+
+	var records []byte
+	for offset := 0; offset+discardRecordSize <= len(old); offset += discardRecordSize {
+		record := old[offset : offset+discardRecordSize]
+		fid := binary.LittleEndian.Uint32(record[:4])
+		total := binary.LittleEndian.Uint32(record[4:8])
+		if fid != 0 || total != 0 {
+			records = append(records, record...)
+		}
+	}
+
+	size := discardFileSize
+	for int64(discardHeaderSize+len(records)) > size {
+		size *= 2
+	}
+	buf := make([]byte, size)
+	copy(buf[:4], discardMagic)
+	binary.LittleEndian.PutUint32(buf[4:8], discardVersion)
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(len(records)/discardRecordSize))
+	copy(buf[discardHeaderSize:], records)
+
+	tmpName := fName + ".migrate"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, ioselector.FilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("migrate discard file %s, %d records", fName, len(records)/discardRecordSize)
+	return os.Rename(tmpName, fName)
+}
@@ -0,0 +1,144 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// discardedSize returns the discarded size of the log file fid recorded by d.
+func discardedSize(t *testing.T, d *discard, fid uint32) uint32 {
+	d.drain()
+	d.Lock()
+	defer d.Unlock()
+	buf := make([]byte, discardRecordSize)
+	if _, err := d.file.Read(buf, d.location[fid]); err != nil {
+		t.Fatalf("read discard record err: %v", err)
+	}
+	return binary.LittleEndian.Uint32(buf[8:12])
+}
+
+func TestBitcaskDB_RebuildDiscardsDuringUnlink(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("set")
+
+	for i := 0; i < 3*unlinkBatchSize; i++ {
+		_, err := db.SAdd(key, []byte("member"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+
+	// the key is unlinked, and the discard records are rebuilt before all the tombstones are written.
+	db.setIndex.mu.Lock()
+	dk, err := db.detachKey(key, Set)
+	assert.Nil(t, err)
+	db.unlinking[Set][dk] = struct{}{}
+	db.setIndex.mu.Unlock()
+	done, err := db.unlinkBatch(dk)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Nil(t, db.RebuildDiscards())
+	db.unlinkWg.Add(1)
+	db.unlinkInBackground(dk)
+	assert.Empty(t, db.unlinking[Set])
+
+	fid := db.activateLogFile[Set].Fid
+	got := discardedSize(t, db.discards[Set], fid)
+	// every update is sent once, so a rebuild now changes nothing.
+	assert.Nil(t, db.RebuildDiscards())
+	assert.Equal(t, discardedSize(t, db.discards[Set], fid), got)
+}
+
+func TestDiscard_Grow(t *testing.T) {
+	path := t.TempDir()
+	d, err := newDiscard(path, discardFileName, 16, time.Second)
+	assert.Nil(t, err)
+
+	// more records than the initial file can hold.
+	n := uint32(discardFileSize/discardRecordSize) * 2
+	for fid := uint32(0); fid < n; fid++ {
+		d.setTotal(fid, 1000)
+		d.incr(fid, int(fid%100)+1)
+	}
+	assert.True(t, d.file.Size() > discardFileSize)
+	for fid := uint32(0); fid < n; fid++ {
+		assert.Equal(t, fid%100+1, discardedSize(t, d, fid))
+	}
+	assert.Nil(t, d.close())
+
+	// the grown file is mapped as a whole when it is opened again.
+	d, err = newDiscard(path, discardFileName, 16, time.Second)
+	assert.Nil(t, err)
+	defer d.close()
+	assert.Equal(t, int64(n), d.count)
+	assert.Len(t, d.location, int(n))
+	assert.Empty(t, d.freeList)
+	for fid := uint32(0); fid < n; fid++ {
+		assert.Equal(t, fid%100+1, discardedSize(t, d, fid))
+	}
+}
+
+func TestDiscard_Migrate(t *testing.T) {
+	path := t.TempDir()
+	// the discard file of older versions has no header and a fixed size, the free records are zeros.
+	old := make([]byte, discardFileSize)
+	for i, record := range [][3]uint32{{1, 1000, 10}, {0, 0, 0}, {3, 2000, 20}, {0, 0, 5}} {
+		offset := i * discardRecordSize
+		binary.LittleEndian.PutUint32(old[offset:], record[0])
+		binary.LittleEndian.PutUint32(old[offset+4:], record[1])
+		binary.LittleEndian.PutUint32(old[offset+8:], record[2])
+	}
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(path, discardFileName), old, 0644))
+
+	d, err := newDiscard(path, discardFileName, 16, time.Second)
+	assert.Nil(t, err)
+	defer d.close()
+	assert.Equal(t, int64(2), d.count)
+	assert.Len(t, d.location, 2)
+	assert.Equal(t, uint32(10), discardedSize(t, d, 1))
+	assert.Equal(t, uint32(20), discardedSize(t, d, 3))
+	header := make([]byte, discardHeaderSize)
+	_, err = d.file.Read(header, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, discardMagic, header[:4])
+
+	// the records after the migrated ones are allocated.
+	d.setTotal(4, 3000)
+	assert.Equal(t, int64(3), d.count)
+	assert.Equal(t, int64(discardHeaderSize+2*discardRecordSize), d.location[4])
+}
+
+func TestDiscard_InvalidHeader(t *testing.T) {
+	path := t.TempDir()
+	d, err := newDiscard(path, discardFileName, 16, time.Second)
+	assert.Nil(t, err)
+	for fid := uint32(0); fid < uint32(discardFileSize/discardRecordSize)+1; fid++ {
+		d.setTotal(fid, 1000)
+	}
+	assert.Nil(t, d.close())
+	name := filepath.Join(path, discardFileName)
+	content, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		header []byte
+		err    error
+	}{
+		{"bad magic", []byte("BDSX"), ErrInvalidDiscard},
+		{"bad version", append(append([]byte{}, discardMagic...), 2, 0, 0, 0), ErrDiscardVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := append([]byte{}, content...)
+			copy(corrupted, tt.header)
+			assert.Nil(t, ioutil.WriteFile(name, corrupted, 0644))
+			_, err := newDiscard(path, discardFileName, 16, time.Second)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
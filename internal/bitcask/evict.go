@@ -0,0 +1,354 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/options"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// indexNodeOverhead is the estimated memory used by an index node besides its key and value.
+	indexNodeOverhead = 64
+
+	// defaultMaxMemorySamples is the default number of keys sampled to evict a key.
+	defaultMaxMemorySamples = 5
+	// evictionPoolSize is the max number of keys evicted after a round of sampling.
+	evictionPoolSize = 16
+
+	// the logarithmic access counter of LFU works in the same way as redis, a new key starts with lfuInitVal,
+	// the counter is incremented with a probability which decreases as it grows, and is decremented by one
+	// every lfuDecayTime milliseconds the key is not accessed.
+	lfuInitVal   = 5
+	lfuMaxVal    = 255
+	lfuLogFactor = 10
+	lfuDecayTime = 60 * 1000
+)
+
+// ErrOutOfMemory the memory limit is reached and no key can be evicted.
+var ErrOutOfMemory = errors.New("OOM command not allowed when used memory > 'maxmemory'")
+
+// evictor estimates the memory used by indexes, and evicts keys in background when the limit is reached.
+type evictor struct {
+	usedMemory  int64 // Estimated memory used by indexes in bytes, updated atomically.
+	evictedKeys int64 // Number of evicted keys, updated atomically.
+	failed      int32 // Set when there is no key to evict, writes are rejected until memory is freed.
+	notifyC     chan struct{}
+	closeC      chan struct{}
+	wg          *sync.WaitGroup
+}
+
+func newEvictor() *evictor {
+	return &evictor{
+		notifyC: make(chan struct{}, 1),
+		closeC:  make(chan struct{}),
+		wg:      new(sync.WaitGroup),
+	}
+}
+
+// touch records an access of the key, it can be called with the read lock of keyspace held.
+func (meta *keyMeta) touch() {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	freq := meta.lfu(now)
+	if freq < lfuMaxVal {
+		base := float64(0)
+		if freq > lfuInitVal {
+			base = float64(freq - lfuInitVal)
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			freq++
+		}
+	}
+	atomic.StoreUint32(&meta.freq, freq)
+	atomic.StoreInt64(&meta.access, now)
+}
+
+// lfu returns the access counter decayed by the time since the last access.
+func (meta *keyMeta) lfu(now int64) uint32 {
+	freq := atomic.LoadUint32(&meta.freq)
+	periods := (now - atomic.LoadInt64(&meta.access)) / lfuDecayTime
+	if periods >= int64(freq) {
+		return 0
+	}
+	return freq - uint32(periods)
+}
+
+// UsedMemory returns the estimated memory used by indexes in bytes.
+func (db *BitcaskDB) UsedMemory() int64 {
+	return atomic.LoadInt64(&db.evictor.usedMemory)
+}
+
+// EvictedKeys returns the number of keys evicted because of the memory limit.
+func (db *BitcaskDB) EvictedKeys() int64 {
+	return atomic.LoadInt64(&db.evictor.evictedKeys)
+}
+
+// checkMemory is called before writes, it returns ErrOutOfMemory if the memory limit is reached and no key can be
+// evicted. Keys are evicted in background, so the memory may exceed the limit for a short time.
+func (db *BitcaskDB) checkMemory() error {
+	if db.opts.MaxMemory <= 0 || db.UsedMemory() <= db.opts.MaxMemory {
+		return nil
+	}
+	if db.opts.EvictionPolicy == options.NoEviction {
+		return ErrOutOfMemory
+	}
+
+	select {
+	case db.evictor.notifyC <- struct{}{}:
+	default:
+	}
+	if atomic.LoadInt32(&db.evictor.failed) == 1 {
+		return ErrOutOfMemory
+	}
+	return nil
+}
+
+// trackMemory updates the used memory after the node of key is changed from removed to added, either can be nil.
+func (db *BitcaskDB) trackMemory(key []byte, added, removed interface{}) {
+	var delta int64
+	if node, _ := added.(*indexNode); node != nil {
+		delta += db.nodeMemory(key, node)
+	}
+	if node, _ := removed.(*indexNode); node != nil {
+		delta -= db.nodeMemory(key, node)
+	}
+	if delta != 0 {
+		atomic.AddInt64(&db.evictor.usedMemory, delta)
+	}
+}
+
+// releaseTreeMemory updates the used memory after idxTree is removed from the index.
+func (db *BitcaskDB) releaseTreeMemory(idxTree *art.AdaptiveRadixTree) {
+	atomic.AddInt64(&db.evictor.usedMemory, -db.treeMemory(idxTree))
+}
+
+// indexMemory returns the memory used by all the indexes, it is called after the indexes are loaded.
+func (db *BitcaskDB) indexMemory() int64 {
+	size := db.treeMemory(db.strIndex.idxTree)
+	for _, trees := range []map[string]*art.AdaptiveRadixTree{
+		db.listIndex.trees, db.hashIndex.trees, db.setIndex.trees, db.zsetIndex.trees,
+	} {
+		for _, idxTree := range trees {
+			size += db.treeMemory(idxTree)
+		}
+	}
+	return size
+}
+
+func (db *BitcaskDB) treeMemory(idxTree *art.AdaptiveRadixTree) int64 {
+	var size int64
+	iter := idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			break
+		}
+		if idxNode, _ := node.Value().(*indexNode); idxNode != nil {
+			size += db.nodeMemory(node.Key(), idxNode)
+		}
+	}
+	return size
+}
+
+// nodeMemory returns the memory used by the node of key, the value is only counted in KeyValueMemMode,
+// otherwise it stays in the log files.
+func (db *BitcaskDB) nodeMemory(key []byte, node *indexNode) int64 {
+	size := int64(len(key)) + indexNodeOverhead
+	if db.opts.IndexMode == options.KeyValueMemMode {
+		size += int64(len(node.value))
+	}
+	return size
+}
+
+// handleEviction evicts keys when it is notified by writes, until db is closed.
+func (db *BitcaskDB) handleEviction() {
+	defer db.evictor.wg.Done()
+	for {
+		select {
+		case <-db.evictor.closeC:
+			return
+		case <-db.evictor.notifyC:
+			if err := db.evict(); err != nil {
+				log.Errorf("evict keys err: %v", err)
+			}
+		}
+	}
+}
+
+// closeEvictor stops the eviction goroutine and waits for it.
+func (db *BitcaskDB) closeEvictor() {
+	select {
+	case <-db.evictor.closeC:
+	default:
+		close(db.evictor.closeC)
+	}
+	db.evictor.wg.Wait()
+}
+
+// evict removes keys chosen by the eviction policy until the used memory is under the limit.
+// The tombstones of the evicted keys are written, so they are not loaded again after restart.
+func (db *BitcaskDB) evict() error {
+	ev := db.evictor
+	var visited int
+	for db.UsedMemory() > db.opts.MaxMemory {
+		candidates, n, total := db.sampleKeys()
+		visited += n
+		// as many keys as the keyspace holds are sampled and none of them can be evicted.
+		if len(candidates) == 0 && visited >= total {
+			atomic.StoreInt32(&ev.failed, 1)
+			return nil
+		}
+
+		for _, c := range candidates {
+			select {
+			case <-ev.closeC:
+				return nil
+			default:
+			}
+			if db.UsedMemory() <= db.opts.MaxMemory {
+				break
+			}
+
+			var removed bool
+			var err error
+			if c.expired {
+				removed, err = db.removeExpired(c.key)
+			} else {
+				removed, err = db.removeKey(context.Background(), c.key, false)
+			}
+			if err != nil {
+				return err
+			}
+			if removed {
+				visited = 0
+				if !c.expired {
+					atomic.AddInt64(&ev.evictedKeys, 1)
+				}
+			}
+		}
+	}
+	atomic.StoreInt32(&ev.failed, 0)
+	return nil
+}
+
+// evictionCandidate is a key which can be evicted.
+type evictionCandidate struct {
+	key     []byte
+	score   int64
+	expired bool
+}
+
+// sampleKeys visits MaxMemorySamples*evictionPoolSize keys of the keyspace, in MaxMemorySamples walks starting
+// from random positions of the tree, and returns the best evictionPoolSize keys to evict in the order of priority,
+// it is similar to the eviction pool of redis. All the keys are visited if there are not more of them.
+// It also returns the number of keys visited and the total number of keys.
+func (db *BitcaskDB) sampleKeys() ([]evictionCandidate, int, int) {
+	ks := db.keyspace
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	samples := db.opts.MaxMemorySamples
+	if samples <= 0 {
+		samples = defaultMaxMemorySamples
+	}
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	var candidates []evictionCandidate
+	visited := make(map[string]struct{})
+	visit := func(key []byte, value interface{}) {
+		if _, ok := visited[string(key)]; ok {
+			return
+		}
+		visited[string(key)] = struct{}{}
+		meta, _ := value.(*keyMeta)
+		if meta == nil {
+			return
+		}
+		score, expired := db.evictionScore(meta, nowMs)
+		if score >= 0 {
+			candidates = append(candidates, evictionCandidate{key: append([]byte(nil), key...), score: score, expired: expired})
+		}
+	}
+
+	total := ks.idxTree.Size()
+	if total <= samples*evictionPoolSize {
+		ks.idxTree.ForEachAfter(nil, func(key []byte, value interface{}) bool {
+			visit(key, value)
+			return true
+		})
+	} else {
+		for i := 0; i < samples; i++ {
+			start := ks.idxTree.RandomKey()
+			visit(start, ks.idxTree.Get(start))
+			// the walk goes on from the first key if the end of the keyspace is reached.
+			walked := 1
+			walk := func(key []byte, value interface{}) bool {
+				visit(key, value)
+				walked++
+				return walked < evictionPoolSize
+			}
+			ks.idxTree.ForEachAfter(start, walk)
+			if walked < evictionPoolSize {
+				ks.idxTree.ForEachAfter(nil, walk)
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > evictionPoolSize {
+		candidates = candidates[:evictionPoolSize]
+	}
+	return candidates, len(visited), total
+}
+
+// evictionScore returns the priority of meta to be evicted, a higher score is evicted first,
+// and a negative score means it can not be evicted by the policy.
+func (db *BitcaskDB) evictionScore(meta *keyMeta, nowMs int64) (int64, bool) {
+	if meta.expiredAt != 0 && meta.expiredAt <= nowMs {
+		return math.MaxInt64, true
+	}
+
+	switch db.opts.EvictionPolicy {
+	case options.AllKeysLRU:
+		return nowMs - atomic.LoadInt64(&meta.access), false
+	case options.AllKeysLFU:
+		return int64(lfuMaxVal - meta.lfu(nowMs)), false
+	case options.VolatileLRU:
+		if meta.expiredAt == 0 {
+			return -1, false
+		}
+		return nowMs - atomic.LoadInt64(&meta.access), false
+	case options.VolatileTTL:
+		if meta.expiredAt == 0 {
+			return -1, false
+		}
+		return math.MaxInt64 - 1 - meta.expiredAt, false
+	}
+	return -1, false
+}
+
+// removeExpired removes key if it holds an expired string.
+func (db *BitcaskDB) removeExpired(key []byte) (bool, error) {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	db.keyspace.mu.RLock()
+	meta, _ := db.keyspace.idxTree.Get(key).(*keyMeta)
+	expired := meta != nil && meta.dataType == String && meta.expiredAt != 0 && meta.expiredAt <= time.Now().UnixMilli()
+	db.keyspace.mu.RUnlock()
+	if !expired {
+		return false, nil
+	}
+
+	_, err := db.detachKey(key, String)
+	return err == nil, err
+}
@@ -0,0 +1,71 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_UsedMemoryKeyOnly(t *testing.T) {
+	value := make([]byte, 1024)
+	for _, mode := range []options.DataIndexMode{options.KeyValueMemMode, options.KeyOnlyMemMode} {
+		opts := options.DefaultOptions(t.TempDir())
+		opts.IndexMode = mode
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		assert.Nil(t, db.Set([]byte("k"), value))
+		assert.Nil(t, db.HSet([]byte("h"), []byte("f"), value))
+		used := db.UsedMemory()
+		if mode == options.KeyValueMemMode {
+			assert.True(t, used > int64(len(value))*2)
+		} else {
+			assert.True(t, used < int64(len(value)))
+		}
+
+		// the memory is counted in the same way when the indexes are loaded.
+		assert.Nil(t, db.Close())
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, used, db.UsedMemory())
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestBitcaskDB_EvictSampleKeys(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.MaxMemory = 1 << 20
+	opts.EvictionPolicy = options.AllKeysLRU
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	// more keys than a round of sampling visits.
+	n := defaultMaxMemorySamples * evictionPoolSize * 4
+	for i := 0; i < n; i++ {
+		assert.Nil(t, db.Set([]byte("key-"+strconv.Itoa(i)), []byte(strconv.Itoa(i))))
+	}
+	seen := map[string]int{}
+	for i := 0; i < 20; i++ {
+		candidates, visited, total := db.sampleKeys()
+		assert.Equal(t, n, total)
+		assert.True(t, visited > evictionPoolSize && visited <= defaultMaxMemorySamples*evictionPoolSize)
+		assert.Len(t, candidates, evictionPoolSize)
+		for _, c := range candidates {
+			seen[string(c.key)]++
+		}
+	}
+	// the samples start from random positions instead of going through the keyspace from the first key.
+	assert.True(t, len(seen) > evictionPoolSize*2)
+
+	limit := db.UsedMemory() / 2
+	db.opts.MaxMemory = limit
+	assert.Nil(t, db.Set([]byte("last"), []byte("v")))
+	assert.Eventually(t, func() bool {
+		return db.UsedMemory() <= limit
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, db.EvictedKeys() > 0)
+}
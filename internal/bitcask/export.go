@@ -0,0 +1,566 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/util"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// ExportFormat the encoding used by Export.
+type ExportFormat int8
+
+const (
+	// ExportJSONLines writes one JSON object per line, keys and values are base64 encoded.
+	ExportJSONLines ExportFormat = iota
+
+	// ExportBinary writes a compact length-prefixed binary dump.
+	ExportBinary
+)
+
+// exportBatch is the number of strings, or fields and members of a hash or set, read under a lock by Export.
+const exportBatch = 100
+
+const (
+	dumpMagic      = "BCDUMP"
+	dumpVersion    = 2 // version 1 has no expireAt of hash fields.
+	dumpRecordEOF  = 0xFF
+	dumpTypeString = "string"
+	dumpTypeList   = "list"
+	dumpTypeHash   = "hash"
+	dumpTypeSet    = "set"
+	dumpTypeZSet   = "zset"
+)
+
+var (
+	// ErrUnknownExportFormat the export format is not supported.
+	ErrUnknownExportFormat = errors.New("unknown export format")
+
+	// ErrInvalidDumpRecord a record in the dump can not be decoded.
+	ErrInvalidDumpRecord = errors.New("invalid dump record")
+)
+
+// dumpRecord is a single logical record of an export.
+// Collections are flattened into one record per element, so the importer never has to hold a whole key in memory.
+type dumpRecord struct {
+	Type     string `json:"type"`
+	Key      []byte `json:"key"`
+	Field    []byte `json:"field,omitempty"`
+	Member   []byte `json:"member,omitempty"`
+	Value    []byte `json:"value,omitempty"`
+	Score    string `json:"score,omitempty"`
+	ExpireAt int64  `json:"expire_at,omitempty"` // unix milliseconds
+}
+
+type dumpWriter interface {
+	write(rec *dumpRecord) error
+	flush() error
+}
+
+// Export writes every string (with its ttl), list (in order), hash (with the ttl of fields), set and sorted set to w.
+// The indexes are read locked for a batch of strings, or fields and members of a hash or set at a time, and for a
+// whole list or sorted set, so writes are not blocked until the export is finished.
+// Every list and sorted set is a consistent view, but the keys written during the export may or may not be exported.
+func (db *BitcaskDB) Export(w io.Writer, format ExportFormat) error {
+	var dw dumpWriter
+	switch format {
+	case ExportJSONLines:
+		dw = newJSONDumpWriter(w)
+	case ExportBinary:
+		bw, err := newBinaryDumpWriter(w)
+		if err != nil {
+			return err
+		}
+		dw = bw
+	default:
+		return ErrUnknownExportFormat
+	}
+
+	exporters := []func(dumpWriter) error{
+		db.exportStrs, db.exportList, db.exportHash, db.exportSet, db.exportZSet,
+	}
+	for _, export := range exporters {
+		if err := export(dw); err != nil {
+			return err
+		}
+	}
+	return dw.flush()
+}
+
+func (db *BitcaskDB) exportStrs(dw dumpWriter) error {
+	return exportBatches(dw, db.strIndex.mu, func(cursor []byte) ([]byte, []*dumpRecord, error) {
+		var recs []*dumpRecord
+		next, err := scanTree(db.strIndex.idxTree, cursor, exportBatch, func(key []byte, value interface{}) error {
+			idxNode, _ := value.(*indexNode)
+			if idxNode == nil {
+				return nil
+			}
+			val, err := db.getVal(db.strIndex.idxTree, key, String)
+			if err == ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			recs = append(recs, &dumpRecord{Type: dumpTypeString, Key: key, Value: val, ExpireAt: idxNode.expiredAt})
+			return nil
+		})
+		return next, recs, err
+	})
+}
+
+func (db *BitcaskDB) exportList(dw dumpWriter) error {
+	for _, key := range db.collectionKeys(List) {
+		err := exportBatches(dw, db.listIndex.mu, func([]byte) ([]byte, []*dumpRecord, error) {
+			idxTree := db.listIndex.trees[key]
+			if idxTree == nil {
+				return nil, nil, nil
+			}
+			headSeq, tailSeq, err := db.ListMeta(idxTree, []byte(key))
+			if err != nil {
+				return nil, nil, err
+			}
+			var recs []*dumpRecord
+			for _, seq := range db.listSeqs(idxTree, []byte(key), headSeq, tailSeq, 0, db.listLen(idxTree, []byte(key))-1) {
+				val, err := db.getVal(idxTree, db.encodeListKey([]byte(key), seq), List)
+				if err != nil {
+					return nil, nil, err
+				}
+				recs = append(recs, &dumpRecord{Type: dumpTypeList, Key: []byte(key), Value: val})
+			}
+			return nil, recs, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BitcaskDB) exportHash(dw dumpWriter) error {
+	for _, key := range db.collectionKeys(Hash) {
+		err := exportBatches(dw, db.hashIndex.mu, func(cursor []byte) ([]byte, []*dumpRecord, error) {
+			idxTree := db.hashIndex.trees[key]
+			if idxTree == nil {
+				return nil, nil, nil
+			}
+			var recs []*dumpRecord
+			next, err := scanTree(idxTree, cursor, exportBatch, func(encKey []byte, _ interface{}) error {
+				val, err := db.getVal(idxTree, encKey, Hash)
+				if err == ErrKeyNotFound {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				_, field := db.decodeKey(encKey)
+				rec := &dumpRecord{Type: dumpTypeHash, Key: []byte(key), Field: field, Value: val}
+				rec.ExpireAt = db.hFieldExpiredAt(idxTree, encKey)
+				recs = append(recs, rec)
+				return nil
+			})
+			return next, recs, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BitcaskDB) exportSet(dw dumpWriter) error {
+	for _, key := range db.collectionKeys(Set) {
+		err := exportBatches(dw, db.setIndex.mu, func(cursor []byte) ([]byte, []*dumpRecord, error) {
+			idxTree := db.setIndex.trees[key]
+			if idxTree == nil {
+				return nil, nil, nil
+			}
+			var recs []*dumpRecord
+			next, err := scanTree(idxTree, cursor, exportBatch, func(mkey []byte, _ interface{}) error {
+				recs = append(recs, &dumpRecord{Type: dumpTypeSet, Key: []byte(key), Member: memberOf(mkey)})
+				return nil
+			})
+			return next, recs, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *BitcaskDB) exportZSet(dw dumpWriter) error {
+	for _, key := range db.collectionKeys(ZSet) {
+		err := exportBatches(dw, db.zsetIndex.mu, func([]byte) ([]byte, []*dumpRecord, error) {
+			if db.zsetIndex.trees[key] == nil {
+				return nil, nil, nil
+			}
+			entries, err := db.zEntries(context.Background(), []byte(key))
+			if err != nil {
+				return nil, nil, err
+			}
+			recs := make([]*dumpRecord, 0, len(entries))
+			for _, e := range entries {
+				rec := &dumpRecord{Type: dumpTypeZSet, Key: []byte(key), Member: e.Member, Score: util.Float64ToStr(e.Score)}
+				recs = append(recs, rec)
+			}
+			return nil, recs, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportBatches writes the records read by batch until it returns a nil cursor, the cursor returned is passed to
+// the next call. mu is read locked only while a batch is read, so writes can go on while the records are written.
+func exportBatches(dw dumpWriter, mu *rwMutex, batch func(cursor []byte) ([]byte, []*dumpRecord, error)) error {
+	var cursor []byte
+	for {
+		mu.RLock()
+		next, recs, err := batch(cursor)
+		mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if err = dw.write(rec); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// collectionKeys returns the keys of the lists, hashes, sets or sorted sets.
+func (db *BitcaskDB) collectionKeys(dataType DataType) []string {
+	mu := db.indexLock(dataType)
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var trees map[string]*art.AdaptiveRadixTree
+	switch dataType {
+	case List:
+		trees = db.listIndex.trees
+	case Hash:
+		trees = db.hashIndex.trees
+	case Set:
+		trees = db.setIndex.trees
+	case ZSet:
+		trees = db.zsetIndex.trees
+	}
+	keys := make([]string, 0, len(trees))
+	for key := range trees {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// iterateTree calls fn with every alive key and value in idxTree, expired and missing values are skipped.
+func (db *BitcaskDB) iterateTree(idxTree *art.AdaptiveRadixTree, dataType DataType, fn func(key, val []byte) error) error {
+	iter := idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		val, err := db.getVal(idxTree, node.Key(), dataType)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(node.Key(), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import loads the records written by Export into db, the format is detected automatically.
+// Lists are appended to the tail of existing lists, other records overwrite the existing ones.
+// It returns the number of records imported.
+func (db *BitcaskDB) Import(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(dumpMagic))
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	next := newJSONDumpReader(br)
+	if bytes.Equal(head, []byte(dumpMagic)) {
+		if next, err = newBinaryDumpReader(br); err != nil {
+			return 0, err
+		}
+	}
+
+	var count int
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if err = db.importRecord(rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+func (db *BitcaskDB) importRecord(rec *dumpRecord) error {
+	switch rec.Type {
+	case dumpTypeString:
+		if rec.ExpireAt == 0 {
+			return db.Set(rec.Key, rec.Value)
+		}
+		ttl := time.Until(time.UnixMilli(rec.ExpireAt))
+		if ttl <= 0 {
+			return nil
+		}
+		return db.SetEX(rec.Key, rec.Value, ttl)
+	case dumpTypeList:
+		return db.RPush(rec.Key, rec.Value)
+	case dumpTypeHash:
+		if rec.ExpireAt == 0 {
+			return db.HSet(rec.Key, rec.Field, rec.Value)
+		}
+		expiredAt := time.UnixMilli(rec.ExpireAt)
+		if !expiredAt.After(time.Now()) {
+			return nil
+		}
+		if err := db.HSet(rec.Key, rec.Field, rec.Value); err != nil {
+			return err
+		}
+		_, err := db.HExpireAt(rec.Key, expiredAt, ExpireAlways, rec.Field)
+		return err
+	case dumpTypeSet:
+		_, err := db.SAdd(rec.Key, rec.Member)
+		return err
+	case dumpTypeZSet:
+		score, err := util.StrToFloat64(rec.Score)
+		if err != nil {
+			return ErrInvalidDumpRecord
+		}
+		return db.ZAdd(rec.Key, score, rec.Member)
+	}
+	return ErrInvalidDumpRecord
+}
+
+// +-------+--------+----------+------------+-----------+-------+---------+
+// |---------------------------- JSON Lines -------------------------------|
+// +-------+--------+----------+------------+-----------+-------+---------+
+type jsonDumpWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONDumpWriter(w io.Writer) *jsonDumpWriter {
+	bw := bufio.NewWriter(w)
+	return &jsonDumpWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (jw *jsonDumpWriter) write(rec *dumpRecord) error {
+	// Encode appends a newline after every record.
+	return jw.enc.Encode(rec)
+}
+
+func (jw *jsonDumpWriter) flush() error {
+	return jw.w.Flush()
+}
+
+func newJSONDumpReader(r io.Reader) func() (*dumpRecord, error) {
+	dec := json.NewDecoder(r)
+	return func() (*dumpRecord, error) {
+		rec := new(dumpRecord)
+		if err := dec.Decode(rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	}
+}
+
+// +-------+--------+----------+------------+-----------+-------+---------+
+// |------------------------------ Binary ---------------------------------|
+// +-------+--------+----------+------------+-----------+-------+---------+
+// The binary dump starts with magic "BCDUMP" and a version byte, then the records follow.
+// Each record is a type byte and uvarint length-prefixed fields:
+// string: key | value | expireAt(varint)
+// list:   key | value
+// hash:   key | field | value | expireAt(varint)
+// set:    key | member
+// zset:   key | member | score(8 bytes, little endian float64 bits)
+// A single 0xFF byte marks the end of the dump.
+type binaryDumpWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+var dumpTypeCodes = map[string]byte{
+	dumpTypeString: byte(String),
+	dumpTypeList:   byte(List),
+	dumpTypeHash:   byte(Hash),
+	dumpTypeSet:    byte(Set),
+	dumpTypeZSet:   byte(ZSet),
+}
+
+func newBinaryDumpWriter(w io.Writer) (*binaryDumpWriter, error) {
+	bw := &binaryDumpWriter{w: bufio.NewWriter(w), buf: make([]byte, binary.MaxVarintLen64)}
+	if _, err := bw.w.WriteString(dumpMagic); err != nil {
+		return nil, err
+	}
+	if err := bw.w.WriteByte(dumpVersion); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+func (bw *binaryDumpWriter) write(rec *dumpRecord) error {
+	typ, ok := dumpTypeCodes[rec.Type]
+	if !ok {
+		return ErrInvalidDumpRecord
+	}
+	if err := bw.w.WriteByte(typ); err != nil {
+		return err
+	}
+
+	var fields [][]byte
+	switch DataType(typ) {
+	case String, List:
+		fields = [][]byte{rec.Key, rec.Value}
+	case Hash:
+		fields = [][]byte{rec.Key, rec.Field, rec.Value}
+	case Set, ZSet:
+		fields = [][]byte{rec.Key, rec.Member}
+	}
+	for _, field := range fields {
+		n := binary.PutUvarint(bw.buf, uint64(len(field)))
+		if _, err := bw.w.Write(bw.buf[:n]); err != nil {
+			return err
+		}
+		if _, err := bw.w.Write(field); err != nil {
+			return err
+		}
+	}
+
+	switch DataType(typ) {
+	case String, Hash:
+		n := binary.PutVarint(bw.buf, rec.ExpireAt)
+		_, err := bw.w.Write(bw.buf[:n])
+		return err
+	case ZSet:
+		score, err := util.StrToFloat64(rec.Score)
+		if err != nil {
+			return ErrInvalidDumpRecord
+		}
+		binary.LittleEndian.PutUint64(bw.buf[:8], math.Float64bits(score))
+		_, err = bw.w.Write(bw.buf[:8])
+		return err
+	}
+	return nil
+}
+
+func (bw *binaryDumpWriter) flush() error {
+	if err := bw.w.WriteByte(dumpRecordEOF); err != nil {
+		return err
+	}
+	return bw.w.Flush()
+}
+
+func newBinaryDumpReader(br *bufio.Reader) (func() (*dumpRecord, error), error) {
+	header := make([]byte, len(dumpMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	version := header[len(dumpMagic)]
+	if version == 0 || version > dumpVersion {
+		return nil, ErrUnknownExportFormat
+	}
+
+	readField := func() ([]byte, error) {
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, ErrInvalidDumpRecord
+		}
+		buf := make([]byte, size)
+		if _, err = io.ReadFull(br, buf); err != nil {
+			return nil, ErrInvalidDumpRecord
+		}
+		return buf, nil
+	}
+
+	return func() (*dumpRecord, error) {
+		typ, err := br.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidDumpRecord
+		}
+		if typ == dumpRecordEOF {
+			return nil, io.EOF
+		}
+
+		var numFields int
+		rec := new(dumpRecord)
+		switch DataType(typ) {
+		case String:
+			rec.Type, numFields = dumpTypeString, 2
+		case List:
+			rec.Type, numFields = dumpTypeList, 2
+		case Hash:
+			rec.Type, numFields = dumpTypeHash, 3
+		case Set:
+			rec.Type, numFields = dumpTypeSet, 2
+		case ZSet:
+			rec.Type, numFields = dumpTypeZSet, 2
+		default:
+			return nil, ErrInvalidDumpRecord
+		}
+
+		fields := make([][]byte, numFields)
+		for i := range fields {
+			if fields[i], err = readField(); err != nil {
+				return nil, err
+			}
+		}
+		rec.Key = fields[0]
+		switch DataType(typ) {
+		case String:
+			rec.Value = fields[1]
+			if rec.ExpireAt, err = binary.ReadVarint(br); err != nil {
+				return nil, ErrInvalidDumpRecord
+			}
+		case List:
+			rec.Value = fields[1]
+		case Hash:
+			rec.Field, rec.Value = fields[1], fields[2]
+			if version >= 2 {
+				if rec.ExpireAt, err = binary.ReadVarint(br); err != nil {
+					return nil, ErrInvalidDumpRecord
+				}
+			}
+		case Set:
+			rec.Member = fields[1]
+		case ZSet:
+			rec.Member = fields[1]
+			scoreBuf := make([]byte, 8)
+			if _, err = io.ReadFull(br, scoreBuf); err != nil {
+				return nil, ErrInvalidDumpRecord
+			}
+			rec.Score = util.Float64ToStr(math.Float64frombits(binary.LittleEndian.Uint64(scoreBuf)))
+		}
+		return rec, nil
+	}, nil
+}
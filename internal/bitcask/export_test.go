@@ -0,0 +1,84 @@
+package bitcask
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_ExportImport(t *testing.T) {
+	db := openTestDB(t)
+	// more than a batch of strings and fields.
+	n := exportBatch*2 + 10
+	for i := 0; i < n; i++ {
+		assert.Nil(t, db.Set([]byte("s"+strconv.Itoa(i)), []byte(strconv.Itoa(i))))
+		assert.Nil(t, db.HSet([]byte("h"), []byte("f"+strconv.Itoa(i)), []byte(strconv.Itoa(i))))
+		_, err := db.SAdd([]byte("set"), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.SetEX([]byte("ttl"), []byte("v"), time.Hour))
+	assert.Nil(t, db.RPush([]byte("l"), []byte("a"), []byte("b"), []byte("c")))
+	assert.Nil(t, db.ZAdd([]byte("z"), 1.5, []byte("m")))
+
+	for _, format := range []ExportFormat{ExportJSONLines, ExportBinary} {
+		var buf bytes.Buffer
+		assert.Nil(t, db.Export(&buf, format))
+
+		other := openTestDB(t)
+		count, err := other.Import(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, n*3+5, count)
+
+		for _, i := range []int{0, exportBatch, n - 1} {
+			val, err := other.Get([]byte("s" + strconv.Itoa(i)))
+			assert.Nil(t, err)
+			assert.Equal(t, strconv.Itoa(i), string(val))
+			val, err = other.HGet([]byte("h"), []byte("f"+strconv.Itoa(i)))
+			assert.Nil(t, err)
+			assert.Equal(t, strconv.Itoa(i), string(val))
+		}
+		assert.Equal(t, n, other.HLen([]byte("h")))
+		members, err := other.SMembers([]byte("set"))
+		assert.Nil(t, err)
+		assert.Len(t, members, n)
+		ttl, err := other.TTL([]byte("ttl"))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 0)
+		assert.Equal(t, []string{"a", "b", "c"}, listStrings(t, other, []byte("l")))
+		ok, score, err := other.ZScore([]byte("z"), []byte("m"))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 1.5, score)
+	}
+}
+
+// blockingWriter writes to the db whenever the export writes to it.
+type blockingWriter struct {
+	t  *testing.T
+	db *BitcaskDB
+}
+
+func (bw *blockingWriter) Write(p []byte) (int, error) {
+	done := make(chan error)
+	go func() {
+		done <- bw.db.Set([]byte("during"), []byte("export"))
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(bw.t, err)
+	case <-time.After(time.Second):
+		bw.t.Fatal("the write is blocked by the export")
+	}
+	return len(p), nil
+}
+
+func TestBitcaskDB_ExportNotBlockWrites(t *testing.T) {
+	db := openTestDB(t)
+	for i := 0; i < exportBatch*2; i++ {
+		assert.Nil(t, db.Set([]byte("s"+strconv.Itoa(i)), make([]byte, 128)))
+	}
+	assert.Nil(t, db.Export(&blockingWriter{t: t, db: db}, ExportBinary))
+}
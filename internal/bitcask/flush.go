@@ -0,0 +1,206 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/ds/zset"
+	"bitcaskDB/internal/ioselector"
+	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/logfile"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// flushMarkerName is the file recording an unfinished Flush, it holds the first fid of every type kept by the flush.
+// The log files before them are removed in background, and again when db is opened if the process crashes first,
+// so a crash in the middle of a flush never brings back part of the flushed keys.
+const flushMarkerName = "FLUSH"
+
+// Flush removes all the keys of all types.
+// It is atomic on disk: new empty active log files are opened first, then the flush marker is written, which is
+// the point the flush takes effect. The indexes are replaced by empty ones while all the index locks are held,
+// so readers see either all the keys or nothing, and the old log files are removed in background.
+func (db *BitcaskDB) Flush() error {
+	// the background unlink and gc read and write log files, wait for them.
+	db.unlinkWg.Wait()
+	db.gcMu.Lock()
+	defer db.gcMu.Unlock()
+	// the last flush removes its marker once its files are removed.
+	db.flushWg.Wait()
+
+	unlock := lockTypes([]typeLock{{db, String}, {db, List}, {db, Hash}, {db, Set}, {db, ZSet}})
+	defer unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// the new active files are empty, they are harmless if the flush fails before the marker is written.
+	nextFids := make([]uint32, LogFileTypeNum)
+	active := make(map[DataType]*logfile.LogFile)
+	var flushed []*logfile.LogFile
+	for dataType := String; dataType < LogFileTypeNum; dataType++ {
+		files := db.logFiles(dataType)
+		if len(files) == 0 {
+			continue
+		}
+		nextFid := uint32(logfile.InitialLogFileId)
+		for _, lf := range files {
+			if lf.Fid >= nextFid {
+				nextFid = lf.Fid + 1
+			}
+		}
+		lf, err := logfile.GetLogFile(db.opts.DBPath, logfile.FileType(dataType), nextFid, db.opts.LogFileSizeThreshold, db.opts.IoType, db.opts.Checksum)
+		if err != nil {
+			return err
+		}
+		nextFids[dataType], active[dataType] = nextFid, lf
+		flushed = append(flushed, files...)
+	}
+	if len(flushed) == 0 {
+		return nil
+	}
+	if err := db.writeFlushMarker(nextFids); err != nil {
+		for _, lf := range active {
+			_ = lf.Delete()
+		}
+		return err
+	}
+
+	for dataType, lf := range active {
+		db.archivedLogFile[dataType] = make(archivedFiles)
+		db.activateLogFile[dataType] = lf
+		// the pending discard updates of the flushed files are told apart by their fids and ignored.
+		if err := db.discards[dataType].reset(lf.Fid); err != nil {
+			log.Errorf("reset discard of type %d err: %v", dataType, err)
+		}
+		db.discards[dataType].setTotal(lf.Fid, uint32(db.opts.LogFileSizeThreshold))
+	}
+
+	db.strIndex.idxTree = art.NewART()
+	db.listIndex.trees = make(map[string]*art.AdaptiveRadixTree)
+	db.hashIndex.trees = make(map[string]*art.AdaptiveRadixTree)
+	db.hashIndex.volatile = make(map[string]int)
+	db.hashIndex.expires = newFieldExpires()
+	db.setIndex.trees = make(map[string]*art.AdaptiveRadixTree)
+	db.zsetIndex.trees = make(map[string]*art.AdaptiveRadixTree)
+	db.zsetIndex.indexes = zset.New()
+	db.keyspace.reset()
+	atomic.StoreInt64(&db.evictor.usedMemory, 0)
+
+	db.flushWg.Add(1)
+	go db.removeFlushedFiles(flushed)
+	return nil
+}
+
+// logFiles returns the archived and active log files of dataType, the lock of db must be held.
+func (db *BitcaskDB) logFiles(dataType DataType) []*logfile.LogFile {
+	var files []*logfile.LogFile
+	for _, lf := range db.archivedLogFile[dataType] {
+		files = append(files, lf)
+	}
+	if lf := db.activateLogFile[dataType]; lf != nil {
+		files = append(files, lf)
+	}
+	return files
+}
+
+// removeFlushedFiles removes the log files flushed by Flush, then the flush marker.
+func (db *BitcaskDB) removeFlushedFiles(files []*logfile.LogFile) {
+	defer db.flushWg.Done()
+	for _, lf := range files {
+		if err := lf.Delete(); err != nil {
+			log.Errorf("remove flushed log file %d err: %v", lf.Fid, err)
+			// the marker is kept, so the file is removed when db is opened.
+			return
+		}
+	}
+	if err := os.Remove(filepath.Join(db.opts.DBPath, flushMarkerName)); err != nil {
+		log.Errorf("remove flush marker err: %v", err)
+	}
+}
+
+// writeFlushMarker writes the first fid of every type kept by the flush to the flush marker.
+// It is written to a temporary file and renamed, so the marker is either complete or missing.
+func (db *BitcaskDB) writeFlushMarker(nextFids []uint32) error {
+	buf := make([]byte, 4*len(nextFids))
+	for i, fid := range nextFids {
+		binary.LittleEndian.PutUint32(buf[i*4:], fid)
+	}
+
+	name := filepath.Join(db.opts.DBPath, flushMarkerName)
+	tmpName := name + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, ioselector.FilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpName, name); err != nil {
+		return err
+	}
+	return syncDir(db.opts.DBPath)
+}
+
+// finishFlush removes the log files left by a flush which was interrupted by a crash, it is called when db is
+// opened, before the log files are loaded.
+func (db *BitcaskDB) finishFlush() error {
+	name := filepath.Join(db.opts.DBPath, flushMarkerName)
+	buf, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	nextFids := make(map[DataType]uint32)
+	for i := 0; i+4 <= len(buf) && i/4 < LogFileTypeNum; i += 4 {
+		nextFids[DataType(i/4)] = binary.LittleEndian.Uint32(buf[i:])
+	}
+
+	fileInfos, err := ioutil.ReadDir(db.opts.DBPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range fileInfos {
+		// the file name format is log.strs.[id]
+		if !strings.HasPrefix(file.Name(), logfile.FilePrefix) {
+			continue
+		}
+		splitNames := strings.Split(file.Name(), ".")
+		fid, err := strconv.Atoi(splitNames[2])
+		if err != nil {
+			return err
+		}
+		typ := DataType(logfile.FileTypesMap[splitNames[1]])
+		if uint32(fid) < nextFids[typ] {
+			log.Infof("remove flushed log file %s", file.Name())
+			if err := os.Remove(filepath.Join(db.opts.DBPath, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(name)
+}
+
+// syncDir makes the renames and removes of the files in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
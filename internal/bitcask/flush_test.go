@@ -0,0 +1,69 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_Flush(t *testing.T) {
+	path := t.TempDir()
+	db, err := Open(options.DefaultOptions(path))
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Set([]byte("k1"), []byte("v1")))
+	assert.Nil(t, db.RPush([]byte("l"), []byte("a")))
+	assert.Nil(t, db.Flush())
+	_, err = db.Get([]byte("k1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 0, listLen(t, db, []byte("l")))
+
+	assert.Nil(t, db.Set([]byte("k2"), []byte("v2")))
+	assert.Nil(t, db.Close())
+	_, err = os.Stat(filepath.Join(path, flushMarkerName))
+	assert.True(t, os.IsNotExist(err))
+
+	db, err = Open(options.DefaultOptions(path))
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.Get([]byte("k1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.Get([]byte("k2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(val))
+}
+
+func TestBitcaskDB_FlushInterrupted(t *testing.T) {
+	path := t.TempDir()
+	db, err := Open(options.DefaultOptions(path))
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Set([]byte("k1"), []byte("v1")))
+	assert.Nil(t, db.Set([]byte("k2"), []byte("v2")))
+	assert.Nil(t, db.Delete([]byte("k2")))
+	assert.Nil(t, db.RPush([]byte("l"), []byte("a")))
+
+	// the process crashes once the marker is written, none of the flushed files is removed.
+	nextFids := make([]uint32, LogFileTypeNum)
+	for dataType := String; dataType < LogFileTypeNum; dataType++ {
+		if lf := db.activateLogFile[dataType]; lf != nil {
+			nextFids[dataType] = lf.Fid + 1
+		}
+	}
+	assert.Nil(t, db.writeFlushMarker(nextFids))
+	assert.Nil(t, db.Close())
+
+	db, err = Open(options.DefaultOptions(path))
+	assert.Nil(t, err)
+	defer db.Close()
+	for _, key := range []string{"k1", "k2"} {
+		_, err = db.Get([]byte(key))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	assert.Equal(t, 0, listLen(t, db, []byte("l")))
+	_, err = os.Stat(filepath.Join(path, flushMarkerName))
+	assert.True(t, os.IsNotExist(err))
+}
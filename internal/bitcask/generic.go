@@ -0,0 +1,389 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/logfile"
+	"bytes"
+	"context"
+	"errors"
+)
+
+// the number of tombstones written in a batch by the background unlink, the index lock is released between batches.
+const unlinkBatchSize = 256
+
+// errUnlinkInProgress a log file holding a key tombstone can not be removed by gc until the unlink of the key is done.
+var errUnlinkInProgress = errors.New("the tombstones of an unlinked key are not all written")
+
+// detachedKey is a collection that has been removed from the index, but the tombstones of its members are not written yet.
+type detachedKey struct {
+	key      []byte
+	dataType DataType
+	idxTree  *art.AdaptiveRadixTree
+}
+
+// Del removes the specified keys of any type. A key is ignored if it does not exist.
+// Tombstones of all members are written before it returns.
+// It returns the number of keys that were removed.
+func (db *BitcaskDB) Del(keys ...[]byte) (int, error) {
+	return db.removeKeys(context.Background(), keys, false)
+}
+
+// DelCtx is like Del, but it stops and returns the error of ctx if ctx is done before all the keys are removed.
+// The keys removed before that stay removed.
+func (db *BitcaskDB) DelCtx(ctx context.Context, keys ...[]byte) (int, error) {
+	return db.removeKeys(ctx, keys, false)
+}
+
+// Unlink is similar to Del, but only a tombstone of the whole key is written before it returns, the tombstones of
+// the members of collections are written in a background goroutine, so it returns immediately even if the collections
+// are very large. If the process crashes before they are all written, they are written again after the db is opened.
+func (db *BitcaskDB) Unlink(keys ...[]byte) (int, error) {
+	return db.removeKeys(context.Background(), keys, true)
+}
+
+// UnlinkCtx is like Unlink, but it stops and returns the error of ctx if ctx is done before all the keys are removed.
+func (db *BitcaskDB) UnlinkCtx(ctx context.Context, keys ...[]byte) (int, error) {
+	return db.removeKeys(ctx, keys, true)
+}
+
+// Exists returns the number of keys that exist among the specified keys.
+// If the same existing key is mentioned multiple times, it will be counted multiple times.
+func (db *BitcaskDB) Exists(keys ...[]byte) int {
+	var count int
+	for _, key := range keys {
+		if _, ok := db.typeOf(key); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// typeOf returns the type of the value stored at key, false is returned if key does not exist.
+// Unlike keyspace.typeOf, a hash whose fields are all expired does not exist.
+func (db *BitcaskDB) typeOf(key []byte) (DataType, bool) {
+	dataType, ok := db.keyspace.typeOf(key)
+	if ok && dataType == Hash && !db.hashAlive(key) {
+		return 0, false
+	}
+	return dataType, ok
+}
+
+func (db *BitcaskDB) removeKeys(ctx context.Context, keys [][]byte, async bool) (int, error) {
+	var count int
+	for _, key := range keys {
+		removed, err := db.removeKey(ctx, key, async)
+		if err != nil {
+			return count, err
+		}
+		if removed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (db *BitcaskDB) removeKey(ctx context.Context, key []byte, async bool) (bool, error) {
+	for {
+		dataType, ok := db.keyspace.typeOf(key)
+		if !ok {
+			return false, nil
+		}
+
+		mu := db.indexLock(dataType)
+		if err := mu.lockCtx(ctx); err != nil {
+			return false, err
+		}
+		// the key may be changed before the lock is acquired, check it again.
+		if cur, ok := db.keyspace.typeOf(key); !ok || cur != dataType {
+			mu.Unlock()
+			continue
+		}
+		var err error
+		if async && dataType != String {
+			err = db.writeKeyTombstone(key, dataType)
+		}
+		var dk *detachedKey
+		if err == nil {
+			dk, err = db.detachKey(key, dataType)
+		}
+		if err == nil && dk != nil && !async {
+			err = db.writeTombstones(dk, nil)
+		}
+		if err == nil && dk != nil && async {
+			db.unlinking[dataType][dk] = struct{}{}
+		}
+		mu.Unlock()
+
+		if err == nil && dk != nil && async {
+			db.unlinkWg.Add(1)
+			go db.unlinkInBackground(dk)
+		}
+		return err == nil, err
+	}
+}
+
+// writeKeyTombstone writes the tombstone of the collection stored at key, which deletes all its members written before
+// when the index is loaded, so the removal is durable before the tombstones of the members are written.
+// The lock of dataType must be held.
+func (db *BitcaskDB) writeKeyTombstone(key []byte, dataType DataType) error {
+	pos, err := db.writeLogEntry(&logfile.LogEntry{Key: key, Type: logfile.TypeKeyDelete}, dataType)
+	if err != nil {
+		return err
+	}
+	// the tombstone is never indexed.
+	db.sendDiscard(&indexNode{fid: pos.fid, entrySize: pos.entrySize}, true, dataType)
+	return nil
+}
+
+// detachOnLoad moves idxTree of key, which is deleted by a key tombstone, out of the index being loaded.
+// The tombstones of its members are written by resumeUnlinks once the indexes are loaded, since they may not be all
+// written before the process exits. It is only called by the goroutine loading the index of dataType.
+func (db *BitcaskDB) detachOnLoad(key []byte, dataType DataType, idxTree *art.AdaptiveRadixTree) {
+	if idxTree == nil {
+		return
+	}
+	dk := db.loadedUnlinks[dataType][string(key)]
+	if dk == nil {
+		db.loadedUnlinks[dataType][string(key)] = &detachedKey{key: key, dataType: dataType, idxTree: idxTree}
+		return
+	}
+	// the key is unlinked again after it is written.
+	iter := idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			break
+		}
+		dk.idxTree.Put(node.Key(), node.Value())
+	}
+}
+
+// deleteOnLoad removes the member nodeKey of a key deleted by a key tombstone, since its tombstone is loaded.
+func (db *BitcaskDB) deleteOnLoad(key []byte, dataType DataType, nodeKey []byte) {
+	if dk := db.loadedUnlinks[dataType][string(key)]; dk != nil {
+		dk.idxTree.Delete(nodeKey)
+	}
+}
+
+// resumeUnlinks writes the tombstones of the members of the keys deleted by key tombstones in background,
+// it is called after the indexes are loaded.
+func (db *BitcaskDB) resumeUnlinks() {
+	for dataType, dks := range db.loadedUnlinks {
+		for _, dk := range dks {
+			if dk.idxTree.Size() == 0 {
+				continue
+			}
+			db.unlinking[dataType][dk] = struct{}{}
+			db.unlinkWg.Add(1)
+			go db.unlinkInBackground(dk)
+		}
+	}
+	db.loadedUnlinks = nil
+}
+
+// checkKeyTombstone returns errUnlinkInProgress if the tombstones of the members of key are not all written,
+// so the key tombstone is kept by gc.
+func (db *BitcaskDB) checkKeyTombstone(ctx context.Context, key []byte, dataType DataType) error {
+	mu := db.indexLock(dataType)
+	if err := mu.rlockCtx(ctx); err != nil {
+		return err
+	}
+	defer mu.RUnlock()
+
+	for dk := range db.unlinking[dataType] {
+		if bytes.Equal(dk.key, key) {
+			return errUnlinkInProgress
+		}
+	}
+	return nil
+}
+
+// overwriteKey removes key if it holds a value of another type than String, so SET can overwrite values of any type.
+// The lock of strIndex must be held, the lock of other types are acquired after it.
+func (db *BitcaskDB) overwriteKey(key []byte) error {
+	dataType, ok := db.keyspace.typeOf(key)
+	if !ok || dataType == String {
+		return nil
+	}
+
+	mu := db.indexLock(dataType)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return db.removeKeyLocked(key, dataType)
+}
+
+func (db *BitcaskDB) indexLock(dataType DataType) *rwMutex {
+	switch dataType {
+	case List:
+		return db.listIndex.mu
+	case Hash:
+		return db.hashIndex.mu
+	case Set:
+		return db.setIndex.mu
+	case ZSet:
+		return db.zsetIndex.mu
+	default:
+		return db.strIndex.mu
+	}
+}
+
+// detachKey removes key from the index, so it is invisible to readers.
+// Strings are deleted directly, and nil is returned. For collections, the detached tree is returned,
+// and tombstones of the members must be written by writeTombstones.
+// The lock of dataType must be held.
+func (db *BitcaskDB) detachKey(key []byte, dataType DataType) (*detachedKey, error) {
+	db.keyspace.release(key, dataType)
+
+	var idxTree *art.AdaptiveRadixTree
+	switch dataType {
+	case String:
+		entry := &logfile.LogEntry{Key: key, Type: logfile.TypeDelete}
+		pos, err := db.writeLogEntry(entry, String)
+		if err != nil {
+			return nil, err
+		}
+		oldVal, updated := db.strIndex.idxTree.Delete(key)
+		db.trackMemory(key, nil, oldVal)
+		db.sendDiscard(oldVal, updated, String)
+		db.sendDiscard(&indexNode{fid: pos.fid, entrySize: pos.entrySize}, updated, String)
+		return nil, nil
+	case List:
+		idxTree = db.listIndex.trees[string(key)]
+		if idxTree == nil {
+			return nil, nil
+		}
+		// reset the list meta first, the list is empty even if the tombstones of elements are not written.
+		if err := db.saveListMeta(idxTree, key, initialListSeq, initialListSeq+1); err != nil {
+			return nil, err
+		}
+		delete(db.listIndex.trees, string(key))
+	case Hash:
+		idxTree = db.hashIndex.trees[string(key)]
+		// the ttls of the fields are left in the expires, they are skipped when they are reached.
+		delete(db.hashIndex.trees, string(key))
+	case Set:
+		idxTree = db.setIndex.trees[string(key)]
+		delete(db.setIndex.trees, string(key))
+	case ZSet:
+		idxTree = db.zsetIndex.trees[string(key)]
+		delete(db.zsetIndex.trees, string(key))
+		db.zsetIndex.indexes.ZClear(string(key))
+	}
+
+	if idxTree == nil {
+		return nil, nil
+	}
+	db.releaseTreeMemory(idxTree)
+	return &detachedKey{key: key, dataType: dataType, idxTree: idxTree}, nil
+}
+
+// writeTombstones writes the delete entries of the members in nodeKeys, or all members if nodeKeys is nil.
+// Members which exist in the live index again are skipped, so a key written after it is detached will not be deleted.
+// The lock of dk.dataType must be held.
+func (db *BitcaskDB) writeTombstones(dk *detachedKey, nodeKeys [][]byte) error {
+	if nodeKeys == nil {
+		iter := dk.idxTree.Iterator()
+		for iter.HasNext() {
+			node, err := iter.Next()
+			if err != nil {
+				return err
+			}
+			nodeKeys = append(nodeKeys, node.Key())
+		}
+	}
+
+	liveTree := db.liveTree(dk.key, dk.dataType)
+	for _, nodeKey := range nodeKeys {
+		if liveTree != nil && liveTree.Get(nodeKey) != nil {
+			continue
+		}
+
+		var entry *logfile.LogEntry
+		switch dk.dataType {
+		case List:
+			// the meta of list has been reset when it is detached.
+			if string(nodeKey) == string(dk.key) {
+				continue
+			}
+			entry = &logfile.LogEntry{Key: nodeKey, Type: logfile.TypeDelete}
+		case Hash:
+			entry = &logfile.LogEntry{Key: nodeKey, Type: logfile.TypeDelete}
+		case Set:
+			entry = &logfile.LogEntry{Key: dk.key, Value: memberOf(nodeKey), Type: logfile.TypeDelete}
+		case ZSet:
+			entry = &logfile.LogEntry{Key: dk.key, Value: nodeKey, Type: logfile.TypeDelete}
+		default:
+			return nil
+		}
+
+		pos, err := db.writeLogEntry(entry, dk.dataType)
+		if err != nil {
+			return err
+		}
+		db.sendDiscard(dk.idxTree.Get(nodeKey), true, dk.dataType)
+		db.sendDiscard(&indexNode{fid: pos.fid, entrySize: pos.entrySize}, true, dk.dataType)
+	}
+	return nil
+}
+
+// liveTree returns the index tree of key in the index now.
+func (db *BitcaskDB) liveTree(key []byte, dataType DataType) *art.AdaptiveRadixTree {
+	switch dataType {
+	case List:
+		return db.listIndex.trees[string(key)]
+	case Hash:
+		return db.hashIndex.trees[string(key)]
+	case Set:
+		return db.setIndex.trees[string(key)]
+	case ZSet:
+		return db.zsetIndex.trees[string(key)]
+	}
+	return nil
+}
+
+func (db *BitcaskDB) unlinkInBackground(dk *detachedKey) {
+	defer db.unlinkWg.Done()
+
+	for {
+		done, err := db.unlinkBatch(dk)
+		if err != nil {
+			log.Errorf("unlink key %q err: %v", dk.key, err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// unlinkBatch writes the tombstones of at most unlinkBatchSize members of dk, and removes them from the detached tree,
+// so the tree always holds the members whose discard updates are not sent yet, which are counted by RebuildDiscards.
+// It returns true once the tombstones of all the members are written.
+func (db *BitcaskDB) unlinkBatch(dk *detachedKey) (bool, error) {
+	mu := db.indexLock(dk.dataType)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var batch [][]byte
+	iter := dk.idxTree.Iterator()
+	for iter.HasNext() && len(batch) < unlinkBatchSize {
+		node, err := iter.Next()
+		if err != nil {
+			break
+		}
+		batch = append(batch, node.Key())
+	}
+	err := db.writeTombstones(dk, batch)
+	if err == nil {
+		for _, nodeKey := range batch {
+			dk.idxTree.Delete(nodeKey)
+		}
+	}
+	done := dk.idxTree.Size() == 0
+	if err != nil || done {
+		delete(db.unlinking[dk.dataType], dk)
+	}
+	return done, err
+}
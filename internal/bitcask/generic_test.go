@@ -0,0 +1,110 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/options"
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countTombstones returns the number of member tombstones of key in the log files of dataType.
+func countTombstones(t *testing.T, db *BitcaskDB, dataType DataType, key []byte) int {
+	files := []*logfile.LogFile{db.activateLogFile[dataType]}
+	for _, lf := range db.archivedLogFile[dataType] {
+		files = append(files, lf)
+	}
+	var count int
+	for _, lf := range files {
+		offset := int64(logfile.SegmentHeaderSize)
+		for {
+			entry, size, err := lf.ReadLogEntry(offset)
+			if err == io.EOF || err == logfile.ErrEndOfEntry {
+				break
+			}
+			if err != nil {
+				t.Fatalf("read log entry err: %v", err)
+			}
+			if entry.Type == logfile.TypeDelete && string(entry.Key) == string(key) {
+				count++
+			}
+			offset += size
+		}
+	}
+	return count
+}
+
+func TestBitcaskDB_UnlinkCrash(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	n := unlinkBatchSize*2 + 10
+	for i := 0; i < n; i++ {
+		member := []byte("m" + strconv.Itoa(i))
+		assert.Nil(t, db.RPush([]byte("list"), member))
+		assert.Nil(t, db.HSet([]byte("hash"), member, member))
+		_, err = db.SAdd([]byte("set"), member)
+		assert.Nil(t, err)
+		assert.Nil(t, db.ZAdd([]byte("zset"), float64(i), member))
+	}
+
+	// the process exits after the key tombstones are written, before any tombstone of the members.
+	for _, dataType := range []DataType{List, Hash, Set, ZSet} {
+		key := []byte(typeNames[dataType])
+		mu := db.indexLock(dataType)
+		mu.Lock()
+		assert.Nil(t, db.writeKeyTombstone(key, dataType))
+		_, err = db.detachKey(key, dataType)
+		mu.Unlock()
+		assert.Nil(t, err)
+	}
+	// the set is written again after it is unlinked.
+	_, err = db.SAdd([]byte("set"), []byte("new"))
+	assert.Nil(t, err)
+
+	db = reopenTestDB(t, db, opts)
+	for _, typeName := range []string{"list", "hash", "zset"} {
+		assert.Equal(t, typeNameNone, db.Type([]byte(typeName)))
+	}
+	members, err := db.SMembers([]byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("new")}, members)
+
+	// the tombstones of the members are written after the db is opened.
+	db.unlinkWg.Wait()
+	for _, dataType := range []DataType{Hash, Set, ZSet} {
+		assert.Empty(t, db.unlinking[dataType])
+	}
+	assert.Equal(t, n, countTombstones(t, db, Set, []byte("set")))
+	assert.Equal(t, n, countTombstones(t, db, ZSet, []byte("zset")))
+
+	db = reopenTestDB(t, db, opts)
+	members, err = db.SMembers([]byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("new")}, members)
+}
+
+func TestBitcaskDB_UnlinkKeepKeyTombstone(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("set")
+	_, err := db.SAdd(key, []byte("m"))
+	assert.Nil(t, err)
+
+	db.setIndex.mu.Lock()
+	dk, err := db.detachKey(key, Set)
+	assert.Nil(t, err)
+	db.unlinking[Set][dk] = struct{}{}
+	db.setIndex.mu.Unlock()
+	// gc can not drop the key tombstone before the tombstones of the members are written.
+	assert.Equal(t, errUnlinkInProgress, db.checkKeyTombstone(context.Background(), key, Set))
+	assert.Nil(t, db.checkKeyTombstone(context.Background(), []byte("other"), Set))
+
+	db.unlinkWg.Add(1)
+	db.unlinkInBackground(dk)
+	assert.Nil(t, db.checkKeyTombstone(context.Background(), key, Set))
+}
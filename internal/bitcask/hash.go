@@ -3,9 +3,65 @@ package bitcask
 import (
 	art "bitcaskDB/internal/ds/art"
 	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/util"
+	"container/heap"
+	"context"
 	"errors"
 	"math"
+	"math/rand"
 	"strconv"
+	"time"
+)
+
+// HSetCondition is the condition for HSetEx to set the fields.
+type HSetCondition int8
+
+const (
+	// HSetAlways sets the fields unconditionally.
+	HSetAlways HSetCondition = iota
+	// HSetIfNoneExist sets the fields only if none of them exists.
+	HSetIfNoneExist
+	// HSetIfAllExist sets the fields only if all of them exist.
+	HSetIfAllExist
+)
+
+// ExpireCondition is the condition for HExpire to set the ttl of the fields.
+type ExpireCondition int8
+
+const (
+	// ExpireAlways sets the ttl unconditionally.
+	ExpireAlways ExpireCondition = iota
+	// ExpireIfNoTTL sets the ttl only if the field has no ttl.
+	ExpireIfNoTTL
+	// ExpireIfHasTTL sets the ttl only if the field has a ttl.
+	ExpireIfHasTTL
+	// ExpireIfGreater sets the ttl only if it is greater than the current one, a field without ttl is
+	// treated as never expiring.
+	ExpireIfGreater
+	// ExpireIfLess sets the ttl only if it is less than the current one, a field without ttl is
+	// treated as never expiring.
+	ExpireIfLess
+)
+
+// The results of HExpire, HTTL and HPersist for every field.
+const (
+	// HFieldNotExist the field or the key does not exist.
+	HFieldNotExist = -2
+	// HFieldNoTTL the field exists but has no ttl, it is returned by HTTL and HPersist.
+	HFieldNoTTL = -1
+	// HFieldNotSet the condition of HExpire is not satisfied.
+	HFieldNotSet = 0
+	// HFieldUpdated the ttl is set by HExpire or removed by HPersist.
+	HFieldUpdated = 1
+	// HFieldDeleted the field is deleted by HExpire because the expiration time is in the past.
+	HFieldDeleted = 2
+)
+
+// the number of expired hash fields deleted in a call of expireHashFields, and the number deleted in a batch,
+// the lock of hashIndex is released between batches.
+const (
+	hashFieldExpireLimit = 1000
+	hashFieldExpireBatch = 100
 )
 
 // HSet sets field in the hash stored at key to value. If key does not exist, a new key holding a hash is created.
@@ -13,36 +69,22 @@ import (
 // Return num of elements in hash of the specified key.
 // Multiple field-value pair is accepted. Parameter order should be like "key", "field", "value", "field", "value"...
 func (db *BitcaskDB) HSet(key []byte, args ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
 
 	if len(args) == 0 || len(args)&1 == 1 {
 		return ErrWrongNumberOfArgs
 	}
-
-	if db.hashIndex.trees[string(key)] == nil {
-		db.hashIndex.trees[string(key)] = art.NewART()
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return err
 	}
-	idxTree := db.hashIndex.trees[string(key)]
 
 	for i := 0; i < len(args); i += 2 {
-		field, value := args[i], args[i+1]
-		encKey := db.encodeKey(key, field)
-		ent := &logfile.LogEntry{Key: encKey, Value: value}
-		pos, err := db.writeLogEntry(ent, Hash)
-		if err != nil {
-			return err
-		}
-		/*
-			In rosedb, the author rewrite the entrySize and update. I can't understand and feel unreasonable...
-			Beacause the GCRatio is calculated as a percentage of invalid record size to total file size
-
-			ent := &logfile.LogEntry{Key: field, Value: value}
-			_, size := logfile.EncodeEntry(entry)
-			valuePos.entrySize = size
-			err = db.updateIndexTree(idxTree, ent, valuePos, true, Hash)
-		*/
-		if err = db.updateIndexTree(idxTree, ent, pos, true, Hash); err != nil {
+		if err := db.hsetInternal(key, args[i], args[i+1], 0); err != nil {
 			return err
 		}
 	}
@@ -53,9 +95,16 @@ func (db *BitcaskDB) HSet(key []byte, args ...[]byte) error {
 // If the key doesn't exist, new hash is created.
 // If field already exist, HSetNX doesn't have side effect.
 func (db *BitcaskDB) HSetNX(key, field, value []byte) (bool, error) {
+	if err := db.checkMemory(); err != nil {
+		return false, err
+	}
+
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return false, err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
 		db.hashIndex.trees[string(key)] = art.NewART()
 	}
@@ -68,10 +117,15 @@ func (db *BitcaskDB) HSetNX(key, field, value []byte) (bool, error) {
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return false, err
 	}
+	claim, err := db.keyspace.claim(key, Hash, 0)
+	if err != nil {
+		return false, err
+	}
 
 	ent := &logfile.LogEntry{Key: encKey, Value: value}
 	pos, err := db.writeLogEntry(ent, Hash)
 	if err != nil {
+		claim.rollback()
 		return false, err
 	}
 	err = db.updateIndexTree(idxTree, ent, pos, true, Hash)
@@ -87,6 +141,9 @@ func (db *BitcaskDB) HGet(key, field []byte) ([]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
 		return nil, nil
@@ -109,6 +166,10 @@ func (db *BitcaskDB) HMGet(key []byte, fields ...[]byte) ([][]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
+
 	var vals [][]byte
 	length := len(fields)
 
@@ -140,6 +201,9 @@ func (db *BitcaskDB) HDel(key []byte, fields ...[]byte) (int, error) {
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return 0, err
+	}
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
 		return 0, nil
@@ -147,22 +211,16 @@ func (db *BitcaskDB) HDel(key []byte, fields ...[]byte) (int, error) {
 
 	var count int
 	for _, field := range fields {
-		encKey := db.encodeKey(key, field)
-		ent := &logfile.LogEntry{Key: encKey, Type: logfile.TypeDelete}
-		pos, err := db.writeLogEntry(ent, Hash)
+		updated, err := db.hdelInternal(key, idxTree, field)
 		if err != nil {
 			return count, err
 		}
-		oldVal, updated := idxTree.Delete(encKey)
 		if updated {
 			count++
 		}
-
-		db.sendDiscard(oldVal, updated, Hash)
-		// the delete operation is also invalid.
-		_, eSize := logfile.EncodeEntry(ent)
-		idxNode := &indexNode{fid: pos.fid, entrySize: eSize}
-		db.sendDiscard(idxNode, updated, Hash)
+	}
+	if idxTree.Size() == 0 {
+		db.keyspace.release(key, Hash)
 	}
 	return count, nil
 
@@ -175,6 +233,9 @@ func (db *BitcaskDB) HExists(key, field []byte) (bool, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return false, err
+	}
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
 		return false, nil
@@ -199,7 +260,7 @@ func (db *BitcaskDB) HLen(key []byte) int {
 		return 0
 	}
 
-	return idxTree.Size()
+	return db.hLen(key, idxTree)
 }
 
 // HKeys returns all field names in the hash stored at key.
@@ -220,18 +281,25 @@ func (db *BitcaskDB) HFields(key []byte) ([][]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
 	var fields [][]byte
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
 		return fields, nil
 	}
 
+	now := time.Now().UnixMilli()
 	iter := idxTree.Iterator()
-	if iter.HasNext() {
+	for iter.HasNext() {
 		node, err := iter.Next()
 		if err != nil {
 			return fields, err
 		}
+		if idxNode, _ := node.Value().(*indexNode); idxNode == nil || idxNode.expired(now) {
+			continue
+		}
 		encKey := node.Key()
 		_, field := db.decodeKey(encKey)
 		fields = append(fields, field)
@@ -244,6 +312,9 @@ func (db *BitcaskDB) HVals(key []byte) ([][]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
 	var values [][]byte
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
@@ -251,13 +322,16 @@ func (db *BitcaskDB) HVals(key []byte) ([][]byte, error) {
 	}
 
 	iter := idxTree.Iterator()
-	if iter.HasNext() {
+	for iter.HasNext() {
 		node, err := iter.Next()
 		if err != nil {
 			return values, err
 		}
 		val, err := db.getVal(idxTree, node.Key(), Hash)
-		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
 			return values, err
 		}
 		values = append(values, val)
@@ -267,9 +341,318 @@ func (db *BitcaskDB) HVals(key []byte) ([][]byte, error) {
 
 // HGetAll return all fields and values of the hash stored at key.
 func (db *BitcaskDB) HGetAll(key []byte) ([][]byte, error) {
+	return db.HGetAllCtx(context.Background(), key)
+}
+
+// HGetAllCtx is like HGetAll, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) HGetAllCtx(ctx context.Context, key []byte) ([][]byte, error) {
+	if err := db.hashIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.hashIndex.mu.RUnlock()
+
+	return db.hGetAll(ctx, key)
+}
+
+// HRandField returns random fields of the hash stored at key, each followed by its value if withValues is true.
+// If count is positive, at most count distinct fields are returned.
+// If count is negative, -count fields are returned and the same field may be returned multiple times.
+func (db *BitcaskDB) HRandField(key []byte, count int, withValues bool) ([][]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 
+	pairs, err := db.hGetAll(context.Background(), key)
+	if err != nil || len(pairs) == 0 || count == 0 {
+		return nil, err
+	}
+
+	n := len(pairs) / 2
+	var picked []int
+	switch {
+	case count < 0:
+		picked = make([]int, -count)
+		for i := range picked {
+			picked[i] = rand.Intn(n)
+		}
+	case count >= n:
+		picked = make([]int, n)
+		for i := range picked {
+			picked[i] = i
+		}
+	default:
+		// the first count fields of a random permutation are a uniform sample.
+		picked = rand.Perm(n)[:count]
+	}
+
+	res := make([][]byte, 0, len(picked)*2)
+	for _, i := range picked {
+		res = append(res, pairs[2*i])
+		if withValues {
+			res = append(res, pairs[2*i+1])
+		}
+	}
+	return res, nil
+}
+
+// HGetDel returns the values associated with the fields in the hash stored at key and deletes the fields.
+// For every field that does not exist in the hash, a nil value is returned.
+// The key is removed when the hash becomes empty.
+func (db *BitcaskDB) HGetDel(key []byte, fields ...[]byte) ([][]byte, error) {
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
+	vals := make([][]byte, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		return vals, nil
+	}
+
+	for i, field := range fields {
+		val, err := db.getVal(idxTree, db.encodeKey(key, field), Hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return vals, err
+		}
+		vals[i] = val
+		if _, err = db.hdelInternal(key, idxTree, field); err != nil {
+			return vals, err
+		}
+	}
+	if idxTree.Size() == 0 {
+		db.keyspace.release(key, Hash)
+	}
+	return vals, nil
+}
+
+// HSetEx sets the fields in the hash stored at key to their values if cond is satisfied, either all the fields
+// are set or none of them. Parameter order should be the same as HSet. It returns true if the fields are set.
+func (db *BitcaskDB) HSetEx(key []byte, cond HSetCondition, args ...[]byte) (bool, error) {
+	if err := db.checkMemory(); err != nil {
+		return false, err
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if len(args) == 0 || len(args)&1 == 1 {
+		return false, ErrWrongNumberOfArgs
+	}
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return false, err
+	}
+
+	if cond != HSetAlways {
+		idxTree := db.hashIndex.trees[string(key)]
+		for i := 0; i < len(args); i += 2 {
+			exists := false
+			if idxTree != nil {
+				_, err := db.getVal(idxTree, db.encodeKey(key, args[i]), Hash)
+				if err != nil && !errors.Is(err, ErrKeyNotFound) {
+					return false, err
+				}
+				exists = err == nil
+			}
+			if exists != (cond == HSetIfAllExist) {
+				return false, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if err := db.hsetInternal(key, args[i], args[i+1], 0); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HExpire sets a ttl on the fields of the hash stored at key if cond is satisfied, the fields are deleted
+// if duration is not positive. The result of every field is one of HFieldNotExist, HFieldNotSet,
+// HFieldUpdated and HFieldDeleted. The ttl is kept until it is removed by HPersist or the field is overwritten by HSet.
+func (db *BitcaskDB) HExpire(key []byte, duration time.Duration, cond ExpireCondition, fields ...[]byte) ([]int, error) {
+	return db.HExpireAt(key, time.Now().Add(duration), cond, fields...)
+}
+
+// HExpireAt is like HExpire, but the fields expire at the given time, which is truncated to milliseconds.
+func (db *BitcaskDB) HExpireAt(key []byte, at time.Time, cond ExpireCondition, fields ...[]byte) ([]int, error) {
+	expiredAt := at.UnixMilli()
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
+	res := make([]int, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		for i := range res {
+			res[i] = HFieldNotExist
+		}
+		return res, nil
+	}
+
+	now := time.Now().UnixMilli()
+	for i, field := range fields {
+		encKey := db.encodeKey(key, field)
+		val, err := db.getVal(idxTree, encKey, Hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			res[i] = HFieldNotExist
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if !cond.satisfied(db.hFieldExpiredAt(idxTree, encKey), expiredAt) {
+			res[i] = HFieldNotSet
+			continue
+		}
+
+		if expiredAt <= now {
+			if _, err = db.hdelInternal(key, idxTree, field); err != nil {
+				return res, err
+			}
+			res[i] = HFieldDeleted
+			continue
+		}
+		if err = db.hsetInternal(key, field, val, expiredAt); err != nil {
+			return res, err
+		}
+		res[i] = HFieldUpdated
+	}
+	if idxTree.Size() == 0 {
+		db.keyspace.release(key, Hash)
+	}
+	return res, nil
+}
+
+// HExpireTime returns the unix time in seconds at which the fields of the hash stored at key expire.
+// HFieldNotExist is returned for the field which does not exist, and HFieldNoTTL for the field without ttl.
+func (db *BitcaskDB) HExpireTime(key []byte, fields ...[]byte) ([]int64, error) {
+	res, err := db.HPExpireTime(key, fields...)
+	for i, expiredAt := range res {
+		if expiredAt > 0 {
+			res[i] = (expiredAt + 500) / 1000
+		}
+	}
+	return res, err
+}
+
+// HPExpireTime is like HExpireTime, but the time is in milliseconds.
+func (db *BitcaskDB) HPExpireTime(key []byte, fields ...[]byte) ([]int64, error) {
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
+	res := make([]int64, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	now := time.Now().UnixMilli()
+	for i, field := range fields {
+		res[i] = HFieldNotExist
+		if idxTree == nil {
+			continue
+		}
+		idxNode, _ := idxTree.Get(db.encodeKey(key, field)).(*indexNode)
+		switch {
+		case idxNode == nil || idxNode.expired(now):
+		case idxNode.expiredAt == 0:
+			res[i] = HFieldNoTTL
+		default:
+			res[i] = idxNode.expiredAt
+		}
+	}
+	return res, nil
+}
+
+// HTTL returns the remaining time to live in seconds of the fields of the hash stored at key.
+// HFieldNotExist is returned for the field which does not exist, and HFieldNoTTL for the field without ttl.
+func (db *BitcaskDB) HTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	res, err := db.HPTTL(key, fields...)
+	for i, ttl := range res {
+		if ttl >= 0 {
+			res[i] = (ttl + 500) / 1000
+		}
+	}
+	return res, err
+}
+
+// HPTTL is like HTTL, but the time to live is in milliseconds.
+func (db *BitcaskDB) HPTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	res, err := db.HPExpireTime(key, fields...)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	for i, expiredAt := range res {
+		if expiredAt > 0 {
+			res[i] = expiredAt - now
+		}
+	}
+	return res, nil
+}
+
+// HPersist removes the ttl of the fields of the hash stored at key.
+// The result of every field is one of HFieldNotExist, HFieldNoTTL and HFieldUpdated.
+func (db *BitcaskDB) HPersist(key []byte, fields ...[]byte) ([]int, error) {
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
+	res := make([]int, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	for i, field := range fields {
+		res[i] = HFieldNotExist
+		if idxTree == nil {
+			continue
+		}
+		encKey := db.encodeKey(key, field)
+		val, err := db.getVal(idxTree, encKey, Hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if db.hFieldExpiredAt(idxTree, encKey) == 0 {
+			res[i] = HFieldNoTTL
+			continue
+		}
+		if err = db.hsetInternal(key, field, val, 0); err != nil {
+			return res, err
+		}
+		res[i] = HFieldUpdated
+	}
+	return res, nil
+}
+
+// satisfied returns whether the ttl of a field can be changed from expiredAt to newExpiredAt, 0 means no ttl.
+func (cond ExpireCondition) satisfied(expiredAt, newExpiredAt int64) bool {
+	switch cond {
+	case ExpireIfNoTTL:
+		return expiredAt == 0
+	case ExpireIfHasTTL:
+		return expiredAt != 0
+	case ExpireIfGreater:
+		return expiredAt != 0 && newExpiredAt > expiredAt
+	case ExpireIfLess:
+		return expiredAt == 0 || newExpiredAt < expiredAt
+	}
+	return true
+}
+
+// hGetAll returns all fields and values of the hash stored at key, the lock of hashIndex must be held.
+func (db *BitcaskDB) hGetAll(ctx context.Context, key []byte) ([][]byte, error) {
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, err
+	}
 	var pairs [][]byte
 	idxTree := db.hashIndex.trees[string(key)]
 	if idxTree == nil {
@@ -279,7 +662,10 @@ func (db *BitcaskDB) HGetAll(key []byte) ([][]byte, error) {
 	var index int
 	pairs = make([][]byte, idxTree.Size()*2)
 	iter := idxTree.Iterator()
-	if iter.HasNext() {
+	for iter.HasNext() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		node, err := iter.Next()
 		if err != nil {
 			return pairs, err
@@ -287,7 +673,10 @@ func (db *BitcaskDB) HGetAll(key []byte) ([][]byte, error) {
 		encKey := node.Key()
 		_, field := db.decodeKey(encKey)
 		val, err := db.getVal(idxTree, encKey, Hash)
-		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
 			return pairs, err
 		}
 		pairs[index], pairs[index+1] = field, val
@@ -315,21 +704,21 @@ func (db *BitcaskDB) HStrLen(key, field []byte) int {
 	return len(val)
 }
 
-// HScan iterates over a specified key of type Hash and finds its fields and values.
-// Parameter prefix will match field`s prefix, and pattern is a regular expression that also matchs the field.
-// Parameter count limits the number of keys, a nil slice will be returned if count is not a positive number.
-// The returned values will be a mixed data of fields and values, like [field1, value1, field2, value2, etc...].
-// func (db *BitcaskDB) HScan(key []byte, prefix []byte, pattern string, count int) ([][]byte, error) {
-// }
-
 // HIncrBy increments the number stored at field in the hash stored at key by increment.
 // If key does not exist, a new key holding a hash is created. If field does not exist
 // the value is set to 0 before the operation is performed. The range of values supported
-// by HINCRBY is limited to 64bit signed integers.
+// by HINCRBY is limited to 64bit signed integers. The ttl of field is kept.
 func (db *BitcaskDB) HIncrBy(key, field []byte, incr int64) (int64, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return 0, err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
 		db.hashIndex.trees[string(key)] = art.NewART()
 	}
@@ -355,16 +744,324 @@ func (db *BitcaskDB) HIncrBy(key, field []byte, incr int64) (int64, error) {
 	}
 	valInt64 += incr
 	val = []byte(strconv.FormatInt(valInt64, 10))
+	// the ttl of the field is kept.
+	if err = db.hsetInternal(key, field, val, db.hFieldExpiredAt(idxTree, encKey)); err != nil {
+		return 0, err
+	}
+	return valInt64, nil
+}
 
-	ent := &logfile.LogEntry{Key: encKey, Value: val}
+// HIncrByFloat increments the float number stored at field in the hash stored at key by increment, and returns
+// the new value. If field does not exist, the value is set to 0 before the operation is performed.
+// The ttl of field is kept.
+func (db *BitcaskDB) HIncrByFloat(key, field []byte, incr float64) (float64, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return 0, err
+	}
+
+	var cur float64
+	var expiredAt int64
+	if idxTree := db.hashIndex.trees[string(key)]; idxTree != nil {
+		encKey := db.encodeKey(key, field)
+		expiredAt = db.hFieldExpiredAt(idxTree, encKey)
+		val, err := db.getVal(idxTree, encKey, Hash)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return 0, err
+		}
+		if len(val) > 0 {
+			if cur, err = strconv.ParseFloat(string(val), 64); err != nil || math.IsNaN(cur) {
+				return 0, ErrWrongFloatType
+			}
+		}
+	}
+
+	res := cur + incr
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, ErrFloatOverflow
+	}
+	if err := db.hsetInternal(key, field, []byte(util.Float64ToStr(res)), expiredAt); err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+// hdelInternal removes field from the hash stored at key, it returns false if field does not exist.
+// The tombstone is always written. The lock of hashIndex must be held.
+func (db *BitcaskDB) hdelInternal(key []byte, idxTree *art.AdaptiveRadixTree, field []byte) (bool, error) {
+	encKey := db.encodeKey(key, field)
+	ent := &logfile.LogEntry{Key: encKey, Type: logfile.TypeDelete}
 	pos, err := db.writeLogEntry(ent, Hash)
 	if err != nil {
-		return 0, err
+		return false, err
 	}
-	err = db.updateIndexTree(idxTree, ent, pos, true, Hash)
+	oldVal, updated := idxTree.Delete(encKey)
+	db.trackMemory(encKey, nil, oldVal)
+
+	db.sendDiscard(oldVal, updated, Hash)
+	// the delete operation is also invalid.
+	_, eSize := logfile.EncodeEntry(ent)
+	idxNode := &indexNode{fid: pos.fid, entrySize: eSize}
+	db.sendDiscard(idxNode, updated, Hash)
+	return updated, nil
+}
+
+// hsetInternal sets field in the hash stored at key to value, the field expires at expiredAt(unix milliseconds)
+// if it is not 0. The lock of hashIndex must be held.
+func (db *BitcaskDB) hsetInternal(key, field, value []byte, expiredAt int64) error {
+	claim, err := db.keyspace.claim(key, Hash, 0)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return valInt64, nil
+	encKey := db.encodeKey(key, field)
+	ent := &logfile.LogEntry{Key: encKey, Value: value, ExpiredAt: expiredAt}
+	pos, err := db.writeLogEntry(ent, Hash)
+	if err != nil {
+		claim.rollback()
+		return err
+	}
+	if db.hashIndex.trees[string(key)] == nil {
+		db.hashIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.hashIndex.trees[string(key)]
+	if expiredAt != 0 {
+		db.addFieldExpire(string(key), encKey, expiredAt)
+	}
+	/*
+		In rosedb, the author rewrite the entrySize and update. I can't understand and feel unreasonable...
+		Beacause the GCRatio is calculated as a percentage of invalid record size to total file size
+
+		ent := &logfile.LogEntry{Key: field, Value: value}
+		_, size := logfile.EncodeEntry(entry)
+		valuePos.entrySize = size
+		err = db.updateIndexTree(idxTree, ent, valuePos, true, Hash)
+	*/
+	return db.updateIndexTree(idxTree, ent, pos, true, Hash)
+}
+
+// hFieldExpiredAt returns the expiration time of the alive field encKey, 0 is returned if it has no ttl.
+func (db *BitcaskDB) hFieldExpiredAt(idxTree *art.AdaptiveRadixTree, encKey []byte) int64 {
+	idxNode, _ := idxTree.Get(encKey).(*indexNode)
+	if idxNode == nil || idxNode.expired(time.Now().UnixMilli()) {
+		return 0
+	}
+	return idxNode.expiredAt
+}
+
+// hLen returns the number of alive fields in the hash stored at key, the lock of hashIndex must be held.
+func (db *BitcaskDB) hLen(key []byte, idxTree *art.AdaptiveRadixTree) int {
+	if _, ok := db.hashIndex.volatile[string(key)]; !ok {
+		return idxTree.Size()
+	}
+	var count int
+	now := time.Now().UnixMilli()
+	iter := idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			break
+		}
+		if idxNode, _ := node.Value().(*indexNode); idxNode != nil && !idxNode.expired(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// expireHashFields deletes the hash fields whose ttls are reached in the order of expiration, and removes the hashes
+// which become empty. At most hashFieldExpireLimit fields are deleted in a call, the rest are deleted by the next call,
+// and they are never returned in the meantime.
+// Tombstones of the fields are written, so they are not loaded again after restart.
+func (db *BitcaskDB) expireHashFields() error {
+	for n := 0; n < hashFieldExpireLimit; n += hashFieldExpireBatch {
+		more, err := db.expireHashFieldBatch()
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireHashFieldBatch deletes at most hashFieldExpireBatch expired fields, it returns whether there may be more.
+func (db *BitcaskDB) expireHashFieldBatch() (bool, error) {
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	expires := db.hashIndex.expires
+	for i := 0; i < hashFieldExpireBatch; i++ {
+		fe := expires.peek()
+		if fe == nil || fe.expiredAt > now {
+			return false, nil
+		}
+		db.removeFieldExpire(fe)
+
+		idxTree := db.hashIndex.trees[fe.key]
+		if idxTree == nil {
+			continue
+		}
+		// the ttl is stale if the field is deleted or its ttl is removed after it is added.
+		idxNode, _ := idxTree.Get(fe.encKey).(*indexNode)
+		if idxNode == nil || idxNode.expiredAt != fe.expiredAt {
+			continue
+		}
+		_, field := db.decodeKey(fe.encKey)
+		if _, err := db.hdelInternal([]byte(fe.key), idxTree, field); err != nil {
+			// it is retried by the next call.
+			db.addFieldExpire(fe.key, fe.encKey, fe.expiredAt)
+			return false, err
+		}
+		if idxTree.Size() == 0 {
+			db.keyspace.release([]byte(fe.key), Hash)
+		}
+	}
+	return true, nil
+}
+
+// addFieldExpire records that the field encKey of the hash stored at key expires at expiredAt,
+// the ttl recorded for the field before is replaced. The lock of hashIndex must be held.
+func (db *BitcaskDB) addFieldExpire(key string, encKey []byte, expiredAt int64) {
+	if fe := db.hashIndex.expires.get(encKey); fe != nil {
+		db.hashIndex.expires.update(fe, expiredAt)
+		return
+	}
+	db.hashIndex.expires.push(&fieldExpire{key: key, encKey: append([]byte(nil), encKey...), expiredAt: expiredAt})
+	db.hashIndex.volatile[key]++
+}
+
+// removeFieldExpire removes the ttl fe, the lock of hashIndex must be held.
+func (db *BitcaskDB) removeFieldExpire(fe *fieldExpire) {
+	db.hashIndex.expires.remove(fe)
+	if db.hashIndex.volatile[fe.key] <= 1 {
+		delete(db.hashIndex.volatile, fe.key)
+	} else {
+		db.hashIndex.volatile[fe.key]--
+	}
+}
+
+// loadFieldExpires adds the ttls of the hash fields after all the log files are loaded.
+func (db *BitcaskDB) loadFieldExpires() error {
+	keys := db.hashIndex.volatile
+	db.hashIndex.volatile = make(map[string]int)
+	for key := range keys {
+		idxTree := db.hashIndex.trees[key]
+		if idxTree == nil {
+			continue
+		}
+		iter := idxTree.Iterator()
+		for iter.HasNext() {
+			node, err := iter.Next()
+			if err != nil {
+				return err
+			}
+			if idxNode, _ := node.Value().(*indexNode); idxNode != nil && idxNode.expiredAt != 0 {
+				db.addFieldExpire(key, node.Key(), idxNode.expiredAt)
+			}
+		}
+	}
+	return nil
+}
+
+// hashAlive returns whether the hash stored at key has any field which is not expired.
+// Keys of hashes are kept in the keyspace until their expired fields are deleted, so the keyspace is not enough.
+func (db *BitcaskDB) hashAlive(key []byte) bool {
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		return false
+	}
+	if _, ok := db.hashIndex.volatile[string(key)]; !ok {
+		return idxTree.Size() > 0
+	}
+	now := time.Now().UnixMilli()
+	iter := idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			return false
+		}
+		if idxNode, _ := node.Value().(*indexNode); idxNode != nil && !idxNode.expired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldExpire is the ttl of a field of the hash stored at key.
+type fieldExpire struct {
+	key       string
+	encKey    []byte
+	expiredAt int64
+	index     int // The index in the heap.
+}
+
+// fieldExpires is a min heap of the ttls of the hash fields ordered by the expiration time,
+// and the ttls are indexed by the encoded keys of the fields, so the ttl of a field is updated in place.
+type fieldExpires struct {
+	items []*fieldExpire
+	keys  map[string]*fieldExpire
+}
+
+func newFieldExpires() *fieldExpires {
+	return &fieldExpires{keys: make(map[string]*fieldExpire)}
+}
+
+func (fes *fieldExpires) Len() int { return len(fes.items) }
+
+func (fes *fieldExpires) Less(i, j int) bool { return fes.items[i].expiredAt < fes.items[j].expiredAt }
+
+func (fes *fieldExpires) Swap(i, j int) {
+	fes.items[i], fes.items[j] = fes.items[j], fes.items[i]
+	fes.items[i].index = i
+	fes.items[j].index = j
+}
+
+func (fes *fieldExpires) Push(x interface{}) {
+	fe := x.(*fieldExpire)
+	fe.index = len(fes.items)
+	fes.items = append(fes.items, fe)
+}
+
+func (fes *fieldExpires) Pop() interface{} {
+	n := len(fes.items)
+	fe := fes.items[n-1]
+	fes.items[n-1] = nil
+	fes.items = fes.items[:n-1]
+	return fe
+}
+
+func (fes *fieldExpires) get(encKey []byte) *fieldExpire {
+	return fes.keys[string(encKey)]
+}
+
+// peek returns the ttl which expires first, nil is returned if there is none.
+func (fes *fieldExpires) peek() *fieldExpire {
+	if len(fes.items) == 0 {
+		return nil
+	}
+	return fes.items[0]
+}
+
+func (fes *fieldExpires) push(fe *fieldExpire) {
+	heap.Push(fes, fe)
+	fes.keys[string(fe.encKey)] = fe
+}
+
+func (fes *fieldExpires) update(fe *fieldExpire, expiredAt int64) {
+	fe.expiredAt = expiredAt
+	heap.Fix(fes, fe.index)
+}
+
+func (fes *fieldExpires) remove(fe *fieldExpire) {
+	heap.Remove(fes, fe.index)
+	delete(fes.keys, string(fe.encKey))
 }
@@ -0,0 +1,339 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_HashFieldsExpired(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	// the expired fields are not deleted in background.
+	opts.HashFieldExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	key := []byte("h")
+
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v"), []byte("f2"), []byte("v")))
+	res, err := db.HExpire(key, 20*time.Millisecond, ExpireAlways, []byte("f1"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldUpdated, HFieldUpdated}, res)
+	assert.Equal(t, 1, db.Exists(key))
+	assert.Equal(t, typeNameHash, db.Type(key))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, 0, db.HLen(key))
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Equal(t, typeNameNone, db.Type(key))
+	_, keys, err := db.Scan(nil, nil, 10, "")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	assert.Nil(t, db.expireHashFields())
+	assert.Equal(t, 0, db.hashIndex.expires.Len())
+	assert.Empty(t, db.hashIndex.volatile)
+	assert.Equal(t, 0, db.keyspace.idxTree.Size())
+}
+
+func TestBitcaskDB_ExpireHashFieldsBounded(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.HashFieldExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("h")
+
+	n := hashFieldExpireLimit + 10
+	for i := 0; i < n; i++ {
+		assert.Nil(t, db.HSet(key, []byte("f"+strconv.Itoa(i)), []byte("v")))
+	}
+	assert.Nil(t, db.HSet(key, []byte("alive"), []byte("v")))
+	// the fields must not expire before they are all set.
+	expireAt := time.Now().Add(300 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		_, err = db.HExpire(key, time.Hour, ExpireAlways, []byte("f"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+		// the ttl of a field is replaced, not added again.
+		_, err = db.HExpireAt(key, expireAt, ExpireAlways, []byte("f"+strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, n, db.hashIndex.expires.Len())
+	// the ttl of a persisted field is left, and skipped when it is reached.
+	res, err := db.HPersist(key, []byte("f0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldUpdated}, res)
+
+	time.Sleep(time.Until(expireAt) + 10*time.Millisecond)
+	assert.Nil(t, db.expireHashFields())
+	assert.Equal(t, n-hashFieldExpireLimit, db.hashIndex.expires.Len())
+	assert.Nil(t, db.expireHashFields())
+	assert.Equal(t, 0, db.hashIndex.expires.Len())
+	assert.Equal(t, 2, db.HLen(key))
+
+	// the ttls are loaded again after restart.
+	expireAt = time.Now().Add(300 * time.Millisecond)
+	_, err = db.HExpireAt(key, expireAt, ExpireAlways, []byte("alive"))
+	assert.Nil(t, err)
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, 1, db.hashIndex.expires.Len())
+	time.Sleep(time.Until(expireAt) + 10*time.Millisecond)
+	assert.Nil(t, db.expireHashFields())
+	assert.Equal(t, 1, db.HLen(key))
+	assert.Equal(t, 1, db.Exists(key))
+}
+
+func TestBitcaskDB_HIncrByFloat(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("h")
+	assert.Nil(t, db.HSet(key, []byte("f"), []byte("2.5"), []byte("int"), []byte("3"), []byte("str"), []byte("abc"),
+		[]byte("nan"), []byte("nan"), []byte("max"), []byte("1.7e308")))
+	assert.Nil(t, db.Set([]byte("s"), []byte("v")))
+
+	tests := []struct {
+		name  string
+		key   string
+		field string
+		incr  float64
+		want  float64
+		err   error
+	}{
+		{"float", "h", "f", 0.25, 2.75, nil},
+		{"integer", "h", "int", -0.5, 2.5, nil},
+		{"new field", "h", "new", 1.5, 1.5, nil},
+		{"new key", "h2", "f", -1, -1, nil},
+		{"not a float", "h", "str", 1, 0, ErrWrongFloatType},
+		{"nan value", "h", "nan", 1, 0, ErrWrongFloatType},
+		{"overflow", "h", "max", 1.7e308, 0, ErrFloatOverflow},
+		{"infinite increment", "h", "f", math.Inf(1), 0, ErrFloatOverflow},
+		{"wrong type", "s", "f", 1, 0, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := db.HIncrByFloat([]byte(tt.key), []byte(tt.field), tt.incr)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+
+	// the ttl of the field is kept.
+	_, err = db.HExpire(key, time.Hour, ExpireAlways, []byte("f"))
+	assert.Nil(t, err)
+	res, err := db.HIncrByFloat(key, []byte("f"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.75, res)
+
+	db = reopenTestDB(t, db, opts)
+	val, err := db.HGet(key, []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, "3.75", string(val))
+	ttls, err := db.HTTL(key, []byte("f"), []byte("int"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3600, HFieldNoTTL}, ttls)
+	val, err = db.HGet(key, []byte("max"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.7e308", string(val))
+}
+
+func TestBitcaskDB_HRandField(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("h")
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f3"), []byte("v3")))
+	assert.Nil(t, db.Set([]byte("s"), []byte("v")))
+	all := []string{"f1", "f2", "f3"}
+
+	tests := []struct {
+		name       string
+		key        string
+		count      int
+		withValues bool
+		n          int
+		distinct   bool
+		err        error
+	}{
+		{"zero count", "h", 0, false, 0, true, nil},
+		{"less than size", "h", 2, false, 2, true, nil},
+		{"more than size", "h", 5, false, 3, true, nil},
+		{"negative count", "h", -5, false, 5, false, nil},
+		{"with values", "h", 2, true, 2, true, nil},
+		{"negative with values", "h", -4, true, 4, false, nil},
+		{"missing key", "missing", 3, false, 0, true, nil},
+		{"wrong type", "s", 1, false, 0, true, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := db.HRandField([]byte(tt.key), tt.count, tt.withValues)
+			assert.Equal(t, tt.err, err)
+			fields := toStrings(res)
+			if tt.withValues {
+				assert.Len(t, res, 2*tt.n)
+				fields = fields[:0]
+				for i := 0; i < len(res); i += 2 {
+					assert.Equal(t, "v"+string(res[i][1:]), string(res[i+1]))
+					fields = append(fields, string(res[i]))
+				}
+			}
+			assert.Len(t, fields, tt.n)
+			for _, field := range fields {
+				assert.Contains(t, all, field)
+			}
+			if tt.distinct {
+				seen := make(map[string]bool)
+				for _, field := range fields {
+					assert.False(t, seen[field], field)
+					seen[field] = true
+				}
+			}
+		})
+	}
+}
+
+func TestBitcaskDB_HGetDel(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("h")
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f3"), []byte("v3")))
+	assert.Nil(t, db.Set([]byte("s"), []byte("v")))
+
+	tests := []struct {
+		name   string
+		key    string
+		fields []string
+		want   [][]byte
+		len    int
+		err    error
+	}{
+		{"some fields", "h", []string{"f1", "missing", "f1"}, [][]byte{[]byte("v1"), nil, nil}, 2, nil},
+		{"missing key", "missing", []string{"f1"}, [][]byte{nil}, 0, nil},
+		{"wrong type", "s", []string{"f1"}, nil, 0, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vals, err := db.HGetDel([]byte(tt.key), keysOf(tt.fields...)...)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, vals)
+			assert.Equal(t, tt.len, db.HLen([]byte(tt.key)))
+		})
+	}
+
+	db = reopenTestDB(t, db, opts)
+	vals, err := db.HMGet(key, []byte("f1"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{nil, []byte("v2")}, vals)
+	// the key is removed once the hash is empty.
+	vals, err = db.HGetDel(key, []byte("f2"), []byte("f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v2"), []byte("v3")}, vals)
+	assert.Equal(t, typeNameNone, db.Type(key))
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, 0, db.Exists(key))
+}
+
+func TestBitcaskDB_HSetEx(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("h")
+	assert.Nil(t, db.HSet(key, []byte("f1"), []byte("v1")))
+	assert.Nil(t, db.Set([]byte("s"), []byte("v")))
+
+	tests := []struct {
+		name string
+		key  string
+		cond HSetCondition
+		args []string
+		ok   bool
+		want map[string]string
+		err  error
+	}{
+		{"none exist", "h", HSetIfNoneExist, []string{"f2", "v2", "f3", "v3"}, true,
+			map[string]string{"f1": "v1", "f2": "v2", "f3": "v3"}, nil},
+		{"none exist fails", "h", HSetIfNoneExist, []string{"f4", "v4", "f1", "x"}, false,
+			map[string]string{"f1": "v1", "f2": "v2", "f3": "v3"}, nil},
+		{"all exist", "h", HSetIfAllExist, []string{"f1", "x1", "f2", "x2"}, true,
+			map[string]string{"f1": "x1", "f2": "x2", "f3": "v3"}, nil},
+		{"all exist fails", "h", HSetIfAllExist, []string{"f3", "y", "f4", "v4"}, false,
+			map[string]string{"f1": "x1", "f2": "x2", "f3": "v3"}, nil},
+		{"always", "h", HSetAlways, []string{"f3", "y", "f4", "v4"}, true,
+			map[string]string{"f1": "x1", "f2": "x2", "f3": "y", "f4": "v4"}, nil},
+		{"all exist on missing key", "h2", HSetIfAllExist, []string{"f1", "v1"}, false, map[string]string{}, nil},
+		{"none exist on missing key", "h2", HSetIfNoneExist, []string{"f1", "v1"}, true, map[string]string{"f1": "v1"}, nil},
+		{"odd arguments", "h2", HSetAlways, []string{"f1", "v1", "f2"}, false, map[string]string{"f1": "v1"}, ErrWrongNumberOfArgs},
+		{"no arguments", "h2", HSetAlways, nil, false, map[string]string{"f1": "v1"}, ErrWrongNumberOfArgs},
+		{"wrong type", "s", HSetAlways, []string{"f1", "v1"}, false, nil, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := db.HSetEx([]byte(tt.key), tt.cond, keysOf(tt.args...)...)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.ok, ok)
+			if tt.want == nil {
+				return
+			}
+			pairs, err := db.HGetAll([]byte(tt.key))
+			assert.Nil(t, err)
+			got := make(map[string]string)
+			for i := 0; i < len(pairs); i += 2 {
+				got[string(pairs[i])] = string(pairs[i+1])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// the ttl of an overwritten field is removed.
+	_, err := db.HExpire(key, time.Hour, ExpireAlways, []byte("f1"))
+	assert.Nil(t, err)
+	ok, err := db.HSetEx(key, HSetIfAllExist, []byte("f1"), []byte("z"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ttls, err := db.HTTL(key, []byte("f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{HFieldNoTTL}, ttls)
+}
+
+func TestBitcaskDB_HashFieldsExpiredReopen(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.HashFieldExpireInterval = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key, gone := []byte("h"), []byte("gone")
+
+	assert.Nil(t, db.HSet(key, []byte("short"), []byte("v"), []byte("long"), []byte("v"), []byte("none"), []byte("v")))
+	assert.Nil(t, db.HSet(gone, []byte("f"), []byte("v")))
+	_, err = db.HExpire(key, 50*time.Millisecond, ExpireAlways, []byte("short"))
+	assert.Nil(t, err)
+	_, err = db.HExpire(key, time.Hour, ExpireAlways, []byte("long"))
+	assert.Nil(t, err)
+	_, err = db.HExpire(gone, 50*time.Millisecond, ExpireAlways, []byte("f"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	// the fields expire while the db is closed.
+	time.Sleep(60 * time.Millisecond)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	val, err := db.HGet(key, []byte("short"))
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, 2, db.HLen(key))
+	ttls, err := db.HTTL(key, []byte("short"), []byte("long"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{HFieldNotExist, 3600, HFieldNoTTL}, ttls)
+	assert.Equal(t, 0, db.HLen(gone))
+	assert.Equal(t, 0, db.Exists(gone))
+	assert.Equal(t, typeNameNone, db.Type(gone))
+
+	// the expired fields are deleted and the deletion survives another restart.
+	assert.Nil(t, db.expireHashFields())
+	assert.Equal(t, 1, db.hashIndex.expires.Len())
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, 1, db.hashIndex.expires.Len())
+	assert.Equal(t, 2, db.HLen(key))
+	assert.Equal(t, 0, db.Exists(gone))
+}
@@ -38,7 +38,7 @@ func (db *BitcaskDB) buildIndex(dataType DataType, ent *logfile.LogEntry, pos *v
 }
 
 func (db *BitcaskDB) buildStrsIndex(ent *logfile.LogEntry, pos *valuePos) {
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	if ent.Type == logfile.TypeDelete || (ent.ExpiredAt != 0 && ent.ExpiredAt < ts) {
 		db.strIndex.idxTree.Delete(ent.Key)
 		return
@@ -54,6 +54,11 @@ func (db *BitcaskDB) buildStrsIndex(ent *logfile.LogEntry, pos *valuePos) {
 }
 
 func (db *BitcaskDB) buildListIndex(ent *logfile.LogEntry, pos *valuePos) {
+	if ent.Type == logfile.TypeKeyDelete {
+		db.detachOnLoad(ent.Key, List, db.listIndex.trees[string(ent.Key)])
+		delete(db.listIndex.trees, string(ent.Key))
+		return
+	}
 	key := ent.Key
 	if ent.Type != logfile.TypeListMeta {
 		key = key[4:]
@@ -65,6 +70,7 @@ func (db *BitcaskDB) buildListIndex(ent *logfile.LogEntry, pos *valuePos) {
 	idxTree := db.listIndex.trees[string(key)]
 	if ent.Type == logfile.TypeDelete {
 		idxTree.Delete(ent.Key)
+		db.deleteOnLoad(key, List, ent.Key)
 		return
 	}
 	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
@@ -79,6 +85,12 @@ func (db *BitcaskDB) buildListIndex(ent *logfile.LogEntry, pos *valuePos) {
 }
 
 func (db *BitcaskDB) buildHashIndex(ent *logfile.LogEntry, pos *valuePos) {
+	if ent.Type == logfile.TypeKeyDelete {
+		db.detachOnLoad(ent.Key, Hash, db.hashIndex.trees[string(ent.Key)])
+		delete(db.hashIndex.trees, string(ent.Key))
+		delete(db.hashIndex.volatile, string(ent.Key))
+		return
+	}
 	encKey := ent.Key
 	// fmt.Println(len(encKey))
 	key, _ := db.decodeKey(encKey)
@@ -91,6 +103,7 @@ func (db *BitcaskDB) buildHashIndex(ent *logfile.LogEntry, pos *valuePos) {
 
 	if ent.Type == logfile.TypeDelete {
 		idxTree.Delete(ent.Key)
+		db.deleteOnLoad(key, Hash, ent.Key)
 		return
 	}
 	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
@@ -99,26 +112,34 @@ func (db *BitcaskDB) buildHashIndex(ent *logfile.LogEntry, pos *valuePos) {
 	}
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
+		// the ttls are added once all the log files are loaded, the entry may be overwritten later.
+		db.hashIndex.volatile[string(key)] = 0
 	}
 	idxTree.Put(ent.Key, idxNode)
 }
 
 func (db *BitcaskDB) buildSetIndex(ent *logfile.LogEntry, pos *valuePos) {
+	if ent.Type == logfile.TypeKeyDelete {
+		db.detachOnLoad(ent.Key, Set, db.setIndex.trees[string(ent.Key)])
+		delete(db.setIndex.trees, string(ent.Key))
+		return
+	}
 	if db.setIndex.trees[string(ent.Key)] == nil {
 		db.setIndex.trees[string(ent.Key)] = art.NewART()
 	}
 	idxTree := db.setIndex.trees[string(ent.Key)]
 
-	if err := db.setIndex.murhash.Write(ent.Value); err != nil {
+	mkey, err := memberKey(ent.Value)
+	if err != nil {
 		log.Fatalf("fail to write murmur hash: %v", err)
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
 
 	if ent.Type == logfile.TypeDelete {
 		// In ROSEDB, the author code as follow:
 		// idxTree.Delete(ent.Value)
-		idxTree.Delete(sum)
+		idxTree.Delete(mkey)
+		db.deleteOnLoad(ent.Key, Set, mkey)
+		return
 	}
 
 	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
@@ -128,15 +149,31 @@ func (db *BitcaskDB) buildSetIndex(ent *logfile.LogEntry, pos *valuePos) {
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
 	}
-	idxTree.Put(sum, idxNode)
+	idxTree.Put(mkey, idxNode)
 }
 
 func (db *BitcaskDB) buildZSetIndex(ent *logfile.LogEntry, pos *valuePos) {
-	// type == delete :	key----key, value----sum
+	if ent.Type == logfile.TypeKeyDelete {
+		db.detachOnLoad(ent.Key, ZSet, db.zsetIndex.trees[string(ent.Key)])
+		delete(db.zsetIndex.trees, string(ent.Key))
+		db.zsetIndex.indexes.ZClear(string(ent.Key))
+		return
+	}
+	// type == delete :	key----key, value----memberKey, or only the sum of member written by older versions.
 	if ent.Type == logfile.TypeDelete {
-		db.zsetIndex.indexes.ZRem(string(ent.Key), string(ent.Value))
-		if db.zsetIndex.trees[string(ent.Key)] != nil {
-			db.zsetIndex.trees[string(ent.Key)].Delete(ent.Value)
+		db.deleteOnLoad(ent.Key, ZSet, ent.Value)
+		idxTree := db.zsetIndex.trees[string(ent.Key)]
+		if idxTree == nil {
+			return
+		}
+		mkeys := [][]byte{ent.Value}
+		// the keys of older versions are the sums, which are the prefixes of the keys now.
+		if len(memberOf(ent.Value)) == 0 && idxTree.Get(ent.Value) == nil {
+			mkeys = idxTree.PrefixScan(ent.Value, idxTree.Size())
+		}
+		for _, mkey := range mkeys {
+			db.zsetIndex.indexes.ZRem(string(ent.Key), string(mkey))
+			idxTree.Delete(mkey)
 		}
 		return
 	}
@@ -149,24 +186,23 @@ func (db *BitcaskDB) buildZSetIndex(ent *logfile.LogEntry, pos *valuePos) {
 	}
 	idxTree := db.zsetIndex.trees[string(key)]
 
-	if err := db.zsetIndex.murhash.Write(ent.Value); err != nil {
+	mkey, err := memberKey(ent.Value)
+	if err != nil {
 		return
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
 
 	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
 	if db.opts.IndexMode == options.KeyValueMemMode {
 		idxNode.value = ent.Value
 	}
-	idxTree.Put(sum, idxNode)
+	idxTree.Put(mkey, idxNode)
 
 	score, err := util.StrToFloat64(string(scoreBuf))
 	if err != nil {
 		return
 	}
 
-	db.zsetIndex.indexes.ZAdd(string(key), score, string(sum))
+	db.zsetIndex.indexes.ZAdd(string(key), score, string(mkey))
 }
 
 func (db *BitcaskDB) updateIndexTree(idxTree *art.AdaptiveRadixTree,
@@ -181,12 +217,18 @@ func (db *BitcaskDB) updateIndexTree(idxTree *art.AdaptiveRadixTree,
 		idxNode.expiredAt = entry.ExpiredAt
 	}
 	oldVal, updated := idxTree.Put(entry.Key, idxNode)
+	db.trackMemory(entry.Key, idxNode, oldVal)
 	if sendDiscard {
 		db.sendDiscard(oldVal, updated, dType)
 	}
 	return nil
 }
 
+// expired returns whether the node has a ttl and is expired at now(unix milliseconds).
+func (idxNode *indexNode) expired(now int64) bool {
+	return idxNode.expiredAt != 0 && idxNode.expiredAt <= now
+}
+
 func (db *BitcaskDB) getVal(idxTree *art.AdaptiveRadixTree, key []byte, dataType DataType) ([]byte, error) {
 	rawData := idxTree.Get(key)
 	if rawData == nil {
@@ -197,7 +239,7 @@ func (db *BitcaskDB) getVal(idxTree *art.AdaptiveRadixTree, key []byte, dataType
 		return nil, ErrKeyNotFound
 	}
 
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	if idxNode.expiredAt != 0 && idxNode.expiredAt <= ts {
 		// I should probably delete the node this time...
 		return nil, ErrKeyNotFound
@@ -236,7 +278,7 @@ func (db *BitcaskDB) getIndexNode(idxTree *art.AdaptiveRadixTree, key []byte, da
 		return nil, ErrKeyNotFound
 	}
 
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	if idxNode.expiredAt != 0 && idxNode.expiredAt < ts {
 		return nil, ErrKeyNotFound
 	}
@@ -264,7 +306,7 @@ func (db *BitcaskDB) LoadIndexFromLogFiles() error {
 				log.Fatalf("log file is nil, failed to open db")
 			}
 
-			var offset int64
+			var offset int64 = logfile.SegmentHeaderSize
 			for {
 				entry, eSize, err := logFile.ReadLogEntry(offset)
 				if err != nil {
@@ -289,5 +331,8 @@ func (db *BitcaskDB) LoadIndexFromLogFiles() error {
 		go iteratorAndHandle(DataType(i), wg)
 	}
 	wg.Wait()
-	return nil
+	if err := db.pruneLists(); err != nil {
+		return err
+	}
+	return db.loadFieldExpires()
 }
@@ -0,0 +1,241 @@
+package bitcask
+
+import (
+	art "bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/log"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWrongType operation against a key holding the wrong kind of value.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// type names returned by Type, same as redis.
+const (
+	typeNameNone   = "none"
+	typeNameString = "string"
+	typeNameList   = "list"
+	typeNameHash   = "hash"
+	typeNameSet    = "set"
+	typeNameZSet   = "zset"
+)
+
+var typeNames = map[DataType]string{
+	String: typeNameString,
+	List:   typeNameList,
+	Hash:   typeNameHash,
+	Set:    typeNameSet,
+	ZSet:   typeNameZSet,
+}
+
+// keyspace records the type of every alive key, so a key can only hold one type of value at the same time.
+// The lock of keyspace must be acquired after the lock of the data type index, and is never held while
+// acquiring other locks.
+type keyspace struct {
+	mu      *sync.RWMutex
+	idxTree *art.AdaptiveRadixTree
+	counts  map[DataType]int // Number of keys of each type, including the expired keys which are not removed yet.
+}
+
+type keyMeta struct {
+	access    int64  // Time of the last access in milliseconds, used by eviction, updated atomically.
+	freq      uint32 // Logarithmic access counter, used by eviction, updated atomically.
+	dataType  DataType
+	expiredAt int64 // unix milliseconds, only strings can expire now.
+}
+
+func newKeyMeta(dataType DataType, expiredAt int64) *keyMeta {
+	meta := &keyMeta{dataType: dataType, expiredAt: expiredAt, freq: lfuInitVal}
+	meta.touch()
+	return meta
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{idxTree: art.NewART(), mu: new(sync.RWMutex), counts: make(map[DataType]int)}
+}
+
+// reset removes all the keys, it is called by Flush.
+func (ks *keyspace) reset() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.idxTree = art.NewART()
+	ks.counts = make(map[DataType]int)
+}
+
+// put sets the meta of key and updates the counters, the lock must be held.
+func (ks *keyspace) put(key []byte, meta *keyMeta) {
+	oldVal, _ := ks.idxTree.Put(key, meta)
+	if old, _ := oldVal.(*keyMeta); old != nil {
+		ks.counts[old.dataType]--
+	}
+	ks.counts[meta.dataType]++
+}
+
+// delete removes key and updates the counters, the lock must be held.
+func (ks *keyspace) delete(key []byte) {
+	oldVal, _ := ks.idxTree.Delete(key)
+	if old, _ := oldVal.(*keyMeta); old != nil {
+		ks.counts[old.dataType]--
+	}
+}
+
+// get returns the meta of an alive key, expired keys are treated as not exist.
+func (ks *keyspace) get(key []byte) *keyMeta {
+	meta, _ := ks.idxTree.Get(key).(*keyMeta)
+	if meta == nil {
+		return nil
+	}
+	if meta.expiredAt != 0 && meta.expiredAt <= time.Now().UnixMilli() {
+		return nil
+	}
+	return meta
+}
+
+// typeOf returns the type of the value stored at key, false is returned if key does not exist.
+func (ks *keyspace) typeOf(key []byte) (DataType, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	meta := ks.get(key)
+	if meta == nil {
+		return 0, false
+	}
+	return meta.dataType, true
+}
+
+// check returns ErrWrongType if key holds a value of another type.
+func (ks *keyspace) check(key []byte, dataType DataType) error {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	meta := ks.get(key)
+	if meta == nil {
+		return nil
+	}
+	if meta.dataType != dataType {
+		return ErrWrongType
+	}
+	meta.touch()
+	return nil
+}
+
+// keyClaim is what claim changed in the keyspace, so it can be rolled back if the value fails to be written.
+type keyClaim struct {
+	ks        *keyspace
+	key       []byte
+	meta      *keyMeta
+	created   bool  // The key didn't exist before the claim.
+	expiredAt int64 // The expire time of the key before the claim.
+}
+
+// claim records that key holds a value of dataType, must be called before writing the value.
+// It returns ErrWrongType if key holds a value of another type.
+// The claim must be rolled back if the value fails to be written, otherwise the key exists without a value.
+func (ks *keyspace) claim(key []byte, dataType DataType, expiredAt int64) (keyClaim, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	meta := ks.get(key)
+	if meta != nil && meta.dataType != dataType {
+		return keyClaim{}, ErrWrongType
+	}
+	// keep the meta of an existing key, so its access history is not lost.
+	if meta == nil {
+		meta = newKeyMeta(dataType, expiredAt)
+		ks.put(key, meta)
+		return keyClaim{ks: ks, key: key, meta: meta, created: true}, nil
+	}
+	claim := keyClaim{ks: ks, key: key, meta: meta, expiredAt: meta.expiredAt}
+	meta.expiredAt = expiredAt
+	meta.touch()
+	return claim, nil
+}
+
+// rollback undoes the claim, the lock of the data type index must be held since the claim.
+func (c keyClaim) rollback() {
+	c.ks.mu.Lock()
+	defer c.ks.mu.Unlock()
+
+	// the keyspace may be reset by Flush.
+	if meta, _ := c.ks.idxTree.Get(c.key).(*keyMeta); meta != c.meta {
+		return
+	}
+	if c.created {
+		c.ks.delete(c.key)
+		return
+	}
+	c.meta.expiredAt = c.expiredAt
+}
+
+// release removes key if it holds a value of dataType, it is called when the value is deleted or becomes empty.
+func (ks *keyspace) release(key []byte, dataType DataType) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	meta, _ := ks.idxTree.Get(key).(*keyMeta)
+	if meta != nil && meta.dataType == dataType {
+		ks.delete(key)
+	}
+}
+
+// Type returns the string representation of the type of the value stored at key.
+// The different types that can be returned are: string, list, set, zset and hash.
+// If key does not exist, none is returned.
+func (db *BitcaskDB) Type(key []byte) string {
+	dataType, ok := db.typeOf(key)
+	if !ok {
+		return typeNameNone
+	}
+	return typeNames[dataType]
+}
+
+// buildKeyspace builds the keyspace from all the indexes after they are loaded from log files.
+func (db *BitcaskDB) buildKeyspace() {
+	ks := db.keyspace
+	add := func(key []byte, dataType DataType, expiredAt int64) {
+		if meta := ks.get(key); meta != nil {
+			// the same key may hold values of different types which are written by older versions,
+			// only the first one can be accessed.
+			log.Infof("key %q holds both %s and %s, the %s value is ignored",
+				key, typeNames[meta.dataType], typeNames[dataType], typeNames[dataType])
+			return
+		}
+		ks.put(key, newKeyMeta(dataType, expiredAt))
+	}
+
+	ts := time.Now().UnixMilli()
+	iter := db.strIndex.idxTree.Iterator()
+	for iter.HasNext() {
+		node, err := iter.Next()
+		if err != nil {
+			break
+		}
+		idxNode, _ := node.Value().(*indexNode)
+		if idxNode == nil || (idxNode.expiredAt != 0 && idxNode.expiredAt <= ts) {
+			continue
+		}
+		add(node.Key(), String, idxNode.expiredAt)
+	}
+
+	for key, idxTree := range db.listIndex.trees {
+		if db.listLen(idxTree, []byte(key)) > 0 {
+			add([]byte(key), List, 0)
+		}
+	}
+	for key, idxTree := range db.hashIndex.trees {
+		if db.hLen([]byte(key), idxTree) > 0 {
+			add([]byte(key), Hash, 0)
+		}
+	}
+	for key, idxTree := range db.setIndex.trees {
+		if idxTree.Size() > 0 {
+			add([]byte(key), Set, 0)
+		}
+	}
+	for key := range db.zsetIndex.trees {
+		if db.zsetIndex.indexes.ZCard(key) > 0 {
+			add([]byte(key), ZSet, 0)
+		}
+	}
+}
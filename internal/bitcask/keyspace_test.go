@@ -0,0 +1,109 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/options"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_ClaimRollback(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.IoType = logfile.FileIO
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	key, newKey := []byte("k"), []byte("new")
+	assert.Nil(t, db.Set(key, []byte("v")))
+	assert.Nil(t, db.ZAdd([]byte("z"), 1, []byte("m")))
+	// the writes fail once the active log files are closed.
+	assert.Nil(t, db.activateLogFile[String].Close())
+	assert.Nil(t, db.activateLogFile[ZSet].Close())
+
+	assert.NotNil(t, db.SetEX(key, []byte("v2"), time.Hour))
+	assert.Equal(t, int64(0), db.keyspace.get(key).expiredAt)
+	assert.NotNil(t, db.Set(newKey, []byte("v")))
+	assert.Equal(t, 0, db.Exists(newKey))
+	assert.NotNil(t, db.ZAdd(newKey, 1, []byte("m")))
+	assert.Equal(t, 0, db.Exists(newKey))
+	assert.Nil(t, db.zsetIndex.trees[string(newKey)])
+	stats, err := db.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Keys)
+
+	// the key is free to hold a value of another type.
+	assert.Nil(t, db.HSet(newKey, []byte("f"), []byte("v")))
+	assert.Equal(t, "hash", db.Type(newKey))
+}
+
+func TestBitcaskDB_StatsKeys(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	assertKeys := func(db *BitcaskDB, want map[string]int) {
+		stats, err := db.Stats()
+		assert.Nil(t, err)
+		var keys int
+		for _, n := range want {
+			keys += n
+		}
+		assert.Equal(t, keys, stats.Keys)
+		assert.Equal(t, want, stats.TypeKeys)
+	}
+
+	assert.Nil(t, db.Set([]byte("s1"), []byte("v")))
+	assert.Nil(t, db.Set([]byte("s2"), []byte("v")))
+	assert.Nil(t, db.HSet([]byte("h"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("l"), []byte("a")))
+	assert.Nil(t, db.ZAdd([]byte("z"), 1, []byte("m")))
+	assertKeys(db, map[string]int{"string": 2, "hash": 1, "list": 1, "zset": 1})
+
+	// the key holds a value of another type after it is deleted.
+	_, err = db.Del([]byte("s2"))
+	assert.Nil(t, err)
+	_, err = db.SAdd([]byte("s2"), []byte("m"))
+	assert.Nil(t, err)
+	_, err = db.LPop([]byte("l"))
+	assert.Nil(t, err)
+	assertKeys(db, map[string]int{"string": 1, "hash": 1, "set": 1, "zset": 1})
+
+	db = reopenTestDB(t, db, opts)
+	assertKeys(db, map[string]int{"string": 1, "hash": 1, "set": 1, "zset": 1})
+
+	assert.Nil(t, db.Flush())
+	assertKeys(db, map[string]int{})
+}
+
+func TestBitcaskDB_ReadWrongType(t *testing.T) {
+	db := openTestDB(t)
+	str, list, zset := []byte("str"), []byte("list"), []byte("zset")
+	assert.Nil(t, db.Set(str, []byte("v")))
+	assert.Nil(t, db.RPush(list, []byte("a")))
+	assert.Nil(t, db.ZAdd(zset, 1, []byte("m")))
+
+	_, err := db.LLen(str)
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.StrLen(list)
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.ZCard(str)
+	assert.Equal(t, ErrWrongType, err)
+	_, _, err = db.ZScore(list, []byte("m"))
+	assert.Equal(t, ErrWrongType, err)
+	_, _, err = db.ZRank(str, []byte("m"))
+	assert.Equal(t, ErrWrongType, err)
+	_, _, err = db.ZRevRank(list, []byte("m"))
+	assert.Equal(t, ErrWrongType, err)
+
+	// missing keys are still empty.
+	n, err := db.StrLen([]byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	ok, rank, err := db.ZRank(zset, []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, rank)
+}
@@ -3,15 +3,25 @@ package bitcask
 import (
 	art "bitcaskDB/internal/ds/art"
 	"bitcaskDB/internal/logfile"
+	"bytes"
+	"context"
 	"encoding/binary"
 )
 
 // LPush insert all the specified values at the head of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operations.
 func (db *BitcaskDB) LPush(key []byte, values ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
 
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
 	if db.listIndex.trees[string(key)] == nil {
 		db.listIndex.trees[string(key)] = art.NewART()
 	}
@@ -27,9 +37,17 @@ func (db *BitcaskDB) LPush(key []byte, values ...[]byte) error {
 // RPush insert all the specified values at the tail of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operations.
 func (db *BitcaskDB) RPush(key []byte, values ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
 
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
 	if db.listIndex.trees[string(key)] == nil {
 		db.listIndex.trees[string(key)] = art.NewART()
 	}
@@ -46,10 +64,18 @@ func (db *BitcaskDB) RPush(key []byte, values ...[]byte) error {
 // only if key already exists and holds a list.
 // In contrary to LPUSH, no operation will be performed when key does not yet exist.
 func (db *BitcaskDB) LPushX(key []byte, values ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
 
-	if db.listIndex.trees[string(key)] == nil {
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
+	if db.listIndex.trees[string(key)] == nil || db.Type(key) == typeNameNone {
 		return ErrKeyNotFound
 	}
 
@@ -65,10 +91,18 @@ func (db *BitcaskDB) LPushX(key []byte, values ...[]byte) error {
 // only if key already exists and holds a list.
 // In contrary to RPUSH, no operation will be performed when key does not yet exist.
 func (db *BitcaskDB) RPushX(key []byte, values ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
 
-	if db.listIndex.trees[string(key)] == nil {
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
+	if db.listIndex.trees[string(key)] == nil || db.Type(key) == typeNameNone {
 		return ErrKeyNotFound
 	}
 
@@ -84,6 +118,10 @@ func (db *BitcaskDB) RPushX(key []byte, values ...[]byte) error {
 func (db *BitcaskDB) LPop(key []byte) ([]byte, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return nil, err
+	}
 	return db.popInternal(key, true)
 }
 
@@ -91,15 +129,30 @@ func (db *BitcaskDB) LPop(key []byte) ([]byte, error) {
 func (db *BitcaskDB) RPop(key []byte) ([]byte, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return nil, err
+	}
 	return db.popInternal(key, false)
 }
 
 // LMove atomically returns and removes the first/last element of the list stored at source,
 // and pushes the element at the first/last element of the list stored at destination.
 func (db *BitcaskDB) LMove(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte, error) {
+	if err := db.checkMemory(); err != nil {
+		return nil, err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
 
+	if err := db.keyspace.check(srcKey, List); err != nil {
+		return nil, err
+	}
+	if err := db.keyspace.check(dstKey, List); err != nil {
+		return nil, err
+	}
 	val, err := db.popInternal(srcKey, srcIsLeft)
 
 	if err != nil {
@@ -121,20 +174,15 @@ func (db *BitcaskDB) LMove(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]
 
 // LLen returns the length of the list stored at key.
 // If key does not exist, it is interpreted as an empty list and 0 is returned.
-func (db *BitcaskDB) LLen(key []byte) int {
+// An error is returned when key exists and does not hold a list.
+func (db *BitcaskDB) LLen(key []byte) (int, error) {
 	db.listIndex.mu.RLock()
 	defer db.listIndex.mu.RUnlock()
 
-	idxTree := db.listIndex.trees[string(key)]
-	if idxTree == nil {
-		return 0
-	}
-
-	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
-	if err != nil {
-		return -1
+	if err := db.keyspace.check(key, List); err != nil {
+		return 0, err
 	}
-	return int(tailSeq - headSeq - 1)
+	return db.listLen(db.listIndex.trees[string(key)], key), nil
 }
 
 // LIndex returns the element at index in the list stored at key.
@@ -143,6 +191,9 @@ func (db *BitcaskDB) LIndex(key []byte, index int) ([]byte, error) {
 	db.listIndex.mu.RLock()
 	defer db.listIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, List); err != nil {
+		return nil, err
+	}
 	idxTree := db.listIndex.trees[string(key)]
 	if idxTree == nil {
 		return nil, nil
@@ -152,12 +203,8 @@ func (db *BitcaskDB) LIndex(key []byte, index int) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	seq, err := db.listSequence(headSeq, tailSeq, index)
-	if err != nil {
-		return nil, err
-	}
-	if seq >= tailSeq || seq <= headSeq {
+	seq, ok := db.listSeqAt(idxTree, key, headSeq, tailSeq, index)
+	if !ok {
 		return nil, ErrWrongIndex
 	}
 
@@ -171,9 +218,16 @@ func (db *BitcaskDB) LIndex(key []byte, index int) ([]byte, error) {
 
 // LSet Sets the list element at index to element.
 func (db *BitcaskDB) LSet(key []byte, index int, value []byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
 	idxTree := db.listIndex.trees[string(key)]
 	if idxTree == nil {
 		return ErrKeyNotFound
@@ -183,11 +237,8 @@ func (db *BitcaskDB) LSet(key []byte, index int, value []byte) error {
 	if err != nil {
 		return err
 	}
-	seq, err := db.listSequence(headSeq, tailSeq, index)
-	if err != nil {
-		return err
-	}
-	if seq >= tailSeq || seq <= headSeq {
+	seq, ok := db.listSeqAt(idxTree, key, headSeq, tailSeq, index)
+	if !ok {
 		return ErrWrongIndex
 	}
 
@@ -208,9 +259,19 @@ func (db *BitcaskDB) LSet(key []byte, index int, value []byte) error {
 // If start is larger than the end of the list, an empty list is returned.
 // If stop is larger than the actual end of the list, Redis will treat it like the last element of the list.
 func (db *BitcaskDB) LRange(key []byte, start, end int) (values [][]byte, err error) {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	return db.LRangeCtx(context.Background(), key, start, end)
+}
 
+// LRangeCtx is like LRange, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) LRangeCtx(ctx context.Context, key []byte, start, end int) (values [][]byte, err error) {
+	if err = db.listIndex.mu.rlockCtx(ctx); err != nil {
+		return
+	}
+	defer db.listIndex.mu.RUnlock()
+
+	if err = db.keyspace.check(key, List); err != nil {
+		return
+	}
 	idxTree := db.listIndex.trees[string(key)]
 	if idxTree == nil {
 		err = ErrKeyNotFound
@@ -222,31 +283,28 @@ func (db *BitcaskDB) LRange(key []byte, start, end int) (values [][]byte, err er
 		return
 	}
 
-	startSeq, err := db.listSequence(headSeq, tailSeq, start)
-	if err != nil {
-		return
+	length := db.listLen(idxTree, key)
+	if start < 0 {
+		start += length
 	}
-
-	endSeq, err := db.listSequence(headSeq, tailSeq, end)
-	if err != nil {
-		return
+	if end < 0 {
+		end += length
 	}
-
-	// normalize startSeq
-	if startSeq <= headSeq {
-		startSeq = headSeq + 1
+	if start < 0 {
+		start = 0
 	}
-	// normalize endSeq
-	if endSeq >= tailSeq {
-		endSeq = tailSeq - 1
+	if end >= length {
+		end = length - 1
 	}
-
-	if startSeq >= tailSeq || endSeq <= headSeq || startSeq > endSeq {
+	if start >= length || end < 0 || start > end {
 		err = ErrWrongIndex
 		return
 	}
 
-	for seq := startSeq; seq <= endSeq; seq++ {
+	for _, seq := range db.listSeqs(idxTree, key, headSeq, tailSeq, start, end) {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 		var val []byte
 		encKey := db.encodeListKey(key, seq)
 		val, err = db.getVal(idxTree, encKey, List)
@@ -255,11 +313,462 @@ func (db *BitcaskDB) LRange(key []byte, start, end int) (values [][]byte, err er
 		}
 		values = append(values, val)
 	}
-
 	return
 
 }
 
+// LRem removes the first count occurrences of elements equal to value from the list stored at key.
+// If count > 0, elements are removed moving from head to tail. If count < 0, elements are removed moving
+// from tail to head. If count = 0, all the elements equal to value are removed.
+// The removed elements leave holes in the sequences of the list, so no other element is rewritten.
+// It returns the number of removed elements.
+func (db *BitcaskDB) LRem(key []byte, count int, value []byte) (int, error) {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return 0, err
+	}
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	if err != nil {
+		return 0, err
+	}
+	seqs := db.listSeqs(idxTree, key, headSeq, tailSeq, 0, db.listLen(idxTree, key)-1)
+
+	limit := count
+	if count < 0 {
+		limit = -count
+	}
+	var removed []uint32
+	for i := range seqs {
+		if count != 0 && len(removed) == limit {
+			break
+		}
+		seq := seqs[i]
+		if count < 0 {
+			seq = seqs[len(seqs)-1-i]
+		}
+		val, err := db.getVal(idxTree, db.encodeListKey(key, seq), List)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(val, value) {
+			removed = append(removed, seq)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	for _, seq := range removed {
+		if err = db.deleteListElement(idxTree, db.encodeListKey(key, seq)); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), db.shrinkList(idxTree, key, headSeq, tailSeq)
+}
+
+// LInsert inserts value in the list stored at key either before or after the first element equal to pivot.
+// The value is pushed if it becomes the head or the tail, or fills the hole next to its position, otherwise
+// the list is relocated with the value inserted.
+// It returns the length of the list after the insert operation, or -1 when pivot is not found,
+// and 0 when key does not exist.
+func (db *BitcaskDB) LInsert(key []byte, before bool, pivot, value []byte) (int, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+	defer db.serveBlocked(List)
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return 0, err
+	}
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	if err != nil {
+		return 0, err
+	}
+	length := db.listLen(idxTree, key)
+	if length == 0 {
+		return 0, nil
+	}
+	seqs := db.listSeqs(idxTree, key, headSeq, tailSeq, 0, length-1)
+	old, err := db.listValues(idxTree, key, seqs)
+	if err != nil {
+		return 0, err
+	}
+
+	at := -1
+	for i, val := range old {
+		if bytes.Equal(val, pivot) {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return -1, nil
+	}
+	if !before {
+		at++
+	}
+
+	switch {
+	case at == 0 || at == length:
+		err = db.pushInternal(key, value, at == 0)
+	case seqs[at]-seqs[at-1] > 1:
+		ent := &logfile.LogEntry{Key: db.encodeListKey(key, seqs[at]-1), Value: value}
+		var pos *valuePos
+		if pos, err = db.writeLogEntry(ent, List); err == nil {
+			err = db.updateIndexTree(idxTree, ent, pos, true, List)
+		}
+	default:
+		values := make([][]byte, 0, length+1)
+		values = append(values, old[:at]...)
+		values = append(values, value)
+		values = append(values, old[at:]...)
+		err = db.relocateList(idxTree, key, headSeq, tailSeq, seqs, values)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return length + 1, nil
+}
+
+// LTrim trims the list stored at key, so that it will contain only the specified range of elements.
+// Both start and stop are zero-based indexes, and can be negative numbers indicating offsets from the end of the list.
+// If start is larger than the end of the list, or start > stop, the list is emptied and key is removed.
+func (db *BitcaskDB) LTrim(key []byte, start, stop int) error {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return err
+	}
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil
+	}
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	if err != nil {
+		return err
+	}
+
+	length := db.listLen(idxTree, key)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		start, stop = 0, -1
+	}
+	if start == 0 && stop == length-1 {
+		return nil
+	}
+
+	// the meta is saved first, the trimmed elements are out of the range of the list then,
+	// so they are never read again even if a crash happens before they are dropped.
+	seqs := db.listSeqs(idxTree, key, headSeq, tailSeq, 0, length-1)
+	if start > stop {
+		if err = db.saveListMeta(idxTree, key, initialListSeq, initialListSeq+1); err != nil {
+			return err
+		}
+		db.keyspace.release(key, List)
+	} else if err = db.saveListMeta(idxTree, key, seqs[start]-1, seqs[stop]+1); err != nil {
+		return err
+	}
+	for i, seq := range seqs {
+		if i < start || i > stop {
+			db.dropListElement(idxTree, db.encodeListKey(key, seq))
+		}
+	}
+	return nil
+}
+
+// LPos returns the indexes of the elements equal to value in the list stored at key.
+// If rank is positive, the first rank-1 matches are skipped moving from head to tail, and if rank is negative,
+// the matches are searched from tail to head and the first -rank-1 of them are skipped.
+// At most count indexes are returned, 0 means all the matches. At most maxLen elements are compared,
+// 0 means all the elements.
+func (db *BitcaskDB) LPos(key, value []byte, rank, count, maxLen int) ([]int, error) {
+	if rank == 0 {
+		return nil, ErrInvalidRank
+	}
+	if count < 0 || maxLen < 0 {
+		return nil, ErrWrongIndex
+	}
+
+	db.listIndex.mu.RLock()
+	defer db.listIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, List); err != nil {
+		return nil, err
+	}
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil
+	}
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	if err != nil {
+		return nil, err
+	}
+
+	length := db.listLen(idxTree, key)
+	seqs := db.listSeqs(idxTree, key, headSeq, tailSeq, 0, length-1)
+	if maxLen == 0 || maxLen > length {
+		maxLen = length
+	}
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var indexes []int
+	for i := 0; i < maxLen; i++ {
+		index := i
+		if rank < 0 {
+			index = length - 1 - i
+		}
+		val, err := db.getVal(idxTree, db.encodeListKey(key, seqs[index]), List)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(val, value) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		indexes = append(indexes, index)
+		if count != 0 && len(indexes) == count {
+			break
+		}
+	}
+	return indexes, nil
+}
+
+// listValues returns the elements of the list at seqs.
+func (db *BitcaskDB) listValues(idxTree *art.AdaptiveRadixTree, key []byte, seqs []uint32) ([][]byte, error) {
+	values := make([][]byte, 0, len(seqs))
+	for _, seq := range seqs {
+		val, err := db.getVal(idxTree, db.encodeListKey(key, seq), List)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+	return values, nil
+}
+
+// listLen returns the number of elements of the list, which are the nodes of idxTree except the meta.
+func (db *BitcaskDB) listLen(idxTree *art.AdaptiveRadixTree, key []byte) int {
+	if idxTree == nil {
+		return 0
+	}
+	n := idxTree.Size()
+	if idxTree.Get(key) != nil {
+		n--
+	}
+	return n
+}
+
+// listSeqs returns the sequences of the elements of the list from index start to end, which must be in range.
+// The sequences are computed directly if the list has no holes, otherwise the holes are skipped one by one.
+func (db *BitcaskDB) listSeqs(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32, start, end int) []uint32 {
+	if end < start {
+		return nil
+	}
+	seqs := make([]uint32, 0, end-start+1)
+	if db.listLen(idxTree, key) == int(tailSeq-headSeq-1) {
+		for i := start; i <= end; i++ {
+			seqs = append(seqs, headSeq+1+uint32(i))
+		}
+		return seqs
+	}
+
+	index := 0
+	for seq := headSeq + 1; seq < tailSeq && index <= end; seq++ {
+		if idxTree.Get(db.encodeListKey(key, seq)) == nil {
+			continue
+		}
+		if index >= start {
+			seqs = append(seqs, seq)
+		}
+		index++
+	}
+	return seqs
+}
+
+// listSeqAt returns the sequence of the element at index, a negative index counts from the tail.
+// It returns false if index is out of range.
+func (db *BitcaskDB) listSeqAt(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32, index int) (uint32, bool) {
+	length := db.listLen(idxTree, key)
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return 0, false
+	}
+	if length == int(tailSeq-headSeq-1) || index < length/2 {
+		return db.listSeqs(idxTree, key, headSeq, tailSeq, index, index)[0], true
+	}
+
+	// the tail is closer.
+	n := length - 1
+	for seq := tailSeq - 1; seq > headSeq; seq-- {
+		if idxTree.Get(db.encodeListKey(key, seq)) == nil {
+			continue
+		}
+		if n == index {
+			return seq, true
+		}
+		n--
+	}
+	return 0, false
+}
+
+// shrinkList updates the meta of the list after elements are removed. The holes at both ends are cut off,
+// and the list is relocated if most of its sequences are holes, so reads never skip too many holes.
+func (db *BitcaskDB) shrinkList(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32) error {
+	length := db.listLen(idxTree, key)
+	if length == 0 {
+		if err := db.saveListMeta(idxTree, key, initialListSeq, initialListSeq+1); err != nil {
+			return err
+		}
+		db.keyspace.release(key, List)
+		return nil
+	}
+
+	newHead, newTail := headSeq, tailSeq
+	for idxTree.Get(db.encodeListKey(key, newHead+1)) == nil {
+		newHead++
+	}
+	for idxTree.Get(db.encodeListKey(key, newTail-1)) == nil {
+		newTail--
+	}
+	if int(newTail-newHead-1) > 2*length+maxListHoles {
+		seqs := db.listSeqs(idxTree, key, newHead, newTail, 0, length-1)
+		values, err := db.listValues(idxTree, key, seqs)
+		if err != nil {
+			return err
+		}
+		return db.relocateList(idxTree, key, newHead, newTail, seqs, values)
+	}
+	if newHead == headSeq && newTail == tailSeq {
+		return nil
+	}
+	return db.saveListMeta(idxTree, key, newHead, newTail)
+}
+
+// relocateList stores values as the elements of the list at the free sequences next to its range, saves the meta
+// of the new range, then drops the old elements at oldSeqs, which are out of the new range.
+// The new elements are invisible until the meta is saved, and the old ones are invisible after it, so a crash in
+// the middle neither duplicates nor loses elements.
+func (db *BitcaskDB) relocateList(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32, oldSeqs []uint32, values [][]byte) error {
+	n := uint32(len(values))
+	// move towards the initial sequence, so the list never runs out of sequences.
+	newHead, newTail := tailSeq-1, tailSeq+n
+	if headSeq/2+tailSeq/2 > initialListSeq {
+		newHead, newTail = headSeq-n, headSeq+1
+	}
+	for i, val := range values {
+		ent := &logfile.LogEntry{Key: db.encodeListKey(key, newHead+1+uint32(i)), Value: val}
+		pos, err := db.writeLogEntry(ent, List)
+		if err != nil {
+			return err
+		}
+		if err = db.updateIndexTree(idxTree, ent, pos, true, List); err != nil {
+			return err
+		}
+	}
+	if err := db.saveListMeta(idxTree, key, newHead, newTail); err != nil {
+		return err
+	}
+	for _, seq := range oldSeqs {
+		db.dropListElement(idxTree, db.encodeListKey(key, seq))
+	}
+	return nil
+}
+
+// dropListElement removes the element of encKey, which is out of the range of the list, from the index.
+// It needs no tombstone, since a sequence out of the range is always written before the range covers it again.
+func (db *BitcaskDB) dropListElement(idxTree *art.AdaptiveRadixTree, encKey []byte) {
+	oldVal, updated := idxTree.Delete(encKey)
+	db.trackMemory(encKey, nil, oldVal)
+	db.sendDiscard(oldVal, updated, List)
+}
+
+// maybeRewriteListHole rewrites the tombstone of a hole of the list when its log file is rewritten by gc.
+// A hole is a removed element inside the range of the list, the tombstone is kept as long as the hole is,
+// otherwise an older value of the element would come back when db is opened.
+func (db *BitcaskDB) maybeRewriteListHole(idxTree *art.AdaptiveRadixTree, key []byte, ent *logfile.LogEntry) error {
+	if idxTree.Get(ent.Key) != nil {
+		return nil
+	}
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	if err != nil {
+		return err
+	}
+	if _, seq := db.decodeListKey(ent.Key); seq <= headSeq || seq >= tailSeq {
+		return nil
+	}
+	pos, err := db.writeLogEntry(ent, List)
+	if err != nil {
+		return err
+	}
+	// the tombstone itself is garbage.
+	_, eSize := logfile.EncodeEntry(ent)
+	db.sendDiscard(&indexNode{fid: pos.fid, entrySize: eSize}, true, List)
+	return nil
+}
+
+// pruneLists removes the elements out of the ranges of the lists from the index when db is opened.
+// They are left by a crash before they are deleted, such as the elements trimmed by LTrim.
+func (db *BitcaskDB) pruneLists() error {
+	for key, idxTree := range db.listIndex.trees {
+		headSeq, tailSeq, err := db.ListMeta(idxTree, []byte(key))
+		if err != nil {
+			return err
+		}
+		var stale [][]byte
+		iter := idxTree.Iterator()
+		for iter.HasNext() {
+			node, err := iter.Next()
+			if err != nil {
+				return err
+			}
+			// skip the meta, whose key is the key of the list.
+			if len(node.Key()) == len(key) {
+				continue
+			}
+			if _, seq := db.decodeListKey(node.Key()); seq <= headSeq || seq >= tailSeq {
+				stale = append(stale, node.Key())
+			}
+		}
+		for _, encKey := range stale {
+			oldVal, _ := idxTree.Delete(encKey)
+			db.trackMemory(encKey, nil, oldVal)
+		}
+	}
+	return nil
+}
+
 func (db *BitcaskDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 	idxTree := db.listIndex.trees[string(key)]
 	if idxTree == nil {
@@ -271,8 +780,9 @@ func (db *BitcaskDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 		return nil, err
 	}
 
+	length := db.listLen(idxTree, key)
 	// reset
-	if tailSeq-headSeq-1 <= 0 {
+	if length == 0 {
 		headSeq = initialListSeq
 		tailSeq = headSeq + 1
 		err = db.saveListMeta(idxTree, key, headSeq, tailSeq)
@@ -282,9 +792,17 @@ func (db *BitcaskDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 		return nil, nil
 	}
 
+	// the holes next to the head or the tail are skipped.
 	seq := headSeq + 1
-	if !isLeft {
+	if isLeft {
+		for seq < tailSeq && idxTree.Get(db.encodeListKey(key, seq)) == nil {
+			seq++
+		}
+	} else {
 		seq = tailSeq - 1
+		for seq > headSeq && idxTree.Get(db.encodeListKey(key, seq)) == nil {
+			seq--
+		}
 	}
 
 	encKey := db.encodeListKey(key, seq) // seq(len = 4) + key
@@ -295,27 +813,40 @@ func (db *BitcaskDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 
 	// update
 	if isLeft {
-		headSeq++
+		headSeq = seq
 	} else {
-		tailSeq--
+		tailSeq = seq
+	}
+	if err = db.saveListMeta(idxTree, key, headSeq, tailSeq); err != nil {
+		return nil, err
+	}
+	if length == 1 {
+		db.keyspace.release(key, List)
 	}
-	db.saveListMeta(idxTree, key, headSeq, tailSeq)
 
 	// delete
+	if err = db.deleteListElement(idxTree, encKey); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// deleteListElement removes the element of encKey from the index and writes its tombstone.
+func (db *BitcaskDB) deleteListElement(idxTree *art.AdaptiveRadixTree, encKey []byte) error {
 	oldVal, updated := idxTree.Delete(encKey)
+	db.trackMemory(encKey, nil, oldVal)
 	db.sendDiscard(oldVal, updated, List)
 
 	ent := &logfile.LogEntry{Key: encKey, Type: logfile.TypeDelete}
 	pos, err := db.writeLogEntry(ent, List)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// delete itself
 	_, eSize := logfile.EncodeEntry(ent)
 	idxNode := &indexNode{fid: pos.fid, entrySize: eSize}
 	db.sendDiscard(idxNode, updated, List)
-
-	return val, nil
+	return nil
 }
 
 func (db *BitcaskDB) pushInternal(key []byte, val []byte, isLeft bool) error {
@@ -324,6 +855,10 @@ func (db *BitcaskDB) pushInternal(key []byte, val []byte, isLeft bool) error {
 	if err != nil {
 		return err
 	}
+	claim, err := db.keyspace.claim(key, List, 0)
+	if err != nil {
+		return err
+	}
 
 	seq := headSeq
 	if !isLeft {
@@ -334,6 +869,7 @@ func (db *BitcaskDB) pushInternal(key []byte, val []byte, isLeft bool) error {
 	ent := &logfile.LogEntry{Key: encKey, Value: val}
 	pos, err := db.writeLogEntry(ent, List)
 	if err != nil {
+		claim.rollback()
 		return err
 	}
 	err = db.updateIndexTree(idxTree, ent, pos, true, List)
@@ -347,7 +883,11 @@ func (db *BitcaskDB) pushInternal(key []byte, val []byte, isLeft bool) error {
 		tailSeq++
 	}
 
-	return db.saveListMeta(idxTree, key, headSeq, tailSeq)
+	if err = db.saveListMeta(idxTree, key, headSeq, tailSeq); err != nil {
+		return err
+	}
+	db.listIndex.blocked.markReady(key)
+	return nil
 }
 
 // ListMeta Get the head/tail sequence of the list corresponding to the key
@@ -393,18 +933,6 @@ func (db *BitcaskDB) saveListMeta(idxTree *art.AdaptiveRadixTree, key []byte, he
 	return db.updateIndexTree(idxTree, ent, pos, true, List)
 }
 
-// listSequence just convert logical index to physical seq.
-// whether physical seq is legal or not, just convert it
-func (db *BitcaskDB) listSequence(headSeq, tailSeq uint32, index int) (uint32, error) {
-	var seq uint32
-	if index >= 0 {
-		seq = headSeq + uint32(index) + 1
-	} else {
-		seq = tailSeq - uint32(-index)
-	}
-	return seq, nil
-}
-
 // GetStrsKeys get all stored keys of type String.
 func (db *BitcaskDB) GetListKeys() ([][]byte, error) {
 	db.listIndex.mu.RLock()
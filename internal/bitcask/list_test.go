@@ -0,0 +1,225 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listStrings(t *testing.T, db *BitcaskDB, key []byte) []string {
+	values, err := db.LRange(key, 0, -1)
+	if err != nil && err != ErrWrongIndex {
+		t.Fatalf("lrange err: %v", err)
+	}
+	res := make([]string, 0, len(values))
+	for _, val := range values {
+		res = append(res, string(val))
+	}
+	return res
+}
+
+func listLen(t *testing.T, db *BitcaskDB, key []byte) int {
+	n, err := db.LLen(key)
+	if err != nil {
+		t.Fatalf("llen err: %v", err)
+	}
+	return n
+}
+
+func reopenTestDB(t *testing.T, db *BitcaskDB, opts options.Options) *BitcaskDB {
+	assert.Nil(t, db.Close())
+	db, err := Open(opts)
+	if err != nil {
+		t.Fatalf("open db err: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestBitcaskDB_LRemHoles(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("l")
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("x"), []byte("b"), []byte("x"), []byte("c"), []byte("x")))
+	n, err := db.LRem(key, 2, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"a", "b", "c", "x"}, listStrings(t, db, key))
+	assert.Equal(t, 4, listLen(t, db, key))
+
+	val, err := db.LIndex(key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", string(val))
+	val, err = db.LIndex(key, -2)
+	assert.Nil(t, err)
+	assert.Equal(t, "c", string(val))
+	_, err = db.LIndex(key, 4)
+	assert.Equal(t, ErrWrongIndex, err)
+	assert.Nil(t, db.LSet(key, 2, []byte("C")))
+	indexes, err := db.LPos(key, []byte("C"), 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, indexes)
+
+	// the value is inserted into the hole between a and b.
+	length, err := db.LInsert(key, false, []byte("a"), []byte("y"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, length)
+	assert.Equal(t, []string{"a", "y", "b", "C", "x"}, listStrings(t, db, key))
+
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, []string{"a", "y", "b", "C", "x"}, listStrings(t, db, key))
+
+	n, err = db.LRem(key, -1, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	val, err = db.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(val))
+	val, err = db.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "y", string(val))
+	// the hole left by b is skipped.
+	val, err = db.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "C", string(val))
+	assert.Equal(t, []string{"x"}, listStrings(t, db, key))
+
+	n, err = db.LRem(key, 0, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, listLen(t, db, key))
+	assert.Equal(t, 0, db.Exists(key))
+}
+
+func TestBitcaskDB_LRemRelocate(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("l")
+
+	for i := 0; i < 200; i++ {
+		val := "x"
+		if i%50 == 25 {
+			val = strconv.Itoa(i)
+		}
+		assert.Nil(t, db.RPush(key, []byte(val)))
+	}
+	n, err := db.LRem(key, 0, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 196, n)
+	assert.Equal(t, []string{"25", "75", "125", "175"}, listStrings(t, db, key))
+
+	// the list is relocated, since most of its sequences are holes.
+	idxTree := db.listIndex.trees[string(key)]
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, int(tailSeq-headSeq-1))
+	assert.Equal(t, 4, db.listLen(idxTree, key))
+}
+
+func TestBitcaskDB_LInsertRelocate(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("l")
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c")))
+	length, err := db.LInsert(key, true, []byte("b"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, length)
+	length, err = db.LInsert(key, true, []byte("a"), []byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, length)
+	length, err = db.LInsert(key, false, []byte("c"), []byte("t"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, length)
+	length, err = db.LInsert(key, false, []byte("z"), []byte("t"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, length)
+	assert.Equal(t, []string{"h", "a", "x", "b", "c", "t"}, listStrings(t, db, key))
+
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, []string{"h", "a", "x", "b", "c", "t"}, listStrings(t, db, key))
+	assert.Equal(t, 6, listLen(t, db, key))
+}
+
+func TestBitcaskDB_LTrimInterrupted(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("l")
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("d")))
+	assert.Nil(t, db.LTrim(key, 1, 2))
+	assert.Equal(t, []string{"b", "c"}, listStrings(t, db, key))
+
+	// the process crashes once the meta of LTrim is saved, before the trimmed elements are dropped.
+	idxTree := db.listIndex.trees[string(key)]
+	assert.Nil(t, db.RPush(key, []byte("e")))
+	headSeq, tailSeq, err := db.ListMeta(idxTree, key)
+	assert.Nil(t, err)
+	assert.Nil(t, db.saveListMeta(idxTree, key, headSeq+1, tailSeq))
+
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, []string{"c", "e"}, listStrings(t, db, key))
+	assert.Equal(t, 2, listLen(t, db, key))
+
+	assert.Nil(t, db.LTrim(key, 5, 10))
+	assert.Equal(t, 0, listLen(t, db, key))
+	assert.Equal(t, 0, db.Exists(key))
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, 0, listLen(t, db, key))
+}
+
+func TestBitcaskDB_ListHoleSurvivesGC(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.LogFileSizeThreshold = 4 << 10
+	opts.LogFileGCRatio = 0
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	key := []byte("l")
+
+	// rollFile writes to another list until the active list log file is archived.
+	rollFile := func() uint32 {
+		fid := db.activateLogFile[List].Fid
+		for db.activateLogFile[List].Fid == fid {
+			assert.Nil(t, db.RPush([]byte("filler"), make([]byte, 1024)))
+		}
+		return fid
+	}
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c")))
+	rollFile()
+	// the tombstone of b is in another file than b.
+	n, err := db.LRem(key, 1, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	fid := rollFile()
+
+	db.discards[List].drain()
+	assert.Nil(t, db.RunLogFileGC(List, int(fid)))
+	_, ok := db.archivedLogFile[List][fid]
+	assert.False(t, ok)
+
+	db = reopenTestDB(t, db, opts)
+	assert.Equal(t, []string{"a", "c"}, listStrings(t, db, key))
+}
+
+func TestBitcaskDB_LRangeSharedLock(t *testing.T) {
+	db := openTestDB(t)
+	key := []byte("l")
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b")))
+
+	// a range does not wait for the other readers of lists.
+	db.listIndex.mu.RLock()
+	defer db.listIndex.mu.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	values, err := db.LRangeCtx(ctx, key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, values)
+}
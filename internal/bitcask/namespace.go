@@ -0,0 +1,205 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/util"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// namespaceDir is the directory under db path where the namespaces are stored.
+	namespaceDir = "ns"
+	// droppedPrefix is the prefix of the directories of dropped namespaces, they are removed in background.
+	droppedPrefix = ".dropped-"
+)
+
+var (
+	// ErrInvalidNamespace the name of namespace is empty, or contains path separators.
+	ErrInvalidNamespace = errors.New("invalid namespace name")
+
+	// ErrNamespaceNotFound namespace not found
+	ErrNamespaceNotFound = errors.New("namespace not found")
+
+	// ErrTooManyNamespaces the number of opened namespaces reaches MaxNamespaces.
+	ErrTooManyNamespaces = errors.New("too many opened namespaces")
+)
+
+// Stats is the statistics of a db or a namespace.
+type Stats struct {
+	Keys         int            // Number of keys of all types, the expired keys which are not removed yet are counted.
+	TypeKeys     map[string]int // Number of keys of each type, keyed by the type names returned by Type.
+	LogFiles     int            // Number of log files.
+	DiskSize     int64          // Total size of log files in bytes.
+	Namespaces   int            // Number of opened namespaces, their keys and files are not counted.
+	UsedMemory   int64          // Estimated memory used by indexes in bytes.
+	EvictedKeys  int64          // Number of keys evicted because of the memory limit.
+	LostDiscards int64          // Number of discard updates lost because the discard channel is full.
+}
+
+// NamespacePath returns the directory of namespace name in the db stored at path.
+func NamespacePath(path, name string) string {
+	return filepath.Join(path, namespaceDir, name)
+}
+
+// Namespace returns the handle of namespace name, it is created if it does not exist.
+// A namespace is an independent keyspace with the same API as db. It is a nested db opened with the options of db
+// in its own directory under db, rather than a key prefix in the log files of db, so it can be dropped in constant time
+// and has its own stats.
+// The cost is that an opened namespace holds the same resources as a db opened by Open: the active and archived
+// log files and a discard file of every type stay open, and a discard goroutine of every type runs besides the log file gc,
+// hash field expiration, discard rebuild and eviction goroutines enabled by the options.
+// Use MaxNamespaces to limit the number of namespaces opened at the same time, ErrTooManyNamespaces is returned
+// when it is reached. Namespaces are closed when db is closed or they are dropped.
+func (db *BitcaskDB) Namespace(name string) (*BitcaskDB, error) {
+	if err := checkNamespace(name); err != nil {
+		return nil, err
+	}
+
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	if ns, ok := db.namespaces[name]; ok {
+		return ns, nil
+	}
+	if db.opts.MaxNamespaces > 0 && len(db.namespaces) >= db.opts.MaxNamespaces {
+		return nil, ErrTooManyNamespaces
+	}
+	opts := db.opts
+	opts.DBPath = NamespacePath(db.opts.DBPath, name)
+	opts.RemakeDir = false
+	ns, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	db.namespaces[name] = ns
+	return ns, nil
+}
+
+// Namespaces returns the names of all the namespaces in db, including the ones not opened.
+func (db *BitcaskDB) Namespaces() ([]string, error) {
+	fileInfos, err := ioutil.ReadDir(filepath.Join(db.opts.DBPath, namespaceDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range fileInfos {
+		if file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// DropNamespace closes namespace name and removes all its data. The directory of the namespace is renamed
+// and then removed in background, so it takes constant time no matter how many keys it holds.
+// The handles of the dropped namespace must not be used any more.
+func (db *BitcaskDB) DropNamespace(name string) error {
+	if err := checkNamespace(name); err != nil {
+		return err
+	}
+
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	if ns, ok := db.namespaces[name]; ok {
+		delete(db.namespaces, name)
+		if err := ns.Close(); err != nil {
+			return err
+		}
+	}
+
+	path := NamespacePath(db.opts.DBPath, name)
+	if !util.PathExist(path) {
+		return ErrNamespaceNotFound
+	}
+	dropped := NamespacePath(db.opts.DBPath, fmt.Sprintf("%s%s-%d", droppedPrefix, name, time.Now().UnixNano()))
+	if err := os.Rename(path, dropped); err != nil {
+		return err
+	}
+	go func() {
+		if err := os.RemoveAll(dropped); err != nil {
+			log.Errorf("remove dropped namespace %s err: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+// Stats returns the statistics of db.
+func (db *BitcaskDB) Stats() (*Stats, error) {
+	stats := &Stats{
+		TypeKeys:     make(map[string]int),
+		UsedMemory:   db.UsedMemory(),
+		EvictedKeys:  db.EvictedKeys(),
+		LostDiscards: db.LostDiscardUpdates(),
+	}
+	db.keyspace.mu.RLock()
+	for dataType, n := range db.keyspace.counts {
+		if n > 0 {
+			stats.Keys += n
+			stats.TypeKeys[typeNames[dataType]] = n
+		}
+	}
+	db.keyspace.mu.RUnlock()
+
+	fileInfos, err := ioutil.ReadDir(db.opts.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range fileInfos {
+		if strings.HasPrefix(file.Name(), logfile.FilePrefix) {
+			stats.LogFiles++
+			stats.DiskSize += file.Size()
+		}
+	}
+
+	db.nsMu.Lock()
+	stats.Namespaces = len(db.namespaces)
+	db.nsMu.Unlock()
+	return stats, nil
+}
+
+// closeNamespaces closes all the opened namespaces, it is called when db is closed.
+func (db *BitcaskDB) closeNamespaces(ctx context.Context) error {
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	for name, ns := range db.namespaces {
+		if err := ns.CloseCtx(ctx); err != nil {
+			return err
+		}
+		delete(db.namespaces, name)
+	}
+	return nil
+}
+
+// removeDroppedNamespaces removes the directories of the dropped namespaces left by the last run.
+func (db *BitcaskDB) removeDroppedNamespaces() {
+	paths, err := filepath.Glob(NamespacePath(db.opts.DBPath, droppedPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if err = os.RemoveAll(path); err != nil {
+			log.Errorf("remove dropped namespace %s err: %v", path, err)
+		}
+	}
+}
+
+func checkNamespace(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return ErrInvalidNamespace
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_MaxNamespaces(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	opts.MaxNamespaces = 2
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, name := range []string{"a", "b", "a"} {
+		_, err = db.Namespace(name)
+		assert.Nil(t, err)
+	}
+	_, err = db.Namespace("c")
+	assert.Equal(t, ErrTooManyNamespaces, err)
+
+	// a dropped namespace is not counted.
+	assert.Nil(t, db.DropNamespace("a"))
+	_, err = db.Namespace("c")
+	assert.Nil(t, err)
+	stats, err := db.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.Namespaces)
+}
@@ -0,0 +1,120 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/rdb"
+	"errors"
+	"io"
+	"time"
+)
+
+// ImportRDB loads the keys of redis database dbIndex in the rdb file into db, all databases are loaded if dbIndex < 0.
+// Keys already expired are skipped, strings and hash fields keep their expire time.
+// Values are merged into the existing keys, lists are appended to the tail.
+// Keys of the types bitcask doesn't support(stream, module...) are skipped with a log.
+// It returns the number of keys loaded.
+func (db *BitcaskDB) ImportRDB(r io.Reader, dbIndex int) (int, error) {
+	parser, err := rdb.NewParser(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		var unsupported *rdb.ErrUnsupportedType
+		if errors.As(err, &unsupported) {
+			log.Infof("skip rdb key: %v", err)
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if dbIndex >= 0 && entry.DB != dbIndex {
+			continue
+		}
+		loaded, err := db.LoadRDBEntry(entry)
+		if err != nil {
+			return count, err
+		}
+		if loaded {
+			count++
+		}
+	}
+}
+
+// LoadRDBEntry writes a key parsed from the rdb file into db.
+// It returns false if the key has already expired and is skipped.
+func (db *BitcaskDB) LoadRDBEntry(entry *rdb.Entry) (bool, error) {
+	var ttl time.Duration
+	if entry.ExpireAt != 0 {
+		ttl = time.Until(time.Unix(0, entry.ExpireAt*int64(time.Millisecond)))
+		if ttl <= 0 {
+			return false, nil
+		}
+		if entry.Type != rdb.String && entry.Type != rdb.Hash {
+			// only strings and hash fields can expire in bitcask now.
+			log.Infof("the expire time of key %q is dropped", entry.Key)
+		}
+	}
+
+	var err error
+	switch entry.Type {
+	case rdb.String:
+		if ttl > 0 {
+			err = db.SetEX(entry.Key, entry.Value, ttl)
+		} else {
+			err = db.Set(entry.Key, entry.Value)
+		}
+	case rdb.List:
+		if len(entry.Members) > 0 {
+			err = db.RPush(entry.Key, entry.Members...)
+		}
+	case rdb.Hash:
+		return db.loadRDBHash(entry)
+	case rdb.Set:
+		_, err = db.SAdd(entry.Key, entry.Members...)
+	case rdb.ZSet:
+		for _, member := range entry.ZSet {
+			if err = db.ZAdd(entry.Key, member.Score, member.Member); err != nil {
+				break
+			}
+		}
+	}
+	return err == nil, err
+}
+
+// loadRDBHash sets the fields of a hash loaded from the rdb file.
+// The expire time of the key is applied to every field, and the fields already expired are skipped.
+func (db *BitcaskDB) loadRDBHash(entry *rdb.Entry) (bool, error) {
+	if err := db.checkMemory(); err != nil {
+		return false, err
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.keyspace.check(entry.Key, Hash); err != nil {
+		return false, err
+	}
+
+	var loaded bool
+	now := time.Now().UnixMilli()
+	for _, field := range entry.Fields {
+		expiredAt := field.ExpireAt
+		if entry.ExpireAt != 0 && (expiredAt == 0 || entry.ExpireAt < expiredAt) {
+			expiredAt = entry.ExpireAt
+		}
+		if expiredAt != 0 && expiredAt <= now {
+			continue
+		}
+		if err := db.hsetInternal(entry.Key, field.Field, field.Value, expiredAt); err != nil {
+			return false, err
+		}
+		loaded = true
+	}
+	return loaded, nil
+}
@@ -0,0 +1,77 @@
+package bitcask
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the rdb files are generated by the tests of package rdb.
+const rdbTestdata = "../rdb/testdata/"
+
+func importRDBFile(t *testing.T, db *BitcaskDB, name string, dbIndex int) int {
+	f, err := os.Open(rdbTestdata + name)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	count, err := db.ImportRDB(f, dbIndex)
+	assert.Nil(t, err)
+	return count
+}
+
+func TestBitcaskDB_ImportRDB(t *testing.T) {
+	db := openTestDB(t)
+	// the expired key "old" and the key "k1" in db 1 are skipped.
+	assert.Equal(t, 21, importRDBFile(t, db, "dump.rdb", 0))
+
+	val, err := db.Get([]byte("lzf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaaaaaaaa", string(val))
+	_, err = db.Get([]byte("old"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("k1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	ttl, err := db.TTL([]byte("t"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	assert.Equal(t, []string{"a", "b", "5", "plain"}, listStrings(t, db, []byte("l")))
+	ok, score, err := db.ZScore([]byte("z3"), []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 4.5, score)
+	values, err := db.HGetAll([]byte("zm"))
+	assert.Nil(t, err)
+	assert.Len(t, values, 4)
+}
+
+func TestBitcaskDB_ImportRDBUnsupported(t *testing.T) {
+	db := openTestDB(t)
+	assert.Equal(t, 4, importRDBFile(t, db, "unsupported.rdb", -1))
+	for key, val := range map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"} {
+		res, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, val, string(res))
+	}
+	assert.Equal(t, 0, db.Exists([]byte("stream"), []byte("module"), []byte("stream3")))
+}
+
+func TestBitcaskDB_ImportRDBHashTTL(t *testing.T) {
+	const farFuture = 4102444800000
+	db := openTestDB(t)
+	assert.Equal(t, 5, importRDBFile(t, db, "hash_ttl.rdb", -1))
+
+	fields := [][]byte{[]byte("f1"), []byte("f2"), []byte("f3")}
+	for _, key := range []string{"h22", "h23", "h24", "h25"} {
+		res, err := db.HPExpireTime([]byte(key), fields...)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{HFieldNoTTL, farFuture, HFieldNotExist}, res, key)
+		assert.Equal(t, 2, db.HLen([]byte(key)), key)
+	}
+
+	// the expire time of the key is applied to the fields.
+	res, err := db.HPExpireTime([]byte("hkey"), fields[:2]...)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{farFuture - 1000, farFuture - 2000}, res)
+}
@@ -0,0 +1,199 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/ds/art"
+	"bitcaskDB/internal/util"
+	"errors"
+)
+
+// defaultScanCount is the number of elements visited by a scan call if count is not positive, same as redis.
+const defaultScanCount = 10
+
+// ErrUnknownTypeName the type name passed to Scan is not one of string, list, hash, set and zset.
+var ErrUnknownTypeName = errors.New("unknown type name")
+
+// Scan incrementally iterates the keys of all types. The iteration starts with a nil cursor, and every call returns
+// the cursor for the next call, a nil cursor is returned when the iteration is completed.
+// Keys that exist during the whole iteration are always returned, and every key is returned at most once.
+//
+// At most count keys are visited in a call, only keys matching pattern and holding a value of typeName are returned.
+// An empty pattern or typeName means no filter.
+func (db *BitcaskDB) Scan(cursor, pattern []byte, count int, typeName string) ([]byte, [][]byte, error) {
+	if typeName != "" && !isTypeName(typeName) {
+		return nil, nil, ErrUnknownTypeName
+	}
+
+	db.keyspace.mu.RLock()
+	var keys [][]byte
+	var hashes map[string]bool
+	next, err := scanTree(db.keyspace.idxTree, cursor, count, func(key []byte, _ interface{}) error {
+		meta := db.keyspace.get(key)
+		if meta == nil {
+			return nil
+		}
+		if typeName != "" && typeNames[meta.dataType] != typeName {
+			return nil
+		}
+		if len(pattern) > 0 && !util.GlobMatch(pattern, key) {
+			return nil
+		}
+		if meta.dataType == Hash {
+			if hashes == nil {
+				hashes = make(map[string]bool)
+			}
+			hashes[string(key)] = true
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	db.keyspace.mu.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the hashes whose fields are all expired stay in the keyspace until the fields are deleted, skip them.
+	// The lock of hashIndex is acquired after the lock of keyspace is released.
+	if len(hashes) > 0 {
+		alive := keys[:0]
+		for _, key := range keys {
+			if hashes[string(key)] && !db.hashAlive(key) {
+				continue
+			}
+			alive = append(alive, key)
+		}
+		keys = alive
+	}
+	return next, keys, nil
+}
+
+// HScan incrementally iterates the fields of the hash stored at key, it returns the cursor for the next call,
+// and the matched fields followed by their values.
+// The cursor, pattern and count work in the same way as Scan.
+func (db *BitcaskDB) HScan(key, cursor, pattern []byte, count int) ([]byte, [][]byte, error) {
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, Hash); err != nil {
+		return nil, nil, err
+	}
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var values [][]byte
+	next, err := scanTree(idxTree, cursor, count, func(encKey []byte, _ interface{}) error {
+		_, field := db.decodeKey(encKey)
+		if len(pattern) > 0 && !util.GlobMatch(pattern, field) {
+			return nil
+		}
+		val, err := db.getVal(idxTree, encKey, Hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values = append(values, field, val)
+		return nil
+	})
+	return next, values, err
+}
+
+// SScan incrementally iterates the members of the set stored at key, it returns the cursor for the next call
+// and the matched members.
+// The cursor, pattern and count work in the same way as Scan.
+func (db *BitcaskDB) SScan(key, cursor, pattern []byte, count int) ([]byte, [][]byte, error) {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, Set); err != nil {
+		return nil, nil, err
+	}
+	idxTree := db.setIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var members [][]byte
+	next, err := scanTree(idxTree, cursor, count, func(mkey []byte, _ interface{}) error {
+		member := memberOf(mkey)
+		if len(pattern) > 0 && !util.GlobMatch(pattern, member) {
+			return nil
+		}
+		members = append(members, member)
+		return nil
+	})
+	return next, members, err
+}
+
+// ZScan incrementally iterates the members of the sorted set stored at key, it returns the cursor for the next call,
+// and the matched members followed by their scores.
+// The cursor, pattern and count work in the same way as Scan.
+func (db *BitcaskDB) ZScan(key, cursor, pattern []byte, count int) ([]byte, [][]byte, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return nil, nil, err
+	}
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var values [][]byte
+	next, err := scanTree(idxTree, cursor, count, func(mkey []byte, _ interface{}) error {
+		ok, score := db.zsetIndex.indexes.ZScore(string(key), string(mkey))
+		if !ok {
+			return nil
+		}
+		member := memberOf(mkey)
+		if len(pattern) > 0 && !util.GlobMatch(pattern, member) {
+			return nil
+		}
+		values = append(values, member, []byte(util.Float64ToStr(score)))
+		return nil
+	})
+	return next, values, err
+}
+
+// scanTree visits at most count nodes whose keys are greater than cursor in idxTree, in the order of keys.
+// The cursor is the key of the last node visited, so the iteration is not affected by the keys added or deleted
+// between calls. It returns the cursor for the next call, or nil if there are no more nodes.
+// The nodes before cursor are not visited, so a call costs O(count) whatever the cursor is.
+// The lock of idxTree must be held.
+func scanTree(idxTree *art.AdaptiveRadixTree, cursor []byte, count int, fn func(key []byte, value interface{}) error) ([]byte, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var last, next []byte
+	var err error
+	idxTree.ForEachAfter(cursor, func(key []byte, value interface{}) bool {
+		if count == 0 {
+			// there are more nodes, the iteration goes on from the last node visited.
+			next = last
+			return false
+		}
+		if err = fn(key, value); err != nil {
+			return false
+		}
+		last = key
+		count--
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func isTypeName(name string) bool {
+	for _, typeName := range typeNames {
+		if typeName == name {
+			return true
+		}
+	}
+	return false
+}
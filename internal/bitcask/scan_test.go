@@ -0,0 +1,50 @@
+package bitcask
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitcaskDB_Scan(t *testing.T) {
+	db := openTestDB(t)
+
+	var want []string
+	for i := 0; i < 500; i++ {
+		key := "key" + strconv.Itoa(i)
+		assert.Nil(t, db.Set([]byte(key), []byte("v")))
+		want = append(want, key)
+	}
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+	sort.Strings(want)
+
+	var got []string
+	var cursor []byte
+	for {
+		next, keys, err := db.Scan(cursor, []byte("key*"), 7, "string")
+		assert.Nil(t, err)
+		for _, key := range keys {
+			got = append(got, string(key))
+		}
+		if next == nil {
+			break
+		}
+		// the cursor key is deleted between calls, the iteration goes on after it.
+		assert.Nil(t, db.Delete(next))
+		want = removeString(want, string(next))
+		got = removeString(got, string(next))
+		cursor = next
+	}
+	assert.Equal(t, want, got)
+}
+
+func removeString(values []string, value string) []string {
+	for i, v := range values {
+		if v == value {
+			return append(values[:i], values[i+1:]...)
+		}
+	}
+	return values
+}
@@ -4,48 +4,38 @@ import (
 	"bitcaskDB/internal/ds/art"
 	"bitcaskDB/internal/logfile"
 	"bitcaskDB/internal/util"
+	"context"
+	"encoding/binary"
+	"math/rand"
 )
 
 // SAdd add the specified members to the set stored at key.
 // Specified members that are already a member of this set are ignored.
 // If key does not exist, a new set is created before adding the specified members.
 func (db *BitcaskDB) SAdd(key []byte, members ...[]byte) (int, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
 	db.setIndex.mu.Lock()
 	defer db.setIndex.mu.Unlock()
 
-	if db.setIndex.trees[string(key)] == nil {
-		db.setIndex.trees[string(key)] = art.NewART()
+	if err := db.keyspace.check(key, Set); err != nil {
+		return 0, err
 	}
-	idxTree := db.setIndex.trees[string(key)]
 
 	var cnt int
 	for _, mem := range members {
 		if len(mem) == 0 {
 			continue
 		}
-
-		if err := db.setIndex.murhash.Write(mem); err != nil {
-			return cnt, err
-		}
-		sum := db.setIndex.murhash.EncodeSum128()
-		db.setIndex.murhash.Reset()
-
-		// The elements in the set are unique
-		idxNode := idxTree.Get(sum)
-		if idxNode != nil {
-			continue
-		}
-
-		ent := &logfile.LogEntry{Key: key, Value: mem}
-		pos, err := db.writeLogEntry(ent, Set)
+		added, err := db.saddInternal(key, mem)
 		if err != nil {
 			return cnt, err
 		}
-		ent.Key = sum
-		if err := db.updateIndexTree(idxTree, ent, pos, true, Set); err != nil {
-			return cnt, err
+		if added {
+			cnt++
 		}
-		cnt++
 	}
 	return cnt, nil
 }
@@ -55,6 +45,9 @@ func (db *BitcaskDB) SPop(key []byte, count uint) ([][]byte, error) {
 	db.setIndex.mu.Lock()
 	defer db.setIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, Set); err != nil {
+		return nil, err
+	}
 	if db.setIndex.trees[string(key)] == nil {
 		return nil, nil
 	}
@@ -68,11 +61,7 @@ func (db *BitcaskDB) SPop(key []byte, count uint) ([][]byte, error) {
 		if node == nil {
 			continue
 		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
-		if err != nil {
-			return nil, err
-		}
-		values = append(values, val)
+		values = append(values, memberOf(node.Key()))
 	}
 
 	for _, val := range values {
@@ -90,6 +79,9 @@ func (db *BitcaskDB) SRem(key []byte, members ...[]byte) (int, error) {
 	db.setIndex.mu.Lock()
 	defer db.setIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, Set); err != nil {
+		return 0, err
+	}
 	if db.setIndex.trees[string(key)] == nil {
 		return 0, nil
 	}
@@ -115,21 +107,27 @@ func (db *BitcaskDB) SIsMember(key, member []byte) bool {
 		return false
 	}
 	idxTree := db.setIndex.trees[string(key)]
-	if err := db.setIndex.murhash.Write(member); err != nil {
+	mkey, err := memberKey(member)
+	if err != nil {
 		return false
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
-	node := idxTree.Get(sum)
+	node := idxTree.Get(mkey)
 	return node != nil
 }
 
 // SMembers returns all the members of the set value stored at key.
 func (db *BitcaskDB) SMembers(key []byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
+	return db.SMembersCtx(context.Background(), key)
+}
+
+// SMembersCtx is like SMembers, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) SMembersCtx(ctx context.Context, key []byte) ([][]byte, error) {
+	if err := db.setIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
 	defer db.setIndex.mu.RUnlock()
 
-	return db.sMembers(key)
+	return db.sMembers(ctx, key)
 }
 
 // SCard returns the set cardinality (number of elements) of the set stored at key.
@@ -145,13 +143,246 @@ func (db *BitcaskDB) SCard(key []byte) int {
 // SDiff returns the members of the set difference between the first set and
 // all the successive sets. Returns error if no key is passed as a parameter.
 func (db *BitcaskDB) SDiff(keys ...[]byte) ([][]byte, error) {
+	return db.SDiffCtx(context.Background(), keys...)
+}
+
+// SDiffCtx is like SDiff, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) SDiffCtx(ctx context.Context, keys ...[]byte) ([][]byte, error) {
+	if err := db.setIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.setIndex.mu.RUnlock()
+
+	return db.sDiff(ctx, keys)
+}
+
+// SUnion returns the members of the set resulting from the union of all the given sets.
+func (db *BitcaskDB) SUnion(keys ...[]byte) ([][]byte, error) {
+	return db.SUnionCtx(context.Background(), keys...)
+}
+
+// SUnionCtx is like SUnion, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) SUnionCtx(ctx context.Context, keys ...[]byte) ([][]byte, error) {
+	if err := db.setIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.setIndex.mu.RUnlock()
+
+	return db.sUnion(ctx, keys)
+}
+
+// SInter returns the members of the set resulting from the intersection of all the given sets.
+func (db *BitcaskDB) SInter(keys ...[]byte) ([][]byte, error) {
+	return db.SInterCtx(context.Background(), keys...)
+}
+
+// SInterCtx is like SInter, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) SInterCtx(ctx context.Context, keys ...[]byte) ([][]byte, error) {
+	if err := db.setIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.setIndex.mu.RUnlock()
+
+	return db.sInter(ctx, keys, 0)
+}
+
+// SInterCard returns the cardinality of the intersection of all the given sets.
+// If limit is positive, it stops counting when the cardinality reaches limit.
+func (db *BitcaskDB) SInterCard(limit int, keys ...[]byte) (int, error) {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	members, err := db.sInter(context.Background(), keys, limit)
+	return len(members), err
+}
+
+// SDiffStore is like SDiff, but it stores the result in dst and returns its cardinality.
+// dst is overwritten if it already exists regardless of its type, and removed if the result is empty.
+func (db *BitcaskDB) SDiffStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.sStore(dst, func() ([][]byte, error) {
+		return db.sDiff(context.Background(), keys)
+	})
+}
+
+// SUnionStore is like SUnion, but it stores the result in dst and returns its cardinality.
+// dst is overwritten if it already exists regardless of its type, and removed if the result is empty.
+func (db *BitcaskDB) SUnionStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.sStore(dst, func() ([][]byte, error) {
+		return db.sUnion(context.Background(), keys)
+	})
+}
+
+// SInterStore is like SInter, but it stores the result in dst and returns its cardinality.
+// dst is overwritten if it already exists regardless of its type, and removed if the result is empty.
+func (db *BitcaskDB) SInterStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.sStore(dst, func() ([][]byte, error) {
+		return db.sInter(context.Background(), keys, 0)
+	})
+}
+
+// SMove moves member from the set stored at src to the set stored at dst atomically.
+// It returns false if member is not a member of src, in which case nothing is done.
+func (db *BitcaskDB) SMove(src, dst, member []byte) (bool, error) {
+	if err := db.checkMemory(); err != nil {
+		return false, err
+	}
+
+	db.setIndex.mu.Lock()
+	defer db.setIndex.mu.Unlock()
+
+	if err := db.keyspace.check(src, Set); err != nil {
+		return false, err
+	}
+	if err := db.keyspace.check(dst, Set); err != nil {
+		return false, err
+	}
+	idxTree := db.setIndex.trees[string(src)]
+	if idxTree == nil {
+		return false, nil
+	}
+	if string(src) == string(dst) {
+		mkey, err := memberKey(member)
+		if err != nil {
+			return false, err
+		}
+		return idxTree.Get(mkey) != nil, nil
+	}
+
+	removed, err := db.sremInternal(src, member)
+	if err != nil || !removed {
+		return false, err
+	}
+	if _, err = db.saddInternal(dst, member); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SRandMember returns random members of the set stored at key without removing them.
+// If count is positive, at most count distinct members are returned.
+// If count is negative, -count members are returned and the same member may be returned multiple times.
+func (db *BitcaskDB) SRandMember(key []byte, count int) ([][]byte, error) {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	members, err := db.sMembers(context.Background(), key)
+	if err != nil || len(members) == 0 || count == 0 {
+		return nil, err
+	}
+
+	if count < 0 {
+		values := make([][]byte, -count)
+		for i := range values {
+			values[i] = members[rand.Intn(len(members))]
+		}
+		return values, nil
+	}
+	if count >= len(members) {
+		return members, nil
+	}
+	// partial Fisher-Yates shuffle, the first count members are a uniform sample.
+	for i := 0; i < count; i++ {
+		j := i + rand.Intn(len(members)-i)
+		members[i], members[j] = members[j], members[i]
+	}
+	return members[:count], nil
+}
+
+// SMIsMember returns whether each member is a member of the set stored at key.
+func (db *BitcaskDB) SMIsMember(key []byte, members ...[]byte) ([]bool, error) {
 	db.setIndex.mu.RLock()
 	defer db.setIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, Set); err != nil {
+		return nil, err
+	}
+	res := make([]bool, len(members))
+	idxTree := db.setIndex.trees[string(key)]
+	if idxTree == nil {
+		return res, nil
+	}
+	for i, mem := range members {
+		mkey, err := memberKey(mem)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = idxTree.Get(mkey) != nil
+	}
+	return res, nil
+}
+
+// saddInternal adds member to the set stored at key, it returns false if member already exists.
+// The lock of setIndex must be held.
+func (db *BitcaskDB) saddInternal(key, member []byte) (bool, error) {
+	if db.setIndex.trees[string(key)] == nil {
+		db.setIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.setIndex.trees[string(key)]
+
+	mkey, err := memberKey(member)
+	if err != nil {
+		return false, err
+	}
+
+	// The elements in the set are unique
+	idxNode := idxTree.Get(mkey)
+	if idxNode != nil {
+		return false, nil
+	}
+
+	claim, err := db.keyspace.claim(key, Set, 0)
+	if err != nil {
+		return false, err
+	}
+	ent := &logfile.LogEntry{Key: key, Value: member}
+	pos, err := db.writeLogEntry(ent, Set)
+	if err != nil {
+		claim.rollback()
+		return false, err
+	}
+	ent.Key = mkey
+	if err := db.updateIndexTree(idxTree, ent, pos, true, Set); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (db *BitcaskDB) sremInternal(key []byte, member []byte) (bool, error) {
+	idxTree := db.setIndex.trees[string(key)]
+
+	mkey, err := memberKey(member)
+	if err != nil {
+		return false, err
+	}
+
+	oldVal, updated := idxTree.Delete(mkey)
+	db.trackMemory(mkey, nil, oldVal)
+	if !updated {
+		return false, nil
+	}
+	if idxTree.Size() == 0 {
+		db.keyspace.release(key, Set)
+	}
+	entry := &logfile.LogEntry{Key: key, Value: member, Type: logfile.TypeDelete}
+	pos, err := db.writeLogEntry(entry, Set)
+	if err != nil {
+		return false, err
+	}
+
+	db.sendDiscard(oldVal, updated, Set)
+	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
+	db.sendDiscard(idxNode, true, Set)
+	return true, nil
+}
+
+// sDiff returns the members of the first set which are not in the successive sets.
+// The lock of setIndex must be held.
+func (db *BitcaskDB) sDiff(ctx context.Context, keys [][]byte) ([][]byte, error) {
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
 
-	firstSet, err := db.sMembers(keys[0])
+	firstSet, err := db.sMembers(ctx, keys[0])
 	if err != nil {
 		return nil, err
 	}
@@ -160,17 +391,15 @@ func (db *BitcaskDB) SDiff(keys ...[]byte) ([][]byte, error) {
 		return firstSet, nil
 	}
 
-	successiveSet := make(map[uint64]struct{})
+	// members are compared by their real bytes, hashes of them may collide.
+	successiveSet := make(map[string]struct{})
 	for _, key := range keys[1:] {
-		members, err := db.sMembers(key)
+		members, err := db.sMembers(ctx, key)
 		if err != nil {
 			return nil, err
 		}
 		for _, mem := range members {
-			h := util.MemHash(mem)
-			if _, ok := successiveSet[h]; !ok {
-				successiveSet[h] = struct{}{}
-			}
+			successiveSet[string(mem)] = struct{}{}
 		}
 	}
 
@@ -180,37 +409,32 @@ func (db *BitcaskDB) SDiff(keys ...[]byte) ([][]byte, error) {
 
 	var values [][]byte
 	for _, mem := range firstSet {
-		h := util.MemHash(mem)
-		if _, ok := successiveSet[h]; !ok {
+		if _, ok := successiveSet[string(mem)]; !ok {
 			values = append(values, mem)
 		}
 	}
 	return values, nil
 }
 
-// SUnion returns the members of the set resulting from the union of all the given sets.
-func (db *BitcaskDB) SUnion(keys ...[]byte) ([][]byte, error) {
-	db.setIndex.mu.RLock()
-	defer db.setIndex.mu.RUnlock()
-
+// sUnion returns the members of all the given sets, the lock of setIndex must be held.
+func (db *BitcaskDB) sUnion(ctx context.Context, keys [][]byte) ([][]byte, error) {
 	if len(keys) == 0 {
 		return nil, ErrWrongNumberOfArgs
 	}
 	if len(keys) == 1 {
-		return db.sMembers(keys[0])
+		return db.sMembers(ctx, keys[0])
 	}
 
 	var values [][]byte
-	set := make(map[uint64]struct{})
+	set := make(map[string]struct{})
 	for _, key := range keys {
-		members, err := db.sMembers(key)
+		members, err := db.sMembers(ctx, key)
 		if err != nil {
 			return nil, err
 		}
 		for _, mem := range members {
-			h := util.MemHash(mem)
-			if _, ok := set[h]; !ok {
-				set[h] = struct{}{}
+			if _, ok := set[string(mem)]; !ok {
+				set[string(mem)] = struct{}{}
 				values = append(values, mem)
 			}
 		}
@@ -218,33 +442,116 @@ func (db *BitcaskDB) SUnion(keys ...[]byte) ([][]byte, error) {
 	return values, nil
 }
 
-func (db *BitcaskDB) sremInternal(key []byte, member []byte) (bool, error) {
-	idxTree := db.setIndex.trees[string(key)]
-
-	if err := db.setIndex.murhash.Write(member); err != nil {
-		return false, err
+// sInter returns the members which are in all the given sets, it stops after limit members if limit is positive.
+// The smallest set is iterated and its members are looked up in the others. The lock of setIndex must be held.
+func (db *BitcaskDB) sInter(ctx context.Context, keys [][]byte, limit int) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+	for _, key := range keys {
+		if err := db.keyspace.check(key, Set); err != nil {
+			return nil, err
+		}
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
 
-	oldVal, updated := idxTree.Delete(sum)
-	if !updated {
-		return false, nil
+	trees := make([]*art.AdaptiveRadixTree, len(keys))
+	smallest := 0
+	for i, key := range keys {
+		trees[i] = db.setIndex.trees[string(key)]
+		if trees[i] == nil || trees[i].Size() == 0 {
+			return nil, nil
+		}
+		if trees[i].Size() < trees[smallest].Size() {
+			smallest = i
+		}
 	}
-	entry := &logfile.LogEntry{Key: key, Value: member, Type: logfile.TypeDelete}
-	pos, err := db.writeLogEntry(entry, Set)
+
+	members, err := db.sMembers(ctx, keys[smallest])
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	var values [][]byte
+	for _, mem := range members {
+		mkey, err := memberKey(mem)
+		if err != nil {
+			return nil, err
+		}
+		found := true
+		for i, idxTree := range trees {
+			if i != smallest && idxTree.Get(mkey) == nil {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		values = append(values, mem)
+		if limit > 0 && len(values) >= limit {
+			break
+		}
+	}
+	return values, nil
+}
 
-	db.sendDiscard(oldVal, updated, Set)
-	idxNode := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
-	db.sendDiscard(idxNode, true, Set)
-	return true, nil
+// sStore replaces dst with the set computed by op, dst is removed if the set is empty.
+// The locks are held during the whole operation, so readers see either the old or the new value of dst.
+func (db *BitcaskDB) sStore(dst []byte, op func() ([][]byte, error)) (int, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	return db.storeKey(dst, Set, func(dstExists bool, dstType DataType) (int, error) {
+		members, err := op()
+		if err != nil {
+			return 0, err
+		}
+		if dstExists {
+			if err = db.removeKeyLocked(dst, dstType); err != nil {
+				return 0, err
+			}
+		}
+		for _, mem := range members {
+			if _, err = db.saddInternal(dst, mem); err != nil {
+				return 0, err
+			}
+		}
+		return len(members), nil
+	})
 }
 
-// sMembers is a helper method to get all members of the given set key.
-func (db *BitcaskDB) sMembers(key []byte) ([][]byte, error) {
+// memberKey returns the key of member in the index trees of sets and sorted sets, which is the murmur sum of member
+// followed by member itself. Members are unique even if their sums collide, and the real member is always decoded
+// from the key, whatever the index mode is. The sum is kept in front for the tombstones of sorted sets written by
+// older versions, which have only the sum.
+// It uses its own hasher, so it can be called with the read lock of the index.
+func memberKey(member []byte) ([]byte, error) {
+	murhash := util.NewMurmur128()
+	if err := murhash.Write(member); err != nil {
+		return nil, err
+	}
+	return append(murhash.EncodeSum128(), member...), nil
+}
+
+// memberOf returns a copy of the member in mkey, which is returned by memberKey.
+func memberOf(mkey []byte) []byte {
+	// the sum is two uvarints.
+	var offset int
+	for i := 0; i < 2; i++ {
+		_, n := binary.Uvarint(mkey[offset:])
+		if n <= 0 {
+			return nil
+		}
+		offset += n
+	}
+	return append([]byte{}, mkey[offset:]...)
+}
+
+// sMembers is a helper method to get all members of the given set key, it stops when ctx is done.
+func (db *BitcaskDB) sMembers(ctx context.Context, key []byte) ([][]byte, error) {
+	if err := db.keyspace.check(key, Set); err != nil {
+		return nil, err
+	}
 	idxTree := db.setIndex.trees[string(key)]
 	if idxTree == nil {
 		return nil, nil
@@ -252,15 +559,14 @@ func (db *BitcaskDB) sMembers(key []byte) ([][]byte, error) {
 	var members [][]byte
 	iter := idxTree.Iterator()
 	for iter.HasNext() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		node, _ := iter.Next()
 		if node == nil {
 			continue
 		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
-		if err != nil {
-			return nil, err
-		}
-		members = append(members, val)
+		members = append(members, memberOf(node.Key()))
 	}
 	return members, nil
 }
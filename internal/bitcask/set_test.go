@@ -0,0 +1,261 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// toStrings converts values to strings, so they are compared and printed readably.
+func toStrings(values [][]byte) []string {
+	res := make([]string, 0, len(values))
+	for _, val := range values {
+		res = append(res, string(val))
+	}
+	return res
+}
+
+// writeSets writes the sets s1 = {a, b, c, d}, s2 = {b, c, e}, s3 = {c, d} and the string str.
+func writeSets(t *testing.T, db *BitcaskDB) {
+	sets := map[string][]string{"s1": {"a", "b", "c", "d"}, "s2": {"b", "c", "e"}, "s3": {"c", "d"}}
+	for key, members := range sets {
+		for _, mem := range members {
+			_, err := db.SAdd([]byte(key), []byte(mem))
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+}
+
+func keysOf(keys ...string) [][]byte {
+	res := make([][]byte, len(keys))
+	for i, key := range keys {
+		res[i] = []byte(key)
+	}
+	return res
+}
+
+func TestBitcaskDB_SInter(t *testing.T) {
+	db := openTestDB(t)
+	writeSets(t, db)
+
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+		err  error
+	}{
+		{"two sets", []string{"s1", "s2"}, []string{"b", "c"}, nil},
+		{"three sets", []string{"s1", "s2", "s3"}, []string{"c"}, nil},
+		{"one set", []string{"s3"}, []string{"c", "d"}, nil},
+		{"missing set", []string{"s1", "missing"}, []string{}, nil},
+		{"wrong type", []string{"s1", "str"}, []string{}, ErrWrongType},
+		{"no keys", nil, []string{}, ErrWrongNumberOfArgs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := db.SInter(keysOf(tt.keys...)...)
+			assert.Equal(t, tt.err, err)
+			assert.ElementsMatch(t, tt.want, toStrings(members))
+		})
+	}
+}
+
+func TestBitcaskDB_SInterCard(t *testing.T) {
+	db := openTestDB(t)
+	writeSets(t, db)
+
+	tests := []struct {
+		name  string
+		limit int
+		keys  []string
+		want  int
+	}{
+		{"no limit", 0, []string{"s1", "s2"}, 2},
+		{"limit reached", 1, []string{"s1", "s2"}, 1},
+		{"limit not reached", 5, []string{"s1", "s2"}, 2},
+		{"missing set", 0, []string{"s1", "missing"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := db.SInterCard(tt.limit, keysOf(tt.keys...)...)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, n)
+		})
+	}
+	_, err := db.SInterCard(0, []byte("s1"), []byte("str"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_SetStore(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	writeSets(t, db)
+
+	tests := []struct {
+		name  string
+		store func(dst []byte, keys ...[]byte) (int, error)
+		keys  []string
+		want  []string
+	}{
+		{"diff", db.SDiffStore, []string{"s1", "s2"}, []string{"a", "d"}},
+		{"union", db.SUnionStore, []string{"s2", "s3"}, []string{"b", "c", "d", "e"}},
+		{"inter", db.SInterStore, []string{"s1", "s2", "s3"}, []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the destination is overwritten whatever its type is.
+			dst := []byte("dst-" + tt.name)
+			assert.Nil(t, db.Set(dst, []byte("v")))
+			n, err := tt.store(dst, keysOf(tt.keys...)...)
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.want), n)
+			members, err := db.SMembers(dst)
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, tt.want, toStrings(members))
+		})
+	}
+
+	// the destination can be one of the sources.
+	n, err := db.SUnionStore([]byte("s2"), []byte("s2"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	members, err := db.SMembers([]byte("s2"))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"b", "c", "d", "e"}, toStrings(members))
+
+	// an empty result removes the destination.
+	n, err = db.SInterStore([]byte("s3"), []byte("s3"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, typeNameNone, db.Type([]byte("s3")))
+	_, err = db.SDiffStore([]byte("dst"), []byte("str"))
+	assert.Equal(t, ErrWrongType, err)
+
+	db = reopenTestDB(t, db, opts)
+	for _, tt := range tests {
+		members, err := db.SMembers([]byte("dst-" + tt.name))
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, tt.want, toStrings(members))
+	}
+	assert.Equal(t, typeNameNone, db.Type([]byte("s3")))
+}
+
+func TestBitcaskDB_SMove(t *testing.T) {
+	db := openTestDB(t)
+	writeSets(t, db)
+
+	tests := []struct {
+		name   string
+		src    string
+		dst    string
+		member string
+		moved  bool
+		err    error
+	}{
+		{"member in both", "s1", "s2", "b", true, nil},
+		{"new dst", "s1", "new", "a", true, nil},
+		{"not a member", "s1", "s2", "x", false, nil},
+		{"same set", "s2", "s2", "e", true, nil},
+		{"missing src", "missing", "s2", "a", false, nil},
+		{"last member", "s3", "s2", "c", true, nil},
+		{"wrong type", "s3", "str", "d", false, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, err := db.SMove([]byte(tt.src), []byte(tt.dst), []byte(tt.member))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.moved, moved)
+		})
+	}
+	for key, want := range map[string][]string{"s1": {"c", "d"}, "s2": {"b", "c", "e"}, "new": {"a"}, "s3": {"d"}} {
+		members, err := db.SMembers([]byte(key))
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, want, toStrings(members), key)
+	}
+
+	_, err := db.SMove([]byte("s3"), []byte("s1"), []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, typeNameNone, db.Type([]byte("s3")))
+}
+
+func TestBitcaskDB_SRandMember(t *testing.T) {
+	db := openTestDB(t)
+	writeSets(t, db)
+	all := []string{"a", "b", "c", "d"}
+
+	tests := []struct {
+		name     string
+		key      string
+		count    int
+		size     int
+		distinct bool
+	}{
+		{"positive count", "s1", 2, 2, true},
+		{"count larger than set", "s1", 10, 4, true},
+		{"negative count", "s1", -10, 10, false},
+		{"zero count", "s1", 0, 0, true},
+		{"missing set", "missing", 3, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := db.SRandMember([]byte(tt.key), tt.count)
+			assert.Nil(t, err)
+			assert.Len(t, members, tt.size)
+			seen := make(map[string]bool)
+			for _, mem := range toStrings(members) {
+				assert.Contains(t, all, mem)
+				if tt.distinct {
+					assert.False(t, seen[mem], "duplicate member %s", mem)
+				}
+				seen[mem] = true
+			}
+		})
+	}
+	// nothing is removed.
+	assert.Equal(t, 4, db.SCard([]byte("s1")))
+	_, err := db.SRandMember([]byte("str"), 1)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_SMIsMember(t *testing.T) {
+	db := openTestDB(t)
+	writeSets(t, db)
+
+	res, err := db.SMIsMember([]byte("s2"), []byte("a"), []byte("b"), []byte("e"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true, true, true}, res)
+	res, err = db.SMIsMember([]byte("missing"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, false}, res)
+	_, err = db.SMIsMember([]byte("str"), []byte("a"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestMemberKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		member []byte
+	}{
+		{"empty", []byte{}},
+		{"ascii", []byte("member")},
+		{"uvarint like", []byte{0x80, 0x80, 0x01}},
+		{"long", make([]byte, 1024)},
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mkey, err := memberKey(tt.member)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.member, memberOf(mkey))
+			// the sum alone decodes to an empty member.
+			assert.Equal(t, []byte{}, memberOf(mkey[:len(mkey)-len(tt.member)]))
+			assert.False(t, seen[string(mkey)])
+			seen[string(mkey)] = true
+		})
+	}
+	assert.Nil(t, memberOf([]byte{0x80}))
+}
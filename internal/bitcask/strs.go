@@ -4,48 +4,55 @@ import (
 	"bitcaskDB/internal/logfile"
 	"bitcaskDB/internal/util"
 	"bytes"
+	"context"
 	"errors"
 	"math"
 	"strconv"
 	"time"
 )
 
-// Set set key to hold the string value. If key already holds a value, it is overwritten.
+// Set set key to hold the string value. If key already holds a value, it is overwritten,
+// regardless of its type.
 func (db *BitcaskDB) Set(key, value []byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	// write the entry to log file
-	entry := &logfile.LogEntry{Key: key, Value: value}
-	valuePos, err := db.writeLogEntry(entry, String)
-	if err != nil {
+	if err := db.overwriteKey(key); err != nil {
 		return err
 	}
-	// update index
-	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	return db.setInternal(key, value, 0)
 }
 
 // SetEX set key to hold the string value and set key to timeout after the given duration.
+// If key already holds a value, it is overwritten, regardless of its type.
 func (db *BitcaskDB) SetEX(key, value []byte, duration time.Duration) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	if duration < 0 {
 		return ErrInvalidTimeDuration
 	}
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	// write the entry to log file
-	expiredAt := time.Now().Add(duration).Unix()
-	entry := &logfile.LogEntry{Key: key, Value: value, ExpiredAt: expiredAt}
-	valuePos, err := db.writeLogEntry(entry, String)
-	if err != nil {
+	if err := db.overwriteKey(key); err != nil {
 		return err
 	}
-	// update index
-	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+	expiredAt := time.Now().Add(duration).UnixMilli()
+	return db.setInternal(key, value, expiredAt)
 }
 
 // SetNX sets the key-value pair if it is not exist. It returns nil if the key already exists.
 func (db *BitcaskDB) SetNX(key, value []byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
@@ -57,19 +64,29 @@ func (db *BitcaskDB) SetNX(key, value []byte) error {
 	if val != nil {
 		return nil
 	}
+	// The key holds a value of another type, which also means it exists.
+	claim, err := db.keyspace.claim(key, String, 0)
+	if err != nil {
+		return nil
+	}
 
 	// write the entry to log file
 	entry := &logfile.LogEntry{Key: key, Value: value}
 	valuePos, err := db.writeLogEntry(entry, String)
 	if err != nil {
+		claim.rollback()
 		return err
 	}
 	// update index
 	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
 }
 
-// Set set key to hold the string value. If key already holds a value, it is overwritten.
+// MSet sets the given keys to their respective values. Existing values are overwritten, regardless of their types.
 func (db *BitcaskDB) MSet(args ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
@@ -78,10 +95,18 @@ func (db *BitcaskDB) MSet(args ...[]byte) error {
 	}
 
 	for i := 0; i < len(args)-1; i += 2 {
+		if err := db.overwriteKey(args[i]); err != nil {
+			return err
+		}
+		claim, err := db.keyspace.claim(args[i], String, 0)
+		if err != nil {
+			return err
+		}
 		// write the entry to log file
 		entry := &logfile.LogEntry{Key: args[i], Value: args[i+1]}
 		valuePos, err := db.writeLogEntry(entry, String)
 		if err != nil {
+			claim.rollback()
 			return err
 		}
 		// update index
@@ -96,6 +121,10 @@ func (db *BitcaskDB) MSet(args ...[]byte) error {
 // MSetNX sets given keys to their respective values. MSetNX will not perform
 // any operation at all even if just a single key already exists.
 func (db *BitcaskDB) MSetNX(args ...[]byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
@@ -113,6 +142,9 @@ func (db *BitcaskDB) MSetNX(args ...[]byte) error {
 		if val != nil {
 			return nil
 		}
+		if err = db.keyspace.check(key, String); err != nil {
+			return nil
+		}
 	}
 
 	var addedKeys = make(map[uint64]struct{})
@@ -123,9 +155,14 @@ func (db *BitcaskDB) MSetNX(args ...[]byte) error {
 		if _, ok := addedKeys[h]; ok {
 			continue
 		}
+		claim, err := db.keyspace.claim(key, String, 0)
+		if err != nil {
+			return err
+		}
 		entry := &logfile.LogEntry{Key: key, Value: value}
 		valPos, err := db.writeLogEntry(entry, String)
 		if err != nil {
+			claim.rollback()
 			return err
 		}
 		err = db.updateIndexTree(db.strIndex.idxTree, entry, valPos, true, String)
@@ -140,6 +177,10 @@ func (db *BitcaskDB) MSetNX(args ...[]byte) error {
 // Append appends the value at the end of the old value if key already exists.
 // It will be similar to Set if key does not exist.
 func (db *BitcaskDB) Append(key, value []byte) error {
+	if err := db.checkMemory(); err != nil {
+		return err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
@@ -150,10 +191,15 @@ func (db *BitcaskDB) Append(key, value []byte) error {
 	if oldVal != nil {
 		value = append(oldVal, value...)
 	}
+	claim, err := db.keyspace.claim(key, String, 0)
+	if err != nil {
+		return err
+	}
 
 	entry := &logfile.LogEntry{Key: key, Value: value}
 	pos, err := db.writeLogEntry(entry, String)
 	if err != nil {
+		claim.rollback()
 		return err
 	}
 	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
@@ -161,14 +207,27 @@ func (db *BitcaskDB) Append(key, value []byte) error {
 
 // Get get the value of key.
 // If the key does not exist the error ErrKeyNotFound is returned.
+// If the key holds a value of another type the error ErrWrongType is returned.
 func (db *BitcaskDB) Get(key []byte) ([]byte, error) {
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, String); err != nil {
+		return nil, err
+	}
 	return db.getVal(db.strIndex.idxTree, key, String)
 }
 
+// MGet returns the values of all specified keys, the value of a key which does not exist is nil.
 func (db *BitcaskDB) MGet(keys [][]byte) ([][]byte, error) {
-	db.strIndex.mu.RLock()
+	return db.MGetCtx(context.Background(), keys)
+}
+
+// MGetCtx is like MGet, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) MGetCtx(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	if err := db.strIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
 	defer db.strIndex.mu.RUnlock()
 
 	if len(keys) == 0 {
@@ -177,6 +236,9 @@ func (db *BitcaskDB) MGet(keys [][]byte) ([][]byte, error) {
 
 	values := make([][]byte, len(keys))
 	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		value, err := db.getVal(db.strIndex.idxTree, key, String)
 		if err != nil && !errors.Is(ErrKeyNotFound, err) {
 			return nil, err
@@ -199,6 +261,8 @@ func (db *BitcaskDB) Delete(key []byte) error {
 	}
 
 	oldVal, update := db.strIndex.idxTree.Delete(key)
+	db.trackMemory(key, nil, oldVal)
+	db.keyspace.release(key, String)
 
 	db.sendDiscard(oldVal, update, String)
 
@@ -216,6 +280,9 @@ func (db *BitcaskDB) GetDel(key []byte) ([]byte, error) {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
+	if err := db.keyspace.check(key, String); err != nil {
+		return nil, err
+	}
 	val, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil && err != ErrKeyNotFound {
 		return nil, err
@@ -231,6 +298,8 @@ func (db *BitcaskDB) GetDel(key []byte) ([]byte, error) {
 	}
 
 	oldVal, update := db.strIndex.idxTree.Delete(key)
+	db.trackMemory(key, nil, oldVal)
+	db.keyspace.release(key, String)
 
 	db.sendDiscard(oldVal, update, String)
 
@@ -243,16 +312,19 @@ func (db *BitcaskDB) GetDel(key []byte) ([]byte, error) {
 }
 
 // StrLen returns the length of the string value stored at key. If the key
-// doesn't exist, it returns 0.
-func (db *BitcaskDB) StrLen(key []byte) int {
+// doesn't exist, it returns 0. An error is returned when key exists and does not hold a string.
+func (db *BitcaskDB) StrLen(key []byte) (int, error) {
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, String); err != nil {
+		return 0, err
+	}
 	value, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil {
-		return 0
+		return 0, nil
 	}
-	return len(value)
+	return len(value), nil
 }
 
 // Count returns the total number of keys of String.
@@ -268,30 +340,40 @@ func (db *BitcaskDB) Count() int {
 
 // Persist remove the expiration time for the given key.
 func (db *BitcaskDB) Persist(key []byte) error {
-	db.strIndex.mu.RLock()
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
 	val, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil {
-		db.strIndex.mu.RUnlock()
 		return err
 	}
-	db.strIndex.mu.RUnlock()
-	return db.Set(key, val)
+	return db.setInternal(key, val, 0)
 }
 
 // Expire set the expiration time for the given key.
 func (db *BitcaskDB) Expire(key []byte, duration time.Duration) error {
+	if duration < 0 {
+		return ErrInvalidTimeDuration
+	}
 	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
 	val, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil {
-		db.strIndex.mu.Unlock()
 		return err
 	}
-	db.strIndex.mu.Unlock()
-	return db.SetEX(key, val, duration)
+	return db.setInternal(key, val, time.Now().Add(duration).UnixMilli())
 }
 
-// TTL get ttl(time to live) for the given key.
+// TTL get ttl(time to live) in seconds for the given key, it is rounded to the nearest second.
+// 0 is returned if the key has no ttl.
 func (db *BitcaskDB) TTL(key []byte) (int64, error) {
+	ttl, err := db.PTTL(key)
+	return (ttl + 500) / 1000, err
+}
+
+// PTTL is like TTL, but the ttl is in milliseconds.
+func (db *BitcaskDB) PTTL(key []byte) (int64, error) {
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
@@ -302,16 +384,39 @@ func (db *BitcaskDB) TTL(key []byte) (int64, error) {
 
 	var ttl int64
 	if idxNode.expiredAt != 0 {
-		ttl = idxNode.expiredAt - time.Now().Unix()
+		ttl = idxNode.expiredAt - time.Now().UnixMilli()
 	}
 	return ttl, nil
 }
 
+// setInternal sets key to hold the string value, the lock of strIndex must be held.
+func (db *BitcaskDB) setInternal(key, value []byte, expiredAt int64) error {
+	claim, err := db.keyspace.claim(key, String, expiredAt)
+	if err != nil {
+		return err
+	}
+
+	// write the entry to log file
+	entry := &logfile.LogEntry{Key: key, Value: value, ExpiredAt: expiredAt}
+	valuePos, err := db.writeLogEntry(entry, String)
+	if err != nil {
+		claim.rollback()
+		return err
+	}
+	// update index
+	return db.updateIndexTree(db.strIndex.idxTree, entry, valuePos, true, String)
+}
+
 // incrDecrBy is a helper method for Incr, IncrBy, Decr, and DecrBy methods. It updates the key by incr.
+// The caller must hold the lock of strIndex.
 func (db *BitcaskDB) incrDecrBy(key []byte, incr int64) (int64, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
 
+	if err := db.keyspace.check(key, String); err != nil {
+		return 0, err
+	}
 	val, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return 0, err
@@ -332,9 +437,14 @@ func (db *BitcaskDB) incrDecrBy(key []byte, incr int64) (int64, error) {
 
 	valInt64 += incr
 	val = []byte(strconv.FormatInt(valInt64, 10))
+	claim, err := db.keyspace.claim(key, String, 0)
+	if err != nil {
+		return 0, err
+	}
 	ent := &logfile.LogEntry{Key: key, Value: val}
 	pos, err := db.writeLogEntry(ent, String)
 	if err != nil {
+		claim.rollback()
 		return 0, err
 	}
 	err = db.updateIndexTree(db.strIndex.idxTree, ent, pos, true, String)
@@ -387,9 +497,12 @@ func (db *BitcaskDB) IncrBy(key []byte, incr int64) (int64, error) {
 // GetRange returns the substring of the string value stored at key, [start, end]
 // determined by the offsets start and end.
 func (db *BitcaskDB) GetRange(key []byte, start, end int) ([]byte, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
 
+	if err := db.keyspace.check(key, String); err != nil {
+		return nil, err
+	}
 	val, err := db.getVal(db.strIndex.idxTree, key, String)
 	if err != nil {
 		return nil, err
@@ -423,17 +536,328 @@ func (db *BitcaskDB) GetRange(key []byte, start, end int) ([]byte, error) {
 	return val[start : end+1], nil
 }
 
-// Scan iterates over all keys of type String and finds its value.
-// Parameter prefix will match key`s prefix, and pattern is a regular expression that also matchs the key.
-// Parameter count limits the number of keys, a nil slice will be returned if count is not a positive number.
-// The returned values will be a mixed data of keys and values, like [key1, value1, key2, value2, etc...].
-func (db *BitcaskDB) Scan(prefix []byte, pattern string, count int) ([][]byte, error) {
-	return nil, nil
+// SetCondition is the condition for SetArgs to set the key.
+type SetCondition int8
+
+const (
+	// SetAlways sets the key unconditionally.
+	SetAlways SetCondition = iota
+	// SetIfNotExist sets the key only if it does not exist.
+	SetIfNotExist
+	// SetIfExist sets the key only if it already exists.
+	SetIfExist
+)
+
+// maxStringSize the maximum size of a string value.
+const maxStringSize = 512 << 20
+
+// SetOptions are the options of SetArgs.
+type SetOptions struct {
+	Condition SetCondition
+	// ExpiredAt the time at which the key expires, it is truncated to milliseconds. The zero value means no ttl.
+	ExpiredAt time.Time
+	// KeepTTL keeps the ttl of the existing key, ExpiredAt is ignored if it is true.
+	KeepTTL bool
+	// Get returns the old string value, ErrWrongType is returned if the key holds a value of another type.
+	Get bool
+}
+
+// SetArgs sets key to hold the string value according to opts, the value of another type is overwritten.
+// It returns the old value if opts.Get is true, nil is returned if the key does not exist,
+// and whether the key is set. The key is deleted if opts.ExpiredAt is in the past.
+func (db *BitcaskDB) SetArgs(key, value []byte, opts SetOptions) ([]byte, bool, error) {
+	if err := db.checkMemory(); err != nil {
+		return nil, false, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	dataType, exists := db.keyspace.typeOf(key)
+	var oldVal []byte
+	if opts.Get && exists {
+		if dataType != String {
+			return nil, false, ErrWrongType
+		}
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, false, err
+		}
+		oldVal = val
+	}
+	if (opts.Condition == SetIfNotExist && exists) || (opts.Condition == SetIfExist && !exists) {
+		return oldVal, false, nil
+	}
+
+	var expiredAt int64
+	switch {
+	case opts.KeepTTL:
+		if idxNode, err := db.getIndexNode(db.strIndex.idxTree, key, String); err == nil {
+			expiredAt = idxNode.expiredAt
+		}
+	case !opts.ExpiredAt.IsZero():
+		expiredAt = opts.ExpiredAt.UnixMilli()
+	}
+
+	if err := db.overwriteKey(key); err != nil {
+		return nil, false, err
+	}
+	if expiredAt != 0 && expiredAt <= time.Now().UnixMilli() {
+		_, err := db.detachKey(key, String)
+		return oldVal, err == nil, err
+	}
+	if err := db.setInternal(key, value, expiredAt); err != nil {
+		return nil, false, err
+	}
+	return oldVal, true, nil
+}
+
+// GetSet sets key to hold the string value and returns the old value, nil is returned if key does not exist.
+// The ttl of the key is removed.
+func (db *BitcaskDB) GetSet(key, value []byte) ([]byte, error) {
+	oldVal, _, err := db.SetArgs(key, value, SetOptions{Get: true})
+	return oldVal, err
+}
+
+// GetEx returns the value of key and sets its expiration time to expiredAt, which is truncated to milliseconds.
+// The ttl is removed if persist is true, and kept if expiredAt is zero. The key is deleted if expiredAt is in the past.
+// If the key does not exist the error ErrKeyNotFound is returned.
+func (db *BitcaskDB) GetEx(key []byte, expiredAt time.Time, persist bool) ([]byte, error) {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, String); err != nil {
+		return nil, err
+	}
+	idxNode, err := db.getIndexNode(db.strIndex.idxTree, key, String)
+	if err != nil {
+		return nil, err
+	}
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case persist:
+		if idxNode.expiredAt != 0 {
+			err = db.setInternal(key, val, 0)
+		}
+	case !expiredAt.IsZero():
+		if ms := expiredAt.UnixMilli(); ms <= time.Now().UnixMilli() {
+			_, err = db.detachKey(key, String)
+		} else {
+			err = db.setInternal(key, val, ms)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// SetRange overwrites part of the string stored at key, starting at offset, for the entire length of value.
+// The string is padded with zero bytes if offset is larger than its length, and a non-existing key is treated
+// as an empty string. The ttl of the key is kept. It returns the length of the string after it is modified.
+func (db *BitcaskDB) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, ErrWrongIndex
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, String); err != nil {
+		return 0, err
+	}
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	// nothing is written if value is empty, so the key is not created.
+	if len(value) == 0 {
+		return len(val), nil
+	}
+	if offset+len(value) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+
+	newVal := make([]byte, len(val))
+	copy(newVal, val)
+	if end := offset + len(value); end > len(newVal) {
+		newVal = append(newVal, make([]byte, end-len(newVal))...)
+	}
+	copy(newVal[offset:], value)
+	if err = db.setInternal(key, newVal, db.strExpiredAt(key)); err != nil {
+		return 0, err
+	}
+	return len(newVal), nil
+}
+
+// IncrByFloat increments the float number stored at key by incr, and returns the new value.
+// If key does not exist, it is set to 0 before the operation is performed. The ttl of the key is kept.
+func (db *BitcaskDB) IncrByFloat(key []byte, incr float64) (float64, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, String); err != nil {
+		return 0, err
+	}
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	var cur float64
+	if len(val) > 0 {
+		if cur, err = strconv.ParseFloat(string(val), 64); err != nil || math.IsNaN(cur) {
+			return 0, ErrWrongFloatType
+		}
+	}
+
+	res := cur + incr
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, ErrFloatOverflow
+	}
+	if err = db.setInternal(key, []byte(util.Float64ToStr(res)), db.strExpiredAt(key)); err != nil {
+		return 0, err
+	}
+	return res, nil
+}
+
+// LCSMatch is a matched range of the longest common subsequence, the ranges are 0-based and inclusive.
+type LCSMatch struct {
+	Start1, End1 int // the range in the first string.
+	Start2, End2 int // the range in the second string.
+}
+
+// Len returns the length of the match.
+func (m LCSMatch) Len() int {
+	return m.End1 - m.Start1 + 1
+}
+
+// LCS returns the longest common subsequence of the strings stored at key1 and key2.
+// A non-existing key is treated as an empty string.
+func (db *BitcaskDB) LCS(key1, key2 []byte) ([]byte, error) {
+	res, _, err := db.lcs(key1, key2, -1)
+	return res, err
+}
+
+// LCSIdx returns the matched ranges of the longest common subsequence of the strings stored at key1 and key2,
+// from the end of the strings to the beginning, and the length of the longest common subsequence.
+// The matches shorter than minMatchLen are not returned.
+func (db *BitcaskDB) LCSIdx(key1, key2 []byte, minMatchLen int) ([]LCSMatch, int, error) {
+	if minMatchLen < 0 {
+		minMatchLen = 0
+	}
+	res, matches, err := db.lcs(key1, key2, minMatchLen)
+	return matches, len(res), err
+}
+
+// lcs computes the longest common subsequence of the strings stored at key1 and key2 by dynamic programming.
+// The matched ranges are collected only if minMatchLen is not negative.
+func (db *BitcaskDB) lcs(key1, key2 []byte, minMatchLen int) ([]byte, []LCSMatch, error) {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	var vals [2][]byte
+	for i, key := range [][]byte{key1, key2} {
+		if err := db.keyspace.check(key, String); err != nil {
+			return nil, nil, err
+		}
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, nil, err
+		}
+		vals[i] = val
+	}
+
+	a, b := vals[0], vals[1]
+	alen, blen := len(a), len(b)
+	if uint64(alen+1)*uint64(blen+1)*4 > maxStringSize {
+		return nil, nil, ErrLCSTooLarge
+	}
+	// dp[i*(blen+1)+j] is the length of the LCS of a[:i] and b[:j].
+	width := blen + 1
+	dp := make([]uint32, (alen+1)*width)
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				dp[i*width+j] = dp[(i-1)*width+j-1] + 1
+			case dp[(i-1)*width+j] > dp[i*width+j-1]:
+				dp[i*width+j] = dp[(i-1)*width+j]
+			default:
+				dp[i*width+j] = dp[i*width+j-1]
+			}
+		}
+	}
+
+	// walk back from the end of both strings, the contiguous matched bytes are merged into ranges.
+	idx := int(dp[alen*width+blen])
+	res := make([]byte, idx)
+	var matches []LCSMatch
+	var cur LCSMatch
+	inRange := false
+	i, j := alen, blen
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			res[idx-1] = a[i-1]
+			if inRange && cur.Start1 == i && cur.Start2 == j {
+				cur.Start1, cur.Start2 = i-1, j-1
+			} else {
+				cur = LCSMatch{Start1: i - 1, End1: i - 1, Start2: j - 1, End2: j - 1}
+				inRange = true
+			}
+			// the range ends at the first byte of either string.
+			emit = i == 1 || j == 1
+			idx, i, j = idx-1, i-1, j-1
+		} else {
+			if dp[(i-1)*width+j] > dp[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			emit = inRange
+		}
+
+		if emit {
+			if minMatchLen >= 0 && cur.Len() >= minMatchLen {
+				matches = append(matches, cur)
+			}
+			inRange = false
+		}
+	}
+	return res, matches, nil
+}
+
+// strExpiredAt returns the expiration time of the alive string stored at key, 0 is returned if it has no ttl.
+// The lock of strIndex must be held.
+func (db *BitcaskDB) strExpiredAt(key []byte) int64 {
+	idxNode, err := db.getIndexNode(db.strIndex.idxTree, key, String)
+	if err != nil {
+		return 0
+	}
+	return idxNode.expiredAt
 }
 
 // GetStrsKeys get all stored keys of type String.
 func (db *BitcaskDB) GetStrsKeys() ([][]byte, error) {
-	db.strIndex.mu.RLock()
+	return db.GetStrsKeysCtx(context.Background())
+}
+
+// GetStrsKeysCtx is like GetStrsKeys, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) GetStrsKeysCtx(ctx context.Context) ([][]byte, error) {
+	if err := db.strIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
 	defer db.strIndex.mu.RUnlock()
 
 	if db.strIndex.idxTree == nil {
@@ -442,8 +866,11 @@ func (db *BitcaskDB) GetStrsKeys() ([][]byte, error) {
 
 	var keys [][]byte
 	iter := db.strIndex.idxTree.Iterator()
-	ts := time.Now().Unix()
+	ts := time.Now().UnixMilli()
 	for iter.HasNext() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		node, err := iter.Next()
 		if err != nil {
 			return nil, err
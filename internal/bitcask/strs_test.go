@@ -0,0 +1,324 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/options"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seedStr writes key according to seed: "" leaves it missing, "old" is a string without ttl,
+// "old+ttl" is a string with a ttl of an hour and "list" is a list.
+func seedStr(t *testing.T, db *BitcaskDB, key []byte, seed string) {
+	switch seed {
+	case "old":
+		assert.Nil(t, db.Set(key, []byte("old")))
+	case "old+ttl":
+		assert.Nil(t, db.SetEX(key, []byte("old"), time.Hour))
+	case "list":
+		assert.Nil(t, db.RPush(key, []byte("v")))
+	}
+}
+
+// assertStr asserts that key holds the string want with the ttl in seconds, a nil want means the key is missing.
+func assertStr(t *testing.T, db *BitcaskDB, key []byte, want []byte, ttl int64) {
+	val, err := db.Get(key)
+	if want == nil {
+		assert.Equal(t, ErrKeyNotFound, err)
+		return
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), string(val))
+	res, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, ttl, res)
+}
+
+func TestBitcaskDB_SetArgs(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		seed    string
+		opts    SetOptions
+		old     []byte
+		ok      bool
+		err     error
+		want    []byte
+		wantTTL int64
+	}{
+		{"plain", "", SetOptions{}, nil, true, nil, []byte("new"), 0},
+		{"plain removes ttl", "old+ttl", SetOptions{}, nil, true, nil, []byte("new"), 0},
+		{"plain overwrites other type", "list", SetOptions{}, nil, true, nil, []byte("new"), 0},
+		{"nx on missing", "", SetOptions{Condition: SetIfNotExist}, nil, true, nil, []byte("new"), 0},
+		{"nx on existing", "old", SetOptions{Condition: SetIfNotExist}, nil, false, nil, []byte("old"), 0},
+		{"nx on other type", "list", SetOptions{Condition: SetIfNotExist}, nil, false, nil, nil, 0},
+		{"xx on missing", "", SetOptions{Condition: SetIfExist}, nil, false, nil, nil, 0},
+		{"xx on existing", "old", SetOptions{Condition: SetIfExist}, nil, true, nil, []byte("new"), 0},
+		{"get on missing", "", SetOptions{Get: true}, nil, true, nil, []byte("new"), 0},
+		{"get on existing", "old", SetOptions{Get: true}, []byte("old"), true, nil, []byte("new"), 0},
+		{"get on other type", "list", SetOptions{Get: true}, nil, false, ErrWrongType, nil, 0},
+		{"nx get on existing", "old", SetOptions{Condition: SetIfNotExist, Get: true}, []byte("old"), false, nil, []byte("old"), 0},
+		{"px", "", SetOptions{ExpiredAt: now.Add(100 * time.Second)}, nil, true, nil, []byte("new"), 100},
+		{"exat in the past", "old", SetOptions{ExpiredAt: now.Add(-time.Second), Get: true}, []byte("old"), true, nil, nil, 0},
+		{"keepttl", "old+ttl", SetOptions{KeepTTL: true, ExpiredAt: now.Add(time.Second)}, nil, true, nil, []byte("new"), 3600},
+		{"keepttl without ttl", "old", SetOptions{KeepTTL: true}, nil, true, nil, []byte("new"), 0},
+		{"xx keepttl", "old+ttl", SetOptions{Condition: SetIfExist, KeepTTL: true}, nil, true, nil, []byte("new"), 3600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []byte(tt.name)
+			seedStr(t, db, key, tt.seed)
+			old, ok, err := db.SetArgs(key, []byte("new"), tt.opts)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.old, old)
+			if tt.seed != "list" || tt.want != nil {
+				assertStr(t, db, key, tt.want, tt.wantTTL)
+			}
+		})
+	}
+	assert.Equal(t, typeNameList, db.Type([]byte("get on other type")))
+	assert.Equal(t, typeNameList, db.Type([]byte("nx on other type")))
+
+	// the expiration time is kept in milliseconds after reopening.
+	key := []byte("pxat")
+	expiredAt := time.UnixMilli(now.Add(time.Hour).UnixMilli())
+	_, _, err = db.SetArgs(key, []byte("v"), SetOptions{ExpiredAt: expiredAt})
+	assert.Nil(t, err)
+	db = reopenTestDB(t, db, opts)
+	ttl, err := db.PTTL(key)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Until(expiredAt).Milliseconds(), ttl, 50)
+	assertStr(t, db, []byte("px"), []byte("new"), 100)
+	assertStr(t, db, []byte("exat in the past"), nil, 0)
+}
+
+func TestBitcaskDB_GetSet(t *testing.T) {
+	db := openTestDB(t)
+
+	tests := []struct {
+		name string
+		seed string
+		old  []byte
+		err  error
+	}{
+		{"missing", "", nil, nil},
+		{"existing", "old", []byte("old"), nil},
+		{"removes ttl", "old+ttl", []byte("old"), nil},
+		{"wrong type", "list", nil, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []byte(tt.name)
+			seedStr(t, db, key, tt.seed)
+			old, err := db.GetSet(key, []byte("new"))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.old, old)
+			if tt.err == nil {
+				assertStr(t, db, key, []byte("new"), 0)
+			}
+		})
+	}
+}
+
+func TestBitcaskDB_GetEx(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		seed      string
+		expiredAt time.Time
+		persist   bool
+		val       []byte
+		err       error
+		want      []byte
+		wantTTL   int64
+	}{
+		{"missing", "", time.Time{}, false, nil, ErrKeyNotFound, nil, 0},
+		{"wrong type", "list", time.Time{}, false, nil, ErrWrongType, nil, 0},
+		{"keeps ttl", "old+ttl", time.Time{}, false, []byte("old"), nil, []byte("old"), 3600},
+		{"sets ttl", "old", now.Add(100 * time.Second), false, []byte("old"), nil, []byte("old"), 100},
+		{"replaces ttl", "old+ttl", now.Add(100 * time.Second), false, []byte("old"), nil, []byte("old"), 100},
+		{"persist", "old+ttl", time.Time{}, true, []byte("old"), nil, []byte("old"), 0},
+		{"persist without ttl", "old", time.Time{}, true, []byte("old"), nil, []byte("old"), 0},
+		{"in the past", "old+ttl", now.Add(-time.Second), false, []byte("old"), nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []byte(tt.name)
+			seedStr(t, db, key, tt.seed)
+			val, err := db.GetEx(key, tt.expiredAt, tt.persist)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.val, val)
+			if tt.seed != "list" {
+				assertStr(t, db, key, tt.want, tt.wantTTL)
+			}
+		})
+	}
+
+	db = reopenTestDB(t, db, opts)
+	for _, tt := range tests {
+		if tt.seed != "list" {
+			assertStr(t, db, []byte(tt.name), tt.want, tt.wantTTL)
+		}
+	}
+}
+
+func TestBitcaskDB_SetRange(t *testing.T) {
+	db := openTestDB(t)
+	assert.Nil(t, db.Set([]byte("hello"), []byte("Hello World")))
+
+	tests := []struct {
+		name   string
+		key    string
+		seed   string
+		offset int
+		value  string
+		n      int
+		err    error
+		want   []byte
+		ttl    int64
+	}{
+		{"missing key", "", "", 0, "ab", 2, nil, []byte("ab"), 0},
+		{"overwrite", "hello", "", 6, "Redis", 11, nil, []byte("Hello Redis"), 0},
+		{"extend", "hello", "", 10, "s!", 12, nil, []byte("Hello Redis!"), 0},
+		{"pad with zero bytes", "", "old", 5, "x", 6, nil, []byte("old\x00\x00x"), 0},
+		{"pad missing key", "", "", 2, "x", 3, nil, []byte("\x00\x00x"), 0},
+		{"keeps ttl", "", "old+ttl", 1, "k", 3, nil, []byte("okd"), 3600},
+		{"empty value", "", "old", 10, "", 3, nil, []byte("old"), 0},
+		{"empty value on missing key", "", "", 10, "", 0, nil, nil, 0},
+		{"negative offset", "", "old", -1, "x", 0, ErrWrongIndex, []byte("old"), 0},
+		{"too long", "", "old", maxStringSize, "x", 0, ErrStringTooLong, []byte("old"), 0},
+		{"wrong type", "", "list", 0, "x", 0, ErrWrongType, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []byte(tt.key)
+			if tt.key == "" {
+				key = []byte(tt.name)
+			}
+			seedStr(t, db, key, tt.seed)
+			n, err := db.SetRange(key, tt.offset, []byte(tt.value))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.n, n)
+			if tt.seed != "list" {
+				assertStr(t, db, key, tt.want, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestBitcaskDB_IncrByFloat(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.MSet([]byte("f"), []byte("2.5"), []byte("int"), []byte("3"), []byte("exp"), []byte("5.0e3"),
+		[]byte("str"), []byte("abc"), []byte("nan"), []byte("nan"), []byte("max"), []byte("1.7e308")))
+	assert.Nil(t, db.SetEX([]byte("ttl"), []byte("1"), time.Hour))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+
+	tests := []struct {
+		name string
+		key  string
+		incr float64
+		want float64
+		err  error
+	}{
+		{"float", "f", 0.25, 2.75, nil},
+		{"integer", "int", -0.5, 2.5, nil},
+		{"exponent", "exp", 1, 5001, nil},
+		{"missing key", "new", 1.5, 1.5, nil},
+		{"keeps ttl", "ttl", 1, 2, nil},
+		{"not a float", "str", 1, 0, ErrWrongFloatType},
+		{"nan value", "nan", 1, 0, ErrWrongFloatType},
+		{"overflow", "max", 1.7e308, 0, ErrFloatOverflow},
+		{"infinite increment", "f", math.Inf(-1), 0, ErrFloatOverflow},
+		{"wrong type", "list", 1, 0, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := db.IncrByFloat([]byte(tt.key), tt.incr)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+
+	db = reopenTestDB(t, db, opts)
+	assertStr(t, db, []byte("f"), []byte("2.75"), 0)
+	assertStr(t, db, []byte("exp"), []byte("5001"), 0)
+	assertStr(t, db, []byte("ttl"), []byte("2"), 3600)
+	assertStr(t, db, []byte("max"), []byte("1.7e308"), 0)
+}
+
+func TestBitcaskDB_LCS(t *testing.T) {
+	db := openTestDB(t)
+	assert.Nil(t, db.MSet([]byte("k1"), []byte("ohmytext"), []byte("k2"), []byte("mynewtext"),
+		[]byte("a"), []byte("abc"), []byte("b"), []byte("xyz")))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+
+	tests := []struct {
+		name       string
+		key1, key2 string
+		want       string
+		err        error
+	}{
+		{"common", "k1", "k2", "mytext", nil},
+		{"same key", "k1", "k1", "ohmytext", nil},
+		{"nothing common", "a", "b", "", nil},
+		{"missing key", "k1", "missing", "", nil},
+		{"wrong type", "k1", "list", "", ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := db.LCS([]byte(tt.key1), []byte(tt.key2))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, string(res))
+		})
+	}
+}
+
+func TestBitcaskDB_LCSIdx(t *testing.T) {
+	db := openTestDB(t)
+	assert.Nil(t, db.MSet([]byte("k1"), []byte("ohmytext"), []byte("k2"), []byte("mynewtext"),
+		[]byte("a"), []byte("abc"), []byte("b"), []byte("xyz")))
+	assert.Nil(t, db.Set([]byte("long"), []byte(strings.Repeat("a", 20000))))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+
+	tests := []struct {
+		name        string
+		key1, key2  string
+		minMatchLen int
+		want        []LCSMatch
+		n           int
+		err         error
+	}{
+		{"all matches", "k1", "k2", 0, []LCSMatch{{4, 7, 5, 8}, {2, 3, 0, 1}}, 6, nil},
+		{"negative min match len", "k1", "k2", -1, []LCSMatch{{4, 7, 5, 8}, {2, 3, 0, 1}}, 6, nil},
+		{"min match len", "k1", "k2", 4, []LCSMatch{{4, 7, 5, 8}}, 6, nil},
+		{"min match len too long", "k1", "k2", 5, nil, 6, nil},
+		{"reversed keys", "k2", "k1", 0, []LCSMatch{{5, 8, 4, 7}, {0, 1, 2, 3}}, 6, nil},
+		{"same key", "a", "a", 0, []LCSMatch{{0, 2, 0, 2}}, 3, nil},
+		{"nothing common", "a", "b", 0, nil, 0, nil},
+		{"missing key", "missing", "k2", 0, nil, 0, nil},
+		{"too large", "long", "long", 0, nil, 0, ErrLCSTooLarge},
+		{"wrong type", "list", "k2", 0, nil, 0, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, n, err := db.LCSIdx([]byte(tt.key1), []byte(tt.key2), tt.minMatchLen)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, matches)
+			assert.Equal(t, tt.n, n)
+		})
+	}
+}
@@ -4,130 +4,633 @@ import (
 	"bitcaskDB/internal/ds/art"
 	"bitcaskDB/internal/logfile"
 	"bitcaskDB/internal/util"
+	"bytes"
+	"context"
+	"math"
+	"sort"
+)
+
+// ScoreBound is a bound of a score range, the score itself is excluded from the range if Exclusive is true.
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+// LexBound is a bound of a lexicographical range of members, the member itself is excluded if Exclusive is true.
+// An unbounded min is negative infinity, and an unbounded max is positive infinity.
+type LexBound struct {
+	Member    []byte
+	Exclusive bool
+	Unbounded bool
+}
+
+// ZMember is a member of a sorted set with its score.
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// Aggregate is how ZUnion and ZInter combine the scores of a member in multiple sorted sets.
+type Aggregate int
+
+const (
+	// AggregateSum adds up the scores, it is the default.
+	AggregateSum Aggregate = iota
+	// AggregateMin takes the lowest score.
+	AggregateMin
+	// AggregateMax takes the highest score.
+	AggregateMax
 )
 
 // ZAdd adds the specified member with the specified score to the sorted set stored at key.
 func (db *BitcaskDB) ZAdd(key []byte, score float64, member []byte) error {
-	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
-
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
+	if err := db.checkMemory(); err != nil {
 		return err
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
 
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
-	}
-	idxTree := db.zsetIndex.trees[string(key)]
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.serveBlocked(ZSet)
 
-	scoreBuf := []byte(util.Float64ToStr(score))
-	zsetKey := db.encodeKey(key, scoreBuf)
-	ent := &logfile.LogEntry{Key: zsetKey, Value: member}
-	pos, err := db.writeLogEntry(ent, ZSet)
-	if err != nil {
-		return err
-	}
-	ent.Key = sum // Change the key...Otherwise, you will have trouble deleting nodes
-	if err := db.updateIndexTree(idxTree, ent, pos, true, ZSet); err != nil {
-		return err
-	}
-	db.zsetIndex.indexes.ZAdd(string(key), score, string(sum))
-	return nil
+	return db.zaddInternal(key, score, member)
 }
 
 // ZScore returns the score of member in the sorted set at key.
-func (db *BitcaskDB) ZScore(key, member []byte) (ok bool, score float64) {
+// An error is returned when key exists and does not hold a sorted set.
+func (db *BitcaskDB) ZScore(key, member []byte) (ok bool, score float64, err error) {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
-		return false, 0
+	if err = db.keyspace.check(key, ZSet); err != nil {
+		return
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
-
-	return db.zsetIndex.indexes.ZScore(string(key), string(sum))
+	mkey, err := memberKey(member)
+	if err != nil {
+		return
+	}
+	ok, score = db.zsetIndex.indexes.ZScore(string(key), string(mkey))
+	return
 }
 
 // ZRem removes the specified members from the sorted set stored at key. Non existing members are ignored.
 // An error is returned when key exists and does not hold a sorted set.
 func (db *BitcaskDB) ZRem(key, member []byte) error {
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
-
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
-	}
-	idxTree := db.zsetIndex.trees[string(key)]
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
+	if err := db.keyspace.check(key, ZSet); err != nil {
 		return err
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
-
-	ok := db.zsetIndex.indexes.ZRem(string(key), string(sum))
-	if !ok {
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
 		return nil
 	}
 
-	oldVal, updated := idxTree.Delete(sum)
-	db.sendDiscard(oldVal, updated, ZSet)
-
-	// The key(just key) here is different from the key(key-score) in writing
-	entry := &logfile.LogEntry{Key: key, Value: sum, Type: logfile.TypeDelete}
-	pos, err := db.writeLogEntry(entry, ZSet)
+	mkey, err := memberKey(member)
 	if err != nil {
 		return err
 	}
-	node := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
-	db.sendDiscard(node, true, ZSet)
-
-	return nil
+	_, err = db.zremInternal(key, idxTree, mkey)
+	return err
 }
 
 // ZCard returns the sorted set cardinality (number of elements) of the sorted set stored at key.
-func (db *BitcaskDB) ZCard(key []byte) int {
+// An error is returned when key exists and does not hold a sorted set.
+func (db *BitcaskDB) ZCard(key []byte) (int, error) {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
-	return db.zsetIndex.indexes.ZCard(string(key))
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return 0, err
+	}
+	return db.zsetIndex.indexes.ZCard(string(key)), nil
 }
 
 // ZRange returns the specified range of elements in the sorted set stored at key.
 func (db *BitcaskDB) ZRange(key []byte, start, stop int) ([][]byte, error) {
-	return db.zRangeInternal(key, start, stop, false)
+	return db.zRangeInternal(context.Background(), key, start, stop, false)
+}
+
+// ZRangeCtx is like ZRange, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZRangeCtx(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	return db.zRangeInternal(ctx, key, start, stop, false)
 }
 
 // ZRevRange returns the specified range of elements in the sorted set stored at key.
 // The elements are considered to be ordered from the highest to the lowest score.
 func (db *BitcaskDB) ZRevRange(key []byte, start, stop int) ([][]byte, error) {
-	return db.zRangeInternal(key, start, stop, true)
+	return db.zRangeInternal(context.Background(), key, start, stop, true)
+}
+
+// ZRevRangeCtx is like ZRevRange, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZRevRangeCtx(ctx context.Context, key []byte, start, stop int) ([][]byte, error) {
+	return db.zRangeInternal(ctx, key, start, stop, true)
 }
 
 // ZRank returns the rank of member in the sorted set stored at key, with the scores ordered from low to high.
 // The rank (or index) is 0-based, which means that the member with the lowest score has rank 0.
-func (db *BitcaskDB) ZRank(key []byte, member []byte) (ok bool, rank int) {
+func (db *BitcaskDB) ZRank(key []byte, member []byte) (ok bool, rank int, err error) {
 	return db.zRankInternal(key, member, false)
 
 }
 
 // ZRevRank returns the rank of member in the sorted set stored at key, with the scores ordered from high to low.
 // The rank (or index) is 0-based, which means that the member with the highest score has rank 0.
-func (db *BitcaskDB) ZRevRank(key []byte, member []byte) (ok bool, rank int) {
+func (db *BitcaskDB) ZRevRank(key []byte, member []byte) (ok bool, rank int, err error) {
 	return db.zRankInternal(key, member, true)
 }
 
-func (db *BitcaskDB) zRangeInternal(key []byte, start, stop int, rev bool) ([][]byte, error) {
+// ZPopMin removes and returns at most count members with the lowest scores in the sorted set stored at key,
+// ordered from the lowest to the highest score.
+func (db *BitcaskDB) ZPopMin(key []byte, count int) ([]ZMember, error) {
+	return db.zPop(key, count, false)
+}
+
+// ZPopMax removes and returns at most count members with the highest scores in the sorted set stored at key,
+// ordered from the highest to the lowest score.
+func (db *BitcaskDB) ZPopMax(key []byte, count int) ([]ZMember, error) {
+	return db.zPop(key, count, true)
+}
+
+// ZRangeByScore returns the members in the sorted set stored at key with a score between min and max,
+// ordered from the lowest to the highest score. The first offset members are skipped, and at most count
+// members are returned if count is not negative.
+func (db *BitcaskDB) ZRangeByScore(key []byte, min, max ScoreBound, offset, count int) ([]ZMember, error) {
+	return db.ZRangeByScoreCtx(context.Background(), key, min, max, offset, count)
+}
+
+// ZRangeByScoreCtx is like ZRangeByScore, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZRangeByScoreCtx(ctx context.Context, key []byte, min, max ScoreBound, offset, count int) ([]ZMember, error) {
+	return db.zRangeByScoreInternal(ctx, key, min, max, offset, count, false)
+}
+
+// ZRevRangeByScore is like ZRangeByScore, but the members are ordered from the highest to the lowest score.
+func (db *BitcaskDB) ZRevRangeByScore(key []byte, max, min ScoreBound, offset, count int) ([]ZMember, error) {
+	return db.ZRevRangeByScoreCtx(context.Background(), key, max, min, offset, count)
+}
+
+// ZRevRangeByScoreCtx is like ZRevRangeByScore, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZRevRangeByScoreCtx(ctx context.Context, key []byte, max, min ScoreBound, offset, count int) ([]ZMember, error) {
+	return db.zRangeByScoreInternal(ctx, key, min, max, offset, count, true)
+}
+
+// ZCount returns the number of members in the sorted set stored at key with a score between min and max.
+func (db *BitcaskDB) ZCount(key []byte, min, max ScoreBound) (int, error) {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	if db.zsetIndex.trees[string(key)] == nil {
-		db.zsetIndex.trees[string(key)] = art.NewART()
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return 0, err
+	}
+	return len(db.zScoreRange(key, min, max, false)), nil
+}
+
+// ZIncrBy increments the score of member in the sorted set stored at key by increment, and returns the new score.
+// If member does not exist, it is added with increment as its score (as if its previous score was 0.0).
+func (db *BitcaskDB) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.serveBlocked(ZSet)
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return 0, err
+	}
+	mkey, err := memberKey(member)
+	if err != nil {
+		return 0, err
+	}
+	_, score := db.zsetIndex.indexes.ZScore(string(key), string(mkey))
+	score += increment
+	if math.IsNaN(score) {
+		return 0, ErrScoreIsNaN
+	}
+	if err = db.zaddInternal(key, score, member); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZRangeByLex returns the members in the sorted set stored at key between min and max in lexicographical order.
+// It is meant for sorted sets whose members have the same score, otherwise the members are ordered by score first.
+// The first offset members are skipped, and at most count members are returned if count is not negative.
+func (db *BitcaskDB) ZRangeByLex(key []byte, min, max LexBound, offset, count int) ([][]byte, error) {
+	return db.ZRangeByLexCtx(context.Background(), key, min, max, offset, count)
+}
+
+// ZRangeByLexCtx is like ZRangeByLex, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZRangeByLexCtx(ctx context.Context, key []byte, min, max LexBound, offset, count int) ([][]byte, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	members, err := db.zLexRange(ctx, key, min, max)
+	if err != nil {
+		return nil, err
+	}
+	members = limitRange(members, offset, count)
+	res := make([][]byte, len(members))
+	for i, m := range members {
+		res[i] = m.Member
+	}
+	return res, nil
+}
+
+// ZLexCount returns the number of members in the sorted set stored at key between min and max.
+func (db *BitcaskDB) ZLexCount(key []byte, min, max LexBound) (int, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	members, err := db.zLexRange(context.Background(), key, min, max)
+	return len(members), err
+}
+
+// ZRemRangeByRank removes all the members in the sorted set stored at key with a rank between start and stop.
+// Both start and stop are 0-based indexes, and can be negative numbers indicating offsets from the highest score.
+// It returns the number of removed members.
+func (db *BitcaskDB) ZRemRangeByRank(key []byte, start, stop int) (int, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return 0, err
 	}
 	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+
+	var removed int
+	for _, val := range db.zsetIndex.indexes.ZRange(string(key), start, stop) {
+		mkey, _ := val.(string)
+		if _, err := db.zremInternal(key, idxTree, []byte(mkey)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ZRemRangeByScore removes all the members in the sorted set stored at key with a score between min and max.
+// It returns the number of removed members.
+func (db *BitcaskDB) ZRemRangeByScore(key []byte, min, max ScoreBound) (int, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return 0, err
+	}
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+
+	var removed int
+	for _, m := range db.zScoreRange(key, min, max, false) {
+		mkey, err := memberKey(m.Member)
+		if err != nil {
+			return removed, err
+		}
+		if _, err = db.zremInternal(key, idxTree, mkey); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ZUnion returns the union of the sorted sets stored at keys ordered by score, non-existing keys are empty sets.
+// The scores of each sorted set are multiplied by its weight in weights, which are all 1 if weights is nil,
+// and the scores of a member in multiple sorted sets are combined by aggregate.
+func (db *BitcaskDB) ZUnion(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZMember, error) {
+	return db.ZUnionCtx(context.Background(), keys, weights, aggregate)
+}
+
+// ZUnionCtx is like ZUnion, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZUnionCtx(ctx context.Context, keys [][]byte, weights []float64, aggregate Aggregate) ([]ZMember, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	return db.zCombine(ctx, keys, weights, aggregate, false)
+}
+
+// ZInter is like ZUnion, but it returns the intersection of the sorted sets stored at keys.
+func (db *BitcaskDB) ZInter(keys [][]byte, weights []float64, aggregate Aggregate) ([]ZMember, error) {
+	return db.ZInterCtx(context.Background(), keys, weights, aggregate)
+}
+
+// ZInterCtx is like ZInter, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZInterCtx(ctx context.Context, keys [][]byte, weights []float64, aggregate Aggregate) ([]ZMember, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	return db.zCombine(ctx, keys, weights, aggregate, true)
+}
+
+// ZDiff returns the members of the first sorted set which are not in any of the following ones, with their
+// scores in the first sorted set, ordered by score.
+func (db *BitcaskDB) ZDiff(keys ...[]byte) ([]ZMember, error) {
+	return db.ZDiffCtx(context.Background(), keys...)
+}
+
+// ZDiffCtx is like ZDiff, but it returns the error of ctx if ctx is done before it completes.
+func (db *BitcaskDB) ZDiffCtx(ctx context.Context, keys ...[]byte) ([]ZMember, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	return db.zDiff(ctx, keys)
+}
+
+// ZUnionStore is like ZUnion, but it stores the result in dst and returns its cardinality.
+// dst is overwritten if it already exists regardless of its type, and removed if the result is empty.
+func (db *BitcaskDB) ZUnionStore(dst []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return db.zStore(dst, func() ([]ZMember, error) {
+		return db.zCombine(context.Background(), keys, weights, aggregate, false)
+	})
+}
+
+// ZInterStore is like ZInter, but it stores the result in dst the same as ZUnionStore.
+func (db *BitcaskDB) ZInterStore(dst []byte, keys [][]byte, weights []float64, aggregate Aggregate) (int, error) {
+	return db.zStore(dst, func() ([]ZMember, error) {
+		return db.zCombine(context.Background(), keys, weights, aggregate, true)
+	})
+}
+
+// ZDiffStore is like ZDiff, but it stores the result in dst the same as ZUnionStore.
+func (db *BitcaskDB) ZDiffStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.zStore(dst, func() ([]ZMember, error) {
+		return db.zDiff(context.Background(), keys)
+	})
+}
+
+func (db *BitcaskDB) zRangeByScoreInternal(ctx context.Context, key []byte, min, max ScoreBound, offset, count int, rev bool) ([]ZMember, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return nil, err
+	}
+	return limitRange(db.zScoreRange(key, min, max, rev), offset, count), nil
+}
+
+// zScoreRange returns the members between min and max ordered by score, the lock of zsetIndex must be held.
+func (db *BitcaskDB) zScoreRange(key []byte, min, max ScoreBound, rev bool) []ZMember {
+	var values []interface{}
+	if rev {
+		values = db.zsetIndex.indexes.ZRevScoreRange(string(key), max.Score, min.Score)
+	} else {
+		values = db.zsetIndex.indexes.ZScoreRange(string(key), min.Score, max.Score)
+	}
+
+	var members []ZMember
+	for i := 0; i+1 < len(values); i += 2 {
+		mkey, _ := values[i].(string)
+		score, _ := values[i+1].(float64)
+		if (min.Exclusive && score == min.Score) || (max.Exclusive && score == max.Score) {
+			continue
+		}
+		members = append(members, ZMember{Member: memberOf([]byte(mkey)), Score: score})
+	}
+	return members
+}
+
+// zLexRange returns the real members between min and max, ordered by score and then lexicographically.
+// The skip list orders the members of the same score by their keys, which begin with the murmur sums,
+// so all of them are read and sorted.
+// The lock of zsetIndex must be held.
+func (db *BitcaskDB) zLexRange(ctx context.Context, key []byte, min, max LexBound) ([]ZMember, error) {
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return nil, err
+	}
+	entries, err := db.zEntries(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ZMember, len(entries))
+	for i, e := range entries {
+		members[i] = e.ZMember
+	}
+	sortZMembers(members)
+
+	res := members[:0]
+	for _, m := range members {
+		if min.aboveMin(m.Member) && max.belowMax(m.Member) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// zStore replaces dst with the sorted set computed by op, dst is removed if the sorted set is empty.
+// The locks are held during the whole operation, so readers see either the old or the new value of dst.
+func (db *BitcaskDB) zStore(dst []byte, op func() ([]ZMember, error)) (int, error) {
+	if err := db.checkMemory(); err != nil {
+		return 0, err
+	}
+
+	return db.storeKey(dst, ZSet, func(dstExists bool, dstType DataType) (int, error) {
+		members, err := op()
+		if err != nil {
+			return 0, err
+		}
+		if dstExists {
+			if err = db.removeKeyLocked(dst, dstType); err != nil {
+				return 0, err
+			}
+		}
+		for _, m := range members {
+			if err = db.zaddInternal(dst, m.Score, m.Member); err != nil {
+				return 0, err
+			}
+		}
+		return len(members), nil
+	})
+}
+
+// zCombine returns the union, or the intersection if inter is true, of the sorted sets stored at keys.
+// Members are identified by their keys in the index trees. The lock of zsetIndex must be held.
+func (db *BitcaskDB) zCombine(ctx context.Context, keys [][]byte, weights []float64, aggregate Aggregate, inter bool) ([]ZMember, error) {
+	if len(keys) == 0 || (weights != nil && len(weights) != len(keys)) {
+		return nil, ErrWrongNumberOfArgs
+	}
+	for _, key := range keys {
+		if err := db.keyspace.check(key, ZSet); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]*ZMember)
+	for i, key := range keys {
+		entries, err := db.zEntries(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+
+		next := result
+		if inter {
+			next = make(map[string]*ZMember, len(entries))
+		}
+		for _, e := range entries {
+			score := e.Score * weight
+			// 0 * ±inf, ignore the score like Redis does.
+			if math.IsNaN(score) {
+				score = 0
+			}
+			if m, ok := result[e.mkey]; ok {
+				m.Score = aggregate.combine(m.Score, score)
+				next[e.mkey] = m
+			} else if i == 0 || !inter {
+				next[e.mkey] = &ZMember{Member: e.Member, Score: score}
+			}
+		}
+		result = next
+		if inter && len(result) == 0 {
+			return nil, nil
+		}
+	}
+
+	members := make([]ZMember, 0, len(result))
+	for _, m := range result {
+		members = append(members, *m)
+	}
+	sortZMembers(members)
+	return members, nil
+}
+
+// zDiff returns the members of the first sorted set of keys which are not in the others.
+// The lock of zsetIndex must be held.
+func (db *BitcaskDB) zDiff(ctx context.Context, keys [][]byte) ([]ZMember, error) {
+	if len(keys) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+	for _, key := range keys {
+		if err := db.keyspace.check(key, ZSet); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := db.zEntries(ctx, keys[0])
+	if err != nil {
+		return nil, err
+	}
+	var members []ZMember
+	for _, e := range entries {
+		found := false
+		for _, key := range keys[1:] {
+			if found, _ = db.zsetIndex.indexes.ZScore(string(key), e.mkey); found {
+				break
+			}
+		}
+		if !found {
+			members = append(members, e.ZMember)
+		}
+	}
+	sortZMembers(members)
+	return members, nil
+}
+
+// zsetEntry is a member of a sorted set with its key in the index tree.
+type zsetEntry struct {
+	ZMember
+	mkey string
+}
+
+// zEntries returns all the members of the sorted set stored at key, the lock of zsetIndex must be held.
+func (db *BitcaskDB) zEntries(ctx context.Context, key []byte) ([]zsetEntry, error) {
+	values := db.zsetIndex.indexes.ZRangeWithScores(string(key), 0, -1)
+	entries := make([]zsetEntry, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mkey, _ := values[i].(string)
+		score, _ := values[i+1].(float64)
+		entries = append(entries, zsetEntry{ZMember: ZMember{Member: memberOf([]byte(mkey)), Score: score}, mkey: mkey})
+	}
+	return entries, nil
+}
+
+// combine combines two scores of a member.
+func (a Aggregate) combine(x, y float64) float64 {
+	switch a {
+	case AggregateMin:
+		return math.Min(x, y)
+	case AggregateMax:
+		return math.Max(x, y)
+	default:
+		// inf + -inf, the sum is 0 like Redis does.
+		if sum := x + y; !math.IsNaN(sum) {
+			return sum
+		}
+		return 0
+	}
+}
+
+// sortZMembers sorts members by score, and then lexicographically.
+func sortZMembers(members []ZMember) {
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return bytes.Compare(members[i].Member, members[j].Member) < 0
+	})
+}
+
+// aboveMin returns if member is in the range whose min bound is b.
+func (b LexBound) aboveMin(member []byte) bool {
+	if b.Unbounded {
+		return true
+	}
+	cmp := bytes.Compare(member, b.Member)
+	return cmp > 0 || (cmp == 0 && !b.Exclusive)
+}
+
+// belowMax returns if member is in the range whose max bound is b.
+func (b LexBound) belowMax(member []byte) bool {
+	if b.Unbounded {
+		return true
+	}
+	cmp := bytes.Compare(member, b.Member)
+	return cmp < 0 || (cmp == 0 && !b.Exclusive)
+}
+
+// limitRange skips the first offset members, and keeps at most count members if count is not negative.
+func limitRange(members []ZMember, offset, count int) []ZMember {
+	if offset < 0 || offset >= len(members) {
+		return nil
+	}
+	members = members[offset:]
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
 
+func (db *BitcaskDB) zRangeInternal(ctx context.Context, key []byte, start, stop int, rev bool) ([][]byte, error) {
+	if err := db.zsetIndex.mu.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.zsetIndex.mu.RUnlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return nil, err
+	}
 	var res [][]byte
 	var values []interface{}
 	if rev {
@@ -136,34 +639,36 @@ func (db *BitcaskDB) zRangeInternal(key []byte, start, stop int, rev bool) ([][]
 		values = db.zsetIndex.indexes.ZRange(string(key), start, stop)
 	}
 	for _, val := range values {
-		v, _ := val.(string)
-		if val, err := db.getVal(idxTree, []byte(v), ZSet); err != nil {
+		if err := ctx.Err(); err != nil {
 			return nil, err
-		} else {
-			res = append(res, val)
 		}
+		mkey, _ := val.(string)
+		res = append(res, memberOf([]byte(mkey)))
 	}
 	return res, nil
 }
 
-func (db *BitcaskDB) zRankInternal(key []byte, member []byte, rev bool) (ok bool, rank int) {
+func (db *BitcaskDB) zRankInternal(key []byte, member []byte, rev bool) (ok bool, rank int, err error) {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
+
+	if err = db.keyspace.check(key, ZSet); err != nil {
+		return
+	}
 	if db.zsetIndex.trees[string(key)] == nil {
 		return
 	}
 
-	if err := db.zsetIndex.murhash.Write(member); err != nil {
+	mkey, err := memberKey(member)
+	if err != nil {
 		return
 	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
 
 	var result int64
 	if rev {
-		result = db.zsetIndex.indexes.ZRevRank(string(key), string(sum))
+		result = db.zsetIndex.indexes.ZRevRank(string(key), string(mkey))
 	} else {
-		result = db.zsetIndex.indexes.ZRank(string(key), string(sum))
+		result = db.zsetIndex.indexes.ZRank(string(key), string(mkey))
 	}
 	if result != -1 {
 		ok = true
@@ -180,10 +685,120 @@ func (db *BitcaskDB) ZKeys() [][]byte {
 	return db.zsetIndex.indexes.ZKeys()
 }
 
-// ZScore returns the score of member in the sorted set at key.
+// ZMembers returns all the members of the sorted set stored at key, in no particular order.
 func (db *BitcaskDB) ZMembers(key []byte) [][]byte {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	return util.StrArrToByteArr(db.zsetIndex.indexes.ZMembers(string(key)))
+	mkeys := db.zsetIndex.indexes.ZMembers(string(key))
+	members := make([][]byte, len(mkeys))
+	for i, mkey := range mkeys {
+		members[i] = memberOf([]byte(mkey))
+	}
+	return members
+}
+
+func (db *BitcaskDB) zPop(key []byte, count int, max bool) ([]ZMember, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	if err := db.keyspace.check(key, ZSet); err != nil {
+		return nil, err
+	}
+	var members []ZMember
+	for i := 0; i < count; i++ {
+		member, ok, err := db.zpopInternal(key, max)
+		if err != nil {
+			return members, err
+		}
+		if !ok {
+			break
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// zpopInternal removes and returns the member with the lowest or highest score in the sorted set stored at key,
+// which is the head or tail of the skip list. It returns false if the sorted set is empty.
+// The lock of zsetIndex must be held.
+func (db *BitcaskDB) zpopInternal(key []byte, max bool) (ZMember, bool, error) {
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return ZMember{}, false, nil
+	}
+
+	var mkey string
+	var score float64
+	var ok bool
+	if max {
+		mkey, score, ok = db.zsetIndex.indexes.ZPeekMax(string(key))
+	} else {
+		mkey, score, ok = db.zsetIndex.indexes.ZPeekMin(string(key))
+	}
+	if !ok {
+		return ZMember{}, false, nil
+	}
+	if _, err := db.zremInternal(key, idxTree, []byte(mkey)); err != nil {
+		return ZMember{}, false, err
+	}
+	return ZMember{Member: memberOf([]byte(mkey)), Score: score}, true, nil
+}
+
+// zremInternal removes the member of mkey, which is returned by memberKey, from the sorted set stored at key.
+// It returns false if the member does not exist. The lock of zsetIndex must be held.
+func (db *BitcaskDB) zremInternal(key []byte, idxTree *art.AdaptiveRadixTree, mkey []byte) (bool, error) {
+	ok := db.zsetIndex.indexes.ZRem(string(key), string(mkey))
+	if !ok {
+		return false, nil
+	}
+	if db.zsetIndex.indexes.ZCard(string(key)) == 0 {
+		db.keyspace.release(key, ZSet)
+	}
+
+	oldVal, updated := idxTree.Delete(mkey)
+	db.trackMemory(mkey, nil, oldVal)
+	db.sendDiscard(oldVal, updated, ZSet)
+
+	// The key(just key) here is different from the key(key-score) in writing
+	entry := &logfile.LogEntry{Key: key, Value: mkey, Type: logfile.TypeDelete}
+	pos, err := db.writeLogEntry(entry, ZSet)
+	if err != nil {
+		return false, err
+	}
+	node := &indexNode{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
+	db.sendDiscard(node, true, ZSet)
+	return true, nil
+}
+
+// zaddInternal adds member with score to the sorted set stored at key, the lock of zsetIndex must be held.
+func (db *BitcaskDB) zaddInternal(key []byte, score float64, member []byte) error {
+	mkey, err := memberKey(member)
+	if err != nil {
+		return err
+	}
+	claim, err := db.keyspace.claim(key, ZSet, 0)
+	if err != nil {
+		return err
+	}
+
+	scoreBuf := []byte(util.Float64ToStr(score))
+	zsetKey := db.encodeKey(key, scoreBuf)
+	ent := &logfile.LogEntry{Key: zsetKey, Value: member}
+	pos, err := db.writeLogEntry(ent, ZSet)
+	if err != nil {
+		claim.rollback()
+		return err
+	}
+	if db.zsetIndex.trees[string(key)] == nil {
+		db.zsetIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.zsetIndex.trees[string(key)]
+	ent.Key = mkey // Change the key...Otherwise, you will have trouble deleting nodes
+	if err := db.updateIndexTree(idxTree, ent, pos, true, ZSet); err != nil {
+		return err
+	}
+	db.zsetIndex.indexes.ZAdd(string(key), score, string(mkey))
+	db.zsetIndex.blocked.markReady(key)
+	return nil
 }
@@ -0,0 +1,485 @@
+package bitcask
+
+import (
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/options"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeZSet writes the sorted set key with the members and scores in pairs.
+func writeZSet(t *testing.T, db *BitcaskDB, key string, members ...ZMember) {
+	for _, m := range members {
+		assert.Nil(t, db.ZAdd([]byte(key), m.Score, m.Member))
+	}
+}
+
+func zm(member string, score float64) ZMember {
+	return ZMember{Member: []byte(member), Score: score}
+}
+
+// zMembers returns the members of values in order.
+func zMembers(values []ZMember) []string {
+	res := make([]string, 0, len(values))
+	for _, m := range values {
+		res = append(res, string(m.Member))
+	}
+	return res
+}
+
+func incl(score float64) ScoreBound { return ScoreBound{Score: score} }
+func excl(score float64) ScoreBound { return ScoreBound{Score: score, Exclusive: true} }
+
+var (
+	negInf = incl(math.Inf(-1))
+	posInf = incl(math.Inf(1))
+)
+
+func TestBitcaskDB_ZRangeByScore(t *testing.T) {
+	db := openTestDB(t)
+	writeZSet(t, db, "z", zm("a", 1), zm("b", 2), zm("c", 3), zm("d", 4), zm("e", 5))
+	writeZSet(t, db, "inf", zm("low", math.Inf(-1)), zm("mid", 0), zm("high", math.Inf(1)))
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+
+	tests := []struct {
+		name          string
+		key           string
+		min, max      ScoreBound
+		offset, count int
+		want          []string
+	}{
+		{"inclusive", "z", incl(2), incl(4), 0, -1, []string{"b", "c", "d"}},
+		{"exclusive", "z", excl(2), excl(4), 0, -1, []string{"c"}},
+		{"exclusive min", "z", excl(2), incl(4), 0, -1, []string{"c", "d"}},
+		{"infinite", "z", negInf, posInf, 0, -1, []string{"a", "b", "c", "d", "e"}},
+		{"infinite min", "z", negInf, excl(3), 0, -1, []string{"a", "b"}},
+		{"limit", "z", negInf, posInf, 1, 2, []string{"b", "c"}},
+		{"offset out of range", "z", negInf, posInf, 5, 2, []string{}},
+		{"min above max", "z", incl(4), incl(2), 0, -1, []string{}},
+		{"empty range", "z", excl(1), excl(2), 0, -1, []string{}},
+		{"missing key", "missing", negInf, posInf, 0, -1, []string{}},
+		{"infinite scores", "inf", negInf, posInf, 0, -1, []string{"low", "mid", "high"}},
+		{"exclusive infinite scores", "inf", excl(math.Inf(-1)), excl(math.Inf(1)), 0, -1, []string{"mid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := db.ZRangeByScore([]byte(tt.key), tt.min, tt.max, tt.offset, tt.count)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, zMembers(members))
+
+			count, err := db.ZCount([]byte(tt.key), tt.min, tt.max)
+			assert.Nil(t, err)
+			if tt.count < 0 && tt.offset == 0 {
+				assert.Equal(t, len(tt.want), count)
+			}
+
+			// the reverse range has the same members in the reverse order.
+			all, err := db.ZRangeByScore([]byte(tt.key), tt.min, tt.max, 0, -1)
+			assert.Nil(t, err)
+			assert.Len(t, all, count)
+			rev, err := db.ZRevRangeByScore([]byte(tt.key), tt.max, tt.min, 0, -1)
+			assert.Nil(t, err)
+			assert.Len(t, rev, count)
+			for i := range rev {
+				assert.Equal(t, all[len(all)-1-i], rev[i])
+			}
+		})
+	}
+
+	// the scores are returned with the members.
+	members, err := db.ZRevRangeByScore([]byte("z"), posInf, excl(3), 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{zm("d", 4)}, members)
+	members, err = db.ZRangeByScore([]byte("inf"), negInf, incl(0), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{zm("low", math.Inf(-1)), zm("mid", 0)}, members)
+
+	_, err = db.ZRangeByScore([]byte("str"), negInf, posInf, 0, -1)
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.ZCount([]byte("str"), negInf, posInf)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_ZIncrBy(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	key := []byte("z")
+
+	tests := []struct {
+		name      string
+		member    string
+		increment float64
+		want      float64
+		err       error
+	}{
+		{"new member", "a", 1.5, 1.5, nil},
+		{"existing member", "a", 2, 3.5, nil},
+		{"negative increment", "a", -4, -0.5, nil},
+		{"infinite", "b", math.Inf(1), math.Inf(1), nil},
+		{"nan", "b", math.Inf(-1), 0, ErrScoreIsNaN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, err := db.ZIncrBy(key, tt.increment, []byte(tt.member))
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, score)
+		})
+	}
+
+	// the scores are persisted.
+	db = reopenTestDB(t, db, opts)
+	members, err := db.ZRangeByScore(key, negInf, posInf, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{zm("a", -0.5), zm("b", math.Inf(1))}, members)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.ZIncrBy([]byte("str"), 1, []byte("a"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_ZRangeByLex(t *testing.T) {
+	db := openTestDB(t)
+	for _, mem := range []string{"g", "e", "c", "a", "b", "d", "f"} {
+		assert.Nil(t, db.ZAdd([]byte("z"), 0, []byte(mem)))
+	}
+	lex := func(member string, exclusive bool) LexBound {
+		return LexBound{Member: []byte(member), Exclusive: exclusive}
+	}
+	unbounded := LexBound{Unbounded: true}
+
+	tests := []struct {
+		name          string
+		key           string
+		min, max      LexBound
+		offset, count int
+		want          []string
+	}{
+		{"inclusive", "z", lex("b", false), lex("d", false), 0, -1, []string{"b", "c", "d"}},
+		{"exclusive", "z", lex("b", true), lex("d", true), 0, -1, []string{"c"}},
+		{"unbounded", "z", unbounded, unbounded, 0, -1, []string{"a", "b", "c", "d", "e", "f", "g"}},
+		{"unbounded max", "z", lex("e", false), unbounded, 0, -1, []string{"e", "f", "g"}},
+		{"unbounded min", "z", unbounded, lex("b", true), 0, -1, []string{"a"}},
+		{"between members", "z", lex("bb", false), lex("dd", false), 0, -1, []string{"c", "d"}},
+		{"limit", "z", unbounded, unbounded, 2, 3, []string{"c", "d", "e"}},
+		{"min above max", "z", lex("d", false), lex("b", false), 0, -1, []string{}},
+		{"missing key", "missing", unbounded, unbounded, 0, -1, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := db.ZRangeByLex([]byte(tt.key), tt.min, tt.max, tt.offset, tt.count)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, toStrings(members))
+			if tt.offset == 0 && tt.count < 0 {
+				count, err := db.ZLexCount([]byte(tt.key), tt.min, tt.max)
+				assert.Nil(t, err)
+				assert.Equal(t, len(tt.want), count)
+			}
+		})
+	}
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err := db.ZRangeByLex([]byte("str"), unbounded, unbounded, 0, -1)
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.ZLexCount([]byte("str"), unbounded, unbounded)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestBitcaskDB_ZRemRange(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	all := []ZMember{zm("a", 1), zm("b", 2), zm("c", 3), zm("d", 4), zm("e", 5)}
+
+	tests := []struct {
+		name   string
+		remove func(key []byte) (int, error)
+		want   []string
+	}{
+		{"first ranks", func(key []byte) (int, error) { return db.ZRemRangeByRank(key, 0, 1) }, []string{"c", "d", "e"}},
+		{"negative ranks", func(key []byte) (int, error) { return db.ZRemRangeByRank(key, -2, -1) }, []string{"a", "b", "c"}},
+		{"ranks out of range", func(key []byte) (int, error) { return db.ZRemRangeByRank(key, 5, 10) }, []string{"a", "b", "c", "d", "e"}},
+		{"inclusive scores", func(key []byte) (int, error) { return db.ZRemRangeByScore(key, incl(2), incl(4)) }, []string{"a", "e"}},
+		{"exclusive scores", func(key []byte) (int, error) { return db.ZRemRangeByScore(key, excl(2), excl(4)) }, []string{"a", "b", "d", "e"}},
+		{"infinite scores", func(key []byte) (int, error) { return db.ZRemRangeByScore(key, negInf, excl(3)) }, []string{"c", "d", "e"}},
+		{"all scores", func(key []byte) (int, error) { return db.ZRemRangeByScore(key, negInf, posInf) }, []string{}},
+		{"all ranks", func(key []byte) (int, error) { return db.ZRemRangeByRank(key, 0, -1) }, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := []byte(tt.name)
+			writeZSet(t, db, tt.name, all...)
+			removed, err := tt.remove(key)
+			assert.Nil(t, err)
+			assert.Equal(t, len(all)-len(tt.want), removed)
+			members, err := db.ZRange(key, 0, -1)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, toStrings(members))
+		})
+	}
+
+	// the removals are persisted, and the sorted sets which become empty are removed.
+	db = reopenTestDB(t, db, opts)
+	for _, tt := range tests {
+		members, err := db.ZRange([]byte(tt.name), 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, toStrings(members), tt.name)
+		if len(tt.want) == 0 {
+			assert.Equal(t, typeNameNone, db.Type([]byte(tt.name)))
+		}
+	}
+
+	removed, err := db.ZRemRangeByScore([]byte("missing"), negInf, posInf)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+	removed, err = db.ZRemRangeByRank([]byte("missing"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestBitcaskDB_ZPop(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	key := []byte("z")
+	writeZSet(t, db, "z", zm("a", 1), zm("b", 2), zm("c", 3), zm("d", 4), zm("e", 5))
+
+	tests := []struct {
+		name  string
+		pop   func(key []byte, count int) ([]ZMember, error)
+		count int
+		want  []ZMember
+	}{
+		{"min", db.ZPopMin, 2, []ZMember{zm("a", 1), zm("b", 2)}},
+		{"max", db.ZPopMax, 1, []ZMember{zm("e", 5)}},
+		{"zero count", db.ZPopMin, 0, nil},
+		{"count larger than set", db.ZPopMax, 5, []ZMember{zm("d", 4), zm("c", 3)}},
+		{"empty set", db.ZPopMin, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := tt.pop(key, tt.count)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, members)
+		})
+	}
+	assert.Equal(t, typeNameNone, db.Type(key))
+
+	// the popped members are removed from the log files too.
+	writeZSet(t, db, "z", zm("a", 1), zm("b", 2))
+	_, err = db.ZPopMax(key, 1)
+	assert.Nil(t, err)
+	db = reopenTestDB(t, db, opts)
+	members, err := db.ZRangeByScore(key, negInf, posInf, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{zm("a", 1)}, members)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.ZPopMin([]byte("str"), 1)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+// writeZSets writes z1 = {a:1, b:2, c:3}, z2 = {b:10, c:20, d:30}, z3 = {c:100} and inf = {b:+inf, x:-inf}.
+func writeZSets(t *testing.T, db *BitcaskDB) {
+	writeZSet(t, db, "z1", zm("a", 1), zm("b", 2), zm("c", 3))
+	writeZSet(t, db, "z2", zm("b", 10), zm("c", 20), zm("d", 30))
+	writeZSet(t, db, "z3", zm("c", 100))
+	writeZSet(t, db, "inf", zm("b", math.Inf(1)), zm("x", math.Inf(-1)))
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+}
+
+func TestBitcaskDB_ZUnionInter(t *testing.T) {
+	db := openTestDB(t)
+	writeZSets(t, db)
+
+	tests := []struct {
+		name      string
+		inter     bool
+		keys      []string
+		weights   []float64
+		aggregate Aggregate
+		want      []ZMember
+		err       error
+	}{
+		{"union", false, []string{"z1", "z2"}, nil, AggregateSum, []ZMember{zm("a", 1), zm("b", 12), zm("c", 23), zm("d", 30)}, nil},
+		{"union weights", false, []string{"z1", "z2"}, []float64{2, 1}, AggregateSum, []ZMember{zm("a", 2), zm("b", 14), zm("c", 26), zm("d", 30)}, nil},
+		{"union min", false, []string{"z1", "z2"}, nil, AggregateMin, []ZMember{zm("a", 1), zm("b", 2), zm("c", 3), zm("d", 30)}, nil},
+		{"union max", false, []string{"z1", "z2"}, nil, AggregateMax, []ZMember{zm("a", 1), zm("b", 10), zm("c", 20), zm("d", 30)}, nil},
+		{"union missing key", false, []string{"z3", "missing"}, nil, AggregateSum, []ZMember{zm("c", 100)}, nil},
+		{"union infinite", false, []string{"inf", "inf"}, []float64{1, -1}, AggregateSum, []ZMember{zm("b", 0), zm("x", 0)}, nil},
+		{"union zero weight", false, []string{"inf"}, []float64{0}, AggregateSum, []ZMember{zm("b", 0), zm("x", 0)}, nil},
+		{"inter", true, []string{"z1", "z2"}, nil, AggregateSum, []ZMember{zm("b", 12), zm("c", 23)}, nil},
+		{"inter three", true, []string{"z1", "z2", "z3"}, nil, AggregateSum, []ZMember{zm("c", 123)}, nil},
+		{"inter weights max", true, []string{"z1", "z2"}, []float64{1, 0.5}, AggregateMax, []ZMember{zm("b", 5), zm("c", 10)}, nil},
+		{"inter missing key", true, []string{"z1", "missing"}, nil, AggregateSum, []ZMember{}, nil},
+		{"wrong weights", false, []string{"z1", "z2"}, []float64{1}, AggregateSum, []ZMember{}, ErrWrongNumberOfArgs},
+		{"no keys", true, nil, nil, AggregateSum, []ZMember{}, ErrWrongNumberOfArgs},
+		{"wrong type", false, []string{"z1", "str"}, nil, AggregateSum, []ZMember{}, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			combine := db.ZUnion
+			if tt.inter {
+				combine = db.ZInter
+			}
+			members, err := combine(keysOf(tt.keys...), tt.weights, tt.aggregate)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, append([]ZMember{}, members...))
+		})
+	}
+}
+
+func TestBitcaskDB_ZDiff(t *testing.T) {
+	db := openTestDB(t)
+	writeZSets(t, db)
+
+	tests := []struct {
+		name string
+		keys []string
+		want []ZMember
+		err  error
+	}{
+		{"two sets", []string{"z1", "z2"}, []ZMember{zm("a", 1)}, nil},
+		{"three sets", []string{"z2", "z1", "z3"}, []ZMember{zm("d", 30)}, nil},
+		{"one set", []string{"z1"}, []ZMember{zm("a", 1), zm("b", 2), zm("c", 3)}, nil},
+		{"missing following key", []string{"z3", "missing"}, []ZMember{zm("c", 100)}, nil},
+		{"missing first key", []string{"missing", "z1"}, []ZMember{}, nil},
+		{"no keys", nil, []ZMember{}, ErrWrongNumberOfArgs},
+		{"wrong type", []string{"z1", "str"}, []ZMember{}, ErrWrongType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := db.ZDiff(keysOf(tt.keys...)...)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.want, append([]ZMember{}, members...))
+		})
+	}
+}
+
+func TestBitcaskDB_ZStore(t *testing.T) {
+	opts := options.DefaultOptions(t.TempDir())
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	writeZSets(t, db)
+
+	tests := []struct {
+		name  string
+		store func(dst []byte) (int, error)
+		want  []ZMember
+	}{
+		{"union", func(dst []byte) (int, error) {
+			return db.ZUnionStore(dst, keysOf("z1", "z3"), []float64{1, 2}, AggregateSum)
+		}, []ZMember{zm("a", 1), zm("b", 2), zm("c", 203)}},
+		{"inter", func(dst []byte) (int, error) {
+			return db.ZInterStore(dst, keysOf("z1", "z2"), nil, AggregateMin)
+		}, []ZMember{zm("b", 2), zm("c", 3)}},
+		{"diff", func(dst []byte) (int, error) {
+			return db.ZDiffStore(dst, keysOf("z2", "z3")...)
+		}, []ZMember{zm("b", 10), zm("d", 30)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the destination is overwritten whatever its type is.
+			dst := []byte("dst-" + tt.name)
+			assert.Nil(t, db.Set(dst, []byte("v")))
+			n, err := tt.store(dst)
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.want), n)
+			members, err := db.ZRangeByScore(dst, negInf, posInf, 0, -1)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, members)
+		})
+	}
+
+	// the destination can be one of the sources.
+	n, err := db.ZUnionStore([]byte("z3"), keysOf("z3", "z1"), nil, AggregateMax)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	// an empty result removes the destination.
+	n, err = db.ZInterStore([]byte("z2"), keysOf("z2", "missing"), nil, AggregateSum)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, typeNameNone, db.Type([]byte("z2")))
+	_, err = db.ZDiffStore([]byte("dst"), []byte("str"))
+	assert.Equal(t, ErrWrongType, err)
+
+	db = reopenTestDB(t, db, opts)
+	for _, tt := range tests {
+		members, err := db.ZRangeByScore([]byte("dst-"+tt.name), negInf, posInf, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, members, tt.name)
+	}
+	members, err := db.ZRangeByScore([]byte("z3"), negInf, posInf, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{zm("a", 1), zm("b", 2), zm("c", 100)}, members)
+	assert.Equal(t, typeNameNone, db.Type([]byte("z2")))
+}
+
+func TestBitcaskDB_ZSetMembersReopen(t *testing.T) {
+	for _, mode := range []options.DataIndexMode{options.KeyValueMemMode, options.KeyOnlyMemMode} {
+		opts := options.DefaultOptions(t.TempDir())
+		opts.IndexMode = mode
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		key := []byte("z")
+		writeZSet(t, db, "z", zm("a", 1), zm(string([]byte{0x80, 0x01}), 2), zm("c", 3), zm("", 4))
+		assert.Nil(t, db.ZRem(key, []byte("c")))
+
+		db = reopenTestDB(t, db, opts)
+		want := []ZMember{zm("a", 1), zm(string([]byte{0x80, 0x01}), 2), zm("", 4)}
+		members, err := db.ZRangeByScore(key, negInf, posInf, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, want, members, mode)
+		assert.ElementsMatch(t, zMembers(want), toStrings(db.ZMembers(key)), mode)
+		ok, score, err := db.ZScore(key, []byte{0x80, 0x01})
+		assert.True(t, ok)
+		assert.Equal(t, float64(2), score)
+		assert.Nil(t, err)
+	}
+}
+
+func TestBitcaskDB_ZSetLegacyTombstone(t *testing.T) {
+	for _, mode := range []options.DataIndexMode{options.KeyValueMemMode, options.KeyOnlyMemMode} {
+		opts := options.DefaultOptions(t.TempDir())
+		opts.IndexMode = mode
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		key := []byte("z")
+		writeZSet(t, db, "z", zm("a", 1), zm("b", 2), zm("c", 3))
+
+		// older versions wrote only the sum of the member in the tombstone.
+		for _, member := range []string{"b", "missing"} {
+			mkey, err := memberKey([]byte(member))
+			assert.Nil(t, err)
+			sum := mkey[:len(mkey)-len(member)]
+			_, err = db.writeLogEntry(&logfile.LogEntry{Key: key, Value: sum, Type: logfile.TypeDelete}, ZSet)
+			assert.Nil(t, err)
+		}
+
+		db = reopenTestDB(t, db, opts)
+		members, err := db.ZRangeByScore(key, negInf, posInf, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, []ZMember{zm("a", 1), zm("c", 3)}, members, mode)
+		n, err := db.ZCard(key)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		ok, _, err := db.ZScore(key, []byte("b"))
+		assert.False(t, ok)
+		assert.Nil(t, err)
+
+		// removing every member removes the key.
+		writeZSet(t, db, "legacy", zm("x", 1))
+		mkey, err := memberKey([]byte("x"))
+		assert.Nil(t, err)
+		_, err = db.writeLogEntry(&logfile.LogEntry{Key: []byte("legacy"), Value: mkey[:len(mkey)-1], Type: logfile.TypeDelete}, ZSet)
+		assert.Nil(t, err)
+		db = reopenTestDB(t, db, opts)
+		assert.Equal(t, typeNameNone, db.Type([]byte("legacy")))
+	}
+}
@@ -96,35 +96,57 @@ var cmdReadOperationMap = map[string]struct{}{
 	"mget":     {},
 	"getrange": {},
 	"strlen":   {},
+	"lcs":      {},
 
 	// list
 	"llen":   {},
 	"lindex": {},
 	"lrange": {},
+	"lpos":   {},
 
 	// hash commands
-	"hget":    {},
-	"hmget":   {},
-	"hexists": {},
-	"hlen":    {},
-	"hkeys":   {},
-	"hvals":   {},
-	"hgetall": {},
-	"hstrlen": {},
-	"hscan":   {},
+	"hget":        {},
+	"hmget":       {},
+	"hexists":     {},
+	"hlen":        {},
+	"hkeys":       {},
+	"hvals":       {},
+	"hgetall":     {},
+	"hstrlen":     {},
+	"hscan":       {},
+	"hrandfield":  {},
+	"hexpiretime": {},
+	"httl":        {},
 
 	// set commands
-	"sismember": {},
-	"smembers":  {},
-	"scard":     {},
-	"sdiff":     {},
-	"sunion":    {},
+	"sismember":   {},
+	"smembers":    {},
+	"scard":       {},
+	"sdiff":       {},
+	"sunion":      {},
+	"sinter":      {},
+	"sintercard":  {},
+	"srandmember": {},
+	"smismember":  {},
+	"sscan":       {},
 
 	// zset commands
-	"zscore":    {},
-	"zcard":     {},
-	"zrange":    {},
-	"zrevrange": {},
-	"zrank":     {},
-	"zrevrank":  {},
+	"zscore":           {},
+	"zcard":            {},
+	"zrange":           {},
+	"zrevrange":        {},
+	"zrank":            {},
+	"zrevrank":         {},
+	"zrangebyscore":    {},
+	"zrevrangebyscore": {},
+	"zcount":           {},
+	"zrangebylex":      {},
+	"zlexcount":        {},
+	"zunion":           {},
+	"zinter":           {},
+	"zdiff":            {},
+	"zscan":            {},
+
+	// generic commands
+	"scan": {},
 }
@@ -12,71 +12,118 @@ type cmdHandler func(client *Client, cmd []byte, args [][]byte) (interface{}, er
 var supportedCommands = map[string]cmdHandler{
 
 	// string commands
-	"set":      opLogEntry,
-	"get":      opLogEntry,
-	"mget":     opLogEntry,
-	"getrange": opLogEntry,
-	"getdel":   opLogEntry,
-	"setex":    opLogEntry,
-	"setnx":    opLogEntry,
-	"mset":     opLogEntry,
-	"msetnx":   opLogEntry,
-	"append":   opLogEntry,
-	"decr":     opLogEntry,
-	"decrby":   opLogEntry,
-	"incr":     opLogEntry,
-	"incrby":   opLogEntry,
-	"strlen":   opLogEntry,
+	"set":         opLogEntry,
+	"get":         opLogEntry,
+	"mget":        opLogEntry,
+	"getrange":    opLogEntry,
+	"getdel":      opLogEntry,
+	"setex":       opLogEntry,
+	"setnx":       opLogEntry,
+	"mset":        opLogEntry,
+	"msetnx":      opLogEntry,
+	"append":      opLogEntry,
+	"decr":        opLogEntry,
+	"decrby":      opLogEntry,
+	"incr":        opLogEntry,
+	"incrby":      opLogEntry,
+	"strlen":      opLogEntry,
+	"getex":       opLogEntry,
+	"getset":      opLogEntry,
+	"setrange":    opLogEntry,
+	"incrbyfloat": opLogEntry,
+	"lcs":         opLogEntry,
 
 	// list
-	"lpush":  opLogEntry,
-	"lpushx": opLogEntry,
-	"rpush":  opLogEntry,
-	"rpushx": opLogEntry,
-	"lpop":   opLogEntry,
-	"rpop":   opLogEntry,
-	"lmove":  opLogEntry,
-	"llen":   opLogEntry,
-	"lindex": opLogEntry,
-	"lset":   opLogEntry,
-	"lrange": opLogEntry,
+	"lpush":   opLogEntry,
+	"lpushx":  opLogEntry,
+	"rpush":   opLogEntry,
+	"rpushx":  opLogEntry,
+	"lpop":    opLogEntry,
+	"rpop":    opLogEntry,
+	"lmove":   opLogEntry,
+	"llen":    opLogEntry,
+	"lindex":  opLogEntry,
+	"lset":    opLogEntry,
+	"lrange":  opLogEntry,
+	"lrem":    opLogEntry,
+	"linsert": opLogEntry,
+	"ltrim":   opLogEntry,
+	"lpos":    opLogEntry,
 
 	// hash commands
-	"hset":    opLogEntry,
-	"hsetnx":  opLogEntry,
-	"hget":    opLogEntry,
-	"hmget":   opLogEntry,
-	"hdel":    opLogEntry,
-	"hexists": opLogEntry,
-	"hlen":    opLogEntry,
-	"hkeys":   opLogEntry,
-	"hvals":   opLogEntry,
-	"hgetall": opLogEntry,
-	"hstrlen": opLogEntry,
-	"hscan":   opLogEntry,
-	"hincrby": opLogEntry,
+	"hset":         opLogEntry,
+	"hsetnx":       opLogEntry,
+	"hget":         opLogEntry,
+	"hmget":        opLogEntry,
+	"hdel":         opLogEntry,
+	"hexists":      opLogEntry,
+	"hlen":         opLogEntry,
+	"hkeys":        opLogEntry,
+	"hvals":        opLogEntry,
+	"hgetall":      opLogEntry,
+	"hstrlen":      opLogEntry,
+	"hscan":        opLogEntry,
+	"hincrby":      opLogEntry,
+	"hincrbyfloat": opLogEntry,
+	"hrandfield":   opLogEntry,
+	"hgetdel":      opLogEntry,
+	"hsetex":       opLogEntry,
+	"hexpire":      opLogEntry,
+	"hexpireat":    opLogEntry,
+	"hexpiretime":  opLogEntry,
+	"httl":         opLogEntry,
+	"hpersist":     opLogEntry,
 
 	// set commands
-	"sadd":      opLogEntry,
-	"spop":      opLogEntry,
-	"srem":      opLogEntry,
-	"sismember": opLogEntry,
-	"smembers":  opLogEntry,
-	"scard":     opLogEntry,
-	"sdiff":     opLogEntry,
-	"sunion":    opLogEntry,
+	"sadd":        opLogEntry,
+	"spop":        opLogEntry,
+	"srem":        opLogEntry,
+	"sismember":   opLogEntry,
+	"smembers":    opLogEntry,
+	"scard":       opLogEntry,
+	"sdiff":       opLogEntry,
+	"sunion":      opLogEntry,
+	"sinter":      opLogEntry,
+	"sintercard":  opLogEntry,
+	"sdiffstore":  opLogEntry,
+	"sunionstore": opLogEntry,
+	"sinterstore": opLogEntry,
+	"smove":       opLogEntry,
+	"srandmember": opLogEntry,
+	"smismember":  opLogEntry,
+	"sscan":       opLogEntry,
 
 	// zset commands
-	"zadd":      opLogEntry,
-	"zscore":    opLogEntry,
-	"zrem":      opLogEntry,
-	"zcard":     opLogEntry,
-	"zrange":    opLogEntry,
-	"zrevrange": opLogEntry,
-	"zrank":     opLogEntry,
-	"zrevrank":  opLogEntry,
-
-	// // generic commands
+	"zadd":             opLogEntry,
+	"zscore":           opLogEntry,
+	"zrem":             opLogEntry,
+	"zcard":            opLogEntry,
+	"zrange":           opLogEntry,
+	"zrevrange":        opLogEntry,
+	"zrank":            opLogEntry,
+	"zrevrank":         opLogEntry,
+	"zrangebyscore":    opLogEntry,
+	"zrevrangebyscore": opLogEntry,
+	"zcount":           opLogEntry,
+	"zincrby":          opLogEntry,
+	"zrangebylex":      opLogEntry,
+	"zlexcount":        opLogEntry,
+	"zremrangebyrank":  opLogEntry,
+	"zremrangebyscore": opLogEntry,
+	"zpopmin":          opLogEntry,
+	"zpopmax":          opLogEntry,
+	"bzpopmin":         opLogEntry,
+	"bzpopmax":         opLogEntry,
+	"zunion":           opLogEntry,
+	"zinter":           opLogEntry,
+	"zdiff":            opLogEntry,
+	"zunionstore":      opLogEntry,
+	"zinterstore":      opLogEntry,
+	"zdiffstore":       opLogEntry,
+	"zscan":            opLogEntry,
+
+	// generic commands
+	"scan": opLogEntry,
 	// "type": keyType,
 	// "del":  del,
 
@@ -41,7 +41,7 @@ func (s *NodeServiceImpl) RegisterSlave(ctx context.Context, req *node.RegisterS
 
 // OpLogEntry implements the NodeServiceImpl interface.
 func (s *NodeServiceImpl) OpLogEntry(ctx context.Context, req *node.LogEntryRequest) (resp *node.LogEntryResponse, err error) {
-	return bitcaskNode.HandleOpLogEntryRequest(req)
+	return bitcaskNode.HandleOpLogEntryRequest(ctx, req)
 }
 
 // // IncrReplFailNotify implements the NodeServiceImpl interface.
@@ -127,15 +127,10 @@ func (node *BitcaskNode) resetReplication(resetDB bool) {
 	node.cf.CurReplicationOffset = 0
 
 	if resetDB {
-		opts := options.DefaultOptions(node.cf.Path)
-		opts.RemakeDir = true
-		db, err := bitcask.Open(opts)
 		log.Infof("MASTER <-> REPLICA sync: Flushing old data")
-		if err != nil {
-			fmt.Printf("open bitcaskdb err: %v", err)
-			return
+		if err := node.db.Flush(); err != nil {
+			log.Errorf("flush bitcaskdb err: %v", err)
 		}
-		node.db = db
 	}
 }
 
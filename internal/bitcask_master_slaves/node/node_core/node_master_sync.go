@@ -214,8 +214,8 @@ func (bitcaskNode *BitcaskNode) FullReplication(slaveId string) {
 	for _, key := range keys {
 		members := bitcaskNode.db.ZMembers(key)
 		for _, member := range members {
-			ok, score := bitcaskNode.db.ZScore(key, member)
-			if !ok {
+			ok, score, err := bitcaskNode.db.ZScore(key, member)
+			if err != nil || !ok {
 				log.Errorf("unexist key:%s, member:%s", key, member)
 				continue
 			}
@@ -7,88 +7,144 @@ import (
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
 	"bitcaskDB/internal/log"
 	"bitcaskDB/internal/util"
+	"context"
 	"fmt"
+	"time"
 )
 
 var resultOK = "OK"
 
-type cmdHandler func(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error)
+type cmdHandler func(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error)
 
 var supportedCommands = map[string]cmdHandler{
 	// string commands
-	"set":      set,
-	"get":      get,
-	"mget":     mGet,
-	"getrange": getRange,
-	"getdel":   getDel,
-	"setex":    setEX,
-	"setnx":    setNX,
-	"mset":     mSet,
-	"msetnx":   mSetNX,
-	"append":   appendStr,
-	"decr":     decr,
-	"decrby":   decrBy,
-	"incr":     incr,
-	"incrby":   incrBy,
-	"strlen":   strLen,
+	"set":         set,
+	"get":         get,
+	"mget":        mGet,
+	"getrange":    getRange,
+	"getdel":      getDel,
+	"setex":       setEX,
+	"setnx":       setNX,
+	"mset":        mSet,
+	"msetnx":      mSetNX,
+	"append":      appendStr,
+	"decr":        decr,
+	"decrby":      decrBy,
+	"incr":        incr,
+	"incrby":      incrBy,
+	"strlen":      strLen,
+	"getex":       getEx,
+	"getset":      getSet,
+	"setrange":    setRange,
+	"incrbyfloat": incrByFloat,
+	"lcs":         lcs,
 
 	// list
-	"lpush":  lPush,
-	"lpushx": lPushX,
-	"rpush":  rPush,
-	"rpushx": rPushX,
-	"lpop":   lPop,
-	"rpop":   rPop,
-	"lmove":  lMove,
-	"llen":   lLen,
-	"lindex": lIndex,
-	"lset":   lSet,
-	"lrange": lRange,
+	"lpush":   lPush,
+	"lpushx":  lPushX,
+	"rpush":   rPush,
+	"rpushx":  rPushX,
+	"lpop":    lPop,
+	"rpop":    rPop,
+	"lmove":   lMove,
+	"llen":    lLen,
+	"lindex":  lIndex,
+	"lset":    lSet,
+	"lrange":  lRange,
+	"lrem":    lRem,
+	"linsert": lInsert,
+	"ltrim":   lTrim,
+	"lpos":    lPos,
 
 	// hash commands
-	"hset":    hSet,
-	"hsetnx":  hSetNX,
-	"hget":    hGet,
-	"hmget":   hmGet,
-	"hdel":    hDel,
-	"hexists": hExists,
-	"hlen":    hLen,
-	"hfields": hFields,
-	"hvals":   hVals,
-	"hgetall": hGetAll,
-	"hstrlen": hStrLen,
-	"hscan":   hScan,
-	"hincrby": hIncrBy,
+	"hset":         hSet,
+	"hsetnx":       hSetNX,
+	"hget":         hGet,
+	"hmget":        hmGet,
+	"hdel":         hDel,
+	"hexists":      hExists,
+	"hlen":         hLen,
+	"hfields":      hFields,
+	"hvals":        hVals,
+	"hgetall":      hGetAll,
+	"hstrlen":      hStrLen,
+	"hscan":        hScan,
+	"hincrby":      hIncrBy,
+	"hincrbyfloat": hIncrByFloat,
+	"hrandfield":   hRandField,
+	"hgetdel":      hGetDel,
+	"hsetex":       hSetEx,
+	"hexpire":      hExpire,
+	"hexpireat":    hExpireAt,
+	"hexpiretime":  hExpireTime,
+	"httl":         hTTL,
+	"hpersist":     hPersist,
 
 	// set commands
-	"sadd":      sAdd,
-	"spop":      sPop,
-	"srem":      sRem,
-	"sismember": sIsMember,
-	"smembers":  sMembers,
-	"scard":     sCard,
-	"sdiff":     sDiff,
-	"sunion":    sUnion,
+	"sadd":        sAdd,
+	"spop":        sPop,
+	"srem":        sRem,
+	"sismember":   sIsMember,
+	"smembers":    sMembers,
+	"scard":       sCard,
+	"sdiff":       sDiff,
+	"sunion":      sUnion,
+	"sinter":      sInter,
+	"sintercard":  sInterCard,
+	"sdiffstore":  sDiffStore,
+	"sunionstore": sUnionStore,
+	"sinterstore": sInterStore,
+	"smove":       sMove,
+	"srandmember": sRandMember,
+	"smismember":  sMIsMember,
+	"sscan":       sScan,
 
 	// zset commands
-	"zadd":      zAdd,
-	"zscore":    zScore,
-	"zrem":      zRem,
-	"zcard":     zCard,
-	"zrange":    zRange,
-	"zrevrange": zRevRange,
-	"zrank":     zRank,
-	"zrevrank":  zRevRank,
+	"zadd":             zAdd,
+	"zscore":           zScore,
+	"zrem":             zRem,
+	"zcard":            zCard,
+	"zrange":           zRange,
+	"zrevrange":        zRevRange,
+	"zrank":            zRank,
+	"zrevrank":         zRevRank,
+	"zrangebyscore":    zRangeByScore,
+	"zrevrangebyscore": zRevRangeByScore,
+	"zcount":           zCount,
+	"zincrby":          zIncrBy,
+	"zrangebylex":      zRangeByLex,
+	"zlexcount":        zLexCount,
+	"zremrangebyrank":  zRemRangeByRank,
+	"zremrangebyscore": zRemRangeByScore,
+	"zpopmin":          zPopMin,
+	"zpopmax":          zPopMax,
+	"bzpopmin":         bzPopMin,
+	"bzpopmax":         bzPopMax,
+	"zunion":           zUnion,
+	"zinter":           zInter,
+	"zdiff":            zDiff,
+	"zunionstore":      zUnionStore,
+	"zinterstore":      zInterStore,
+	"zdiffstore":       zDiffStore,
+	"zscan":            zScan,
 
 	// generic commands
-	"type": keyType,
-	"del":  del,
+	"type":     keyType,
+	"del":      del,
+	"unlink":   unlink,
+	"exists":   exists,
+	"scan":     scan,
+	"rename":   rename,
+	"renamenx": renameNX,
+	"copy":     copyKey,
 
 	"ping": ping,
 	"quit": nil,
 
 	// server management commands
-	"info": info,
+	"info":     info,
+	"flushdb":  flushDB,
+	"flushall": flushDB, // a node has only one db.
 }
 
 var cmdReadOperationMap = map[string]struct{}{
@@ -97,41 +153,71 @@ var cmdReadOperationMap = map[string]struct{}{
 	"mget":     {},
 	"getrange": {},
 	"strlen":   {},
+	"lcs":      {},
 
 	// list
 	"llen":   {},
 	"lindex": {},
 	"lrange": {},
+	"lpos":   {},
 
 	// hash commands
-	"hget":    {},
-	"hmget":   {},
-	"hexists": {},
-	"hlen":    {},
-	"hkeys":   {},
-	"hvals":   {},
-	"hgetall": {},
-	"hstrlen": {},
-	"hscan":   {},
+	"hget":        {},
+	"hmget":       {},
+	"hexists":     {},
+	"hlen":        {},
+	"hkeys":       {},
+	"hvals":       {},
+	"hgetall":     {},
+	"hstrlen":     {},
+	"hscan":       {},
+	"hrandfield":  {},
+	"hexpiretime": {},
+	"httl":        {},
 
 	// set commands
-	"sismember": {},
-	"smembers":  {},
-	"scard":     {},
-	"sdiff":     {},
-	"sunion":    {},
+	"sismember":   {},
+	"smembers":    {},
+	"scard":       {},
+	"sdiff":       {},
+	"sunion":      {},
+	"sinter":      {},
+	"sintercard":  {},
+	"srandmember": {},
+	"smismember":  {},
+	"sscan":       {},
 
 	// zset commands
-	"zscore":    {},
-	"zcard":     {},
-	"zrange":    {},
-	"zrevrange": {},
-	"zrank":     {},
-	"zrevrank":  {},
+	"zscore":           {},
+	"zcard":            {},
+	"zrange":           {},
+	"zrevrange":        {},
+	"zrank":            {},
+	"zrevrank":         {},
+	"zrangebyscore":    {},
+	"zrevrangebyscore": {},
+	"zcount":           {},
+	"zrangebylex":      {},
+	"zlexcount":        {},
+	"zunion":           {},
+	"zinter":           {},
+	"zdiff":            {},
+	"zscan":            {},
+
+	// generic commands
+	"type":   {},
+	"exists": {},
+	"scan":   {},
+}
+
+// blockingCommands are the commands which block until any of their keys can be served.
+var blockingCommands = map[string]struct{}{
+	"bzpopmin": {},
+	"bzpopmax": {},
 }
 
 // 处理Logentry操作申请
-func (bitcaskNode *BitcaskNode) HandleOpLogEntryRequest(req *node.LogEntryRequest) (resp *node.LogEntryResponse, err error) {
+func (bitcaskNode *BitcaskNode) HandleOpLogEntryRequest(ctx context.Context, req *node.LogEntryRequest) (resp *node.LogEntryResponse, err error) {
 	command := req.Cmd
 	_, ok := supportedCommands[command]
 
@@ -166,11 +252,60 @@ func (bitcaskNode *BitcaskNode) HandleOpLogEntryRequest(req *node.LogEntryReques
 	}
 
 	// 判断结束，可以执行
-	return bitcaskNode.executeOpReq(req)
+	if _, ok := blockingCommands[command]; ok && req.MasterId == "" {
+		return bitcaskNode.executeBlockingReq(ctx, req)
+	}
+	return bitcaskNode.executeOpReq(ctx, req)
+}
+
+// executeBlockingReq waits for the keys of a blocking command without holding the node lock, so that the writes
+// which wake it are not stalled, and then executes it for the first key with members. The executed request has
+// only that key and never blocks, so it is also what the slaves replay.
+func (bitcaskNode *BitcaskNode) executeBlockingReq(ctx context.Context, req *node.LogEntryRequest) (*node.LogEntryResponse, error) {
+	args := req.Args_
+	if len(args) < 2 {
+		return &node.LogEntryResponse{
+			BaseResp: pack.BuildBaseResp(node.ErrCode_OpLogEntryErrCode, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: req.Cmd})),
+		}, nil
+	}
+	timeout, err := parseBlockTimeout([]byte(args[len(args)-1]))
+	if err != nil {
+		return &node.LogEntryResponse{BaseResp: pack.BuildBaseResp(node.ErrCode_OpLogEntryErrCode, err)}, nil
+	}
+	keys := util.StrArrToByteArr(args[:len(args)-1])
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		var remaining time.Duration
+		if timeout > 0 {
+			if remaining = time.Until(deadline); remaining <= 0 {
+				break
+			}
+		}
+		key, err := bitcaskNode.db.ZWait(ctx, remaining, keys...)
+		if err != nil {
+			return &node.LogEntryResponse{BaseResp: pack.BuildBaseResp(node.ErrCode_OpLogEntryErrCode, err)}, nil
+		}
+		if key == nil {
+			break
+		}
+
+		resp, err := bitcaskNode.executeOpReq(ctx, &node.LogEntryRequest{Cmd: req.Cmd, Args_: []string{string(key), "0"}})
+		// other clients may pop the members before the node lock is acquired, then wait again.
+		if err != nil || len(resp.Entries) > 0 || resp.BaseResp.StatusCode != int64(node.ErrCode_SuccessCode) {
+			return resp, err
+		}
+	}
+
+	iResp, err := pack.BuildResp(pack.OpLogEntryResp, nil)
+	return iResp.(*node.LogEntryResponse), err
 }
 
 // 执行LogEntry操作
-func (bitcaskNode *BitcaskNode) executeOpReq(req *node.LogEntryRequest) (*node.LogEntryResponse, error) {
+func (bitcaskNode *BitcaskNode) executeOpReq(ctx context.Context, req *node.LogEntryRequest) (*node.LogEntryResponse, error) {
 	command, args := req.Cmd, req.Args_
 	cmdFunc := supportedCommands[command]
 	fmt.Println("command:", command)
@@ -182,7 +317,8 @@ func (bitcaskNode *BitcaskNode) executeOpReq(req *node.LogEntryRequest) (*node.L
 	}
 	rpcResp := &node.LogEntryResponse{}
 
-	if res, err := cmdFunc(bitcaskNode, util.StrArrToByteArr(args)); err != nil {
+	// 读操作在请求取消时提前返回，写操作不能只执行一部分，所以不会被取消
+	if res, err := cmdFunc(ctx, bitcaskNode, util.StrArrToByteArr(args)); err != nil {
 		log.Infof("cmdFunc err [%v]", err)
 		rpcResp.BaseResp = pack.BuildBaseResp(node.ErrCode_OpLogEntryErrCode, err)
 		if isReadOperation(command) {
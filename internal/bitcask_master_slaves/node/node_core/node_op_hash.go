@@ -1,14 +1,21 @@
 package nodeCore
 
 import (
+	"bitcaskDB/internal/bitcask"
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
 	"bitcaskDB/internal/util"
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |--------------------------- Hash commands ----------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
-func hSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hSet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 || len(args)%2 == 0 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hset"})
 	}
@@ -24,7 +31,7 @@ func hSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return cnt, nil
 }
 
-func hSetNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hSetNX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hsetnx"})
 	}
@@ -37,75 +44,85 @@ func hSetNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	}
 }
 
-func hGet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hGet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hget"})
 	}
 	return bitcaskNode.db.HGet(args[0], args[1])
 }
 
-func hmGet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hmGet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hmget"})
 	}
 	return bitcaskNode.db.HMGet(args[0], args[1:]...)
 }
 
-func hDel(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hDel(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hdel"})
 	}
 	return bitcaskNode.db.HDel(args[0], args[1:]...)
 }
 
-func hExists(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hExists(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hdel"})
 	}
 	return bitcaskNode.db.HExists(args[0], args[1])
 }
 
-func hLen(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hLen(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hlen"})
 	}
 	return bitcaskNode.db.HLen(args[0]), nil
 }
 
-func hFields(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hFields(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hkeys"})
 	}
 	return bitcaskNode.db.HFields(args[0])
 }
 
-func hVals(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hVals(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hvals"})
 	}
 	return bitcaskNode.db.HVals(args[0])
 }
 
-func hGetAll(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hGetAll(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hgetall"})
 	}
-	return bitcaskNode.db.HGetAll(args[0])
+	return bitcaskNode.db.HGetAllCtx(ctx, args[0])
 }
 
-func hStrLen(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hStrLen(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hstrlen"})
 	}
 	return bitcaskNode.db.HStrLen(args[0], args[1]), nil
 }
 
-func hScan(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
-	// TODO
-	return resultOK, nil
+func hScan(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hscan"})
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := bitcaskNode.db.HScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, values...), nil
 }
 
-func hIncrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func hIncrBy(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hincrby"})
 	}
@@ -116,28 +133,382 @@ func hIncrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.HIncrBy(args[0], args[1], incr)
 }
 
+func hIncrByFloat(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hincrbyfloat"})
+	}
+	incr, err := util.StrToFloat64(string(args[2]))
+	if err != nil || math.IsNaN(incr) {
+		return nil, errno.ErrFloatIsInvalid
+	}
+	res, err := bitcaskNode.db.HIncrByFloat(args[0], args[1], incr)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(util.Float64ToStr(res)), nil
+}
+
+// hrandfield key [count [WITHVALUES]]
+func hRandField(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hrandfield"})
+	}
+	if len(args) == 1 {
+		fields, err := bitcaskNode.db.HRandField(args[0], 1, false)
+		if err != nil || len(fields) == 0 {
+			return nil, err
+		}
+		return fields[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToLower(string(args[2])) != "withvalues" {
+			return nil, errno.ErrSyntax
+		}
+		withValues = true
+	}
+	return bitcaskNode.db.HRandField(args[0], count, withValues)
+}
+
+// hgetdel key FIELDS numfields field [field ...]
+func hGetDel(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hgetdel"})
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.HGetDel(args[0], fields...)
+}
+
+// hsetex key [FNX|FXX] FIELDS numfields field value [field value ...]
+func hSetEx(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hsetex"})
+	}
+	cond, opts := bitcask.HSetAlways, args[1:]
+	switch strings.ToLower(string(opts[0])) {
+	case "fnx":
+		cond, opts = bitcask.HSetIfNoneExist, opts[1:]
+	case "fxx":
+		cond, opts = bitcask.HSetIfAllExist, opts[1:]
+	}
+	pairs, err := parseHashFields(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := bitcaskNode.db.HSetEx(args[0], cond, pairs...)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// hexpire key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func hExpire(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hexpire"})
+	}
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	cond, fields, err := parseHExpireArgs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	res, err := bitcaskNode.db.HExpire(args[0], time.Duration(seconds)*time.Second, cond, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
+}
+
+// hexpireat key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func hExpireAt(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hexpireat"})
+	}
+	expiredAt, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	cond, fields, err := parseHExpireArgs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	res, err := bitcaskNode.db.HExpireAt(args[0], time.Unix(expiredAt, 0), cond, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
+}
+
+// hexpiretime key FIELDS numfields field [field ...]
+func hExpireTime(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hexpiretime"})
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bitcaskNode.db.HExpireTime(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hTimesReply(res), nil
+}
+
+// httl key FIELDS numfields field [field ...]
+func hTTL(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "httl"})
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bitcaskNode.db.HTTL(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hTimesReply(res), nil
+}
+
+// hpersist key FIELDS numfields field [field ...]
+func hPersist(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "hpersist"})
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bitcaskNode.db.HPersist(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
+}
+
+// parseHExpireArgs parses [NX|XX|GT|LT] FIELDS numfields field [field ...].
+func parseHExpireArgs(opts [][]byte) (bitcask.ExpireCondition, [][]byte, error) {
+	cond := bitcask.ExpireAlways
+	switch strings.ToLower(string(opts[0])) {
+	case "nx":
+		cond, opts = bitcask.ExpireIfNoTTL, opts[1:]
+	case "xx":
+		cond, opts = bitcask.ExpireIfHasTTL, opts[1:]
+	case "gt":
+		cond, opts = bitcask.ExpireIfGreater, opts[1:]
+	case "lt":
+		cond, opts = bitcask.ExpireIfLess, opts[1:]
+	}
+	fields, err := parseHashFields(opts, false)
+	return cond, fields, err
+}
+
+// hFieldsReply converts the results of the fields to the reply.
+func hFieldsReply(res []int) [][]byte {
+	reply := make([][]byte, len(res))
+	for i, r := range res {
+		reply[i] = []byte(strconv.Itoa(r))
+	}
+	return reply
+}
+
+// hTimesReply converts the times of the fields to the reply.
+func hTimesReply(res []int64) [][]byte {
+	reply := make([][]byte, len(res))
+	for i, r := range res {
+		reply[i] = []byte(strconv.FormatInt(r, 10))
+	}
+	return reply
+}
+
+// parseHashFields parses FIELDS numfields field [field ...], each field is followed by its value if withValues is true.
+func parseHashFields(opts [][]byte, withValues bool) ([][]byte, error) {
+	if len(opts) < 3 || strings.ToLower(string(opts[0])) != "fields" {
+		return nil, errno.ErrSyntax
+	}
+	numFields, err := strconv.Atoi(string(opts[1]))
+	if err != nil || numFields <= 0 {
+		return nil, errno.ErrValueIsInvalid
+	}
+	n := numFields
+	if withValues {
+		n *= 2
+	}
+	if len(opts)-2 != n {
+		return nil, errno.ErrSyntax
+	}
+	return opts[2:], nil
+}
+
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |-------------------------- generic commands --------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
-func del(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
-	// TODO
+func del(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "del"})
+	}
+	return bitcaskNode.db.Del(args...)
+}
+
+func unlink(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "unlink"})
+	}
+	return bitcaskNode.db.Unlink(args...)
+}
+
+func exists(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "exists"})
+	}
+	return bitcaskNode.db.Exists(args...), nil
+}
+
+func keyType(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "type"})
+	}
+	return bitcaskNode.db.Type(args[0]), nil
+}
+
+func rename(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "rename"})
+	}
+	if err := bitcaskNode.db.Rename(args[0], args[1]); err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, errno.ErrNoSuchKey
+		}
+		return nil, err
+	}
 	return resultOK, nil
 }
 
-func keyType(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
-	// todo
-	return "string", nil
+func renameNX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "renamenx"})
+	}
+	renamed, err := bitcaskNode.db.RenameNX(args[0], args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, errno.ErrNoSuchKey
+	}
+	return renamed, err
+}
+
+// copy source destination [DB destination-db] [REPLACE]
+// A node has only one db, so the destination db can only be 0.
+func copyKey(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "copy"})
+	}
+	var replace bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "db":
+			if i+1 >= len(args) {
+				return nil, errno.ErrSyntax
+			}
+			index, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, errno.ErrValueIsInvalid
+			}
+			if index != 0 {
+				return nil, errno.ErrDBIndexOutOfRange
+			}
+			i++
+		case "replace":
+			replace = true
+		default:
+			return nil, errno.ErrSyntax
+		}
+	}
+	return bitcaskNode.db.Copy(args[0], bitcaskNode.db, args[1], replace)
+}
+
+func scan(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "scan"})
+	}
+	cursor, pattern, count, typeName, err := parseScanArgs(args, true)
+	if err != nil {
+		return nil, err
+	}
+	next, keys, err := bitcaskNode.db.Scan(cursor, pattern, count, typeName)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, keys...), nil
+}
+
+// parseScanArgs parses the arguments of scan commands: cursor [MATCH pattern] [COUNT count] [TYPE type],
+// TYPE is only allowed if withType is true.
+func parseScanArgs(args [][]byte, withType bool) (cursor, pattern []byte, count int, typeName string, err error) {
+	if cursor, err = util.DecodeScanCursor(args[0]); err != nil {
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			err = errno.ErrSyntax
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				err = errno.ErrValueIsInvalid
+				return
+			}
+		case "type":
+			if !withType {
+				err = errno.ErrSyntax
+				return
+			}
+			typeName = strings.ToLower(string(args[i+1]))
+		default:
+			err = errno.ErrSyntax
+			return
+		}
+	}
+	return
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |---------------------- server management commands --------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
-func info(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func info(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	// todo
 	return "info", nil
 }
 
-func ping(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+// flushdb [ASYNC|SYNC], the flush is always synchronous.
+func flushDB(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, errno.ErrSyntax
+	}
+	if len(args) == 1 {
+		if mode := strings.ToLower(string(args[0])); mode != "async" && mode != "sync" {
+			return nil, errno.ErrSyntax
+		}
+	}
+	if err := bitcaskNode.db.Flush(); err != nil {
+		return nil, err
+	}
+	return resultOK, nil
+}
+
+func ping(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) > 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "ping"})
 	}
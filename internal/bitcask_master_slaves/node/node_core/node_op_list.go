@@ -4,54 +4,56 @@ import (
 	"bitcaskDB/internal/bitcask"
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
 	"bytes"
+	"context"
 	"strconv"
+	"strings"
 )
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |---------------------------- List commands ---------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
 
-func lPush(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lPush(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpush"})
 	}
 	if err := bitcaskNode.db.LPush(args[0], args[1:]...); err != nil {
 		return nil, err
 	}
-	return bitcaskNode.db.LLen(args[0]), nil
+	return bitcaskNode.db.LLen(args[0])
 }
 
-func lPushX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lPushX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpush"})
 	}
 	if err := bitcaskNode.db.LPushX(args[0], args[1:]...); err != nil && err != bitcask.ErrKeyNotFound {
 		return nil, err
 	}
-	return bitcaskNode.db.LLen(args[0]), nil
+	return bitcaskNode.db.LLen(args[0])
 }
 
-func rPush(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func rPush(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpush"})
 	}
 	if err := bitcaskNode.db.RPush(args[0], args[1:]...); err != nil {
 		return nil, err
 	}
-	return bitcaskNode.db.LLen(args[0]), nil
+	return bitcaskNode.db.LLen(args[0])
 }
 
-func rPushX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func rPushX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpush"})
 	}
 	if err := bitcaskNode.db.LPushX(args[0], args[1:]...); err != nil && err != bitcask.ErrKeyNotFound {
 		return nil, err
 	}
-	return bitcaskNode.db.LLen(args[0]), nil
+	return bitcaskNode.db.LLen(args[0])
 }
 
-func lPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lPop(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpop"})
 	}
@@ -62,7 +64,7 @@ func lPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	}
 }
 
-func rPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func rPop(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpop"})
 	}
@@ -73,7 +75,7 @@ func rPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	}
 }
 
-func lMove(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lMove(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 4 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lmove"})
 	}
@@ -95,14 +97,14 @@ func lMove(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.LMove(srcKey, dstKey, srcIsLeft, dstIsLeft)
 }
 
-func lLen(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lLen(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "llen"})
 	}
-	return bitcaskNode.db.LLen(args[0]), nil
+	return bitcaskNode.db.LLen(args[0])
 }
 
-func lIndex(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lIndex(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lindex"})
 	}
@@ -113,7 +115,7 @@ func lIndex(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.LIndex(args[0], index)
 }
 
-func lSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lSet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lset"})
 	}
@@ -127,7 +129,7 @@ func lSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func lRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func lRange(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lrange"})
 	}
@@ -139,5 +141,90 @@ func lRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if err != nil {
 		return nil, errno.ErrValueIsInvalid
 	}
-	return bitcaskNode.db.LRange(args[0], start, stop)
+	return bitcaskNode.db.LRangeCtx(ctx, args[0], start, stop)
+}
+
+func lRem(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lrem"})
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	return bitcaskNode.db.LRem(args[0], count, args[2])
+}
+
+// linsert key BEFORE|AFTER pivot element
+func lInsert(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "linsert"})
+	}
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return nil, errno.ErrSyntax
+	}
+	return bitcaskNode.db.LInsert(args[0], before, args[2], args[3])
+}
+
+func lTrim(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "ltrim"})
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	if err := bitcaskNode.db.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return resultOK, nil
+}
+
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func lPos(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lpos"})
+	}
+	rank, count, maxLen := 1, 1, 0
+	var withCount bool
+	for i := 2; i < len(args); i += 2 {
+		n, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return nil, errno.ErrValueIsInvalid
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			rank = n
+		case "count":
+			count, withCount = n, true
+		case "maxlen":
+			maxLen = n
+		default:
+			return nil, errno.ErrSyntax
+		}
+	}
+	indexes, err := bitcaskNode.db.LPos(args[0], args[1], rank, count, maxLen)
+	if err != nil {
+		return nil, err
+	}
+	if !withCount {
+		if len(indexes) == 0 {
+			return nil, nil
+		}
+		return indexes[0], nil
+	}
+	res := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		res[i] = []byte(strconv.Itoa(index))
+	}
+	return res, nil
 }
@@ -3,26 +3,29 @@ package nodeCore
 import (
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
 	"bitcaskDB/internal/util"
+	"context"
+	"strconv"
+	"strings"
 )
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |---------------------------- Set commands ----------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
-func sAdd(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sAdd(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sadd"})
 	}
 	return bitcaskNode.db.SAdd(args[0], args[1:]...)
 }
 
-func sRem(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sRem(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "srem"})
 	}
 	return bitcaskNode.db.SRem(args[0], args[1:]...)
 }
 
-func sPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sPop(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "spop"})
 	}
@@ -33,37 +36,151 @@ func sPop(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.SPop(args[0], uint(count))
 }
 
-func sIsMember(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sIsMember(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sismember"})
 	}
 	return bitcaskNode.db.SIsMember(args[0], args[1]), nil
 }
 
-func sMembers(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sMembers(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "smembers"})
 	}
-	return bitcaskNode.db.SMembers(args[0])
+	return bitcaskNode.db.SMembersCtx(ctx, args[0])
 }
 
-func sCard(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sCard(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "scard"})
 	}
 	return bitcaskNode.db.SCard(args[0]), nil
 }
 
-func sDiff(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sDiff(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) == 0 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sdiff"})
 	}
-	return bitcaskNode.db.SDiff(args...)
+	return bitcaskNode.db.SDiffCtx(ctx, args...)
 }
 
-func sUnion(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func sUnion(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) == 0 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sdiff"})
 	}
-	return bitcaskNode.db.SUnion(args...)
+	return bitcaskNode.db.SUnionCtx(ctx, args...)
+}
+
+func sScan(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sscan"})
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := bitcaskNode.db.SScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, values...), nil
+}
+
+func sInter(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sinter"})
+	}
+	return bitcaskNode.db.SInterCtx(ctx, args...)
+}
+
+// sintercard numkeys key [key ...] [LIMIT limit]
+func sInterCard(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sintercard"})
+	}
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, errno.ErrValueIsInvalid
+	}
+	if len(args) < numKeys+1 {
+		return nil, errno.ErrSyntax
+	}
+	keys, rest := args[1:numKeys+1], args[numKeys+1:]
+
+	var limit int
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToLower(string(rest[0])) == "limit":
+		if limit, err = strconv.Atoi(string(rest[1])); err != nil || limit < 0 {
+			return nil, errno.ErrValueIsInvalid
+		}
+	default:
+		return nil, errno.ErrSyntax
+	}
+	return bitcaskNode.db.SInterCard(limit, keys...)
+}
+
+func sDiffStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sdiffstore"})
+	}
+	return bitcaskNode.db.SDiffStore(args[0], args[1:]...)
+}
+
+func sUnionStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sunionstore"})
+	}
+	return bitcaskNode.db.SUnionStore(args[0], args[1:]...)
+}
+
+func sInterStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "sinterstore"})
+	}
+	return bitcaskNode.db.SInterStore(args[0], args[1:]...)
+}
+
+func sMove(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "smove"})
+	}
+	return bitcaskNode.db.SMove(args[0], args[1], args[2])
+}
+
+// srandmember key [count]
+func sRandMember(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "srandmember"})
+	}
+	if len(args) == 1 {
+		members, err := bitcaskNode.db.SRandMember(args[0], 1)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		return members[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	return bitcaskNode.db.SRandMember(args[0], count)
+}
+
+func sMIsMember(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "smismember"})
+	}
+	found, err := bitcaskNode.db.SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(found))
+	for i, ok := range found {
+		res[i] = []byte("0")
+		if ok {
+			res[i] = []byte("1")
+		}
+	}
+	return res, nil
 }
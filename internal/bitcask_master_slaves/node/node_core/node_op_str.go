@@ -1,8 +1,12 @@
 package nodeCore
 
 import (
+	"bitcaskDB/internal/bitcask"
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
 	"bitcaskDB/internal/util"
+	"context"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -11,32 +15,97 @@ import (
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |-------------------------- String commands --------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
-func set(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+// set is called as SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|
+// PXAT unix-time-milliseconds|KEEPTTL].
+func set(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "SET"})
 	}
+	opts, err := parseSetArgs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	oldVal, ok, err := bitcaskNode.db.SetArgs(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Get {
+		return oldVal, nil
+	}
+	if !ok {
+		return nil, nil
+	}
+	return resultOK, nil
+}
 
-	var setErr error
-	key, value := args[0], args[1]
-	if len(args) > 2 {
-		if len(args) != 4 || strings.ToLower(string(args[2])) != "ex" {
-			return nil, errno.NewErr(errno.ErrCodeSyntax, nil)
-		}
-		second, err := strconv.Atoi(string(args[3]))
-		if err != nil {
-			return nil, errno.NewErr(errno.ErrCodeSyntax, nil)
+// parseSetArgs parses the options of SET.
+func parseSetArgs(opts [][]byte) (bitcask.SetOptions, error) {
+	var setOpts bitcask.SetOptions
+	var hasExpire bool
+	for i := 0; i < len(opts); i++ {
+		switch opt := strings.ToLower(string(opts[i])); opt {
+		case "nx", "xx":
+			if setOpts.Condition != bitcask.SetAlways {
+				return setOpts, errno.ErrSyntax
+			}
+			setOpts.Condition = bitcask.SetIfNotExist
+			if opt == "xx" {
+				setOpts.Condition = bitcask.SetIfExist
+			}
+		case "get":
+			setOpts.Get = true
+		case "keepttl":
+			if hasExpire {
+				return setOpts, errno.ErrSyntax
+			}
+			setOpts.KeepTTL, hasExpire = true, true
+		case "ex", "px", "exat", "pxat":
+			if hasExpire || i+1 >= len(opts) {
+				return setOpts, errno.ErrSyntax
+			}
+			i++
+			expiredAt, err := parseExpireTime(opt, opts[i])
+			if err != nil {
+				return setOpts, err
+			}
+			setOpts.ExpiredAt, hasExpire = expiredAt, true
+		default:
+			return setOpts, errno.ErrSyntax
 		}
-		setErr = bitcaskNode.db.SetEX(key, value, time.Second*time.Duration(second))
-	} else {
-		setErr = bitcaskNode.db.Set(key, value)
 	}
-	if setErr != nil {
-		return nil, setErr
+	return setOpts, nil
+}
+
+// parseExpireTime converts the value of the expire option EX, PX, EXAT or PXAT to the expiration time.
+func parseExpireTime(opt string, val []byte) (time.Time, error) {
+	n, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return time.Time{}, errno.ErrValueIsInvalid
+	}
+	if n <= 0 {
+		return time.Time{}, errno.ErrInvalidExpireTime
+	}
+	// the relative time must fit in a time.Duration, otherwise it wraps around to a time in the past.
+	unit := time.Millisecond
+	if opt == "ex" || opt == "exat" {
+		unit = time.Second
+	}
+	if opt != "pxat" && n > math.MaxInt64/int64(unit) {
+		return time.Time{}, errno.ErrInvalidExpireTime
+	}
+	switch opt {
+	case "ex":
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	case "px":
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "exat":
+		return time.Unix(n, 0), nil
+	default:
+		return time.UnixMilli(n), nil
 	}
-	return resultOK, nil
 }
 
-func get(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func get(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "GET"})
 	}
@@ -48,26 +117,26 @@ func get(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return value, nil
 }
 
-func mGet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func mGet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) < 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "mget"})
 	}
-	values, err := bitcaskNode.db.MGet(args)
+	values, err := bitcaskNode.db.MGetCtx(ctx, args)
 	return values, err
 }
 
-func getRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func getRange(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func getDel(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func getDel(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "getdel"})
 	}
 	return bitcaskNode.db.GetDel(args[0])
 }
 
-func setEX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func setEX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "setEX"})
 	}
@@ -83,7 +152,7 @@ func setEX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func setNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func setNX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "setNX"})
 	}
@@ -94,7 +163,52 @@ func setNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func mSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+// getEx is called as GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST].
+func getEx(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "getex"})
+	}
+	var expiredAt time.Time
+	var persist bool
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && strings.ToLower(string(args[1])) == "persist":
+		persist = true
+	case len(args) == 3:
+		opt := strings.ToLower(string(args[1]))
+		if opt != "ex" && opt != "px" && opt != "exat" && opt != "pxat" {
+			return nil, errno.ErrSyntax
+		}
+		var err error
+		if expiredAt, err = parseExpireTime(opt, args[2]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errno.ErrSyntax
+	}
+	return bitcaskNode.db.GetEx(args[0], expiredAt, persist)
+}
+
+func getSet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "getset"})
+	}
+	return bitcaskNode.db.GetSet(args[0], args[1])
+}
+
+// setRange is called as SETRANGE key offset value.
+func setRange(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "setrange"})
+	}
+	offset, err := strconv.Atoi(string(args[1]))
+	if err != nil || offset < 0 {
+		return nil, errno.ErrValueIsInvalid
+	}
+	return bitcaskNode.db.SetRange(args[0], offset, args[2])
+}
+
+func mSet(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) == 0 || len(args)%2 != 0 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "mSet"})
 	}
@@ -104,7 +218,7 @@ func mSet(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func mSetNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func mSetNX(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) == 0 || len(args)%2 != 0 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "mSetNX"})
 	}
@@ -114,7 +228,7 @@ func mSetNX(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func appendStr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func appendStr(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "appendStr"})
 	}
@@ -124,7 +238,7 @@ func appendStr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
-func decr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func decr(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "decr"})
 	}
@@ -132,7 +246,7 @@ func decr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.Decr(key)
 }
 
-func decrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func decrBy(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "decrBy"})
 	}
@@ -144,7 +258,7 @@ func decrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.DecrBy(key, decrInt64)
 }
 
-func incr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func incr(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "incr"})
 	}
@@ -152,7 +266,7 @@ func incr(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.Incr(key)
 }
 
-func incrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func incrBy(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "incrBy"})
 	}
@@ -164,9 +278,84 @@ func incrBy(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return bitcaskNode.db.IncrBy(key, decrInt64)
 }
 
-func strLen(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func incrByFloat(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "incrbyfloat"})
+	}
+	incr, err := util.StrToFloat64(string(args[1]))
+	if err != nil || math.IsNaN(incr) {
+		return nil, errno.ErrFloatIsInvalid
+	}
+	res, err := bitcaskNode.db.IncrByFloat(args[0], incr)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(util.Float64ToStr(res)), nil
+}
+
+// lcs is called as LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN].
+// With IDX, the reply is "matches", the ranges of every match in key1 and key2 followed by its length
+// if WITHMATCHLEN is given, then "len" and the length of the LCS.
+func lcs(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "lcs"})
+	}
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "len":
+			getLen = true
+		case "idx":
+			getIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 >= len(args) {
+				return nil, errno.ErrSyntax
+			}
+			i++
+			n, err := strconv.Atoi(string(args[i]))
+			if err != nil {
+				return nil, errno.ErrValueIsInvalid
+			}
+			minMatchLen = n
+		default:
+			return nil, errno.ErrSyntax
+		}
+	}
+	if getLen && getIdx {
+		return nil, errno.ErrLCSLenAndIdx
+	}
+
+	if !getIdx {
+		res, err := bitcaskNode.db.LCS(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		if getLen {
+			return len(res), nil
+		}
+		return res, nil
+	}
+	matches, n, err := bitcaskNode.db.LCSIdx(args[0], args[1], minMatchLen)
+	if err != nil {
+		return nil, err
+	}
+	reply := [][]byte{[]byte("matches")}
+	for _, m := range matches {
+		match := fmt.Sprintf("%d-%d %d-%d", m.Start1, m.End1, m.Start2, m.End2)
+		if withMatchLen {
+			match += " " + strconv.Itoa(m.Len())
+		}
+		reply = append(reply, []byte(match))
+	}
+	return append(reply, []byte("len"), []byte(strconv.Itoa(n))), nil
+}
+
+func strLen(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "strLen"})
 	}
-	return bitcaskNode.db.StrLen(args[0]), nil
+	return bitcaskNode.db.StrLen(args[0])
 }
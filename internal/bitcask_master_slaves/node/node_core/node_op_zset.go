@@ -1,15 +1,21 @@
 package nodeCore
 
 import (
+	"bitcaskDB/internal/bitcask"
 	"bitcaskDB/internal/bitcask_master_slaves/pkg/errno"
+	"bitcaskDB/internal/util"
+	"context"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |------------------------- Sorted Set commands ------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
 
-func zAdd(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zAdd(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zadd"})
 	}
@@ -23,18 +29,18 @@ func zAdd(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return 1, nil
 }
 
-func zScore(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zScore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zscore"})
 	}
-	if ok, score := bitcaskNode.db.ZScore(args[0], args[1]); !ok {
-		return nil, nil
-	} else {
-		return score, nil
+	ok, score, err := bitcaskNode.db.ZScore(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
 	}
+	return score, nil
 }
 
-func zRem(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zRem(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrem"})
 	}
@@ -44,14 +50,14 @@ func zRem(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	return true, nil
 }
 
-func zCard(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zCard(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zcard"})
 	}
-	return bitcaskNode.db.ZCard(args[0]), nil
+	return bitcaskNode.db.ZCard(args[0])
 }
 
-func zRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zRange(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrange"})
 	}
@@ -65,10 +71,10 @@ func zRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if err != nil {
 		return nil, errno.ErrValueIsInvalid
 	}
-	return bitcaskNode.db.ZRange(args[0], start, stop)
+	return bitcaskNode.db.ZRangeCtx(ctx, args[0], start, stop)
 }
 
-func zRevRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zRevRange(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 3 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrevrange"})
 	}
@@ -82,25 +88,473 @@ func zRevRange(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if err != nil {
 		return nil, errno.ErrValueIsInvalid
 	}
-	return bitcaskNode.db.ZRevRange(args[0], start, stop)
+	return bitcaskNode.db.ZRevRangeCtx(ctx, args[0], start, stop)
 }
 
-func zRank(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zRank(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrank"})
 	}
-	if ok, rank := bitcaskNode.db.ZRank(args[0], args[1]); ok {
-		return rank, nil
+	ok, rank, err := bitcaskNode.db.ZRank(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
 	}
-	return nil, nil
+	return rank, nil
 }
 
-func zRevRank(bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+func zRevRank(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrevrank"})
 	}
-	if ok, rank := bitcaskNode.db.ZRevRank(args[0], args[1]); ok {
-		return rank, nil
+	ok, rank, err := bitcaskNode.db.ZRevRank(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return rank, nil
+}
+
+func zScan(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zscan"})
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := bitcaskNode.db.ZScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, values...), nil
+}
+
+// zRangeByScore is called as ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count].
+func zRangeByScore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrangebyscore"})
+	}
+	return zRangeByScoreGeneric(ctx, bitcaskNode, args[0], args[1], args[2], args[3:], false)
+}
+
+// zRevRangeByScore is called as ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count].
+func zRevRangeByScore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrevrangebyscore"})
+	}
+	return zRangeByScoreGeneric(ctx, bitcaskNode, args[0], args[2], args[1], args[3:], true)
+}
+
+func zRangeByScoreGeneric(ctx context.Context, bitcaskNode *BitcaskNode, key, minArg, maxArg []byte, opts [][]byte, rev bool) (interface{}, error) {
+	min, err := parseScoreBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count, err := parseRangeOptions(opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []bitcask.ZMember
+	if rev {
+		members, err = bitcaskNode.db.ZRevRangeByScoreCtx(ctx, key, max, min, offset, count)
+	} else {
+		members, err = bitcaskNode.db.ZRangeByScoreCtx(ctx, key, min, max, offset, count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+func zCount(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zcount"})
+	}
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.ZCount(args[0], min, max)
+}
+
+func zIncrBy(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zincrby"})
+	}
+	increment, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return nil, errno.ErrFloatIsInvalid
+	}
+	return bitcaskNode.db.ZIncrBy(args[0], increment, args[2])
+}
+
+// zRangeByLex is called as ZRANGEBYLEX key min max [LIMIT offset count].
+func zRangeByLex(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zrangebylex"})
+	}
+	min, max, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	_, offset, count, err := parseRangeOptions(args[3:], false)
+	if err != nil || empty {
+		return nil, err
+	}
+	return bitcaskNode.db.ZRangeByLexCtx(ctx, args[0], min, max, offset, count)
+}
+
+func zLexCount(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zlexcount"})
+	}
+	min, max, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return 0, nil
+	}
+	return bitcaskNode.db.ZLexCount(args[0], min, max)
+}
+
+func zRemRangeByRank(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zremrangebyrank"})
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, errno.ErrValueIsInvalid
+	}
+	return bitcaskNode.db.ZRemRangeByRank(args[0], start, stop)
+}
+
+func zRemRangeByScore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zremrangebyscore"})
+	}
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.ZRemRangeByScore(args[0], min, max)
+}
+
+// parseScoreBound parses a score bound like 1.5, (1.5, -inf or +inf, the prefix ( means exclusive.
+func parseScoreBound(arg []byte) (bitcask.ScoreBound, error) {
+	var bound bitcask.ScoreBound
+	if len(arg) > 0 && arg[0] == '(' {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return bound, errno.ErrFloatIsInvalid
+	}
+	bound.Score = score
+	return bound, nil
+}
+
+// parseLexRange parses the bounds of a lexicographical range, a bound is - or +, or a member prefixed by
+// [ for inclusive or ( for exclusive. It returns true if the range is always empty, as + for min or - for max.
+func parseLexRange(minArg, maxArg []byte) (min, max bitcask.LexBound, empty bool, err error) {
+	min, minInf, err := parseLexBound(minArg)
+	if err != nil {
+		return
+	}
+	max, maxInf, err := parseLexBound(maxArg)
+	if err != nil {
+		return
+	}
+	min.Unbounded, max.Unbounded = minInf == '-', maxInf == '+'
+	empty = minInf == '+' || maxInf == '-'
+	return
+}
+
+// parseLexBound parses a bound of a lexicographical range, it returns - or + if the bound is infinite.
+func parseLexBound(arg []byte) (bitcask.LexBound, byte, error) {
+	if len(arg) == 0 {
+		return bitcask.LexBound{}, 0, errno.ErrSyntax
+	}
+	switch arg[0] {
+	case '-', '+':
+		if len(arg) != 1 {
+			return bitcask.LexBound{}, 0, errno.ErrSyntax
+		}
+		return bitcask.LexBound{}, arg[0], nil
+	case '[':
+		return bitcask.LexBound{Member: arg[1:]}, 0, nil
+	case '(':
+		return bitcask.LexBound{Member: arg[1:], Exclusive: true}, 0, nil
+	default:
+		return bitcask.LexBound{}, 0, errno.ErrSyntax
+	}
+}
+
+// parseRangeOptions parses [WITHSCORES] [LIMIT offset count] of range commands, count is -1 without LIMIT.
+func parseRangeOptions(opts [][]byte, allowScores bool) (withScores bool, offset, count int, err error) {
+	count = -1
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToLower(string(opts[i])) {
+		case "withscores":
+			if !allowScores {
+				return false, 0, 0, errno.ErrSyntax
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(opts) {
+				return false, 0, 0, errno.ErrSyntax
+			}
+			if offset, err = strconv.Atoi(string(opts[i+1])); err != nil {
+				return false, 0, 0, errno.ErrValueIsInvalid
+			}
+			if count, err = strconv.Atoi(string(opts[i+2])); err != nil {
+				return false, 0, 0, errno.ErrValueIsInvalid
+			}
+			i += 2
+		default:
+			return false, 0, 0, errno.ErrSyntax
+		}
+	}
+	return
+}
+
+func zPopMin(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return zPopGeneric(bitcaskNode, args, "zpopmin", false)
+}
+
+func zPopMax(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return zPopGeneric(bitcaskNode, args, "zpopmax", true)
+}
+
+// zpopmin|zpopmax key [count]
+func zPopGeneric(bitcaskNode *BitcaskNode, args [][]byte, cmd string, max bool) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: cmd})
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil || count < 0 {
+			return nil, errno.ErrValueIsInvalid
+		}
+	}
+
+	var members []bitcask.ZMember
+	var err error
+	if max {
+		members, err = bitcaskNode.db.ZPopMax(args[0], count)
+	} else {
+		members, err = bitcaskNode.db.ZPopMin(args[0], count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, 0, len(members)*2)
+	for _, m := range members {
+		res = append(res, m.Member, []byte(util.Float64ToStr(m.Score)))
+	}
+	return res, nil
+}
+
+func bzPopMin(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return bzPopGeneric(bitcaskNode, args, "bzpopmin", false)
+}
+
+func bzPopMax(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return bzPopGeneric(bitcaskNode, args, "bzpopmax", true)
+}
+
+// bzpopmin|bzpopmax key [key ...] timeout
+// It never blocks, it pops from the first non-empty key or returns nil. The waiting is done by
+// executeBlockingReq without holding the node lock.
+func bzPopGeneric(bitcaskNode *BitcaskNode, args [][]byte, cmd string, max bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: cmd})
+	}
+	for _, key := range args[:len(args)-1] {
+		var members []bitcask.ZMember
+		var err error
+		if max {
+			members, err = bitcaskNode.db.ZPopMax(key, 1)
+		} else {
+			members, err = bitcaskNode.db.ZPopMin(key, 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(members) > 0 {
+			return [][]byte{key, members[0].Member, []byte(util.Float64ToStr(members[0].Score))}, nil
+		}
 	}
 	return nil, nil
 }
+
+// parseBlockTimeout parses the timeout of blocking commands in seconds, 0 means blocking indefinitely.
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	// NaN fails both comparisons.
+	if err != nil || !(seconds >= 0 && seconds <= math.MaxInt64/float64(time.Second)) {
+		return 0, errno.ErrValueIsInvalid
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// zunion|zinter numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func zUnion(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return zCombineGeneric(ctx, bitcaskNode, args, "zunion", false)
+}
+
+func zInter(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	return zCombineGeneric(ctx, bitcaskNode, args, "zinter", true)
+}
+
+func zCombineGeneric(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte, cmd string, inter bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: cmd})
+	}
+	keys, weights, aggregate, withScores, err := parseZSetOpArgs(args, true, true)
+	if err != nil {
+		return nil, err
+	}
+	var members []bitcask.ZMember
+	if inter {
+		members, err = bitcaskNode.db.ZInterCtx(ctx, keys, weights, aggregate)
+	} else {
+		members, err = bitcaskNode.db.ZUnionCtx(ctx, keys, weights, aggregate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// zdiff numkeys key [key ...] [WITHSCORES]
+func zDiff(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zdiff"})
+	}
+	keys, _, _, withScores, err := parseZSetOpArgs(args, false, true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := bitcaskNode.db.ZDiffCtx(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// zunionstore|zinterstore destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zUnionStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zunionstore"})
+	}
+	keys, weights, aggregate, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.ZUnionStore(args[0], keys, weights, aggregate)
+}
+
+func zInterStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zinterstore"})
+	}
+	keys, weights, aggregate, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.ZInterStore(args[0], keys, weights, aggregate)
+}
+
+// zdiffstore destination numkeys key [key ...]
+func zDiffStore(ctx context.Context, bitcaskNode *BitcaskNode, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, errno.NewErr(errno.ErrCodeWrongArgsNumber, &errno.ErrInfo{Cmd: "zdiffstore"})
+	}
+	keys, _, _, _, err := parseZSetOpArgs(args[1:], false, false)
+	if err != nil {
+		return nil, err
+	}
+	return bitcaskNode.db.ZDiffStore(args[0], keys...)
+}
+
+// parseZSetOpArgs parses numkeys key [key ...] followed by the options of zunion, zinter and zdiff.
+func parseZSetOpArgs(args [][]byte, allowWeights, allowScores bool) (keys [][]byte, weights []float64,
+	aggregate bitcask.Aggregate, withScores bool, err error) {
+
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, nil, 0, false, errno.ErrValueIsInvalid
+	}
+	if len(args) < numKeys+1 {
+		return nil, nil, 0, false, errno.ErrSyntax
+	}
+	keys, opts := args[1:numKeys+1], args[numKeys+1:]
+
+	for i := 0; i < len(opts); i++ {
+		switch option := strings.ToLower(string(opts[i])); {
+		case option == "weights" && allowWeights:
+			if i+numKeys >= len(opts) {
+				return nil, nil, 0, false, errno.ErrSyntax
+			}
+			weights = make([]float64, numKeys)
+			for j := range weights {
+				weights[j], err = strconv.ParseFloat(string(opts[i+1+j]), 64)
+				if err != nil || math.IsNaN(weights[j]) {
+					return nil, nil, 0, false, errno.ErrFloatIsInvalid
+				}
+			}
+			i += numKeys
+		case option == "aggregate" && allowWeights:
+			if i+1 >= len(opts) {
+				return nil, nil, 0, false, errno.ErrSyntax
+			}
+			switch strings.ToLower(string(opts[i+1])) {
+			case "sum":
+				aggregate = bitcask.AggregateSum
+			case "min":
+				aggregate = bitcask.AggregateMin
+			case "max":
+				aggregate = bitcask.AggregateMax
+			default:
+				return nil, nil, 0, false, errno.ErrSyntax
+			}
+			i++
+		case option == "withscores" && allowScores:
+			withScores = true
+		default:
+			return nil, nil, 0, false, errno.ErrSyntax
+		}
+	}
+	return keys, weights, aggregate, withScores, nil
+}
+
+// zMembersReply returns the members, each followed by its score if withScores is true.
+func zMembersReply(members []bitcask.ZMember, withScores bool) [][]byte {
+	res := make([][]byte, 0, len(members))
+	for _, m := range members {
+		res = append(res, m.Member)
+		if withScores {
+			res = append(res, []byte(util.Float64ToStr(m.Score)))
+		}
+	}
+	return res
+}
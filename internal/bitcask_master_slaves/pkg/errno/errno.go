@@ -37,6 +37,9 @@ var (
 
 	ErrFloatIsInvalid    = errors.New("ERR value is not a valid float")
 	ErrDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	ErrNoSuchKey         = errors.New("ERR no such key")
+	ErrInvalidExpireTime = errors.New("ERR invalid expire time")
+	ErrLCSLenAndIdx      = errors.New("ERR If you want both the length and indexes, please just use IDX.")
 )
 
 type ErrNo struct {
@@ -1,6 +1,9 @@
 package art
 
 import (
+	"bytes"
+	"math/rand"
+
 	goart "github.com/plar/go-adaptive-radix-tree"
 )
 
@@ -53,6 +56,97 @@ func (art *AdaptiveRadixTree) PrefixScan(prefix []byte, count int) (keys [][]byt
 	return
 }
 
+// ForEachAfter calls fn for the nodes whose keys are greater than key in the order of keys, until fn returns false.
+// All the nodes are visited if key is empty.
+// The tree can not seek to a key, so the nodes are found by the prefixes of the keys after key instead:
+// the keys starting with key, then the keys sharing key[:i] and followed by a byte greater than key[i],
+// from the longest prefix to the shortest, so the nodes before key are never visited.
+func (art *AdaptiveRadixTree) ForEachAfter(key []byte, fn func(key []byte, value interface{}) bool) {
+	stopped := false
+	cb := func(node goart.Node) bool {
+		if node.Kind() != goart.Leaf || bytes.Compare(node.Key(), key) <= 0 {
+			return true
+		}
+		if !fn(node.Key(), node.Value()) {
+			stopped = true
+			return false
+		}
+		return true
+	}
+
+	if len(key) == 0 {
+		art.tree.ForEach(cb)
+		return
+	}
+	art.tree.ForEachPrefix(key, cb)
+	prefix := make([]byte, len(key))
+	for i := len(key) - 1; i >= 0 && !stopped; i-- {
+		copy(prefix, key[:i])
+		for b := int(key[i]) + 1; b <= 0xff && !stopped; b++ {
+			prefix[i] = byte(b)
+			art.tree.ForEachPrefix(prefix[:i+1], cb)
+		}
+	}
+}
+
+// RandomKey returns the key at a random position of the tree, or nil if the tree is empty.
+// The tree is descended from the root one byte at a time, choosing at random among the bytes which follow the prefix,
+// until the prefix matches a single key. So the keys are not chosen uniformly, the ones in small subtrees are more likely.
+func (art *AdaptiveRadixTree) RandomKey() []byte {
+	var prefix []byte
+	for {
+		first, n := art.firstKeys(prefix)
+		if n == 0 {
+			return nil
+		}
+		if n == 1 {
+			return first
+		}
+
+		// the keys are longer than the prefix except first, which is the smallest one.
+		var choices []int
+		start := 0
+		if len(first) == len(prefix) {
+			choices = append(choices, -1)
+		} else {
+			start = int(first[len(prefix)])
+		}
+		next := append(prefix, 0)
+		for b := start; b <= 0xff; b++ {
+			next[len(prefix)] = byte(b)
+			if _, n := art.firstKeys(next); n > 0 {
+				choices = append(choices, b)
+			}
+		}
+		choice := choices[rand.Intn(len(choices))]
+		if choice < 0 {
+			return first
+		}
+		prefix = append(prefix, byte(choice))
+	}
+}
+
+// firstKeys returns the first key starting with prefix, and the number of such keys up to 2.
+func (art *AdaptiveRadixTree) firstKeys(prefix []byte) (first []byte, n int) {
+	cb := func(node goart.Node) bool {
+		if node.Kind() != goart.Leaf {
+			return true
+		}
+		if n == 0 {
+			first = node.Key()
+		}
+		n++
+		return n < 2
+	}
+
+	if len(prefix) == 0 {
+		art.tree.ForEach(cb)
+	} else {
+		art.tree.ForEachPrefix(prefix, cb)
+	}
+	return
+}
+
 func (art *AdaptiveRadixTree) Iterator() goart.Iterator {
 	return art.tree.Iterator()
 }
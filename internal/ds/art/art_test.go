@@ -0,0 +1,86 @@
+package art
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveRadixTree_ForEachAfter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tree := NewART()
+	var keys [][]byte
+	for i := 0; i < 2000; i++ {
+		// short keys over a few bytes, so many keys are prefixes of others.
+		key := make([]byte, 1+rnd.Intn(6))
+		for j := range key {
+			key[j] = []byte{0, 1, 'a', 0xfe, 0xff}[rnd.Intn(5)]
+		}
+		if _, updated := tree.Put(key, i); !updated {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	collect := func(after []byte, limit int) [][]byte {
+		var res [][]byte
+		tree.ForEachAfter(after, func(key []byte, _ interface{}) bool {
+			res = append(res, key)
+			return len(res) < limit
+		})
+		return res
+	}
+	assert.Equal(t, keys, collect(nil, len(keys)+1))
+
+	for i, key := range keys {
+		want := keys[i+1:]
+		if len(want) > 10 {
+			want = want[:10]
+		}
+		got := collect(key, 10)
+		if len(want) == 0 {
+			assert.Empty(t, got)
+			continue
+		}
+		assert.Equal(t, want, got)
+	}
+	// the cursor may have been deleted.
+	for i := 0; i < 200; i++ {
+		cursor := []byte{byte(rnd.Intn(256)), byte(rnd.Intn(256))}
+		at := sort.Search(len(keys), func(j int) bool { return bytes.Compare(keys[j], cursor) > 0 })
+		want := keys[at:]
+		if len(want) > 3 {
+			want = want[:3]
+		}
+		got := collect(cursor, 3)
+		if len(want) == 0 {
+			assert.Empty(t, got)
+			continue
+		}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestAdaptiveRadixTree_RandomKey(t *testing.T) {
+	tree := NewART()
+	assert.Nil(t, tree.RandomKey())
+
+	keys := map[string]bool{}
+	for _, key := range []string{"a", "ab", "abc", "b", "user:1", "user:2", "user:10", "\xff"} {
+		tree.Put([]byte(key), nil)
+		keys[key] = false
+	}
+	for i := 0; i < 2000; i++ {
+		key := tree.RandomKey()
+		_, ok := keys[string(key)]
+		assert.True(t, ok, "unknown key %q", key)
+		keys[string(key)] = true
+	}
+	// every key can be chosen, including the ones which are prefixes of others.
+	for key, seen := range keys {
+		assert.True(t, seen, "key %q is never chosen", key)
+	}
+}
@@ -227,6 +227,32 @@ func (z *SortedSet) ZRem(key, member string) bool {
 	return false
 }
 
+// ZPeekMin returns the member with the lowest score in the sorted set at key, which is the first node of the skip list.
+func (z *SortedSet) ZPeekMin(key string) (member string, score float64, ok bool) {
+	if !z.exist(key) {
+		return
+	}
+
+	first := z.record[key].skl.head.level[0].forward
+	if first == nil {
+		return
+	}
+	return first.member, first.score, true
+}
+
+// ZPeekMax returns the member with the highest score in the sorted set at key, which is the tail of the skip list.
+func (z *SortedSet) ZPeekMax(key string) (member string, score float64, ok bool) {
+	if !z.exist(key) {
+		return
+	}
+
+	last := z.record[key].skl.tail
+	if last == nil {
+		return
+	}
+	return last.member, last.score, true
+}
+
 // ZGetByRank get the member at key by rank, the rank is ordered from lowest to highest.
 // The rank of lowest is 0 and so on.
 func (z *SortedSet) ZGetByRank(key string, rank int) (val []interface{}) {
@@ -254,7 +280,7 @@ func (z *SortedSet) ZRevGetByRank(key string, rank int) (val []interface{}) {
 // ZScoreRange returns all the elements in the sorted set at key with a score between min and max (including elements with score equal to min or max).
 // The elements are considered to be ordered from low to high scores.
 func (z *SortedSet) ZScoreRange(key string, min, max float64) (val []interface{}) {
-	if !z.exist(key) || min > max {
+	if !z.exist(key) || min > max || z.record[key].skl.length == 0 {
 		return
 	}
 
@@ -292,7 +318,7 @@ func (z *SortedSet) ZScoreRange(key string, min, max float64) (val []interface{}
 // ZRevScoreRange returns all the elements in the sorted set at key with a score between max and min (including elements with score equal to max or min).
 // In contrary to the default ordering of sorted sets, for this command the elements are considered to be ordered from high to low scores.
 func (z *SortedSet) ZRevScoreRange(key string, max, min float64) (val []interface{}) {
-	if !z.exist(key) || max < min {
+	if !z.exist(key) || max < min || z.record[key].skl.length == 0 {
 		return
 	}
 
@@ -314,7 +340,8 @@ func (z *SortedSet) ZRevScoreRange(key string, max, min float64) (val []interfac
 		}
 	}
 
-	for p != nil {
+	// the backward pointer of the first node is nil, and p is the head if no score is less than or equal to max.
+	for p != nil && p != item.head {
 		if p.score < min {
 			break
 		}
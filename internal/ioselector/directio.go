@@ -0,0 +1,229 @@
+package ioselector
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// BlockSize the alignment of the offsets, lengths and memory addresses of direct I/O.
+	BlockSize = 4096
+
+	// directIOBufferSize the size of the write buffer of DirectIOSelector, larger writes are written in chunks of it.
+	directIOBufferSize = 1 << 20
+)
+
+// ErrNegativeOffset offset of read or write is negative.
+var ErrNegativeOffset = errors.New("offset can`t be negative")
+
+// DirectIOSelector represents using direct I/O, which bypasses the page cache of the operating system.
+// Writes are appended to an aligned buffer, which is written to the file in whole blocks when it is full,
+// or when Sync or Close is called, so small writes do not cost a write of the disk each.
+// Unlike the other selectors, the buffered data is lost if the process crashes before it is written to the file.
+// The last partial block is padded with zeros on disk and kept in the buffer, so it is written again with the
+// following writes.
+// Direct I/O is only supported on linux, the file is opened with the page cache on other systems.
+type DirectIOSelector struct {
+	mu       *sync.RWMutex
+	fd       *os.File
+	size     int64  // Size of the file, including the buffered data.
+	buf      []byte // Aligned write buffer, its length is the number of buffered bytes.
+	bufStart int64  // File offset of buf[0], it is always aligned to BlockSize.
+}
+
+// NewDirectIOSelector create a new direct io selector.
+func NewDirectIOSelector(fName string, fsize int64) (IOSelector, error) {
+	if fsize <= 0 {
+		return nil, ErrInvalidFsize
+	}
+	fd, err := openDirectFile(fName, fsize)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return &DirectIOSelector{
+		mu:   new(sync.RWMutex),
+		fd:   fd,
+		size: stat.Size(),
+		buf:  alignedBlock(directIOBufferSize)[:0],
+	}, nil
+}
+
+// Write a slice to log file at offset.
+// Writes are expected to be sequential, a write at any other offset flushes the buffer first.
+// The data is kept in the buffer until the buffer is full, it can be read before it is written to the file.
+func (dio *DirectIOSelector) Write(b []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	if offset != dio.bufStart+int64(len(dio.buf)) {
+		if err := dio.reset(offset); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	for n < len(b) {
+		if len(dio.buf) == cap(dio.buf) {
+			if err := dio.flush(); err != nil {
+				return n, err
+			}
+		}
+		free := dio.buf[len(dio.buf):cap(dio.buf)]
+		copied := copy(free, b[n:])
+		dio.buf = dio.buf[:len(dio.buf)+copied]
+		n += copied
+	}
+	if end := offset + int64(n); end > dio.size {
+		dio.size = end
+	}
+	return n, nil
+}
+
+// Read a slice from offset.
+// It returns the number of bytes read and any error encountered, the buffered data can be read before it is flushed.
+func (dio *DirectIOSelector) Read(b []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+
+	if offset >= dio.size {
+		return 0, io.EOF
+	}
+	length := int64(len(b))
+	if offset+length > dio.size {
+		length = dio.size - offset
+	}
+
+	// the data is read from the file in aligned blocks, unless all of it is in the buffer.
+	bufEnd := dio.bufStart + int64(len(dio.buf))
+	if offset < dio.bufStart || offset+length > bufEnd {
+		start := offset &^ (BlockSize - 1)
+		end := (offset + length + BlockSize - 1) &^ (BlockSize - 1)
+		block := alignedBlock(int(end - start))
+		n, err := dio.fd.ReadAt(block, start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		// the part which is not written to the file yet is in the buffer.
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		copy(b[:length], block[offset-start:])
+	}
+
+	// the buffered data is newer than the file.
+	if offset+length > dio.bufStart && offset < bufEnd {
+		from := offset
+		if from < dio.bufStart {
+			from = dio.bufStart
+		}
+		copy(b[from-offset:length], dio.buf[from-dio.bufStart:])
+	}
+
+	if length < int64(len(b)) {
+		return int(length), io.EOF
+	}
+	return int(length), nil
+}
+
+// Sync writes the buffered data to the file, and commits the current contents of the file to stable storage.
+func (dio *DirectIOSelector) Sync() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	if err := dio.flush(); err != nil {
+		return err
+	}
+	return dio.fd.Sync()
+}
+
+// Close writes the buffered data to the file and closes it, rendering it unusable for I/O.
+// It will return an error if it has already been closed.
+func (dio *DirectIOSelector) Close() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	if err := dio.flush(); err != nil {
+		return err
+	}
+	return dio.fd.Close()
+}
+
+// Delete delete the file.
+// Must close it before delete, and will unmap if in MMapSelector.
+func (dio *DirectIOSelector) Delete() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	dio.buf = dio.buf[:0]
+	if err := dio.fd.Close(); err != nil {
+		return err
+	}
+	return os.Remove(dio.fd.Name())
+}
+
+// flush writes the buffered data to the file in whole blocks, the last partial block is kept in the buffer.
+func (dio *DirectIOSelector) flush() error {
+	if len(dio.buf) == 0 {
+		return nil
+	}
+	full := len(dio.buf) &^ (BlockSize - 1)
+	padded := (len(dio.buf) + BlockSize - 1) &^ (BlockSize - 1)
+	// the padding is zeros, which is the same as the unused space of log files.
+	for i := len(dio.buf); i < padded; i++ {
+		dio.buf[:padded][i] = 0
+	}
+	if _, err := dio.fd.WriteAt(dio.buf[:padded], dio.bufStart); err != nil {
+		return err
+	}
+
+	tail := copy(dio.buf[:BlockSize], dio.buf[full:])
+	dio.bufStart += int64(full)
+	dio.buf = dio.buf[:tail]
+	return nil
+}
+
+// reset flushes the buffer and moves it to offset, the data of the block before offset is read from the file.
+func (dio *DirectIOSelector) reset(offset int64) error {
+	if err := dio.flush(); err != nil {
+		return err
+	}
+	start := offset &^ (BlockSize - 1)
+	dio.buf = dio.buf[:offset-start]
+	if start < offset {
+		block := dio.buf[:BlockSize]
+		n, err := dio.fd.ReadAt(block, start)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		// the part beyond the end of the file is zeros.
+		for i := n; i < BlockSize; i++ {
+			block[i] = 0
+		}
+	}
+	dio.bufStart = start
+	return nil
+}
+
+// alignedBlock returns a slice of n bytes whose address is aligned to BlockSize, as required by direct I/O.
+func alignedBlock(n int) []byte {
+	buf := make([]byte, n+BlockSize)
+	var shift int
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (BlockSize - 1)); rem != 0 {
+		shift = BlockSize - rem
+	}
+	return buf[shift : shift+n : shift+n]
+}
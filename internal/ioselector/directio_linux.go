@@ -0,0 +1,10 @@
+package ioselector
+
+import (
+	"os"
+	"syscall"
+)
+
+func openDirectFile(fName string, fsize int64) (*os.File, error) {
+	return openFileFlag(fName, syscall.O_DIRECT, fsize)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package ioselector
+
+import "os"
+
+// O_DIRECT is not available, the file is opened with the page cache, but the writes are still buffered and aligned.
+func openDirectFile(fName string, fsize int64) (*os.File, error) {
+	return openFile(fName, fsize)
+}
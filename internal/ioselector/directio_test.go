@@ -0,0 +1,78 @@
+package ioselector
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectIOSelector_WriteBuffered(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "directio")
+	dio, err := NewDirectIOSelector(name, 64<<10)
+	assert.Nil(t, err)
+	defer dio.Close()
+
+	var offset int64
+	writes := [][]byte{[]byte("hello"), bytes.Repeat([]byte("a"), BlockSize+10), []byte("world")}
+	for _, data := range writes {
+		n, err := dio.Write(data, offset)
+		assert.Nil(t, err)
+		assert.Equal(t, len(data), n)
+		offset += int64(n)
+
+		// the data is buffered, it is not in the file until Sync, but it can be read.
+		content, err := os.ReadFile(name)
+		assert.Nil(t, err)
+		assert.Equal(t, make([]byte, len(data)), content[offset-int64(len(data)):offset])
+		buf := make([]byte, len(data))
+		_, err = dio.Read(buf, offset-int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, data, buf)
+	}
+
+	assert.Nil(t, dio.Sync())
+	content, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Join(writes, nil), content[:offset])
+
+	// the writes after Sync are buffered again.
+	n, err := dio.Write([]byte("again"), offset)
+	assert.Nil(t, err)
+	content, err = os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, n), content[offset:offset+int64(n)])
+	buf := make([]byte, n)
+	_, err = dio.Read(buf, offset)
+	assert.Nil(t, err)
+	assert.Equal(t, "again", string(buf))
+	assert.Nil(t, dio.Sync())
+	content, err = os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, "again", string(content[offset:offset+int64(n)]))
+}
+
+func TestDirectIOSelector_WriteFullBuffer(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "directio")
+	dio, err := NewDirectIOSelector(name, 4<<20)
+	assert.Nil(t, err)
+	defer dio.Close()
+
+	data := bytes.Repeat([]byte("a"), directIOBufferSize+10)
+	n, err := dio.Write(data, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+
+	// a full buffer is written to the file without Sync, the rest is still buffered.
+	content, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, data[:directIOBufferSize], content[:directIOBufferSize])
+	assert.Equal(t, make([]byte, 10), content[directIOBufferSize:len(data)])
+
+	assert.Nil(t, dio.Close())
+	content, err = os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, data, content[:len(data)])
+}
@@ -35,7 +35,12 @@ type IOSelector interface {
 }
 
 func openFile(fName string, fsize int64) (*os.File, error) {
-	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR, FilePerm)
+	return openFileFlag(fName, 0, fsize)
+}
+
+// openFileFlag opens the file with the extra flag, and extends it to fsize if it is smaller.
+func openFileFlag(fName string, flag int, fsize int64) (*os.File, error) {
+	fd, err := os.OpenFile(fName, os.O_CREATE|os.O_RDWR|flag, FilePerm)
 
 	if err != nil {
 		return nil, err
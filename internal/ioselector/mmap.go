@@ -48,8 +48,9 @@ func (lm *MMapIOSelector) Read(b []byte, offset int64) (int, error) {
 	if offset < 0 || offset >= lm.bufLen {
 		return 0, io.EOF
 	}
+	// the part before the end of the file is read, as with the other selectors.
 	if length+offset > lm.bufLen {
-		return 0, io.EOF
+		return copy(b, lm.buf[offset:]), io.EOF
 	}
 	return copy(b, lm.buf[offset:]), nil
 
@@ -73,6 +74,45 @@ func (lm *MMapIOSelector) Close() error {
 	return lm.fd.Close()
 }
 
+// Size returns the size of the mapped region.
+func (lm *MMapIOSelector) Size() int64 {
+	return lm.bufLen
+}
+
+// Resize changes the size of the file and maps it again, the content within the new size is preserved.
+func (lm *MMapIOSelector) Resize(size int64) error {
+	if size <= 0 {
+		return ErrInvalidFsize
+	}
+	if err := mmap.Msync(lm.buf); err != nil {
+		return err
+	}
+	oldLen := lm.bufLen
+	if size > oldLen {
+		if err := lm.fd.Truncate(size); err != nil {
+			return err
+		}
+	}
+
+	buf, err := mmap.Mremap(lm.buf, int(size))
+	if err == mmap.ErrMremapNotSupported {
+		if err = mmap.Munmap(lm.buf); err != nil {
+			return err
+		}
+		buf, err = mmap.Mmap(lm.fd, true, size)
+	}
+	if err != nil {
+		return err
+	}
+	lm.buf, lm.bufLen = buf, size
+
+	// shrink the file after it is remapped, so the pages beyond the file are never accessed.
+	if size < oldLen {
+		return lm.fd.Truncate(size)
+	}
+	return nil
+}
+
 // Delete delete mapped buffer and remove file on disk.
 func (lm *MMapIOSelector) Delete() error {
 	if err := mmap.Munmap(lm.buf); err != nil {
@@ -17,13 +17,16 @@ const (
 
 	// TypeListMeta represents entry is list meta.
 	TypeListMeta
+
+	// TypeKeyDelete represents entry is the tombstone of a whole collection, it deletes all the members written before it.
+	TypeKeyDelete
 )
 
 // LogEntry is the data will be appended in log file.
 type LogEntry struct {
 	Key       []byte
 	Value     []byte
-	ExpiredAt int64 // time.Unix
+	ExpiredAt int64 // time.UnixMilli
 	Type      EntryType
 }
 
@@ -32,5 +35,5 @@ type entryHeader struct {
 	typ       EntryType
 	kSize     uint32
 	vSize     uint32
-	expiredAt int64 // time.Unix
+	expiredAt int64 // time.UnixMilli, or time.Unix in the log files of version 1.
 }
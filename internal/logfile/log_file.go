@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"os"
 	"sync/atomic"
 )
@@ -15,11 +16,15 @@ type LogFile struct {
 	Fid        uint32 // file id
 	WriteAt    int64  // offset
 	IoSelector ioselector.IOSelector
+	Header     SegmentHeader
 	FileLock   // 匿名结构体
 }
 
 type FileType int8
 
+// IOType represents different types of file io: FileIO(standard file io), MMap(memory map) and DirectIO(direct io).
+type IOType int8
+
 const (
 	FilePrefix       = "log."
 	InitialLogFileId = 0 // InitialLogFileId initial log file id: 0.
@@ -37,6 +42,18 @@ var (
 
 	// ErrWriteSizeNotEqual write size is not equal to entry size.
 	ErrWriteSizeNotEqual = errors.New("logfile: write size is not equal to entry size")
+
+	// ErrUnsupportedIoType unsupported io type, only mmap, fileIO and directIO are supported now.
+	ErrUnsupportedIoType = errors.New("unsupported io type")
+)
+
+const (
+	// FileIO standard file io.
+	FileIO IOType = iota
+	// MMap memory map.
+	MMap
+	// DirectIO direct io, which bypasses the page cache.
+	DirectIO
 )
 
 const (
@@ -65,20 +82,45 @@ var (
 )
 
 // GetLogFile open an existing or create a new log file.
-func GetLogFile(path string, fType FileType, fid uint32, fsize int64) (lf *LogFile, err error) {
+// The io selector of the file is created according to ioType.
+// The entries of a new log file are checked by checksum, 0 means DefaultChecksum,
+// an existing log file keeps the algorithm in its header.
+func GetLogFile(path string, fType FileType, fid uint32, fsize int64, ioType IOType, checksum ChecksumAlgorithm) (lf *LogFile, err error) {
 	if !util.PathExist(path) {
 		err = ErrInvalidDir
 		return
 	}
+	if checksum == 0 {
+		checksum = DefaultChecksum
+	}
+	if !checksum.Valid() {
+		err = ErrUnsupportedChecksum
+		return
+	}
 	lf = &LogFile{Fid: fid}
 	fileName := getFileName(path, fType, fid)
 
-	ioSelector, err := ioselector.NewFileIOSelector(fileName, fsize)
+	var ioSelector ioselector.IOSelector
+	switch ioType {
+	case FileIO:
+		ioSelector, err = ioselector.NewFileIOSelector(fileName, fsize)
+	case MMap:
+		ioSelector, err = ioselector.NewMMapSelector(fileName, fsize)
+	case DirectIO:
+		ioSelector, err = ioselector.NewDirectIOSelector(fileName, fsize)
+	default:
+		err = ErrUnsupportedIoType
+	}
 	if err != nil {
 		return
 	}
 	lf.IoSelector = ioSelector
 
+	if err = lf.initHeader(fType, checksum); err != nil {
+		_ = ioSelector.Close()
+		return nil, err
+	}
+
 	return
 }
 
@@ -86,8 +128,12 @@ func GetLogFile(path string, fType FileType, fid uint32, fsize int64) (lf *LogFi
 // It returns a LogEntry, entry size and an error, if any.
 // If offset is invalid, the err is io.EOF.
 func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
-	// read entry header
-	headerBuf, err := lf.readBytes(offset, MaxHeaderSize)
+	// read entry header, the header of the last entry of a full log file may be shorter than MaxHeaderSize.
+	headerBuf := make([]byte, MaxHeaderSize)
+	n, err := lf.IoSelector.Read(headerBuf, offset)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
 	if err != nil {
 		return nil, 0, err
 	}
@@ -101,6 +147,9 @@ func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
 		ExpiredAt: header.expiredAt,
 		Type:      header.typ,
 	}
+	if lf.Header.expireInSeconds() {
+		e.ExpiredAt *= 1000
+	}
 	kSize, vSize := int64(header.kSize), int64(header.vSize)
 	var entrySize = size + kSize + vSize
 
@@ -114,7 +163,7 @@ func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
 		e.Value = kvBuf[kSize:]
 	}
 	// crc32 check.
-	if crc := getEntryCrc(e, headerBuf[crc32.Size:size]); crc != header.crc32 {
+	if crc := getEntryCrc(e, headerBuf[crc32.Size:size], lf.Header.Checksum); crc != header.crc32 {
 		return nil, 0, ErrInvalidCrc
 	}
 	return e, entrySize, nil
@@ -142,17 +191,29 @@ func (lf *LogFile) readBytes(offset, n int64) (buf []byte, err error) {
 // |------------------------HEADER----------------------|
 //         |--------------------------crc check---------------------------|
 func EncodeEntry(entry *LogEntry) ([]byte, int) {
+	return EncodeEntryWith(entry, SegmentHeader{Version: SegmentVersion, Checksum: DefaultChecksum})
+}
+
+// EncodeEntryWith is like EncodeEntry, but the entry is encoded in the format of the log file with segment header sh,
+// which is the log file the entry is written to.
+func EncodeEntryWith(entry *LogEntry, sh SegmentHeader) ([]byte, int) {
 	if entry == nil {
 		return nil, 0
 	}
 	header := make([]byte, MaxHeaderSize)
 
+	expiredAt := entry.ExpiredAt
+	if sh.expireInSeconds() && expiredAt != 0 {
+		// round up, so the entry never expires earlier than expected.
+		expiredAt = (expiredAt + 999) / 1000
+	}
+
 	// encode header
 	header[4] = byte(entry.Type)
 	var index = 5
 	index += binary.PutVarint(header[index:], int64(len(entry.Key)))
 	index += binary.PutVarint(header[index:], int64(len(entry.Value)))
-	index += binary.PutVarint(header[index:], entry.ExpiredAt)
+	index += binary.PutVarint(header[index:], expiredAt)
 
 	var size = index + len(entry.Key) + len(entry.Value) // len of header + len of key + len of value
 	buf := make([]byte, size)
@@ -163,7 +224,7 @@ func EncodeEntry(entry *LogEntry) ([]byte, int) {
 	copy(buf[index+len(entry.Key):], entry.Value)
 
 	// crc32.
-	crc := crc32.ChecksumIEEE(buf[4:])
+	crc := crc32.Checksum(buf[4:], sh.Checksum.table())
 	binary.LittleEndian.PutUint32(buf[:4], crc)
 
 	return buf, size
@@ -192,13 +253,14 @@ func decodeHeader(buf []byte) (*entryHeader, int64) {
 	return h, int64(index + n)
 }
 
-func getEntryCrc(e *LogEntry, h []byte) uint32 {
+func getEntryCrc(e *LogEntry, h []byte, checksum ChecksumAlgorithm) uint32 {
 	if e == nil {
 		return 0
 	}
-	crc := crc32.ChecksumIEEE(h[:])
-	crc = crc32.Update(crc, crc32.IEEETable, e.Key)
-	crc = crc32.Update(crc, crc32.IEEETable, e.Value)
+	table := checksum.table()
+	crc := crc32.Checksum(h[:], table)
+	crc = crc32.Update(crc, table, e.Key)
+	crc = crc32.Update(crc, table, e.Value)
 	return crc
 }
 
@@ -0,0 +1,320 @@
+package logfile
+
+import (
+	"bitcaskDB/internal/ioselector"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SegmentMagic the magic number at the beginning of every log file.
+	SegmentMagic = "BLOG"
+
+	// SegmentVersion the current version of the log file format.
+	// The expiration time of entries is in unix seconds in version 1, and in unix milliseconds since version 2.
+	SegmentVersion uint16 = 2
+
+	// segmentVersionMilli the first version whose expiration time of entries is in unix milliseconds.
+	segmentVersionMilli uint16 = 2
+
+	// SegmentHeaderSize the size of the segment header, the first entry of a log file starts after it.
+	SegmentHeaderSize = 32
+
+	// migratePrefix is the prefix of the temporary files written by migration.
+	migratePrefix = ".migrate."
+)
+
+// ChecksumAlgorithm the checksum algorithm of the entries in a log file.
+type ChecksumAlgorithm uint8
+
+const (
+	// ChecksumIEEE crc32 with the IEEE polynomial, it is used by the log files written by old versions.
+	ChecksumIEEE ChecksumAlgorithm = iota + 1
+
+	// ChecksumCRC32C crc32 with the Castagnoli polynomial, which is computed by hardware instructions
+	// on amd64 and arm64, and detects more burst errors than IEEE.
+	ChecksumCRC32C
+)
+
+// DefaultChecksum the checksum algorithm of new log files.
+const DefaultChecksum = ChecksumCRC32C
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Valid returns whether the algorithm is supported.
+func (c ChecksumAlgorithm) Valid() bool {
+	return c == ChecksumIEEE || c == ChecksumCRC32C
+}
+
+// table returns the crc32 table of the algorithm, the zero value means a headerless log file, which uses IEEE.
+func (c ChecksumAlgorithm) table() *crc32.Table {
+	if c == ChecksumCRC32C {
+		return castagnoliTable
+	}
+	return crc32.IEEETable
+}
+
+var (
+	// ErrLegacySegment log file has no segment header, it is written by an old version.
+	ErrLegacySegment = errors.New("logfile: log file has no segment header, run the migrate command to upgrade it")
+
+	// ErrInvalidSegmentHeader segment header is corrupted or does not match the log file.
+	ErrInvalidSegmentHeader = errors.New("logfile: invalid segment header")
+
+	// ErrUnsupportedSegmentVersion log file is written by a newer version.
+	ErrUnsupportedSegmentVersion = errors.New("logfile: unsupported segment version")
+
+	// ErrUnsupportedChecksum checksum algorithm of the log file is unknown.
+	ErrUnsupportedChecksum = errors.New("logfile: unsupported checksum algorithm")
+)
+
+// SegmentHeader is the metadata at the beginning of a log file.
+// The encoded header looks like:
+// +---------+-----------+-----------+--------------+--------------+------------+---------+
+// |  magic  |  version  |  type     |  checksum    |  created at  |  reserved  |  crc    |
+// +---------+-----------+-----------+--------------+--------------+------------+---------+
+// 0         4           6           7              8              16           28        32
+type SegmentHeader struct {
+	Version   uint16
+	Type      FileType
+	Checksum  ChecksumAlgorithm // Checksum algorithm of the entries.
+	CreatedAt int64             // Creation time in unix nanoseconds.
+}
+
+func newSegmentHeader(fType FileType, checksum ChecksumAlgorithm) SegmentHeader {
+	return SegmentHeader{
+		Version:   SegmentVersion,
+		Type:      fType,
+		Checksum:  checksum,
+		CreatedAt: time.Now().UnixNano(),
+	}
+}
+
+// expireInSeconds returns whether the expiration time of the entries is in unix seconds.
+func (h SegmentHeader) expireInSeconds() bool {
+	return h.Version < segmentVersionMilli
+}
+
+func encodeSegmentHeader(h SegmentHeader) []byte {
+	buf := make([]byte, SegmentHeaderSize)
+	copy(buf[:4], SegmentMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], h.Version)
+	buf[6] = byte(h.Type)
+	buf[7] = byte(h.Checksum)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(h.CreatedAt))
+	binary.LittleEndian.PutUint32(buf[28:], crc32.ChecksumIEEE(buf[:28]))
+	return buf
+}
+
+func decodeSegmentHeader(buf []byte) (SegmentHeader, error) {
+	var h SegmentHeader
+	if len(buf) < SegmentHeaderSize {
+		return h, ErrInvalidSegmentHeader
+	}
+	if string(buf[:4]) != SegmentMagic {
+		return h, ErrLegacySegment
+	}
+	if crc32.ChecksumIEEE(buf[:28]) != binary.LittleEndian.Uint32(buf[28:SegmentHeaderSize]) {
+		return h, ErrInvalidSegmentHeader
+	}
+	h.Version = binary.LittleEndian.Uint16(buf[4:6])
+	if h.Version > SegmentVersion {
+		return h, ErrUnsupportedSegmentVersion
+	}
+	h.Type = FileType(buf[6])
+	h.Checksum = ChecksumAlgorithm(buf[7])
+	if !h.Checksum.Valid() {
+		return h, ErrUnsupportedChecksum
+	}
+	h.CreatedAt = int64(binary.LittleEndian.Uint64(buf[8:16]))
+	return h, nil
+}
+
+// initHeader writes the segment header with checksum if the log file is new, or reads and validates the existing one.
+func (lf *LogFile) initHeader(fType FileType, checksum ChecksumAlgorithm) error {
+	buf := make([]byte, SegmentHeaderSize)
+	if _, err := lf.IoSelector.Read(buf, 0); err != nil && err != io.EOF {
+		return err
+	}
+
+	// a new log file is filled with zeros.
+	if bytes.Equal(buf, make([]byte, SegmentHeaderSize)) {
+		lf.Header = newSegmentHeader(fType, checksum)
+		if _, err := lf.IoSelector.Write(encodeSegmentHeader(lf.Header), 0); err != nil {
+			return err
+		}
+		lf.WriteAt = SegmentHeaderSize
+		return nil
+	}
+
+	h, err := decodeSegmentHeader(buf)
+	if err != nil {
+		return err
+	}
+	if h.Type != fType {
+		return ErrInvalidSegmentHeader
+	}
+	lf.Header = h
+	lf.WriteAt = SegmentHeaderSize
+	return nil
+}
+
+// MigrateDir upgrades the headerless log files in the db directory path to the current format.
+// Each file is rewritten to a temporary file with the segment header followed by its entries, and renamed
+// over the old one when it is synced. It must not be called while the db is open.
+// It returns the number of the migrated files.
+func MigrateDir(path string) (int, error) {
+	if err := removeMigrateTemps(path); err != nil {
+		return 0, err
+	}
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var migrated int
+	for _, file := range fileInfos {
+		// the file name format is log.strs.[id]
+		if file.IsDir() || !strings.HasPrefix(file.Name(), FilePrefix) {
+			continue
+		}
+		splitNames := strings.Split(file.Name(), ".")
+		if len(splitNames) != 3 {
+			continue
+		}
+		fType, ok := FileTypesMap[splitNames[1]]
+		if !ok {
+			continue
+		}
+		fid, err := strconv.ParseUint(splitNames[2], 10, 32)
+		if err != nil {
+			return migrated, err
+		}
+		ok, err = migrateLogFile(path, fType, uint32(fid))
+		if err != nil {
+			return migrated, fmt.Errorf("migrate %s: %w", file.Name(), err)
+		}
+		if ok {
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		return migrated, syncDir(path)
+	}
+	return migrated, nil
+}
+
+// migrateLogFile rewrites the log file with the segment header, it returns false if the file has one already.
+func migrateLogFile(path string, fType FileType, fid uint32) (bool, error) {
+	fileName := getFileName(path, fType, fid)
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		return false, err
+	}
+	if stat.Size() == 0 {
+		return false, nil
+	}
+
+	ioSelector, err := ioselector.NewFileIOSelector(fileName, stat.Size())
+	if err != nil {
+		return false, err
+	}
+	old := &LogFile{Fid: fid, IoSelector: ioSelector}
+	defer old.Close()
+
+	buf := make([]byte, SegmentHeaderSize)
+	if _, err := old.IoSelector.Read(buf, 0); err != nil && err != io.EOF {
+		return false, err
+	}
+	if string(buf[:4]) == SegmentMagic {
+		return false, nil
+	}
+
+	// find the end of entries, the crc of every entry is checked on the way.
+	var end int64
+	for {
+		_, eSize, err := old.ReadLogEntry(end)
+		if err == ErrEndOfEntry || err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		end += eSize
+	}
+
+	// the entries are copied as they are, so the checksum algorithm is still IEEE,
+	// and the expiration time is still in seconds.
+	header := newSegmentHeader(fType, ChecksumIEEE)
+	header.Version = 1
+	header.CreatedAt = stat.ModTime().UnixNano()
+	tmpName := filepath.Join(path, migratePrefix+filepath.Base(fileName))
+	tmpSelector, err := ioselector.NewFileIOSelector(tmpName, stat.Size()+SegmentHeaderSize)
+	if err != nil {
+		return false, err
+	}
+	tmp := &LogFile{Fid: fid, IoSelector: tmpSelector, Header: header}
+	if err := tmp.copyFrom(old, end); err != nil {
+		_ = tmp.Delete()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmpName, fileName)
+}
+
+// copyFrom writes the header of lf and the first n bytes of old after it, then syncs lf.
+func (lf *LogFile) copyFrom(old *LogFile, n int64) error {
+	if _, err := lf.IoSelector.Write(encodeSegmentHeader(lf.Header), 0); err != nil {
+		return err
+	}
+	const chunkSize = 1 << 20
+	for offset := int64(0); offset < n; offset += chunkSize {
+		size := n - offset
+		if size > chunkSize {
+			size = chunkSize
+		}
+		chunk, err := old.readBytes(offset, size)
+		if err != nil {
+			return err
+		}
+		if _, err = lf.IoSelector.Write(chunk, SegmentHeaderSize+offset); err != nil {
+			return err
+		}
+	}
+	return lf.Sync()
+}
+
+// removeMigrateTemps removes the temporary files left by an interrupted migration.
+func removeMigrateTemps(path string) error {
+	temps, err := filepath.Glob(filepath.Join(path, migratePrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, name := range temps {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,92 @@
+package logfile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLegacyLogFile writes entries to a log file in the format of the old versions, which has no segment header,
+// checks the entries by IEEE, and keeps the expiration time in seconds. The file is preallocated with zeros.
+func writeLegacyLogFile(t *testing.T, path string, fType FileType, fid uint32, entries []*LogEntry) {
+	data := make([]byte, 0, 4096)
+	for _, e := range entries {
+		buf, _ := EncodeEntryWith(e, SegmentHeader{Version: 1, Checksum: ChecksumIEEE})
+		data = append(data, buf...)
+	}
+	if err := ioutil.WriteFile(getFileName(path, fType, fid), data[:cap(data)], 0644); err != nil {
+		t.Fatalf("write legacy log file err: %v", err)
+	}
+}
+
+// readLogEntries returns all the entries of lf.
+func readLogEntries(t *testing.T, lf *LogFile) []*LogEntry {
+	var entries []*LogEntry
+	offset := int64(SegmentHeaderSize)
+	for {
+		e, size, err := lf.ReadLogEntry(offset)
+		if err == ErrEndOfEntry {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("read log entry err: %v", err)
+		}
+		entries = append(entries, e)
+		offset += size
+	}
+}
+
+func TestMigrateDir(t *testing.T) {
+	path := t.TempDir()
+	files := map[FileType][]*LogEntry{
+		Strs: {
+			{Key: []byte("k1"), Value: []byte("v1")},
+			{Key: []byte("k2"), Value: []byte("v2"), ExpiredAt: 1700000000000},
+			{Key: []byte("k1"), Type: TypeDelete},
+		},
+		List: {
+			{Key: []byte("l"), Value: []byte("a"), ExpiredAt: 1800000000000},
+		},
+	}
+	for fType, entries := range files {
+		writeLegacyLogFile(t, path, fType, 1, entries)
+	}
+	// the files with header are not migrated again.
+	lf, err := GetLogFile(path, Hash, 0, 4096, FileIO, DefaultChecksum)
+	assert.Nil(t, err)
+	buf, _ := EncodeEntry(&LogEntry{Key: []byte("h"), Value: []byte("f")})
+	assert.Nil(t, lf.Write(buf))
+	assert.Nil(t, lf.Close())
+
+	migrated, err := MigrateDir(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, migrated)
+	temps, err := filepath.Glob(filepath.Join(path, migratePrefix+"*"))
+	assert.Nil(t, err)
+	assert.Empty(t, temps)
+
+	for fType, entries := range files {
+		lf, err := GetLogFile(path, fType, 1, 4096, FileIO, DefaultChecksum)
+		assert.Nil(t, err)
+		// the entries are kept as they are, the header tells how to read them.
+		assert.Equal(t, uint16(1), lf.Header.Version)
+		assert.Equal(t, ChecksumIEEE, lf.Header.Checksum)
+		assert.Equal(t, fType, lf.Header.Type)
+		got := readLogEntries(t, lf)
+		assert.Len(t, got, len(entries))
+		for i, e := range got {
+			assert.Equal(t, string(entries[i].Key), string(e.Key))
+			assert.Equal(t, string(entries[i].Value), string(e.Value))
+			assert.Equal(t, entries[i].Type, e.Type)
+			// the expiration time in seconds is read in milliseconds.
+			assert.Equal(t, entries[i].ExpiredAt, e.ExpiredAt)
+		}
+		assert.Nil(t, lf.Close())
+	}
+
+	migrated, err = MigrateDir(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, migrated)
+}
@@ -1,15 +1,24 @@
 package mmap
 
 import (
+	"errors"
 	"os"
 )
 
+// ErrMremapNotSupported mremap is not supported by the platform, the file must be unmapped and mapped again.
+var ErrMremapNotSupported = errors.New("mremap is not supported")
+
 // Mmap uses the mmap system call to memory-map a file. If writable is true,
 // memory protection of the pages is set so that they may be written to as well.
 func Mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
 	return mmap(fd, writable, size)
 }
 
+// Mremap remaps the mapped slice to size, the mapping may be moved so the old slice must not be used any more.
+func Mremap(b []byte, size int) ([]byte, error) {
+	return mremap(b, size)
+}
+
 // Munmap unmaps a previously mapped slice.
 func Munmap(b []byte) error {
 	return munmap(b)
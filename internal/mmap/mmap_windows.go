@@ -66,6 +66,10 @@ func mmap(fd *os.File, write bool, size int64) ([]byte, error) {
 	return data, nil
 }
 
+func mremap(data []byte, size int) ([]byte, error) {
+	return nil, ErrMremapNotSupported
+}
+
 func munmap(b []byte) error {
 	return syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&b[0])))
 }
@@ -1,6 +1,9 @@
 package options
 
-import "time"
+import (
+	"bitcaskDB/internal/logfile"
+	"time"
+)
 
 // DataIndexMode the data index mode.
 type DataIndexMode int
@@ -16,6 +19,26 @@ const (
 	KeyOnlyMemMode
 )
 
+// EvictionPolicy the policy to choose the keys to evict when the memory limit is reached.
+type EvictionPolicy int
+
+const (
+	// NoEviction no key is evicted, writes are rejected when the memory limit is reached.
+	NoEviction EvictionPolicy = iota
+
+	// AllKeysLRU evicts the least recently used keys.
+	AllKeysLRU
+
+	// AllKeysLFU evicts the least frequently used keys.
+	AllKeysLFU
+
+	// VolatileLRU evicts the least recently used keys among the keys with an expire set.
+	VolatileLRU
+
+	// VolatileTTL evicts the keys with the shortest time to live.
+	VolatileTTL
+)
+
 type Options struct {
 	// DBPath db path, will be created automatically if not exist.
 	DBPath string
@@ -28,13 +51,23 @@ type Options struct {
 	// Default value is KeyOnlyMemMode.
 	IndexMode DataIndexMode
 
-	// IoType file r/w io type, support FileIO and MMap now.
+	// IoType file r/w io type, support FileIO, MMap and DirectIO now.
+	// DirectIO bypasses the page cache, it is useful with KeyValueMemMode, where the values are already in memory.
+	// DirectIO buffers the writes in memory and writes them to the disk in whole blocks when the buffer is full,
+	// the log file is rotated, or the log file is synced. So unless Sync is true, the buffered writes are lost if
+	// the process crashes.
 	// Default value is FileIO.
-	// IoType IOType
+	IoType logfile.IOType
+
+	// Checksum the checksum algorithm of the entries of new log files, support ChecksumCRC32C and ChecksumIEEE now.
+	// The existing log files are always read with the algorithm in their segment header, so it can be changed anytime.
+	// Default value is ChecksumCRC32C.
+	Checksum logfile.ChecksumAlgorithm
 
 	// Sync is whether to sync writes from the OS buffer cache through to actual disk.
 	// If false, and the machine crashes, then some recent writes may be lost.
-	// Note that if it is just the process that crashes (and the machine does not) then no writes will be lost.
+	// Note that if it is just the process that crashes (and the machine does not) then no writes will be lost,
+	// except the writes buffered by DirectIO.
 	// Default value is false.
 	Sync bool
 
@@ -59,15 +92,71 @@ type Options struct {
 	// This option represents the size of that channel.
 	// If you got errors like `send discard chan fail`, you can increase this option to avoid it.
 	DiscardBufferSize int
+
+	// DiscardSendTimeout how long a write waits when the discard channel is full.
+	// The update is lost if it can not be sent before the timeout, lost updates are corrected by the rebuild,
+	// see DiscardRebuildInterval.
+	// Default value is 1 second.
+	DiscardSendTimeout time.Duration
+
+	// DiscardRebuildInterval a background goroutine will rebuild the discard records from the indexes periodically
+	// according to the interval, so the updates lost are taken into account by log file gc.
+	// The rebuild holds the index lock of every type in turn while it walks the whole index of the type,
+	// so it is only worth enabling if updates are lost, see BitcaskDB.LostDiscardUpdates.
+	// Default value is 0, which disables the rebuild.
+	DiscardRebuildInterval time.Duration
+
+	// HashFieldExpireInterval a background goroutine will delete the expired fields of hashes periodically according to
+	// the interval, and remove the hashes which become empty. Expired fields are never returned even if they are not deleted.
+	// Default value is 1 second, and the deletion is disabled if it is not positive.
+	HashFieldExpireInterval time.Duration
+
+	// MaxMemory the limit of the memory used by indexes in bytes, 0 means no limit.
+	// The memory is estimated from the keys and values held by indexes, values are only counted in KeyValueMemMode.
+	// Keys are evicted according to EvictionPolicy when the limit is reached, or writes are rejected if no key can be evicted.
+	// Every namespace has its own limit.
+	// Default value is 0.
+	MaxMemory int64
+
+	// EvictionPolicy the policy to choose the keys to evict when MaxMemory is reached.
+	// Default value is NoEviction.
+	EvictionPolicy EvictionPolicy
+
+	// MaxMemorySamples the number of keys sampled to choose a key to evict, more samples are more accurate but slower.
+	// Default value is 5.
+	MaxMemorySamples int
+
+	// MaxNamespaces the limit of the namespaces opened at the same time by a db, 0 means no limit.
+	// Every opened namespace is a db of its own, which holds open files and runs background goroutines,
+	// see BitcaskDB.Namespace.
+	// Default value is 0.
+	MaxNamespaces int
 }
 
 func DefaultOptions(path string) Options {
 	return Options{
-		DBPath:               path,
-		IndexMode:            KeyValueMemMode,
-		LogFileGCInterval:    time.Hour * 8,
-		LogFileGCRatio:       0.5,
-		LogFileSizeThreshold: 512 << 20, // 512*2e10 B = 512 KB
-		DiscardBufferSize:    8 << 20,
+		DBPath:                  path,
+		IndexMode:               KeyValueMemMode,
+		Checksum:                logfile.DefaultChecksum,
+		LogFileGCInterval:       time.Hour * 8,
+		LogFileGCRatio:          0.5,
+		LogFileSizeThreshold:    512 << 20, // 512*2e10 B = 512 KB
+		DiscardBufferSize:       8 << 20,
+		DiscardSendTimeout:      time.Second,
+		HashFieldExpireInterval: time.Second,
+		MaxMemorySamples:        5,
 	}
 }
+
+var evictionPolicyNames = map[EvictionPolicy]string{
+	NoEviction:  "noeviction",
+	AllKeysLRU:  "allkeys-lru",
+	AllKeysLFU:  "allkeys-lfu",
+	VolatileLRU: "volatile-lru",
+	VolatileTTL: "volatile-ttl",
+}
+
+// String returns the name of the policy, same as redis.
+func (p EvictionPolicy) String() string {
+	return evictionPolicyNames[p]
+}
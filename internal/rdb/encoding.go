@@ -0,0 +1,266 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+)
+
+// length encoding, the two most significant bits of the first byte.
+const (
+	len6Bit     = 0
+	len14Bit    = 1
+	len32or64   = 2
+	lenEncValue = 3
+	len32Bit    = 0x80
+	len64Bit    = 0x81
+)
+
+// special string encodings when the length type is lenEncValue.
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// The lengths in the rdb file can't be trusted, so the memory allocated before the data is actually read is limited,
+// otherwise a corrupted length may exhaust the memory.
+const (
+	maxPreallocItems = 1 << 10
+	maxPreallocBytes = 1 << 20
+)
+
+// prealloc returns the capacity to allocate for size items.
+func prealloc(size uint64, limit int) int {
+	if size > uint64(limit) {
+		return limit
+	}
+	return int(size)
+}
+
+// readLength reads a length encoded integer, special encoded strings are treated as invalid.
+func (p *Parser) readLength() (uint64, error) {
+	length, encoded, err := p.readLengthWithEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if encoded {
+		return 0, ErrInvalidRDB
+	}
+	return length, nil
+}
+
+// readLengthWithEncoding reads a length, if encoded is true, the length is the type of a special encoded string.
+func (p *Parser) readLengthWithEncoding() (length uint64, encoded bool, err error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, false, ErrInvalidRDB
+	}
+
+	switch b >> 6 {
+	case len6Bit:
+		return uint64(b & 0x3f), false, nil
+	case len14Bit:
+		next, err := p.r.ReadByte()
+		if err != nil {
+			return 0, false, ErrInvalidRDB
+		}
+		return uint64(b&0x3f)<<8 | uint64(next), false, nil
+	case lenEncValue:
+		return uint64(b & 0x3f), true, nil
+	}
+
+	// lengths which are 32 or 64 bit are stored in big endian.
+	switch b {
+	case len32Bit:
+		buf := make([]byte, 4)
+		if _, err = io.ReadFull(p.r, buf); err != nil {
+			return 0, false, ErrInvalidRDB
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case len64Bit:
+		buf := make([]byte, 8)
+		if _, err = io.ReadFull(p.r, buf); err != nil {
+			return 0, false, ErrInvalidRDB
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+	return 0, false, ErrInvalidRDB
+}
+
+// readString reads a string which may be stored as an integer or compressed by lzf.
+func (p *Parser) readString() ([]byte, error) {
+	length, encoded, err := p.readLengthWithEncoding()
+	if err != nil {
+		return nil, err
+	}
+
+	if !encoded {
+		return p.readBytes(length)
+	}
+
+	switch length {
+	case encInt8:
+		b, err := p.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int8(b[0])), 10)), nil
+	case encInt16:
+		b, err := p.readBytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(b))), 10)), nil
+	case encInt32:
+		b, err := p.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(b))), 10)), nil
+	case encLZF:
+		compressedLen, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := p.readBytes(compressedLen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, rawLen)
+	}
+	return nil, ErrInvalidRDB
+}
+
+func (p *Parser) readBytes(n uint64) ([]byte, error) {
+	if n <= maxPreallocBytes {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(p.r, buf); err != nil {
+			return nil, ErrInvalidRDB
+		}
+		return buf, nil
+	}
+
+	// the buffer grows as the bytes are read, so a corrupted length fails at the end of the file.
+	if n > math.MaxInt64 {
+		return nil, ErrInvalidRDB
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, p.r, int64(n)); err != nil {
+		return nil, ErrInvalidRDB
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *Parser) skipBytes(n uint64) error {
+	if n > math.MaxInt64 {
+		return ErrInvalidRDB
+	}
+	if _, err := io.CopyN(io.Discard, p.r, int64(n)); err != nil {
+		return ErrInvalidRDB
+	}
+	return nil
+}
+
+func (p *Parser) readUint32() (uint32, error) {
+	buf, err := p.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+func (p *Parser) readUint64() (uint64, error) {
+	buf, err := p.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// readDouble reads a double stored as a string, used by the old zset encoding.
+// The first byte is the length, and 253, 254, 255 mean nan, +inf and -inf.
+func (p *Parser) readDouble() (float64, error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, ErrInvalidRDB
+	}
+	switch b {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := p.readBytes(uint64(b))
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseFloat(string(buf), 64)
+	if err != nil {
+		return 0, ErrInvalidRDB
+	}
+	return val, nil
+}
+
+func (p *Parser) readBinaryDouble() (float64, error) {
+	bits, err := p.readUint64()
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// lzfDecompress decompresses the data compressed by liblzf, the output must be outLen bytes.
+func lzfDecompress(in []byte, outLen uint64) ([]byte, error) {
+	out := make([]byte, 0, prealloc(outLen, maxPreallocBytes))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// literal run of ctrl+1 bytes.
+		if ctrl < 1<<5 {
+			size := ctrl + 1
+			if i+size > len(in) || uint64(len(out)+size) > outLen {
+				return nil, ErrInvalidRDB
+			}
+			out = append(out, in[i:i+size]...)
+			i += size
+			continue
+		}
+
+		// back reference.
+		size := ctrl >> 5
+		if size == 7 {
+			if i >= len(in) {
+				return nil, ErrInvalidRDB
+			}
+			size += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrInvalidRDB
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 || uint64(len(out)+size+2) > outLen {
+			return nil, ErrInvalidRDB
+		}
+		// the reference may overlap the bytes being written, so copy byte by byte.
+		for j := 0; j < size+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if uint64(len(out)) != outLen {
+		return nil, ErrInvalidRDB
+	}
+	return out, nil
+}
@@ -0,0 +1,675 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// ObjectType the type of a key loaded from the rdb file.
+type ObjectType int8
+
+const (
+	String ObjectType = iota
+	List
+	Hash
+	Set
+	ZSet
+)
+
+// value types in the rdb file.
+const (
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeModule2         = 7
+	typeHashZipmap      = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeStream          = 15
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+	typeStream2         = 19
+	typeSetListpack     = 20
+	typeStream3         = 21
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// value types of hashes with field expire times, the pre GA types are saved by redis 7.4.
+const (
+	typeHashMetadataPreGA   = 22
+	typeHashListpackExPreGA = 23
+	typeHashMetadata        = 24
+	typeHashListpackEx      = 25
+)
+
+// opcodes of the values saved by modules.
+const (
+	moduleOpEOF    = 0
+	moduleOpSInt   = 1
+	moduleOpUInt   = 2
+	moduleOpFloat  = 3
+	moduleOpDouble = 4
+	moduleOpString = 5
+)
+
+// special opcodes in the rdb file.
+const (
+	opSlotInfo     = 244
+	opFunction2    = 245
+	opModuleAux    = 247
+	opIdle         = 248
+	opFreq         = 249
+	opAux          = 250
+	opResizeDB     = 251
+	opExpireTimeMs = 252
+	opExpireTime   = 253
+	opSelectDB     = 254
+	opEOF          = 255
+)
+
+const (
+	magic = "REDIS"
+	// the size of a stream id, which is two 64 bits integers.
+	streamIDSize = 16
+	// the newest rdb version we know how to parse.
+	maxVersion = 12
+)
+
+var (
+	// ErrInvalidRDB the file is not a rdb file or is corrupted.
+	ErrInvalidRDB = errors.New("invalid rdb file")
+
+	// ErrUnsupportedVersion the rdb version is newer than we can parse.
+	ErrUnsupportedVersion = errors.New("unsupported rdb version")
+)
+
+// ErrUnsupportedType the rdb file contains a value(stream, module...) that can't be loaded.
+// The value is skipped, so Next can be called again to read the keys after it.
+type ErrUnsupportedType struct {
+	Type byte
+	Key  []byte
+}
+
+func (e *ErrUnsupportedType) Error() string {
+	return fmt.Sprintf("unsupported rdb value type %d of key %q", e.Type, e.Key)
+}
+
+// Entry is a key and its whole value loaded from the rdb file.
+type Entry struct {
+	DB       int
+	Type     ObjectType
+	Key      []byte
+	ExpireAt int64 // unix milliseconds, 0 means the key never expires.
+
+	Value   []byte    // String
+	Members [][]byte  // List elements in order, or Set members
+	Fields  []Field   // Hash
+	ZSet    []ZMember // ZSet
+}
+
+// Field a field and value pair of a hash.
+type Field struct {
+	Field    []byte
+	Value    []byte
+	ExpireAt int64 // unix milliseconds, 0 means the field never expires.
+}
+
+// ZMember a member and score pair of a sorted set.
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// Parser reads entries from a rdb file one by one, so the whole file will never be held in memory.
+type Parser struct {
+	r       *bufio.Reader
+	version int
+	db      int
+	done    bool
+}
+
+// NewParser checks the header of the rdb file and returns a parser.
+func NewParser(r io.Reader) (*Parser, error) {
+	p := &Parser{r: bufio.NewReader(r)}
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		return nil, ErrInvalidRDB
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, ErrInvalidRDB
+	}
+	version, err := strconv.Atoi(string(header[len(magic):]))
+	if err != nil {
+		return nil, ErrInvalidRDB
+	}
+	if version < 1 || version > maxVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	p.version = version
+	return p, nil
+}
+
+// Version returns the rdb version in the header.
+func (p *Parser) Version() int {
+	return p.version
+}
+
+// Next returns the next key in the rdb file, io.EOF is returned when all keys are read.
+func (p *Parser) Next() (*Entry, error) {
+	if p.done {
+		return nil, io.EOF
+	}
+
+	var expireAt int64
+	for {
+		op, err := p.r.ReadByte()
+		if err != nil {
+			return nil, ErrInvalidRDB
+		}
+
+		switch op {
+		case opEOF:
+			// the 8 bytes crc64 checksum after EOF is not verified.
+			p.done = true
+			return nil, io.EOF
+		case opSelectDB:
+			db, err := p.readLength()
+			if err != nil {
+				return nil, err
+			}
+			p.db = int(db)
+		case opResizeDB:
+			if err = p.skipLengths(2); err != nil {
+				return nil, err
+			}
+		case opSlotInfo:
+			if err = p.skipLengths(3); err != nil {
+				return nil, err
+			}
+		case opAux:
+			if err = p.skipStrings(2); err != nil {
+				return nil, err
+			}
+		case opFunction2:
+			if err = p.skipStrings(1); err != nil {
+				return nil, err
+			}
+		case opModuleAux:
+			// the auxiliary data of a module isn't a key, just skip it.
+			if err = p.skipModuleAux(); err != nil {
+				return nil, err
+			}
+		case opIdle:
+			if _, err = p.readLength(); err != nil {
+				return nil, err
+			}
+		case opFreq:
+			if _, err = p.r.ReadByte(); err != nil {
+				return nil, ErrInvalidRDB
+			}
+		case opExpireTime:
+			sec, err := p.readUint32()
+			if err != nil {
+				return nil, err
+			}
+			expireAt = int64(sec) * 1000
+		case opExpireTimeMs:
+			ms, err := p.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			expireAt = int64(ms)
+		default:
+			key, err := p.readString()
+			if err != nil {
+				return nil, err
+			}
+			entry := &Entry{DB: p.db, Key: key, ExpireAt: expireAt}
+			if err = p.readObject(op, entry); err != nil {
+				return nil, err
+			}
+			return entry, nil
+		}
+	}
+}
+
+func (p *Parser) readObject(typ byte, entry *Entry) error {
+	var err error
+	switch typ {
+	case typeString:
+		entry.Type = String
+		entry.Value, err = p.readString()
+	case typeList, typeSet:
+		entry.Type = List
+		if typ == typeSet {
+			entry.Type = Set
+		}
+		entry.Members, err = p.readStrings()
+	case typeHash:
+		entry.Type = Hash
+		var values [][]byte
+		if values, err = p.readStringPairs(); err == nil {
+			entry.Fields = toFields(values)
+		}
+	case typeZSet, typeZSet2:
+		entry.Type = ZSet
+		entry.ZSet, err = p.readZSet(typ == typeZSet2)
+	case typeHashZipmap:
+		entry.Type = Hash
+		var values [][]byte
+		if values, err = p.readPacked(parseZipmap); err == nil {
+			entry.Fields = toFields(values)
+		}
+	case typeListZiplist:
+		entry.Type = List
+		entry.Members, err = p.readPacked(parseZiplist)
+	case typeSetIntset:
+		entry.Type = Set
+		entry.Members, err = p.readPacked(parseIntset)
+	case typeSetListpack:
+		entry.Type = Set
+		entry.Members, err = p.readPacked(parseListpack)
+	case typeHashZiplist, typeHashListpack:
+		entry.Type = Hash
+		parse := parseZiplist
+		if typ == typeHashListpack {
+			parse = parseListpack
+		}
+		var values [][]byte
+		if values, err = p.readPacked(parse); err == nil {
+			if len(values)%2 != 0 {
+				return ErrInvalidRDB
+			}
+			entry.Fields = toFields(values)
+		}
+	case typeZSetZiplist, typeZSetListpack:
+		entry.Type = ZSet
+		parse := parseZiplist
+		if typ == typeZSetListpack {
+			parse = parseListpack
+		}
+		var values [][]byte
+		if values, err = p.readPacked(parse); err == nil {
+			entry.ZSet, err = toZMembers(values)
+		}
+	case typeListQuicklist, typeListQuicklist2:
+		entry.Type = List
+		entry.Members, err = p.readQuicklist(typ == typeListQuicklist2)
+	case typeHashMetadataPreGA, typeHashMetadata:
+		entry.Type = Hash
+		entry.Fields, err = p.readHashMetadata(typ == typeHashMetadata)
+	case typeHashListpackExPreGA, typeHashListpackEx:
+		entry.Type = Hash
+		entry.Fields, err = p.readHashListpackEx(typ == typeHashListpackEx)
+	case typeModule2:
+		if err = p.skipModuleValue(); err != nil {
+			return err
+		}
+		return &ErrUnsupportedType{Type: typ, Key: entry.Key}
+	case typeStream, typeStream2, typeStream3:
+		if err = p.skipStream(typ); err != nil {
+			return err
+		}
+		return &ErrUnsupportedType{Type: typ, Key: entry.Key}
+	default:
+		// the size of an unknown value is unknown either, so the keys after it can't be read.
+		return fmt.Errorf("%w: unknown value type %d of key %q", ErrInvalidRDB, typ, entry.Key)
+	}
+	return err
+}
+
+func (p *Parser) readStrings() ([][]byte, error) {
+	size, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, prealloc(size, maxPreallocItems))
+	for i := uint64(0); i < size; i++ {
+		val, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+	return values, nil
+}
+
+func (p *Parser) readStringPairs() ([][]byte, error) {
+	size, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, prealloc(size, maxPreallocItems)*2)
+	for i := uint64(0); i < size; i++ {
+		field, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		val, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, field, val)
+	}
+	return values, nil
+}
+
+func (p *Parser) readZSet(binaryScore bool) ([]ZMember, error) {
+	size, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ZMember, 0, prealloc(size, maxPreallocItems))
+	for i := uint64(0); i < size; i++ {
+		member, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			score, err = p.readBinaryDouble()
+		} else {
+			score, err = p.readDouble()
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ZMember{Member: member, Score: score})
+	}
+	return members, nil
+}
+
+// readPacked reads a string and decodes it as a ziplist/listpack/intset/zipmap.
+func (p *Parser) readPacked(parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	buf, err := p.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse(buf)
+}
+
+func (p *Parser) readQuicklist(v2 bool) ([][]byte, error) {
+	size, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for i := uint64(0); i < size; i++ {
+		container := uint64(quicklistNodePacked)
+		if v2 {
+			if container, err = p.readLength(); err != nil {
+				return nil, err
+			}
+		}
+		buf, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case container == quicklistNodePlain:
+			values = append(values, buf)
+		case container != quicklistNodePacked:
+			return nil, ErrInvalidRDB
+		case v2:
+			vals, err := parseListpack(buf)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, vals...)
+		default:
+			vals, err := parseZiplist(buf)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, vals...)
+		}
+	}
+	return values, nil
+}
+
+// readHashMetadata reads a hash whose fields may expire, each field is saved as ttl, field and value.
+// The ttl is the unix milliseconds in the pre GA format, and the offset to the min expire time of the hash plus 1 since then,
+// 0 means the field never expires.
+func (p *Parser) readHashMetadata(withMinExpire bool) ([]Field, error) {
+	var minExpire uint64
+	var err error
+	if withMinExpire {
+		if minExpire, err = p.readUint64(); err != nil {
+			return nil, err
+		}
+	}
+	size, err := p.readLength()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]Field, 0, prealloc(size, maxPreallocItems))
+	for i := uint64(0); i < size; i++ {
+		ttl, err := p.readLength()
+		if err != nil {
+			return nil, err
+		}
+		field, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		val, err := p.readString()
+		if err != nil {
+			return nil, err
+		}
+		if ttl != 0 && withMinExpire {
+			ttl += minExpire - 1
+		}
+		if ttl > math.MaxInt64 {
+			return nil, ErrInvalidRDB
+		}
+		fields = append(fields, Field{Field: field, Value: val, ExpireAt: int64(ttl)})
+	}
+	return fields, nil
+}
+
+// readHashListpackEx reads a hash saved as a listpack of field, value and ttl triplets,
+// the ttl is the unix milliseconds and 0 means the field never expires.
+func (p *Parser) readHashListpackEx(withMinExpire bool) ([]Field, error) {
+	if withMinExpire {
+		if _, err := p.readUint64(); err != nil {
+			return nil, err
+		}
+	}
+	values, err := p.readPacked(parseListpack)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%3 != 0 {
+		return nil, ErrInvalidRDB
+	}
+	fields := make([]Field, 0, len(values)/3)
+	for i := 0; i < len(values); i += 3 {
+		ttl, err := strconv.ParseInt(string(values[i+2]), 10, 64)
+		if err != nil || ttl < 0 {
+			return nil, ErrInvalidRDB
+		}
+		fields = append(fields, Field{Field: values[i], Value: values[i+1], ExpireAt: ttl})
+	}
+	return fields, nil
+}
+
+// skipModuleValue skips the value of a module type, which is the module id and the opcodes of its values.
+func (p *Parser) skipModuleValue() error {
+	if _, err := p.readLength(); err != nil {
+		return err
+	}
+	return p.skipModuleOps()
+}
+
+// skipModuleAux skips the auxiliary data of a module, which is the module id, the when opcode, the when
+// and the opcodes of its values.
+func (p *Parser) skipModuleAux() error {
+	if err := p.skipLengths(3); err != nil {
+		return err
+	}
+	return p.skipModuleOps()
+}
+
+func (p *Parser) skipModuleOps() error {
+	for {
+		op, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case moduleOpEOF:
+			return nil
+		case moduleOpSInt, moduleOpUInt:
+			_, err = p.readLength()
+		case moduleOpFloat:
+			_, err = p.readUint32()
+		case moduleOpDouble:
+			_, err = p.readUint64()
+		case moduleOpString:
+			_, err = p.readString()
+		default:
+			return ErrInvalidRDB
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipStream skips a stream, the format is:
+// listpacks: count, then the master id and the listpack of each node.
+// metadata: length, last id, and since stream2: first id, max deleted id and entries added.
+// consumer groups: count, then name, last id, entries read(since stream2), pending entries and consumers of each group.
+func (p *Parser) skipStream(typ byte) error {
+	nodes, err := p.readLength()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		if err = p.skipStrings(2); err != nil {
+			return err
+		}
+	}
+
+	metadata := 3
+	if typ != typeStream {
+		metadata += 5
+	}
+	if err = p.skipLengths(metadata); err != nil {
+		return err
+	}
+
+	groups, err := p.readLength()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if err = p.skipStrings(1); err != nil {
+			return err
+		}
+		lengths := 2
+		if typ != typeStream {
+			lengths++
+		}
+		if err = p.skipLengths(lengths); err != nil {
+			return err
+		}
+
+		// the pending entries of a group: id, delivery time and delivery count.
+		pending, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < pending; j++ {
+			if err = p.skipBytes(streamIDSize + 8); err != nil {
+				return err
+			}
+			if _, err = p.readLength(); err != nil {
+				return err
+			}
+		}
+
+		// consumers: name, seen time, active time(since stream3) and the ids of its pending entries.
+		consumers, err := p.readLength()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			if err = p.skipStrings(1); err != nil {
+				return err
+			}
+			times := 8
+			if typ == typeStream3 {
+				times += 8
+			}
+			if err = p.skipBytes(uint64(times)); err != nil {
+				return err
+			}
+			ids, err := p.readLength()
+			if err != nil {
+				return err
+			}
+			for k := uint64(0); k < ids; k++ {
+				if err = p.skipBytes(streamIDSize); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Parser) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := p.readLength(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Parser) skipStrings(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := p.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toFields(values [][]byte) []Field {
+	fields := make([]Field, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields = append(fields, Field{Field: values[i], Value: values[i+1]})
+	}
+	return fields
+}
+
+func toZMembers(values [][]byte) ([]ZMember, error) {
+	if len(values)%2 != 0 {
+		return nil, ErrInvalidRDB
+	}
+	members := make([]ZMember, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(string(values[i+1]), 64)
+		if err != nil {
+			return nil, ErrInvalidRDB
+		}
+		members = append(members, ZMember{Member: values[i], Score: score})
+	}
+	return members, nil
+}
@@ -0,0 +1,220 @@
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:generate go run testdata/gen.go
+
+const (
+	farFuture = 4102444800000
+	longAgo   = 1000000000000
+)
+
+func parseFile(t *testing.T, name string) (map[string]*Entry, []*ErrUnsupportedType) {
+	f, err := os.Open(name)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	parser, err := NewParser(f)
+	assert.Nil(t, err)
+	entries := make(map[string]*Entry)
+	var unsupported []*ErrUnsupportedType
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			return entries, unsupported
+		}
+		var errType *ErrUnsupportedType
+		if errors.As(err, &errType) {
+			unsupported = append(unsupported, errType)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse %s err: %v", name, err)
+		}
+		entries[string(entry.Key)] = entry
+	}
+}
+
+func strs(values ...string) [][]byte {
+	res := make([][]byte, 0, len(values))
+	for _, val := range values {
+		res = append(res, []byte(val))
+	}
+	return res
+}
+
+func TestParser_Dump(t *testing.T) {
+	entries, unsupported := parseFile(t, "testdata/dump.rdb")
+	assert.Empty(t, unsupported)
+	assert.Len(t, entries, 23)
+
+	strings := map[string]string{
+		"s": "hello", "n": "123", "n16": "-1000", "n32": "100000",
+		"t": "ttl", "old": "gone", "lzf": "aaaaaaaaaa", "k1": "v",
+	}
+	for key, val := range strings {
+		assert.Equal(t, String, entries[key].Type, key)
+		assert.Equal(t, val, string(entries[key].Value), key)
+	}
+	assert.Equal(t, int64(farFuture), entries["t"].ExpireAt)
+	assert.Equal(t, int64(1000*1000), entries["old"].ExpireAt)
+	assert.Equal(t, int64(0), entries["s"].ExpireAt)
+	assert.Equal(t, 0, entries["s"].DB)
+	assert.Equal(t, 1, entries["k1"].DB)
+
+	lists := map[string][][]byte{
+		"l":  strs("a", "b", "5", "plain"),
+		"ql": strs("z1", "7", "300"),
+		"l0": strs("e1", "e2"),
+		"lz": strs("x", "-2"),
+	}
+	for key, members := range lists {
+		assert.Equal(t, List, entries[key].Type, key)
+		assert.Equal(t, members, entries[key].Members, key)
+	}
+
+	sets := map[string][][]byte{
+		"is": strs("1", "2", "-300"),
+		"ls": strs("x", "y"),
+		"s0": strs("only"),
+	}
+	for key, members := range sets {
+		assert.Equal(t, Set, entries[key].Type, key)
+		assert.Equal(t, members, entries[key].Members, key)
+	}
+
+	hashes := map[string][]Field{
+		"h":  {{Field: []byte("f1"), Value: []byte("v1")}, {Field: []byte("f2"), Value: []byte("12")}},
+		"hz": {{Field: []byte("a"), Value: []byte("b")}},
+		"h0": {{Field: []byte("k"), Value: []byte("v")}},
+		"zm": {{Field: []byte("k1"), Value: []byte("v1")}, {Field: []byte("k2"), Value: []byte("w")}},
+	}
+	for key, fields := range hashes {
+		assert.Equal(t, Hash, entries[key].Type, key)
+		assert.Equal(t, fields, entries[key].Fields, key)
+	}
+
+	zsets := map[string][]ZMember{
+		"z":  {{Member: []byte("m1"), Score: 1.5}, {Member: []byte("m2"), Score: 3}},
+		"zz": {{Member: []byte("q"), Score: -2}},
+		"z2": {{Member: []byte("m"), Score: 2.5}},
+		"z3": {{Member: []byte("a"), Score: 4.5}, {Member: []byte("b"), Score: math.Inf(1)}},
+	}
+	for key, members := range zsets {
+		assert.Equal(t, ZSet, entries[key].Type, key)
+		assert.Equal(t, members, entries[key].ZSet, key)
+	}
+}
+
+func TestParser_Unsupported(t *testing.T) {
+	entries, unsupported := parseFile(t, "testdata/unsupported.rdb")
+	assert.Len(t, entries, 4)
+	for key, val := range map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"} {
+		assert.Equal(t, val, string(entries[key].Value), key)
+	}
+
+	assert.Len(t, unsupported, 3)
+	var keys []string
+	var types []byte
+	for _, err := range unsupported {
+		keys = append(keys, string(err.Key))
+		types = append(types, err.Type)
+	}
+	assert.Equal(t, []string{"stream", "module", "stream3"}, keys)
+	assert.Equal(t, []byte{typeStream, typeModule2, typeStream3}, types)
+}
+
+func TestParser_HashTTL(t *testing.T) {
+	entries, unsupported := parseFile(t, "testdata/hash_ttl.rdb")
+	assert.Empty(t, unsupported)
+	assert.Len(t, entries, 5)
+
+	fields := []Field{
+		{Field: []byte("f1"), Value: []byte("v1")},
+		{Field: []byte("f2"), Value: []byte("v2"), ExpireAt: farFuture},
+		{Field: []byte("f3"), Value: []byte("v3"), ExpireAt: longAgo},
+	}
+	for _, key := range []string{"h22", "h23", "h24", "h25"} {
+		assert.Equal(t, Hash, entries[key].Type, key)
+		assert.Equal(t, fields, entries[key].Fields, key)
+	}
+
+	entry := entries["hkey"]
+	assert.Equal(t, int64(farFuture-1000), entry.ExpireAt)
+	assert.Equal(t, []Field{
+		{Field: []byte("f1"), Value: []byte("v1")},
+		{Field: []byte("f2"), Value: []byte("v2"), ExpireAt: farFuture - 2000},
+	}, entry.Fields)
+}
+
+func TestParser_Header(t *testing.T) {
+	_, err := NewParser(bytes.NewReader([]byte("REDIS")))
+	assert.Equal(t, ErrInvalidRDB, err)
+	_, err = NewParser(bytes.NewReader([]byte("RESID0011")))
+	assert.Equal(t, ErrInvalidRDB, err)
+	_, err = NewParser(bytes.NewReader([]byte("REDIS0013")))
+	assert.Equal(t, ErrUnsupportedVersion, err)
+}
+
+func TestParser_UnknownType(t *testing.T) {
+	// a value of the pre GA module type can't be skipped.
+	data := []byte("REDIS0011\x00\x01a\x011\x06\x01m\x00")
+	parser, err := NewParser(bytes.NewReader(data))
+	assert.Nil(t, err)
+	entry, err := parser.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(entry.Key))
+	_, err = parser.Next()
+	assert.True(t, errors.Is(err, ErrInvalidRDB))
+}
+
+func TestParser_CorruptedLength(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// a string of 1<<62 bytes.
+		{"string", []byte("REDIS0011\x00\x01s\x81\x40\x00\x00\x00\x00\x00\x00\x00abc")},
+		// a list of 1<<62 elements.
+		{"list", []byte("REDIS0011\x01\x01l\x81\x40\x00\x00\x00\x00\x00\x00\x00\x01a")},
+		// a hash of 1<<63 fields, the number of fields and values overflows.
+		{"hash", []byte("REDIS0011\x04\x01h\x81\x80\x00\x00\x00\x00\x00\x00\x00\x01a\x01b")},
+		// a zset of 1<<62 members.
+		{"zset", []byte("REDIS0011\x05\x01z\x81\x40\x00\x00\x00\x00\x00\x00\x00")},
+		// a lzf string decompressed to 4GB.
+		{"lzf", []byte("REDIS0011\x00\x01s\xc3\x03\x80\xff\xff\xff\xff\x01aa")},
+		// a lzf string longer than its length.
+		{"lzf overflow", []byte("REDIS0011\x00\x01s\xc3\x05\x02\x00\x61\xe0\x00\x00")},
+		// a hash with field ttls of 1<<62 fields.
+		{"hash ttl", []byte("REDIS0012\x16\x01h\x81\x40\x00\x00\x00\x00\x00\x00\x00\x00\x01f\x01v")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewParser(bytes.NewReader(tt.data))
+			assert.Nil(t, err)
+			_, err = parser.Next()
+			assert.Equal(t, ErrInvalidRDB, err)
+		})
+	}
+}
+
+func TestLzfDecompress(t *testing.T) {
+	out, err := lzfDecompress([]byte{0x00, 'a', 0xe0, 0x00, 0x00}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "aaaaaaaaaa", string(out))
+
+	_, err = lzfDecompress([]byte{0x00, 'a', 0xe0, 0x00, 0x00}, 11)
+	assert.Equal(t, ErrInvalidRDB, err)
+	// the back reference is before the output.
+	_, err = lzfDecompress([]byte{0x20, 0x05}, 3)
+	assert.Equal(t, ErrInvalidRDB, err)
+}
@@ -0,0 +1,260 @@
+// gen writes the rdb files used by the tests of package rdb, run it in the directory of package rdb:
+//
+//	go run testdata/gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+)
+
+const (
+	// 2100-01-01, the keys never expire in the tests.
+	farFuture = 4102444800000
+	// 2001-09-09, the keys have already expired.
+	longAgo = 1000000000000
+)
+
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) op(b ...byte) *writer {
+	w.Write(b)
+	return w
+}
+
+func (w *writer) length(n uint64) *writer {
+	switch {
+	case n < 1<<6:
+		w.WriteByte(byte(n))
+	case n < 1<<14:
+		w.Write([]byte{0x40 | byte(n>>8), byte(n)})
+	case n <= math.MaxUint32:
+		w.WriteByte(0x80)
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	default:
+		w.WriteByte(0x81)
+		_ = binary.Write(w, binary.BigEndian, n)
+	}
+	return w
+}
+
+func (w *writer) str(s string) *writer {
+	w.length(uint64(len(s)))
+	w.WriteString(s)
+	return w
+}
+
+func (w *writer) raw(b []byte) *writer {
+	w.length(uint64(len(b)))
+	w.Write(b)
+	return w
+}
+
+func (w *writer) le(v interface{}) *writer {
+	_ = binary.Write(w, binary.LittleEndian, v)
+	return w
+}
+
+func (w *writer) key(typ byte, key string) *writer {
+	return w.op(typ).str(key)
+}
+
+func (w *writer) end() []byte {
+	w.op(0xff).le(uint64(0))
+	return w.Bytes()
+}
+
+func header(version string) *writer {
+	w := new(writer)
+	w.WriteString("REDIS" + version)
+	w.op(0xfa).str("redis-ver").str("7.2.0")
+	return w
+}
+
+// listpack encodes strings and the integers in [-4096, 4096), which is enough for the tests.
+func listpack(values ...interface{}) []byte {
+	var body bytes.Buffer
+	for _, v := range values {
+		var enc []byte
+		switch v := v.(type) {
+		case int:
+			if v >= 0 && v < 128 {
+				enc = []byte{byte(v)}
+			} else {
+				u := uint16(v) & 0x1fff
+				enc = []byte{0xc0 | byte(u>>8), byte(u)}
+			}
+		case int64:
+			enc = make([]byte, 9)
+			enc[0] = 0xf4
+			binary.LittleEndian.PutUint64(enc[1:], uint64(v))
+		case string:
+			enc = append([]byte{0x80 | byte(len(v))}, v...)
+		}
+		body.Write(enc)
+		body.WriteByte(byte(len(enc)))
+	}
+	body.WriteByte(0xff)
+
+	w := new(writer)
+	w.le(uint32(6 + body.Len())).le(uint16(len(values)))
+	w.Write(body.Bytes())
+	return w.Bytes()
+}
+
+func ziplist(values ...interface{}) []byte {
+	var body bytes.Buffer
+	prev := 0
+	for _, v := range values {
+		entry := []byte{byte(prev)}
+		switch v := v.(type) {
+		case int:
+			if v >= 0 && v <= 12 {
+				entry = append(entry, 0xf1+byte(v))
+			} else {
+				entry = append(entry, 0xc0, byte(v), byte(v>>8))
+			}
+		case string:
+			entry = append(entry, byte(len(v)))
+			entry = append(entry, v...)
+		}
+		body.Write(entry)
+		prev = len(entry)
+	}
+	body.WriteByte(0xff)
+
+	w := new(writer)
+	w.le(uint32(10 + body.Len())).le(uint32(0)).le(uint16(len(values)))
+	w.Write(body.Bytes())
+	return w.Bytes()
+}
+
+func intset(values ...int16) []byte {
+	w := new(writer)
+	w.le(uint32(2)).le(uint32(len(values)))
+	for _, v := range values {
+		w.le(v)
+	}
+	return w.Bytes()
+}
+
+func zipmap() []byte {
+	return []byte{2, 2, 'k', '1', 2, 1, 'v', '1', 0, 2, 'k', '2', 1, 0, 'w', 0xff}
+}
+
+// dump has all the value types and encodings which can be loaded.
+func dump() []byte {
+	w := header("0011")
+	w.op(0xfe).length(0).op(0xfb).length(10).length(1)
+	w.key(0, "s").str("hello")
+	w.key(0, "n").op(0xc0, 123)
+	w.key(0, "n16").op(0xc1).le(int16(-1000))
+	w.key(0, "n32").op(0xc2).le(int32(100000))
+	w.op(0xfc).le(uint64(farFuture)).key(0, "t").str("ttl")
+	w.op(0xfd).le(uint32(1000)).key(0, "old").str("gone")
+	// "aaaaaaaaaa" compressed by lzf: a literal "a" and a back reference of 9 bytes.
+	w.key(0, "lzf").op(0xc3).length(5).length(10).op(0x00, 'a', 0xe0, 0x00, 0x00)
+	w.op(0xf8).length(5).op(0xf9, 3)
+	w.key(18, "l").length(2).length(2).raw(listpack("a", "b", 5)).length(1).str("plain")
+	w.key(14, "ql").length(1).raw(ziplist("z1", 7, 300))
+	w.key(1, "l0").length(2).str("e1").str("e2")
+	w.key(10, "lz").raw(ziplist("x", -2))
+	w.key(11, "is").raw(intset(1, 2, -300))
+	w.key(20, "ls").raw(listpack("x", "y"))
+	w.key(2, "s0").length(1).str("only")
+	w.key(16, "h").raw(listpack("f1", "v1", "f2", 12))
+	w.key(13, "hz").raw(ziplist("a", "b"))
+	w.key(4, "h0").length(1).str("k").str("v")
+	w.key(9, "zm").raw(zipmap())
+	w.key(17, "z").raw(listpack("m1", "1.5", "m2", 3))
+	w.key(12, "zz").raw(ziplist("q", "-2"))
+	w.key(5, "z2").length(1).str("m").le(2.5)
+	w.key(3, "z3").length(2).str("a").op(3).op([]byte("4.5")...).str("b").op(254)
+	w.op(0xfe).length(1).key(0, "k1").str("v")
+	return w.end()
+}
+
+// unsupported has streams, module values and module auxiliary data between the keys.
+func unsupported() []byte {
+	w := header("0011")
+	// module aux: module id, when opcode, when, then an uint, a string, a float and a double.
+	w.op(0xf7).length(1).length(2).length(2)
+	w.length(2).length(7).length(5).str("aux").length(3).le(float32(1)).length(4).le(1.5).length(0)
+	w.op(0xfe).length(0)
+	w.key(0, "a").str("1")
+
+	// stream: a node, length, last id, a group with a pending entry and a consumer.
+	w.key(15, "stream")
+	w.length(1).raw(make([]byte, 16)).raw(listpack(1, 0, "f", 0, 1))
+	w.length(1).length(1).length(0)
+	w.length(1).str("group").length(1).length(0)
+	w.length(1).op(make([]byte, 16)...).le(uint64(farFuture)).length(1)
+	w.length(1).str("consumer").le(uint64(farFuture)).length(1).op(make([]byte, 16)...)
+	w.key(0, "b").str("2")
+
+	// module value: module id, then a signed int and a string.
+	w.key(7, "module").length(0x1234).length(1).length(9).length(5).str("value").length(0)
+	w.key(0, "c").str("3")
+
+	// stream3: the metadata has first id, max deleted id and entries added,
+	// the groups have entries read, and the consumers have the active time.
+	w.key(21, "stream3")
+	w.length(0)
+	w.length(0).length(1).length(0).length(0).length(0).length(0).length(0).length(1)
+	w.length(2)
+	for _, group := range []string{"g1", "g2"} {
+		w.str(group).length(1).length(0).length(1)
+		w.length(0)
+		w.length(2)
+		w.str("c1").le(uint64(farFuture)).le(uint64(farFuture)).length(0)
+		w.str("c2").le(uint64(farFuture)).le(uint64(farFuture)).length(0)
+	}
+	w.key(0, "d").str("4")
+	return w.end()
+}
+
+// hashTTL has the hashes whose fields expire, in the formats of redis 7.4 and 8.
+func hashTTL() []byte {
+	w := header("0012")
+	w.op(0xfe).length(0)
+	// ttl, field, value, the ttl is the unix milliseconds.
+	w.key(22, "h22").length(3)
+	w.length(0).str("f1").str("v1")
+	w.length(farFuture).str("f2").str("v2")
+	w.length(longAgo).str("f3").str("v3")
+
+	// field, value, ttl in a listpack.
+	w.key(23, "h23").raw(listpack("f1", "v1", 0, "f2", "v2", int64(farFuture), "f3", "v3", int64(longAgo)))
+
+	// the min expire time, then the ttl is the offset to it plus 1.
+	w.key(24, "h24").le(uint64(longAgo)).length(3)
+	w.length(0).str("f1").str("v1")
+	w.length(farFuture - longAgo + 1).str("f2").str("v2")
+	w.length(1).str("f3").str("v3")
+
+	w.key(25, "h25").le(uint64(longAgo)).raw(listpack("f1", "v1", 0, "f2", "v2", int64(farFuture), "f3", "v3", int64(longAgo)))
+
+	// the expire time of the key applies to the fields without an earlier one.
+	w.op(0xfc).le(uint64(farFuture-1000)).key(22, "hkey").length(2)
+	w.length(0).str("f1").str("v1")
+	w.length(farFuture - 2000).str("f2").str("v2")
+	return w.end()
+}
+
+func main() {
+	files := map[string][]byte{
+		"testdata/dump.rdb":        dump(),
+		"testdata/unsupported.rdb": unsupported(),
+		"testdata/hash_ttl.rdb":    hashTTL(),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			log.Fatalf("write %s err: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+const (
+	ziplistHeaderSize  = 10
+	listpackHeaderSize = 6
+	intsetHeaderSize   = 8
+	packedEnd          = 0xff
+)
+
+// format of ziplist:
+// +---------+--------+-------+-------+-----+-------+-------+
+// | zlbytes | zltail | zllen | entry | ... | entry | zlend |
+// +---------+--------+-------+-------+-----+-------+-------+
+// 0---------4--------8------10
+// each entry is: prevlen(1 or 5 bytes) | encoding | data
+func parseZiplist(buf []byte) ([][]byte, error) {
+	if len(buf) < ziplistHeaderSize+1 {
+		return nil, ErrInvalidRDB
+	}
+	var values [][]byte
+	pos := ziplistHeaderSize
+	for {
+		if pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		if buf[pos] == packedEnd {
+			return values, nil
+		}
+
+		// skip prevlen.
+		if buf[pos] == 0xfe {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+
+		val, n, err := parseZiplistValue(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+		pos += n
+	}
+}
+
+// parseZiplistValue returns the value of a ziplist entry and the size of encoding and data.
+func parseZiplistValue(buf []byte) ([]byte, int, error) {
+	enc := buf[0]
+	switch enc >> 6 {
+	case 0:
+		return sliceAt(buf, 1, int(enc&0x3f))
+	case 1:
+		if len(buf) < 2 {
+			return nil, 0, ErrInvalidRDB
+		}
+		return sliceAt(buf, 2, int(enc&0x3f)<<8|int(buf[1]))
+	case 2:
+		if len(buf) < 5 {
+			return nil, 0, ErrInvalidRDB
+		}
+		return sliceAt(buf, 5, int(binary.BigEndian.Uint32(buf[1:5])))
+	}
+
+	var val int64
+	var size int
+	switch enc {
+	case 0xc0:
+		size = 2
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	case 0xf0:
+		size = 3
+	case 0xfe:
+		size = 1
+	default:
+		// 1111xxxx, the value is xxxx-1 which is between 0 and 12.
+		if enc >= 0xf1 && enc <= 0xfd {
+			return formatInt(int64(enc&0x0f) - 1), 1, nil
+		}
+		return nil, 0, ErrInvalidRDB
+	}
+	if len(buf) < 1+size {
+		return nil, 0, ErrInvalidRDB
+	}
+	val = readIntLE(buf[1 : 1+size])
+	return formatInt(val), 1 + size, nil
+}
+
+// format of listpack:
+// +-------------+--------------+-------+-----+-------+-----+
+// | total bytes | num elements | entry | ... | entry | end |
+// +-------------+--------------+-------+-----+-------+-----+
+// 0-------------4--------------6
+// each entry is: encoding | data | backlen(1~5 bytes)
+func parseListpack(buf []byte) ([][]byte, error) {
+	if len(buf) < listpackHeaderSize+1 {
+		return nil, ErrInvalidRDB
+	}
+	var values [][]byte
+	pos := listpackHeaderSize
+	for {
+		if pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		if buf[pos] == packedEnd {
+			return values, nil
+		}
+
+		val, n, err := parseListpackValue(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+		pos += n + listpackBacklenSize(n)
+	}
+}
+
+// parseListpackValue returns the value of a listpack entry and the size of encoding and data.
+func parseListpackValue(buf []byte) ([]byte, int, error) {
+	enc := buf[0]
+	switch {
+	case enc&0x80 == 0:
+		// 0xxxxxxx 7 bit unsigned int.
+		return formatInt(int64(enc & 0x7f)), 1, nil
+	case enc&0xc0 == 0x80:
+		// 10xxxxxx 6 bit string length.
+		return sliceAt(buf, 1, int(enc&0x3f))
+	case enc&0xe0 == 0xc0:
+		// 110xxxxx yyyyyyyy 13 bit signed int.
+		if len(buf) < 2 {
+			return nil, 0, ErrInvalidRDB
+		}
+		val := int64(enc&0x1f)<<8 | int64(buf[1])
+		if val >= 1<<12 {
+			val -= 1 << 13
+		}
+		return formatInt(val), 2, nil
+	case enc&0xf0 == 0xe0:
+		// 1110xxxx yyyyyyyy 12 bit string length.
+		if len(buf) < 2 {
+			return nil, 0, ErrInvalidRDB
+		}
+		return sliceAt(buf, 2, int(enc&0x0f)<<8|int(buf[1]))
+	}
+
+	var size int
+	switch enc {
+	case 0xf0:
+		// 32 bit string length.
+		if len(buf) < 5 {
+			return nil, 0, ErrInvalidRDB
+		}
+		return sliceAt(buf, 5, int(binary.LittleEndian.Uint32(buf[1:5])))
+	case 0xf1:
+		size = 2
+	case 0xf2:
+		size = 3
+	case 0xf3:
+		size = 4
+	case 0xf4:
+		size = 8
+	default:
+		return nil, 0, ErrInvalidRDB
+	}
+	if len(buf) < 1+size {
+		return nil, 0, ErrInvalidRDB
+	}
+	return formatInt(readIntLE(buf[1 : 1+size])), 1 + size, nil
+}
+
+// listpackBacklenSize returns how many bytes are used to store the backlen of an entry.
+func listpackBacklenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// format of intset:
+// +----------+--------+----------+-----+----------+
+// | encoding | length | integer  | ... | integer  |
+// +----------+--------+----------+-----+----------+
+// 0----------4--------8
+// encoding is the size of each integer: 2, 4 or 8.
+func parseIntset(buf []byte) ([][]byte, error) {
+	if len(buf) < intsetHeaderSize {
+		return nil, ErrInvalidRDB
+	}
+	size := int(binary.LittleEndian.Uint32(buf[:4]))
+	length := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, ErrInvalidRDB
+	}
+	if len(buf) < intsetHeaderSize+size*length {
+		return nil, ErrInvalidRDB
+	}
+
+	values := make([][]byte, 0, length)
+	for i := 0; i < length; i++ {
+		offset := intsetHeaderSize + i*size
+		values = append(values, formatInt(readIntLE(buf[offset:offset+size])))
+	}
+	return values, nil
+}
+
+// format of zipmap:
+// +-------+-----+-----+-----+-------+-------+-----+-----+
+// | zmlen | len | key | len | free  | value | ... | end |
+// +-------+-----+-----+-----+-------+-------+-----+-----+
+// len is 1 byte, or 254 followed by 4 bytes, free is the unused bytes after the value.
+func parseZipmap(buf []byte) ([][]byte, error) {
+	if len(buf) < 2 {
+		return nil, ErrInvalidRDB
+	}
+	var values [][]byte
+	pos := 1
+	readLen := func() (int, bool) {
+		if pos >= len(buf) || buf[pos] == packedEnd {
+			return 0, false
+		}
+		if buf[pos] < 254 {
+			pos++
+			return int(buf[pos-1]), true
+		}
+		if buf[pos] == 254 && pos+5 <= len(buf) {
+			pos += 5
+			return int(binary.LittleEndian.Uint32(buf[pos-4 : pos])), true
+		}
+		return 0, false
+	}
+
+	for {
+		if pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		if buf[pos] == packedEnd {
+			return values, nil
+		}
+
+		keyLen, ok := readLen()
+		if !ok || pos+keyLen > len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		key := buf[pos : pos+keyLen]
+		pos += keyLen
+
+		valLen, ok := readLen()
+		if !ok || pos >= len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		free := int(buf[pos])
+		pos++
+		if pos+valLen+free > len(buf) {
+			return nil, ErrInvalidRDB
+		}
+		values = append(values, key, buf[pos:pos+valLen])
+		pos += valLen + free
+	}
+}
+
+// sliceAt returns a copy of buf[offset:offset+size] and the total size offset+size.
+func sliceAt(buf []byte, offset, size int) ([]byte, int, error) {
+	if size < 0 || offset+size > len(buf) {
+		return nil, 0, ErrInvalidRDB
+	}
+	val := make([]byte, size)
+	copy(val, buf[offset:offset+size])
+	return val, offset + size, nil
+}
+
+// readIntLE reads a signed little endian integer of 1, 2, 3, 4 or 8 bytes.
+func readIntLE(buf []byte) int64 {
+	var val uint64
+	for i := len(buf) - 1; i >= 0; i-- {
+		val = val<<8 | uint64(buf[i])
+	}
+	// sign extension.
+	shift := uint(64 - 8*len(buf))
+	return int64(val<<shift) >> shift
+}
+
+func formatInt(val int64) []byte {
+	return []byte(strconv.FormatInt(val, 10))
+}
@@ -5,6 +5,7 @@ import (
 	"bitcaskDB/internal/log"
 	"bitcaskDB/internal/util"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
 )
@@ -23,41 +24,30 @@ type ClientHandle struct {
 	conn io.ReadWriteCloser
 	db   *bitcask.BitcaskDB
 	dbs  []*bitcask.BitcaskDB
+
+	// ctx is canceled once the connection is closed, so a blocking command stops waiting for the client.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewClientHandle(conn io.ReadWriteCloser, db *bitcask.BitcaskDB, dbs []*bitcask.BitcaskDB) *ClientHandle {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ClientHandle{
-		conn: conn,
-		dbs:  dbs,
-		db:   db,
+		conn:   conn,
+		dbs:    dbs,
+		db:     db,
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
 func (cli *ClientHandle) Handle() {
 	defer cli.close()
 
-	for {
-		buffer := make([]byte, CmdBufferSize)
-		n, err := cli.conn.Read(buffer) // block read....
-		if err != nil {
-			log.Errorf("conn read err : %v", err)
-			return
-		}
-
-		length, offset := binary.Uvarint(buffer)
-		if int(length) <= CmdBufferSize-offset { // buffer is large enough to receive the msg
-			buffer = buffer[offset:n]
-		} else {
-			tmp := buffer[offset:]
-			buffer = make([]byte, int(length)) // make a new buffer, which is large enough to receive the msg
-			copy(buffer, tmp)
-			_, err := cli.conn.Read(buffer[n-offset:]) // 这里是否该改成非阻塞读？
-			if err != nil {
-				log.Errorf("conn read err : %v", err)
-				return
-			}
-		}
-
+	// the commands are read in another goroutine, so a disconnect is noticed while a command is blocked.
+	cmds := make(chan []byte)
+	go cli.readCommands(cmds)
+	for buffer := range cmds {
 		log.Infof("receive cmd : [%s]", buffer)
 
 		// The command format is [cmd] [key/value]...
@@ -88,8 +78,45 @@ func (cli *ClientHandle) Handle() {
 	}
 }
 
+// readCommands reads the commands of the client into cmds until the connection is closed,
+// then it cancels the context of the client.
+func (cli *ClientHandle) readCommands(cmds chan<- []byte) {
+	defer close(cmds)
+	defer cli.cancel()
+
+	for {
+		buffer := make([]byte, CmdBufferSize)
+		n, err := cli.conn.Read(buffer) // block read....
+		if err != nil {
+			log.Errorf("conn read err : %v", err)
+			return
+		}
+
+		length, offset := binary.Uvarint(buffer)
+		if int(length) <= CmdBufferSize-offset { // buffer is large enough to receive the msg
+			buffer = buffer[offset:n]
+		} else {
+			tmp := buffer[offset:]
+			buffer = make([]byte, int(length)) // make a new buffer, which is large enough to receive the msg
+			copy(buffer, tmp)
+			_, err := cli.conn.Read(buffer[n-offset:]) // 这里是否该改成非阻塞读？
+			if err != nil {
+				log.Errorf("conn read err : %v", err)
+				return
+			}
+		}
+
+		select {
+		case cmds <- buffer:
+		case <-cli.ctx.Done():
+			return
+		}
+	}
+}
+
 func (cli *ClientHandle) close() {
 	log.Info("close client....")
+	cli.cancel()
 	// cli.db.Close() 好像不用关 其他用户也要用
 	if err := cli.conn.Close(); err != nil {
 		log.Errorf("close conn err : %v", err)
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/options"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sendCommand writes cmd to conn in the format read by ClientHandle.
+func sendCommand(t *testing.T, conn net.Conn, cmd string) {
+	msg := make([]byte, binary.MaxVarintLen64+len(cmd))
+	n := binary.PutUvarint(msg, uint64(len(cmd)))
+	n += copy(msg[n:], cmd)
+	if _, err := conn.Write(msg[:n]); err != nil {
+		t.Fatalf("write command err: %v", err)
+	}
+}
+
+func TestClientHandle_BlockedClientDisconnect(t *testing.T) {
+	db, err := bitcask.Open(options.DefaultOptions(t.TempDir()))
+	if err != nil {
+		t.Fatalf("open db err: %v", err)
+	}
+	defer db.Close()
+
+	serverConn, clientConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		NewClientHandle(serverConn, db, []*bitcask.BitcaskDB{db}).Handle()
+		close(done)
+	}()
+
+	sendCommand(t, clientConn, "blpop queue 0")
+	// let the command block before the client goes away.
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, clientConn.Close())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked command is not woken up by the disconnect")
+	}
+
+	// the element is not handed over to the disconnected client.
+	assert.Nil(t, db.RPush([]byte("queue"), []byte("job")))
+	n, err := db.LLen([]byte("queue"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
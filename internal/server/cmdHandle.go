@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -21,79 +22,138 @@ var (
 	errValueIsInvalid    = errors.New("ERR value is not an integer or out of range")
 	errFloatIsInvalid    = errors.New("ERR value is not a valid float")
 	errDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	errNoSuchKey         = errors.New("ERR no such key")
+	errInvalidExpireTime = errors.New("ERR invalid expire time")
+	errLCSLenAndIdx      = errors.New("ERR If you want both the length and indexes, please just use IDX.")
 )
 
 type cmdHandler func(cli *ClientHandle, args [][]byte) (interface{}, error)
 
 var supportedCommands = map[string]cmdHandler{
 	// string commands
-	"set":      set,
-	"get":      get,
-	"mget":     mGet,
-	"getrange": getRange,
-	"getdel":   getDel,
-	"setex":    setEX,
-	"setnx":    setNX,
-	"mset":     mSet,
-	"msetnx":   mSetNX,
-	"append":   appendStr,
-	"decr":     decr,
-	"decrby":   decrBy,
-	"incr":     incr,
-	"incrby":   incrBy,
-	"strlen":   strLen,
+	"set":         set,
+	"get":         get,
+	"mget":        mGet,
+	"getrange":    getRange,
+	"getdel":      getDel,
+	"setex":       setEX,
+	"setnx":       setNX,
+	"mset":        mSet,
+	"msetnx":      mSetNX,
+	"append":      appendStr,
+	"decr":        decr,
+	"decrby":      decrBy,
+	"incr":        incr,
+	"incrby":      incrBy,
+	"strlen":      strLen,
+	"getex":       getEx,
+	"getset":      getSet,
+	"setrange":    setRange,
+	"incrbyfloat": incrByFloat,
+	"lcs":         lcs,
 
 	// list
-	"lpush":  lPush,
-	"lpushx": lPushX,
-	"rpush":  rPush,
-	"rpushx": rPushX,
-	"lpop":   lPop,
-	"rpop":   rPop,
-	"lmove":  lMove,
-	"llen":   lLen,
-	"lindex": lIndex,
-	"lset":   lSet,
-	"lrange": lRange,
+	"lpush":   lPush,
+	"lpushx":  lPushX,
+	"rpush":   rPush,
+	"rpushx":  rPushX,
+	"lpop":    lPop,
+	"rpop":    rPop,
+	"lmove":   lMove,
+	"blpop":   blPop,
+	"brpop":   brPop,
+	"blmove":  blMove,
+	"llen":    lLen,
+	"lindex":  lIndex,
+	"lset":    lSet,
+	"lrange":  lRange,
+	"lrem":    lRem,
+	"linsert": lInsert,
+	"ltrim":   lTrim,
+	"lpos":    lPos,
 
 	// hash commands
-	"hset":    hSet,
-	"hsetnx":  hSetNX,
-	"hget":    hGet,
-	"hmget":   hmGet,
-	"hdel":    hDel,
-	"hexists": hExists,
-	"hlen":    hLen,
-	"hfields": hFields,
-	"hvals":   hVals,
-	"hgetall": hGetAll,
-	"hstrlen": hStrLen,
-	"hscan":   hScan,
-	"hincrby": hIncrBy,
+	"hset":         hSet,
+	"hsetnx":       hSetNX,
+	"hget":         hGet,
+	"hmget":        hmGet,
+	"hdel":         hDel,
+	"hexists":      hExists,
+	"hlen":         hLen,
+	"hfields":      hFields,
+	"hvals":        hVals,
+	"hgetall":      hGetAll,
+	"hstrlen":      hStrLen,
+	"hscan":        hScan,
+	"hincrby":      hIncrBy,
+	"hincrbyfloat": hIncrByFloat,
+	"hrandfield":   hRandField,
+	"hgetdel":      hGetDel,
+	"hsetex":       hSetEx,
+	"hexpire":      hExpire,
+	"hexpireat":    hExpireAt,
+	"hexpiretime":  hExpireTime,
+	"httl":         hTTL,
+	"hpersist":     hPersist,
 
 	// set commands
-	"sadd":      sAdd,
-	"spop":      sPop,
-	"srem":      sRem,
-	"sismember": sIsMember,
-	"smembers":  sMembers,
-	"scard":     sCard,
-	"sdiff":     sDiff,
-	"sunion":    sUnion,
+	"sadd":        sAdd,
+	"spop":        sPop,
+	"srem":        sRem,
+	"sismember":   sIsMember,
+	"smembers":    sMembers,
+	"scard":       sCard,
+	"sdiff":       sDiff,
+	"sunion":      sUnion,
+	"sinter":      sInter,
+	"sintercard":  sInterCard,
+	"sdiffstore":  sDiffStore,
+	"sunionstore": sUnionStore,
+	"sinterstore": sInterStore,
+	"smove":       sMove,
+	"srandmember": sRandMember,
+	"smismember":  sMIsMember,
+	"sscan":       sScan,
 
 	// zset commands
-	"zadd":      zAdd,
-	"zscore":    zScore,
-	"zrem":      zRem,
-	"zcard":     zCard,
-	"zrange":    zRange,
-	"zrevrange": zRevRange,
-	"zrank":     zRank,
-	"zrevrank":  zRevRank,
+	"zadd":             zAdd,
+	"zscore":           zScore,
+	"zrem":             zRem,
+	"zcard":            zCard,
+	"zrange":           zRange,
+	"zrevrange":        zRevRange,
+	"zrank":            zRank,
+	"zrevrank":         zRevRank,
+	"zrangebyscore":    zRangeByScore,
+	"zrevrangebyscore": zRevRangeByScore,
+	"zcount":           zCount,
+	"zincrby":          zIncrBy,
+	"zrangebylex":      zRangeByLex,
+	"zlexcount":        zLexCount,
+	"zremrangebyrank":  zRemRangeByRank,
+	"zremrangebyscore": zRemRangeByScore,
+	"zpopmin":          zPopMin,
+	"zpopmax":          zPopMax,
+	"bzpopmin":         bzPopMin,
+	"bzpopmax":         bzPopMax,
+	"zunion":           zUnion,
+	"zinter":           zInter,
+	"zdiff":            zDiff,
+	"zunionstore":      zUnionStore,
+	"zinterstore":      zInterStore,
+	"zdiffstore":       zDiffStore,
+	"zscan":            zScan,
 
 	// generic commands
-	"type": keyType,
-	"del":  del,
+	"type":     keyType,
+	"del":      del,
+	"unlink":   unlink,
+	"exists":   exists,
+	"scan":     scan,
+	"rename":   rename,
+	"renamenx": renameNX,
+	"copy":     copyKey,
+	"move":     move,
 
 	// connection management commands
 	"select": selectDB,
@@ -101,7 +161,10 @@ var supportedCommands = map[string]cmdHandler{
 	"quit":   nil,
 
 	// server management commands
-	"info": info,
+	"info":     info,
+	"flushdb":  flushDB,
+	"flushall": flushAll,
+	"dbsize":   dbSize,
 }
 
 func newWrongNumOfArgsError(cmd string) error {
@@ -111,29 +174,94 @@ func newWrongNumOfArgsError(cmd string) error {
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |-------------------------- String commands --------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
+// set is called as SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|
+// PXAT unix-time-milliseconds|KEEPTTL].
 func set(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) < 2 {
 		return nil, newWrongNumOfArgsError("SET")
 	}
+	opts, err := parseSetArgs(args[2:])
+	if err != nil {
+		return nil, err
+	}
+	oldVal, ok, err := cli.db.SetArgs(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Get {
+		return oldVal, nil
+	}
+	if !ok {
+		return nil, nil
+	}
+	return resultOK, nil
+}
 
-	var setErr error
-	key, value := args[0], args[1]
-	if len(args) > 2 {
-		if len(args) != 4 || strings.ToLower(string(args[2])) != "ex" {
-			return nil, errSyntax
-		}
-		second, err := strconv.Atoi(string(args[3]))
-		if err != nil {
-			return nil, errSyntax
+// parseSetArgs parses the options of SET.
+func parseSetArgs(opts [][]byte) (bitcask.SetOptions, error) {
+	var setOpts bitcask.SetOptions
+	var hasExpire bool
+	for i := 0; i < len(opts); i++ {
+		switch opt := strings.ToLower(string(opts[i])); opt {
+		case "nx", "xx":
+			if setOpts.Condition != bitcask.SetAlways {
+				return setOpts, errSyntax
+			}
+			setOpts.Condition = bitcask.SetIfNotExist
+			if opt == "xx" {
+				setOpts.Condition = bitcask.SetIfExist
+			}
+		case "get":
+			setOpts.Get = true
+		case "keepttl":
+			if hasExpire {
+				return setOpts, errSyntax
+			}
+			setOpts.KeepTTL, hasExpire = true, true
+		case "ex", "px", "exat", "pxat":
+			if hasExpire || i+1 >= len(opts) {
+				return setOpts, errSyntax
+			}
+			i++
+			expiredAt, err := parseExpireTime(opt, opts[i])
+			if err != nil {
+				return setOpts, err
+			}
+			setOpts.ExpiredAt, hasExpire = expiredAt, true
+		default:
+			return setOpts, errSyntax
 		}
-		setErr = cli.db.SetEX(key, value, time.Second*time.Duration(second))
-	} else {
-		setErr = cli.db.Set(key, value)
 	}
-	if setErr != nil {
-		return nil, setErr
+	return setOpts, nil
+}
+
+// parseExpireTime converts the value of the expire option EX, PX, EXAT or PXAT to the expiration time.
+func parseExpireTime(opt string, val []byte) (time.Time, error) {
+	n, err := strconv.ParseInt(string(val), 10, 64)
+	if err != nil {
+		return time.Time{}, errValueIsInvalid
+	}
+	if n <= 0 {
+		return time.Time{}, errInvalidExpireTime
+	}
+	// the relative time must fit in a time.Duration, otherwise it wraps around to a time in the past.
+	unit := time.Millisecond
+	if opt == "ex" || opt == "exat" {
+		unit = time.Second
+	}
+	if opt != "pxat" && n > math.MaxInt64/int64(unit) {
+		return time.Time{}, errInvalidExpireTime
+	}
+	switch opt {
+	case "ex":
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	case "px":
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "exat":
+		return time.Unix(n, 0), nil
+	default:
+		return time.UnixMilli(n), nil
 	}
-	return resultOK, nil
 }
 
 func get(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -194,6 +322,51 @@ func setNX(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	return resultOK, nil
 }
 
+// getEx is called as GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST].
+func getEx(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("getex")
+	}
+	var expiredAt time.Time
+	var persist bool
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && strings.ToLower(string(args[1])) == "persist":
+		persist = true
+	case len(args) == 3:
+		opt := strings.ToLower(string(args[1]))
+		if opt != "ex" && opt != "px" && opt != "exat" && opt != "pxat" {
+			return nil, errSyntax
+		}
+		var err error
+		if expiredAt, err = parseExpireTime(opt, args[2]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errSyntax
+	}
+	return cli.db.GetEx(args[0], expiredAt, persist)
+}
+
+func getSet(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("getset")
+	}
+	return cli.db.GetSet(args[0], args[1])
+}
+
+// setRange is called as SETRANGE key offset value.
+func setRange(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("setrange")
+	}
+	offset, err := strconv.Atoi(string(args[1]))
+	if err != nil || offset < 0 {
+		return nil, errValueIsInvalid
+	}
+	return cli.db.SetRange(args[0], offset, args[2])
+}
+
 func mSet(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) == 0 || len(args)%2 != 0 {
 		return nil, newWrongNumOfArgsError("mset")
@@ -264,11 +437,86 @@ func incrBy(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	return cli.db.IncrBy(key, decrInt64)
 }
 
+func incrByFloat(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("incrbyfloat")
+	}
+	incr, err := util.StrToFloat64(string(args[1]))
+	if err != nil || math.IsNaN(incr) {
+		return nil, errFloatIsInvalid
+	}
+	res, err := cli.db.IncrByFloat(args[0], incr)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(util.Float64ToStr(res)), nil
+}
+
+// lcs is called as LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN].
+// With IDX, the reply is "matches", the ranges of every match in key1 and key2 followed by its length
+// if WITHMATCHLEN is given, then "len" and the length of the LCS.
+func lcs(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("lcs")
+	}
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "len":
+			getLen = true
+		case "idx":
+			getIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			i++
+			n, err := strconv.Atoi(string(args[i]))
+			if err != nil {
+				return nil, errValueIsInvalid
+			}
+			minMatchLen = n
+		default:
+			return nil, errSyntax
+		}
+	}
+	if getLen && getIdx {
+		return nil, errLCSLenAndIdx
+	}
+
+	if !getIdx {
+		res, err := cli.db.LCS(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		if getLen {
+			return len(res), nil
+		}
+		return res, nil
+	}
+	matches, n, err := cli.db.LCSIdx(args[0], args[1], minMatchLen)
+	if err != nil {
+		return nil, err
+	}
+	reply := [][]byte{[]byte("matches")}
+	for _, m := range matches {
+		match := fmt.Sprintf("%d-%d %d-%d", m.Start1, m.End1, m.Start2, m.End2)
+		if withMatchLen {
+			match += " " + strconv.Itoa(m.Len())
+		}
+		reply = append(reply, []byte(match))
+	}
+	return append(reply, []byte("len"), []byte(strconv.Itoa(n))), nil
+}
+
 func strLen(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, newWrongNumOfArgsError("strlen")
 	}
-	return cli.db.StrLen(args[0]), nil
+	return cli.db.StrLen(args[0])
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
@@ -281,7 +529,7 @@ func lPush(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if err := cli.db.LPush(args[0], args[1:]...); err != nil {
 		return nil, err
 	}
-	return cli.db.LLen(args[0]), nil
+	return cli.db.LLen(args[0])
 }
 
 func lPushX(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -291,7 +539,7 @@ func lPushX(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if err := cli.db.LPushX(args[0], args[1:]...); err != nil && err != bitcask.ErrKeyNotFound {
 		return nil, err
 	}
-	return cli.db.LLen(args[0]), nil
+	return cli.db.LLen(args[0])
 }
 
 func rPush(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -301,7 +549,7 @@ func rPush(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if err := cli.db.RPush(args[0], args[1:]...); err != nil {
 		return nil, err
 	}
-	return cli.db.LLen(args[0]), nil
+	return cli.db.LLen(args[0])
 }
 
 func rPushX(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -311,7 +559,7 @@ func rPushX(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if err := cli.db.LPushX(args[0], args[1:]...); err != nil && err != bitcask.ErrKeyNotFound {
 		return nil, err
 	}
-	return cli.db.LLen(args[0]), nil
+	return cli.db.LLen(args[0])
 }
 
 func lPop(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -340,29 +588,98 @@ func lMove(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 4 {
 		return nil, newWrongNumOfArgsError("lmove")
 	}
-	srcKey, dstKey := args[0], args[1]
-	from, to := bytes.ToLower(args[2]), bytes.ToLower(args[3])
-	var srcIsLeft, dstIsLeft bool
+	srcIsLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+	dstIsLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.LMove(args[0], args[1], srcIsLeft, dstIsLeft)
+}
 
-	if string(from) == "left" {
-		srcIsLeft = true
-	} else if string(from) != "right" {
-		return nil, errSyntax
+// blPop blocks the calling connection only, other clients are served by their own goroutines.
+func blPop(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("blpop")
 	}
-	if string(to) == "left" {
-		dstIsLeft = true
-	} else if string(to) != "right" {
-		return nil, errSyntax
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	key, val, err := cli.db.BLPop(cli.ctx, timeout, args[:len(args)-1]...)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	return [][]byte{key, val}, nil
+}
+
+func brPop(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("brpop")
+	}
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	key, val, err := cli.db.BRPop(cli.ctx, timeout, args[:len(args)-1]...)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	return [][]byte{key, val}, nil
+}
+
+func blMove(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 5 {
+		return nil, newWrongNumOfArgsError("blmove")
 	}
+	srcIsLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+	dstIsLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseBlockTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+	val, err := cli.db.BLMove(cli.ctx, timeout, args[0], args[1], srcIsLeft, dstIsLeft)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	return val, nil
+}
 
-	return cli.db.LMove(srcKey, dstKey, srcIsLeft, dstIsLeft)
+// parseListDirection parses LEFT or RIGHT, it returns true for LEFT.
+func parseListDirection(arg []byte) (bool, error) {
+	switch string(bytes.ToLower(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	default:
+		return false, errSyntax
+	}
+}
+
+// parseBlockTimeout parses the timeout of blocking commands in seconds, 0 means blocking indefinitely.
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	// NaN fails both comparisons.
+	if err != nil || !(seconds >= 0 && seconds <= math.MaxInt64/float64(time.Second)) {
+		return 0, errValueIsInvalid
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
 }
 
 func lLen(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, newWrongNumOfArgsError("llen")
 	}
-	return cli.db.LLen(args[0]), nil
+	return cli.db.LLen(args[0])
 }
 
 func lIndex(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -405,6 +722,91 @@ func lRange(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	return cli.db.LRange(args[0], start, stop)
 }
 
+func lRem(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("lrem")
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return cli.db.LRem(args[0], count, args[2])
+}
+
+// linsert key BEFORE|AFTER pivot element
+func lInsert(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, newWrongNumOfArgsError("linsert")
+	}
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return nil, errSyntax
+	}
+	return cli.db.LInsert(args[0], before, args[2], args[3])
+}
+
+func lTrim(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("ltrim")
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	if err := cli.db.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return resultOK, nil
+}
+
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func lPos(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, newWrongNumOfArgsError("lpos")
+	}
+	rank, count, maxLen := 1, 1, 0
+	var withCount bool
+	for i := 2; i < len(args); i += 2 {
+		n, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return nil, errValueIsInvalid
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			rank = n
+		case "count":
+			count, withCount = n, true
+		case "maxlen":
+			maxLen = n
+		default:
+			return nil, errSyntax
+		}
+	}
+	indexes, err := cli.db.LPos(args[0], args[1], rank, count, maxLen)
+	if err != nil {
+		return nil, err
+	}
+	if !withCount {
+		if len(indexes) == 0 {
+			return nil, nil
+		}
+		return indexes[0], nil
+	}
+	res := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		res[i] = []byte(strconv.Itoa(index))
+	}
+	return res, nil
+}
+
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |--------------------------- Hash commands ----------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
@@ -501,8 +903,18 @@ func hStrLen(cli *ClientHandle, args [][]byte) (interface{}, error) {
 }
 
 func hScan(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	// TODO
-	return resultOK, nil
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("hscan")
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := cli.db.HScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, values...), nil
 }
 
 func hIncrBy(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -516,100 +928,432 @@ func hIncrBy(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	return cli.db.HIncrBy(args[0], args[1], incr)
 }
 
-// +-------+--------+----------+------------+-----------+-------+---------+
-// |---------------------------- Set commands ----------------------------|
-// +-------+--------+----------+------------+-----------+-------+---------+
-func sAdd(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, newWrongNumOfArgsError("sadd")
+func hIncrByFloat(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("hincrbyfloat")
 	}
-	return cli.db.SAdd(args[0], args[1:]...)
-	// return resultOK, nil
-}
-
-func sRem(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, newWrongNumOfArgsError("srem")
+	incr, err := util.StrToFloat64(string(args[2]))
+	if err != nil || math.IsNaN(incr) {
+		return nil, errFloatIsInvalid
 	}
-	return cli.db.SRem(args[0], args[1:]...)
+	res, err := cli.db.HIncrByFloat(args[0], args[1], incr)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(util.Float64ToStr(res)), nil
 }
 
-func sPop(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumOfArgsError("spop")
+// hRandField is called as HRANDFIELD key [count [WITHVALUES]], it returns a single field without count.
+func hRandField(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, newWrongNumOfArgsError("hrandfield")
 	}
-	count, err := util.StrToUint(string(args[1]))
+	if len(args) == 1 {
+		fields, err := cli.db.HRandField(args[0], 1, false)
+		if err != nil || len(fields) == 0 {
+			return nil, err
+		}
+		return fields[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
 	if err != nil {
 		return nil, errValueIsInvalid
 	}
-	return cli.db.SPop(args[0], uint(count))
-}
-
-func sIsMember(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumOfArgsError("sismember")
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToLower(string(args[2])) != "withvalues" {
+			return nil, errSyntax
+		}
+		withValues = true
 	}
-	return cli.db.SIsMember(args[0], args[1]), nil
+	return cli.db.HRandField(args[0], count, withValues)
 }
 
-func sMembers(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, newWrongNumOfArgsError("smembers")
+// hGetDel is called as HGETDEL key FIELDS numfields field [field ...].
+func hGetDel(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, newWrongNumOfArgsError("hgetdel")
 	}
-	return cli.db.SMembers(args[0])
-}
-
-func sCard(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, newWrongNumOfArgsError("scard")
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
 	}
-	return cli.db.SCard(args[0]), nil
+	return cli.db.HGetDel(args[0], fields...)
 }
 
-func sDiff(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) == 0 {
-		return nil, newWrongNumOfArgsError("sdiff")
+// hSetEx is called as HSETEX key [FNX|FXX] FIELDS numfields field value [field value ...].
+func hSetEx(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, newWrongNumOfArgsError("hsetex")
 	}
-	return cli.db.SDiff(args...)
-}
-
-func sUnion(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) == 0 {
-		return nil, newWrongNumOfArgsError("sdiff")
+	cond, opts := bitcask.HSetAlways, args[1:]
+	switch strings.ToLower(string(opts[0])) {
+	case "fnx":
+		cond, opts = bitcask.HSetIfNoneExist, opts[1:]
+	case "fxx":
+		cond, opts = bitcask.HSetIfAllExist, opts[1:]
 	}
-	return cli.db.SUnion(args...)
+	pairs, err := parseHashFields(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := cli.db.HSetEx(args[0], cond, pairs...)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return 1, nil
 }
 
-// +-------+--------+----------+------------+-----------+-------+---------+
-// |------------------------- Sorted Set commands ------------------------|
-// +-------+--------+----------+------------+-----------+-------+---------+
-
-func zAdd(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 3 {
-		return nil, newWrongNumOfArgsError("zadd")
+// hExpire is called as HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...].
+func hExpire(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, newWrongNumOfArgsError("hexpire")
 	}
-	score, err := strconv.ParseFloat(string(args[1]), 64)
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
-		return 0, errFloatIsInvalid
+		return nil, errValueIsInvalid
 	}
-	if err := cli.db.ZAdd(args[0], score, args[2]); err != nil {
+	cond, fields, err := parseHExpireArgs(args[2:])
+	if err != nil {
 		return nil, err
 	}
-	return 1, nil
+	res, err := cli.db.HExpire(args[0], time.Duration(seconds)*time.Second, cond, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
 }
 
-func zScore(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumOfArgsError("zscore")
+// hExpireAt is called as HEXPIREAT key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...].
+func hExpireAt(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 5 {
+		return nil, newWrongNumOfArgsError("hexpireat")
 	}
-	if ok, score := cli.db.ZScore(args[0], args[1]); !ok {
-		return nil, nil
-	} else {
-		return score, nil
+	expiredAt, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	cond, fields, err := parseHExpireArgs(args[2:])
+	if err != nil {
+		return nil, err
 	}
+	res, err := cli.db.HExpireAt(args[0], time.Unix(expiredAt, 0), cond, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
 }
 
-func zRem(cli *ClientHandle, args [][]byte) (interface{}, error) {
+// hExpireTime is called as HEXPIRETIME key FIELDS numfields field [field ...].
+func hExpireTime(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, newWrongNumOfArgsError("hexpiretime")
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cli.db.HExpireTime(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hTimesReply(res), nil
+}
+
+// hTTL is called as HTTL key FIELDS numfields field [field ...].
+func hTTL(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, newWrongNumOfArgsError("httl")
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cli.db.HTTL(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hTimesReply(res), nil
+}
+
+// hPersist is called as HPERSIST key FIELDS numfields field [field ...].
+func hPersist(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 4 {
+		return nil, newWrongNumOfArgsError("hpersist")
+	}
+	fields, err := parseHashFields(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := cli.db.HPersist(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return hFieldsReply(res), nil
+}
+
+// parseHExpireArgs parses [NX|XX|GT|LT] FIELDS numfields field [field ...].
+func parseHExpireArgs(opts [][]byte) (bitcask.ExpireCondition, [][]byte, error) {
+	cond := bitcask.ExpireAlways
+	switch strings.ToLower(string(opts[0])) {
+	case "nx":
+		cond, opts = bitcask.ExpireIfNoTTL, opts[1:]
+	case "xx":
+		cond, opts = bitcask.ExpireIfHasTTL, opts[1:]
+	case "gt":
+		cond, opts = bitcask.ExpireIfGreater, opts[1:]
+	case "lt":
+		cond, opts = bitcask.ExpireIfLess, opts[1:]
+	}
+	fields, err := parseHashFields(opts, false)
+	return cond, fields, err
+}
+
+// hFieldsReply converts the results of the fields to the reply.
+func hFieldsReply(res []int) [][]byte {
+	reply := make([][]byte, len(res))
+	for i, r := range res {
+		reply[i] = []byte(strconv.Itoa(r))
+	}
+	return reply
+}
+
+// hTimesReply converts the times of the fields to the reply.
+func hTimesReply(res []int64) [][]byte {
+	reply := make([][]byte, len(res))
+	for i, r := range res {
+		reply[i] = []byte(strconv.FormatInt(r, 10))
+	}
+	return reply
+}
+
+// parseHashFields parses FIELDS numfields field [field ...], each field is followed by its value if withValues is true.
+func parseHashFields(opts [][]byte, withValues bool) ([][]byte, error) {
+	if len(opts) < 3 || strings.ToLower(string(opts[0])) != "fields" {
+		return nil, errSyntax
+	}
+	numFields, err := strconv.Atoi(string(opts[1]))
+	if err != nil || numFields <= 0 {
+		return nil, errValueIsInvalid
+	}
+	n := numFields
+	if withValues {
+		n *= 2
+	}
+	if len(opts)-2 != n {
+		return nil, errSyntax
+	}
+	return opts[2:], nil
+}
+
+// +-------+--------+----------+------------+-----------+-------+---------+
+// |---------------------------- Set commands ----------------------------|
+// +-------+--------+----------+------------+-----------+-------+---------+
+func sAdd(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sadd")
+	}
+	return cli.db.SAdd(args[0], args[1:]...)
+	// return resultOK, nil
+}
+
+func sRem(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("srem")
+	}
+	return cli.db.SRem(args[0], args[1:]...)
+}
+
+func sPop(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("spop")
+	}
+	count, err := util.StrToUint(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return cli.db.SPop(args[0], uint(count))
+}
+
+func sIsMember(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("sismember")
+	}
+	return cli.db.SIsMember(args[0], args[1]), nil
+}
+
+func sMembers(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("smembers")
+	}
+	return cli.db.SMembers(args[0])
+}
+
+func sCard(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("scard")
+	}
+	return cli.db.SCard(args[0]), nil
+}
+
+func sDiff(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumOfArgsError("sdiff")
+	}
+	return cli.db.SDiff(args...)
+}
+
+func sUnion(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumOfArgsError("sdiff")
+	}
+	return cli.db.SUnion(args...)
+}
+
+func sInter(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumOfArgsError("sinter")
+	}
+	return cli.db.SInter(args...)
+}
+
+// sInterCard is called as SINTERCARD numkeys key [key ...] [LIMIT limit].
+func sInterCard(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sintercard")
+	}
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, errValueIsInvalid
+	}
+	if len(args) < numKeys+1 {
+		return nil, errSyntax
+	}
+	keys, rest := args[1:numKeys+1], args[numKeys+1:]
+
+	var limit int
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToLower(string(rest[0])) == "limit":
+		if limit, err = strconv.Atoi(string(rest[1])); err != nil || limit < 0 {
+			return nil, errValueIsInvalid
+		}
+	default:
+		return nil, errSyntax
+	}
+	return cli.db.SInterCard(limit, keys...)
+}
+
+func sDiffStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sdiffstore")
+	}
+	return cli.db.SDiffStore(args[0], args[1:]...)
+}
+
+func sUnionStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sunionstore")
+	}
+	return cli.db.SUnionStore(args[0], args[1:]...)
+}
+
+func sInterStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sinterstore")
+	}
+	return cli.db.SInterStore(args[0], args[1:]...)
+}
+
+func sMove(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("smove")
+	}
+	return cli.db.SMove(args[0], args[1], args[2])
+}
+
+// sRandMember returns a single member without count, and an array of members with count.
+func sRandMember(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumOfArgsError("srandmember")
+	}
+	if len(args) == 1 {
+		members, err := cli.db.SRandMember(args[0], 1)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		return members[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return cli.db.SRandMember(args[0], count)
+}
+
+func sMIsMember(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("smismember")
+	}
+	found, err := cli.db.SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, len(found))
+	for i, ok := range found {
+		res[i] = []byte("0")
+		if ok {
+			res[i] = []byte("1")
+		}
+	}
+	return res, nil
+}
+
+func sScan(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("sscan")
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, members, err := cli.db.SScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, members...), nil
+}
+
+// +-------+--------+----------+------------+-----------+-------+---------+
+// |------------------------- Sorted Set commands ------------------------|
+// +-------+--------+----------+------------+-----------+-------+---------+
+
+func zAdd(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zadd")
+	}
+	score, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return 0, errFloatIsInvalid
+	}
+	if err := cli.db.ZAdd(args[0], score, args[2]); err != nil {
+		return nil, err
+	}
+	return 1, nil
+}
+
+func zScore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("zscore")
+	}
+	ok, score, err := cli.db.ZScore(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return util.Float64ToStr(score), nil
+}
+
+func zRem(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, newWrongNumOfArgsError("zrem")
 	}
@@ -623,7 +1367,7 @@ func zCard(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, newWrongNumOfArgsError("zcard")
 	}
-	return cli.db.ZCard(args[0]), nil
+	return cli.db.ZCard(args[0])
 }
 
 func zRange(cli *ClientHandle, args [][]byte) (interface{}, error) {
@@ -664,41 +1408,674 @@ func zRank(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, newWrongNumOfArgsError("zrank")
 	}
-	if ok, rank := cli.db.ZRank(args[0], args[1]); ok {
-		return rank, nil
+	ok, rank, err := cli.db.ZRank(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
 	}
-	return nil, nil
+	return rank, nil
 }
 
 func zRevRank(cli *ClientHandle, args [][]byte) (interface{}, error) {
 	if len(args) != 2 {
 		return nil, newWrongNumOfArgsError("zrevrank")
 	}
-	if ok, rank := cli.db.ZRevRank(args[0], args[1]); ok {
-		return rank, nil
+	ok, rank, err := cli.db.ZRevRank(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
+	}
+	return rank, nil
+}
+
+func zPopMin(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return zPopGeneric(cli, args, "zpopmin", false)
+}
+
+func zPopMax(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return zPopGeneric(cli, args, "zpopmax", true)
+}
+
+// zPopGeneric is called as ZPOPMIN|ZPOPMAX key [count], it returns the members followed by their scores.
+func zPopGeneric(cli *ClientHandle, args [][]byte, cmd string, max bool) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumOfArgsError(cmd)
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil || count < 0 {
+			return nil, errValueIsInvalid
+		}
+	}
+
+	var members []bitcask.ZMember
+	var err error
+	if max {
+		members, err = cli.db.ZPopMax(args[0], count)
+	} else {
+		members, err = cli.db.ZPopMin(args[0], count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([][]byte, 0, len(members)*2)
+	for _, m := range members {
+		res = append(res, m.Member, []byte(util.Float64ToStr(m.Score)))
+	}
+	return res, nil
+}
+
+func bzPopMin(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return bzPopGeneric(cli, args, "bzpopmin", false)
+}
+
+func bzPopMax(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return bzPopGeneric(cli, args, "bzpopmax", true)
+}
+
+// bzPopGeneric is called as BZPOPMIN|BZPOPMAX key [key ...] timeout, it returns the key, the member and its score.
+// It blocks the calling connection only, like blPop.
+func bzPopGeneric(cli *ClientHandle, args [][]byte, cmd string, max bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError(cmd)
+	}
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := args[:len(args)-1]
+	var key []byte
+	var member *bitcask.ZMember
+	if max {
+		key, member, err = cli.db.BZPopMax(cli.ctx, timeout, keys...)
+	} else {
+		key, member, err = cli.db.BZPopMin(cli.ctx, timeout, keys...)
+	}
+	if err != nil || member == nil {
+		return nil, err
+	}
+	return [][]byte{key, member.Member, []byte(util.Float64ToStr(member.Score))}, nil
+}
+
+// zRangeByScore is called as ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count].
+func zRangeByScore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zrangebyscore")
+	}
+	return zRangeByScoreGeneric(cli, args[0], args[1], args[2], args[3:], false)
+}
+
+// zRevRangeByScore is called as ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count].
+func zRevRangeByScore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zrevrangebyscore")
+	}
+	return zRangeByScoreGeneric(cli, args[0], args[2], args[1], args[3:], true)
+}
+
+func zRangeByScoreGeneric(cli *ClientHandle, key, minArg, maxArg []byte, opts [][]byte, rev bool) (interface{}, error) {
+	min, err := parseScoreBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count, err := parseRangeOptions(opts, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []bitcask.ZMember
+	if rev {
+		members, err = cli.db.ZRevRangeByScore(key, max, min, offset, count)
+	} else {
+		members, err = cli.db.ZRangeByScore(key, min, max, offset, count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+func zCount(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zcount")
+	}
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZCount(args[0], min, max)
+}
+
+func zIncrBy(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zincrby")
+	}
+	increment, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil {
+		return nil, errFloatIsInvalid
+	}
+	score, err := cli.db.ZIncrBy(args[0], increment, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return util.Float64ToStr(score), nil
+}
+
+// zRangeByLex is called as ZRANGEBYLEX key min max [LIMIT offset count].
+func zRangeByLex(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zrangebylex")
+	}
+	min, max, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	_, offset, count, err := parseRangeOptions(args[3:], false)
+	if err != nil || empty {
+		return nil, err
+	}
+	return cli.db.ZRangeByLex(args[0], min, max, offset, count)
+}
+
+func zLexCount(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zlexcount")
+	}
+	min, max, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return 0, nil
+	}
+	return cli.db.ZLexCount(args[0], min, max)
+}
+
+func zRemRangeByRank(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zremrangebyrank")
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	return cli.db.ZRemRangeByRank(args[0], start, stop)
+}
+
+func zRemRangeByScore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumOfArgsError("zremrangebyscore")
+	}
+	min, err := parseScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZRemRangeByScore(args[0], min, max)
+}
+
+// parseScoreBound parses a score bound like 1.5, (1.5, -inf or +inf, the prefix ( means exclusive.
+func parseScoreBound(arg []byte) (bitcask.ScoreBound, error) {
+	var bound bitcask.ScoreBound
+	if len(arg) > 0 && arg[0] == '(' {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return bound, errFloatIsInvalid
+	}
+	bound.Score = score
+	return bound, nil
+}
+
+// parseLexRange parses the bounds of a lexicographical range, a bound is - or +, or a member prefixed by
+// [ for inclusive or ( for exclusive. It returns true if the range is always empty, as + for min or - for max.
+func parseLexRange(minArg, maxArg []byte) (min, max bitcask.LexBound, empty bool, err error) {
+	min, minInf, err := parseLexBound(minArg)
+	if err != nil {
+		return
+	}
+	max, maxInf, err := parseLexBound(maxArg)
+	if err != nil {
+		return
+	}
+	min.Unbounded, max.Unbounded = minInf == '-', maxInf == '+'
+	empty = minInf == '+' || maxInf == '-'
+	return
+}
+
+// parseLexBound parses a bound of a lexicographical range, it returns - or + if the bound is infinite.
+func parseLexBound(arg []byte) (bitcask.LexBound, byte, error) {
+	if len(arg) == 0 {
+		return bitcask.LexBound{}, 0, errSyntax
+	}
+	switch arg[0] {
+	case '-', '+':
+		if len(arg) != 1 {
+			return bitcask.LexBound{}, 0, errSyntax
+		}
+		return bitcask.LexBound{}, arg[0], nil
+	case '[':
+		return bitcask.LexBound{Member: arg[1:]}, 0, nil
+	case '(':
+		return bitcask.LexBound{Member: arg[1:], Exclusive: true}, 0, nil
+	default:
+		return bitcask.LexBound{}, 0, errSyntax
+	}
+}
+
+// parseRangeOptions parses [WITHSCORES] [LIMIT offset count] of range commands, count is -1 without LIMIT.
+func parseRangeOptions(opts [][]byte, allowScores bool) (withScores bool, offset, count int, err error) {
+	count = -1
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToLower(string(opts[i])) {
+		case "withscores":
+			if !allowScores {
+				return false, 0, 0, errSyntax
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(opts) {
+				return false, 0, 0, errSyntax
+			}
+			if offset, err = strconv.Atoi(string(opts[i+1])); err != nil {
+				return false, 0, 0, errValueIsInvalid
+			}
+			if count, err = strconv.Atoi(string(opts[i+2])); err != nil {
+				return false, 0, 0, errValueIsInvalid
+			}
+			i += 2
+		default:
+			return false, 0, 0, errSyntax
+		}
+	}
+	return
+}
+
+// zUnion is called as ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES].
+func zUnion(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return zCombineGeneric(cli, args, "zunion", false)
+}
+
+// zInter is called the same as ZUNION.
+func zInter(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	return zCombineGeneric(cli, args, "zinter", true)
+}
+
+func zCombineGeneric(cli *ClientHandle, args [][]byte, cmd string, inter bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError(cmd)
+	}
+	keys, weights, aggregate, withScores, err := parseZSetOpArgs(args, true, true)
+	if err != nil {
+		return nil, err
+	}
+	var members []bitcask.ZMember
+	if inter {
+		members, err = cli.db.ZInter(keys, weights, aggregate)
+	} else {
+		members, err = cli.db.ZUnion(keys, weights, aggregate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// zDiff is called as ZDIFF numkeys key [key ...] [WITHSCORES].
+func zDiff(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("zdiff")
+	}
+	keys, _, _, withScores, err := parseZSetOpArgs(args, false, true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZDiff(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// zUnionStore is called as ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX].
+func zUnionStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zunionstore")
+	}
+	keys, weights, aggregate, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZUnionStore(args[0], keys, weights, aggregate)
+}
+
+// zInterStore is called the same as ZUNIONSTORE.
+func zInterStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zinterstore")
+	}
+	keys, weights, aggregate, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZInterStore(args[0], keys, weights, aggregate)
+}
+
+// zDiffStore is called as ZDIFFSTORE destination numkeys key [key ...].
+func zDiffStore(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumOfArgsError("zdiffstore")
+	}
+	keys, _, _, _, err := parseZSetOpArgs(args[1:], false, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZDiffStore(args[0], keys...)
+}
+
+// parseZSetOpArgs parses numkeys key [key ...] followed by the options of ZUNION, ZINTER and ZDIFF.
+func parseZSetOpArgs(args [][]byte, allowWeights, allowScores bool) (keys [][]byte, weights []float64,
+	aggregate bitcask.Aggregate, withScores bool, err error) {
+
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, nil, 0, false, errValueIsInvalid
+	}
+	if len(args) < numKeys+1 {
+		return nil, nil, 0, false, errSyntax
+	}
+	keys, opts := args[1:numKeys+1], args[numKeys+1:]
+
+	for i := 0; i < len(opts); i++ {
+		switch option := strings.ToLower(string(opts[i])); {
+		case option == "weights" && allowWeights:
+			if i+numKeys >= len(opts) {
+				return nil, nil, 0, false, errSyntax
+			}
+			weights = make([]float64, numKeys)
+			for j := range weights {
+				weights[j], err = strconv.ParseFloat(string(opts[i+1+j]), 64)
+				if err != nil || math.IsNaN(weights[j]) {
+					return nil, nil, 0, false, errFloatIsInvalid
+				}
+			}
+			i += numKeys
+		case option == "aggregate" && allowWeights:
+			if i+1 >= len(opts) {
+				return nil, nil, 0, false, errSyntax
+			}
+			switch strings.ToLower(string(opts[i+1])) {
+			case "sum":
+				aggregate = bitcask.AggregateSum
+			case "min":
+				aggregate = bitcask.AggregateMin
+			case "max":
+				aggregate = bitcask.AggregateMax
+			default:
+				return nil, nil, 0, false, errSyntax
+			}
+			i++
+		case option == "withscores" && allowScores:
+			withScores = true
+		default:
+			return nil, nil, 0, false, errSyntax
+		}
+	}
+	return keys, weights, aggregate, withScores, nil
+}
+
+// zMembersReply returns the members, each followed by its score if withScores is true.
+func zMembersReply(members []bitcask.ZMember, withScores bool) [][]byte {
+	res := make([][]byte, 0, len(members))
+	for _, m := range members {
+		res = append(res, m.Member)
+		if withScores {
+			res = append(res, []byte(util.Float64ToStr(m.Score)))
+		}
+	}
+	return res
+}
+
+func zScan(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("zscan")
+	}
+	cursor, pattern, count, _, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := cli.db.ZScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return append([][]byte{util.EncodeScanCursor(next)}, values...), nil
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |-------------------------- generic commands --------------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
 func del(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	// TODO
-	return resultOK, nil
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("del")
+	}
+	return cli.db.Del(args...)
+}
+
+func unlink(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("unlink")
+	}
+	return cli.db.Unlink(args...)
+}
+
+func exists(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("exists")
+	}
+	return cli.db.Exists(args...), nil
 }
 
 func keyType(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	// todo
-	return "string", nil
+	if len(args) != 1 {
+		return nil, newWrongNumOfArgsError("type")
+	}
+	return cli.db.Type(args[0]), nil
+}
+
+func rename(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("rename")
+	}
+	if err := cli.db.Rename(args[0], args[1]); err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, errNoSuchKey
+		}
+		return nil, err
+	}
+	return resultOK, nil
+}
+
+func renameNX(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("renamenx")
+	}
+	renamed, err := cli.db.RenameNX(args[0], args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, errNoSuchKey
+	}
+	return renamed, err
+}
+
+// copy source destination [DB destination-db] [REPLACE]
+func copyKey(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumOfArgsError("copy")
+	}
+	dstDB, replace := cli.db, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "db":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			index, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, errValueIsInvalid
+			}
+			if index < 0 || index >= len(cli.dbs) {
+				return nil, errDBIndexOutOfRange
+			}
+			dstDB = cli.dbs[index]
+			i++
+		case "replace":
+			replace = true
+		default:
+			return nil, errSyntax
+		}
+	}
+	return cli.db.Copy(args[0], dstDB, args[1], replace)
+}
+
+func move(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumOfArgsError("move")
+	}
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errValueIsInvalid
+	}
+	if index < 0 || index >= len(cli.dbs) {
+		return nil, errDBIndexOutOfRange
+	}
+	return cli.db.Move(args[0], cli.dbs[index])
+}
+
+func scan(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumOfArgsError("scan")
+	}
+	cursor, pattern, count, typeName, err := parseScanArgs(args, true)
+	if err != nil {
+		return nil, err
+	}
+	next, keys, err := cli.db.Scan(cursor, pattern, count, typeName)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]byte{util.EncodeScanCursor(next)}, keys...), nil
+}
+
+// parseScanArgs parses the arguments of scan commands: cursor [MATCH pattern] [COUNT count] [TYPE type],
+// TYPE is only allowed if withType is true.
+func parseScanArgs(args [][]byte, withType bool) (cursor, pattern []byte, count int, typeName string, err error) {
+	if cursor, err = util.DecodeScanCursor(args[0]); err != nil {
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			err = errSyntax
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				err = errValueIsInvalid
+				return
+			}
+		case "type":
+			if !withType {
+				err = errSyntax
+				return
+			}
+			typeName = strings.ToLower(string(args[i+1]))
+		default:
+			err = errSyntax
+			return
+		}
+	}
+	return
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
 // |---------------------- server management commands --------------------|
 // +-------+--------+----------+------------+-----------+-------+---------+
 func info(cli *ClientHandle, args [][]byte) (interface{}, error) {
-	// todo
-	return "info", nil
+	stats, err := cli.db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Memory\r\nused_memory:%d\r\n", stats.UsedMemory)
+	fmt.Fprintf(&b, "# Stats\r\nevicted_keys:%d\r\n", stats.EvictedKeys)
+	fmt.Fprintf(&b, "# Keyspace\r\nkeys:%d\r\n", stats.Keys)
+	return b.String(), nil
+}
+
+// flushdb [ASYNC|SYNC], the flush is always synchronous.
+func flushDB(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if err := checkFlushArgs(args); err != nil {
+		return nil, err
+	}
+	if err := cli.db.Flush(); err != nil {
+		return nil, err
+	}
+	return resultOK, nil
+}
+
+// flushall [ASYNC|SYNC], the flush is always synchronous.
+func flushAll(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if err := checkFlushArgs(args); err != nil {
+		return nil, err
+	}
+	for _, db := range cli.dbs {
+		if err := db.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return resultOK, nil
+}
+
+func dbSize(cli *ClientHandle, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumOfArgsError("dbsize")
+	}
+	stats, err := cli.db.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return stats.Keys, nil
+}
+
+func checkFlushArgs(args [][]byte) error {
+	if len(args) > 1 {
+		return errSyntax
+	}
+	if len(args) == 1 {
+		if mode := strings.ToLower(string(args[0])); mode != "async" && mode != "sync" {
+			return errSyntax
+		}
+	}
+	return nil
 }
 
 // +-------+--------+----------+------------+-----------+-------+---------+
@@ -3,20 +3,25 @@ package server
 import (
 	"bitcaskDB/internal/bitcask"
 	"bitcaskDB/internal/log"
+	"bitcaskDB/internal/logfile"
 	"bitcaskDB/internal/options"
+	"bitcaskDB/internal/util"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 )
 
 const (
-	dbName = "bitcaskDB-%04d"
+	// legacyDBName is the directory name of db n before namespaces are supported,
+	// it is moved to namespace n when the server starts.
+	legacyDBName = "bitcaskDB-%04d"
 )
 
 type ServerOptions struct {
@@ -27,6 +32,7 @@ type ServerOptions struct {
 }
 
 type Server struct {
+	root       *bitcask.BitcaskDB   // dbs are the namespaces of root.
 	dbs        []*bitcask.BitcaskDB //
 	serverOpts *ServerOptions
 }
@@ -38,8 +44,10 @@ func init() {
 }
 
 func NewServer(opt *ServerOptions) *Server {
+	root, dbs := openAllDB(opt)
 	return &Server{
-		dbs:        openAllDB(opt),
+		root:       root,
+		dbs:        dbs,
 		serverOpts: opt,
 	}
 }
@@ -60,13 +68,21 @@ func DefaultServer() *Server {
 	return defaultServer
 }
 
-func openAllDB(opt *ServerOptions) (dbs []*bitcask.BitcaskDB) {
+func openAllDB(opt *ServerOptions) (root *bitcask.BitcaskDB, dbs []*bitcask.BitcaskDB) {
 	// open databases and choose the first db as default db
 	now := time.Now()
+	root, err := bitcask.Open(options.DefaultOptions(opt.dbPath))
+	if err != nil {
+		log.Errorf("open db err, fail to start server. %v", err)
+		return
+	}
 	for i := uint(0); i < opt.databases; i++ {
-		path := filepath.Join(opt.dbPath, fmt.Sprintf(dbName, i))
-		opts := options.DefaultOptions(path)
-		db, err := bitcask.Open(opts)
+		name := strconv.Itoa(int(i))
+		if err = migrateLegacyDB(opt.dbPath, name, i); err != nil {
+			log.Errorf("migrate db %d err, fail to start server. %v", i, err)
+			return
+		}
+		db, err := root.Namespace(name)
 		if err != nil {
 			log.Errorf("open db err, fail to start server. %v", err)
 			return
@@ -74,7 +90,28 @@ func openAllDB(opt *ServerOptions) (dbs []*bitcask.BitcaskDB) {
 		dbs = append(dbs, db)
 	}
 	log.Infof("open db from [%s] successfully, time cost: %v", opt.dbPath, time.Since(now))
-	return dbs
+	return root, dbs
+}
+
+// migrateLegacyDB moves the directory of db idx in the legacy layout to namespace name.
+// The log files of the legacy db have no segment header, they are upgraded before the directory is moved,
+// so a db interrupted during the migration is still found in the legacy layout on the next start.
+func migrateLegacyDB(dbPath, name string, idx uint) error {
+	legacy := filepath.Join(dbPath, fmt.Sprintf(legacyDBName, idx))
+	path := bitcask.NamespacePath(dbPath, name)
+	if !util.PathExist(legacy) || util.PathExist(path) {
+		return nil
+	}
+	migrated, err := logfile.MigrateDir(legacy)
+	if err != nil {
+		return err
+	}
+	log.Infof("migrate %d log files of db %d in [%s]", migrated, idx, legacy)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	log.Infof("move db %d from [%s] to [%s]", idx, legacy, path)
+	return os.Rename(legacy, path)
 }
 
 func (srv *Server) Start() {
@@ -97,8 +134,9 @@ func (srv *Server) Start() {
 			log.Errorf("listener close err : [%v]", err)
 		}
 
-		for _, db := range srv.dbs {
-			if err := db.Close(); err != nil {
+		// the namespaces are closed with root.
+		if srv.root != nil {
+			if err := srv.root.Close(); err != nil {
 				log.Errorf("close db err : %v", err)
 			}
 		}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bitcaskDB/internal/bitcask"
+	"bitcaskDB/internal/logfile"
+	"bitcaskDB/internal/util"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAllDB_LegacyDB(t *testing.T) {
+	dbPath := t.TempDir()
+	legacy := filepath.Join(dbPath, fmt.Sprintf(legacyDBName, 0))
+	assert.Nil(t, os.MkdirAll(legacy, os.ModePerm))
+
+	// a log file written by an old version has no segment header, its entries are checked by IEEE,
+	// and it is preallocated with zeros.
+	data := make([]byte, 0, 4096)
+	for i := 0; i < 3; i++ {
+		entry := &logfile.LogEntry{Key: []byte(fmt.Sprintf("k%d", i)), Value: []byte(fmt.Sprintf("v%d", i))}
+		buf, _ := logfile.EncodeEntryWith(entry, logfile.SegmentHeader{Version: 1, Checksum: logfile.ChecksumIEEE})
+		data = append(data, buf...)
+	}
+	data = data[:cap(data)]
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(legacy, logfile.FileNamesMap[logfile.Strs]+"000000000"), data, 0644))
+
+	root, dbs := openAllDB(&ServerOptions{dbPath: dbPath, databases: 2})
+	if root == nil {
+		t.Fatal("open all db failed")
+	}
+	defer root.Close()
+	assert.Len(t, dbs, 2)
+	assert.False(t, util.PathExist(legacy))
+	assert.True(t, util.PathExist(bitcask.NamespacePath(dbPath, "0")))
+	for i := 0; i < 3; i++ {
+		val, err := dbs[0].Get([]byte(fmt.Sprintf("k%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("v%d", i), string(val))
+	}
+	_, err := dbs[1].Get([]byte("k0"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
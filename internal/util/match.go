@@ -0,0 +1,99 @@
+package util
+
+// GlobMatch reports whether str matches the glob-style pattern, the rules are the same as redis:
+//
+//	h?llo matches hello, hallo and hxllo
+//	h*llo matches hllo and heeeello
+//	h[ae]llo matches hello and hallo, but not hillo
+//	h[^e]llo matches hallo, hbllo, ... but not hello
+//	h[a-b]llo matches hallo and hbllo
+//
+// Use \ to escape special characters.
+func GlobMatch(pattern, str []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// skip the consecutive stars.
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if GlobMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			var matched bool
+			matched, pattern = matchClass(pattern[1:], str[0])
+			if !matched {
+				return false
+			}
+			str = str[1:]
+			// pattern points to the closing bracket now.
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+		}
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
+		}
+	}
+	return len(str) == 0
+}
+
+// matchClass matches c against the character class at the beginning of pattern, which is after the '['.
+// It returns the result and the pattern starting at the closing bracket, or an empty pattern if it is not closed.
+func matchClass(pattern []byte, c byte) (bool, []byte) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			pattern = pattern[1:]
+			if pattern[0] == c {
+				matched = true
+			}
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				matched = true
+			}
+			pattern = pattern[2:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+		}
+		pattern = pattern[1:]
+	}
+	if not {
+		matched = !matched
+	}
+	return matched, pattern
+}
@@ -2,6 +2,8 @@ package util
 
 import (
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -67,3 +69,27 @@ func NewErrUnknownCMD(cmd []byte, args [][]byte) error {
 	}
 	return fmt.Errorf("(error) ERR unknown command '%s', with args beginning with: %s", cmd, bytes.Join(args, []byte(", ")))
 }
+
+// ErrInvalidCursor the cursor of scan commands is not returned by the previous call.
+var ErrInvalidCursor = errors.New("ERR invalid cursor")
+
+// EncodeScanCursor converts the cursor returned by the scan methods of db to the cursor replied to clients.
+// The key of the last element visited is hex encoded, and "0" means the iteration is completed.
+func EncodeScanCursor(cursor []byte) []byte {
+	if len(cursor) == 0 {
+		return []byte("0")
+	}
+	return []byte(hex.EncodeToString(cursor))
+}
+
+// DecodeScanCursor converts the cursor sent by clients to the cursor of the scan methods of db, "0" means starting a new iteration.
+func DecodeScanCursor(cursor []byte) ([]byte, error) {
+	if string(cursor) == "0" {
+		return nil, nil
+	}
+	buf := make([]byte, hex.DecodedLen(len(cursor)))
+	if _, err := hex.Decode(buf, cursor); err != nil || len(buf) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return buf, nil
+}